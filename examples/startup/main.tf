@@ -28,7 +28,7 @@ module "hub_mesh" {
         sku_name              = "AZFW_VNet"
         sku_tier              = "Standard"
         subnet_address_prefix = "10.0.1.0/24"
-        firewall_policy_id    = azurerm_firewall_policy.fwpolicy.id
+        firewall_policy       = {}
       }
     }
     eastus2-hub = {
@@ -45,12 +45,70 @@ module "hub_mesh" {
         sku_name              = "AZFW_VNet"
         sku_tier              = "Standard"
         subnet_address_prefix = "10.1.1.0/24"
-        firewall_policy_id    = azurerm_firewall_policy.fwpolicy.id
+        firewall_policy       = {}
       }
     }
   }
-
-  depends_on = [azurerm_firewall_policy_rule_collection_group.allow_internal]
+  spoke_virtual_networks = {
+    spoke1 = {
+      hub_key             = "eastus-hub"
+      name                = "spoke1-vnet-${random_pet.rand.id}"
+      address_space       = ["192.168.0.0/24"]
+      resource_group_name = azurerm_resource_group.spoke1.name
+      route_table_name    = "spoke1-rt"
+      subnets = {
+        spoke1-subnet = {
+          address_prefixes = ["192.168.0.0/24"]
+        }
+      }
+    }
+    spoke2 = {
+      hub_key             = "eastus2-hub"
+      name                = "spoke2-vnet-${random_pet.rand.id}"
+      address_space       = ["192.168.1.0/24"]
+      resource_group_name = azurerm_resource_group.spoke2.name
+      route_table_name    = "spoke2-rt"
+      subnets = {
+        spoke2-subnet = {
+          address_prefixes = ["192.168.1.0/24"]
+        }
+      }
+    }
+  }
+  firewall_policies = {
+    allow-internal = {
+      name                = "allow-internal"
+      location            = azurerm_resource_group.fwpolicy.location
+      resource_group_name = azurerm_resource_group.fwpolicy.name
+      rule_collection_groups = {
+        allow-rfc1918 = {
+          priority = 200
+          network_rule_collections = [
+            {
+              action   = "Allow"
+              name     = "rfc1918"
+              priority = 100
+              rules = [
+                {
+                  destination_ports     = ["*"]
+                  name                  = "rfc1918"
+                  protocols             = ["Any"]
+                  destination_addresses = ["10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"]
+                  source_addresses      = ["10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"]
+                }
+              ]
+            }
+          ]
+        }
+      }
+    }
+    eastus-hub = {
+      base_policy_key = "allow-internal"
+    }
+    eastus2-hub = {
+      base_policy_key = "allow-internal"
+    }
+  }
 }
 
 resource "tls_private_key" "key" {
@@ -67,30 +125,3 @@ resource "azurerm_resource_group" "fwpolicy" {
   location = "eastus"
   name     = "fwpolicy-${random_pet.rand.id}"
 }
-
-resource "azurerm_firewall_policy" "fwpolicy" {
-  location            = azurerm_resource_group.fwpolicy.location
-  name                = "allow-internal"
-  resource_group_name = azurerm_resource_group.fwpolicy.name
-  sku                 = "Standard"
-}
-
-resource "azurerm_firewall_policy_rule_collection_group" "allow_internal" {
-  firewall_policy_id = azurerm_firewall_policy.fwpolicy.id
-  name               = "allow-rfc1918"
-  priority           = 100
-
-  network_rule_collection {
-    action   = "Allow"
-    name     = "rfc1918"
-    priority = 100
-
-    rule {
-      destination_ports     = ["*"]
-      name                  = "rfc1918"
-      protocols             = ["Any"]
-      destination_addresses = ["10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"]
-      source_addresses      = ["10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"]
-    }
-  }
-}
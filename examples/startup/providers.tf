@@ -4,7 +4,7 @@ terraform {
   required_providers {
     azurerm = {
       source  = "hashicorp/azurerm"
-      version = ">=3.7.0, < 4.0"
+      version = ">= 3.112.0, < 4.0"
     }
     local = {
       source  = "hashicorp/local"
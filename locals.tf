@@ -1,19 +1,238 @@
 locals {
+  bastion_pip = {
+    for k, v in local.hub_virtual_networks : k => {
+      location            = local.virtual_networks_modules[k].vnet_location
+      name                = coalesce(v.bastion.public_ip_name, "pip-bas-${k}")
+      resource_group_name = v.resource_group_name
+      tags                = v.bastion.tags
+      zones               = v.bastion.zones
+    } if v.bastion != null
+  }
+  bastions = {
+    for k, v in local.hub_virtual_networks : k => {
+      location               = local.virtual_networks_modules[k].vnet_location
+      name                   = coalesce(v.bastion.name, "bas-${k}")
+      resource_group_name    = v.resource_group_name
+      sku                    = v.bastion.sku
+      scale_units            = v.bastion.scale_units
+      copy_paste_enabled     = v.bastion.copy_paste_enabled
+      file_copy_enabled      = v.bastion.file_copy_enabled
+      ip_connect_enabled     = v.bastion.ip_connect_enabled
+      shareable_link_enabled = v.bastion.shareable_link_enabled
+      tunneling_enabled      = v.bastion.tunneling_enabled
+      subnet_address_prefix  = v.bastion.subnet_address_prefix
+      tags                   = v.bastion.tags
+    } if v.bastion != null
+  }
+  # A route table entry overriding BGP routes regardless of their prefix length only does so when the route table learns
+  # no BGP routes at all.
+  bgp_route_propagation_enabled = {
+    for k, v in var.hub_virtual_networks : k => coalesce(v.bgp_route_propagation_enabled, !anytrue([for e in v.route_table_entries : e.has_bgp_override]))
+  }
+  # CIDR conflicts between and within hubs, each hub's route table checks the conflicts it is involved in.
+  # `overlap(a, b)` is written as comparing the network addresses of both prefixes truncated to the shorter prefix length,
+  # `a within b` as `b` not being longer than `a` and both overlapping.
+  cidr_conflicts = concat(
+    flatten([
+      for i, k_src in keys(var.hub_virtual_networks) : [
+        for j, k_dst in keys(var.hub_virtual_networks) : [
+          for a in var.hub_virtual_networks[k_src].address_space : [
+            for b in var.hub_virtual_networks[k_dst].address_space : {
+              hub_keys    = [k_src, k_dst]
+              subnet_keys = []
+              message     = "address_space ${a} of hub ${k_src} overlaps with address_space ${b} of hub ${k_dst}"
+            } if try(cidrhost("${cidrhost(a, 0)}/${min(split("/", a)[1], split("/", b)[1])}", 0) == cidrhost("${cidrhost(b, 0)}/${min(split("/", a)[1], split("/", b)[1])}", 0), false)
+          ]
+        ] if i < j
+      ]
+    ]),
+    flatten([
+      for k, subnets in local.hub_subnet_prefixes : [
+        for s in subnets : [
+          for p in s.address_prefixes : {
+            hub_keys    = [k]
+            subnet_keys = [s.name]
+            message     = "address prefix ${p} of subnet ${s.name} in hub ${k} is not within the address_space of the hub"
+          } if !anytrue([for a in var.hub_virtual_networks[k].address_space : try(tonumber(split("/", p)[1]) >= tonumber(split("/", a)[1]) && cidrhost("${cidrhost(p, 0)}/${split("/", a)[1]}", 0) == cidrhost(a, 0), false)])
+        ]
+      ]
+    ]),
+    flatten([
+      for k, subnets in local.hub_subnet_prefixes : [
+        for i, s1 in subnets : [
+          for j, s2 in subnets : [
+            for p1 in s1.address_prefixes : [
+              for p2 in s2.address_prefixes : {
+                hub_keys    = [k]
+                subnet_keys = [s1.name, s2.name]
+                message     = "address prefix ${p1} of subnet ${s1.name} overlaps with address prefix ${p2} of subnet ${s2.name} in hub ${k}"
+              } if try(cidrhost("${cidrhost(p1, 0)}/${min(split("/", p1)[1], split("/", p2)[1])}", 0) == cidrhost("${cidrhost(p2, 0)}/${min(split("/", p1)[1], split("/", p2)[1])}", 0), false)
+            ]
+          ] if i < j
+        ]
+      ]
+    ]),
+    flatten([
+      for k, v in var.hub_virtual_networks : [
+        for a in v.address_space : {
+          hub_keys    = [k]
+          subnet_keys = []
+          message     = "address_space ${a} of hub ${k} is not within its routing_address_space"
+        } if !anytrue([for r in v.routing_address_space : try(tonumber(split("/", a)[1]) >= tonumber(split("/", r)[1]) && cidrhost("${cidrhost(a, 0)}/${split("/", r)[1]}", 0) == cidrhost(r, 0), false)])
+      ] if length(v.routing_address_space) > 0
+    ]),
+  )
+  # The `hub_keys` of `var.ddos_protection_plan` the plan cannot be attached to, the plan checks them.
+  ddos_protection_plan_conflicts = concat(
+    [
+      for k in try(var.ddos_protection_plan.hub_keys == null, true) ? [] : var.ddos_protection_plan.hub_keys : {
+        hub_keys = []
+        message  = "hub_keys of ddos_protection_plan references hub ${k}, which does not exist"
+      } if !contains(keys(var.hub_virtual_networks), k)
+    ],
+    [
+      for k in try(var.ddos_protection_plan.hub_keys == null, true) ? [] : var.ddos_protection_plan.hub_keys : {
+        hub_keys = [k]
+        message  = "hub ${k} is listed in the hub_keys of ddos_protection_plan but sets its own ddos_protection_plan_id"
+      } if try(var.hub_virtual_networks[k].ddos_protection_plan_id != null, false)
+    ],
+    [
+      for k in try(var.ddos_protection_plan.hub_keys == null, true) ? [] : var.ddos_protection_plan.hub_keys : {
+        hub_keys = [k]
+        message  = "hub ${k} is listed in the hub_keys of ddos_protection_plan but a virtual hub cannot be attached to a DDoS Protection Plan with virtual_wan"
+      } if local.virtual_wan_enabled && contains(keys(var.hub_virtual_networks), k)
+    ],
+  )
+  # The hub virtual networks the DDoS Protection Plan of `var.ddos_protection_plan` is attached to, those of its `hub_keys` or
+  # else every hub without its own `ddos_protection_plan_id`.
+  ddos_protection_plan_hub_keys = var.ddos_protection_plan == null ? [] : [
+    for k, v in local.hub_virtual_networks : k if v.ddos_protection_plan_id == null && (var.ddos_protection_plan.hub_keys == null ? true : contains(var.ddos_protection_plan.hub_keys, k))
+  ]
+  # The user routes claiming `0.0.0.0/0`, or `::/0`, in a hub whose `default_route` already does.
+  default_route_conflicts = flatten([
+    for k, v in local.hub_virtual_networks : [
+      for r in v.route_table_entries : {
+        hub_keys = [k]
+        message  = "route ${r.name} of hub ${k} claims ${r.address_prefix}, which its default_route already routes to ${local.default_route_next_hop_types[k]}; set the next_hop_type of the default_route to None to route it with route_table_entries"
+      } if r.address_prefix == "0.0.0.0/0" || r.address_prefix == "::/0" && local.default_route_ipv6_enabled[k]
+    ] if local.default_route_next_hop_types[k] != "None"
+  ])
+  # Whether the route table of each hub also routes `::/0`, to its `hub_router_ipv6_address`, as the `default_route` goes
+  # through the firewall or an NVA.
+  default_route_ipv6_enabled = {
+    for k, v in local.hub_virtual_networks : k => v.hub_router_ipv6_address != null && contains(["Firewall", "VirtualAppliance"], local.default_route_next_hop_types[k])
+  }
+  # Where the workload subnets of each hub send `0.0.0.0/0`, through the firewall of the hub if not specified.
+  default_route_next_hop_types = {
+    for k, v in local.hub_virtual_networks : k => coalesce(v.default_route.next_hop_type, v.firewall != null ? "Firewall" : "Internet")
+  }
+  # The log categories each type of resource with diagnostic settings supports, those of `log_categories` they enable.
+  diagnostic_log_categories = {
+    firewall = [
+      "AZFWApplicationRule",
+      "AZFWApplicationRuleAggregation",
+      "AZFWDnsQuery",
+      "AZFWFatFlow",
+      "AZFWFlowTrace",
+      "AZFWFqdnResolveFailure",
+      "AZFWIdpsSignature",
+      "AZFWNatRule",
+      "AZFWNatRuleAggregation",
+      "AZFWNetworkRule",
+      "AZFWNetworkRuleAggregation",
+      "AZFWThreatIntel",
+      "AzureFirewallApplicationRule",
+      "AzureFirewallDnsProxy",
+      "AzureFirewallNetworkRule",
+    ]
+    public_ip       = ["DDoSMitigationFlowLogs", "DDoSMitigationReports", "DDoSProtectionNotifications"]
+    virtual_network = ["VMProtectionAlerts"]
+  }
+  # The hubs whose diagnostic settings have nowhere to send the logs to, each diagnostic setting of the hub checks them.
+  diagnostic_setting_conflicts = [
+    for k, v in local.hub_diagnostic_settings : {
+      hub_keys = [k]
+      message  = "diagnostic_settings of hub ${k} require a log_analytics_workspace_id, a storage_account_id or an eventhub_authorization_rule_id"
+    } if v.log_analytics_workspace_id == null && v.storage_account_id == null && v.eventhub_authorization_rule_id == null
+  ]
+  # The diagnostic settings of the virtual network, the firewall and the firewall public IPs of each hub, keyed by
+  # `{resource}/{key}`, the resource and its key in `azurerm_firewall.fw`, the firewall public IP resources or
+  # `module.hub_virtual_networks`. A resource none of whose `log_categories` it supports only gets metrics, or nothing.
+  diagnostic_settings = {
+    for s in flatten([
+      for k, v in local.hub_diagnostic_settings : [
+        for target in concat(
+          [{ key = "virtual_network/${k}", type = "virtual_network" }],
+          contains(keys(local.firewalls), k) ? [{ key = "firewall/${k}", type = "firewall" }] : [],
+          contains(keys(local.fw_default_ip_configuration_pip), k) ? [{ key = "fw_default_ip_configuration_pip/${k}", type = "public_ip" }] : [],
+          [for pk, p in local.fw_ip_configuration_pip : { key = "fw_ip_configuration_pip/${pk}", type = "public_ip" } if p.hub_key == k],
+          contains(keys(local.fw_management_ip_configuration_pip), k) ? [{ key = "fw_management_ip_configuration_pip/${k}", type = "public_ip" }] : [],
+        ) : {
+          key                            = target.key
+          hub_key                        = k
+          name                           = v.name
+          log_analytics_workspace_id     = v.log_analytics_workspace_id
+          log_analytics_destination_type = target.type == "firewall" && v.log_analytics_workspace_id != null ? v.log_analytics_destination_type : null
+          storage_account_id             = v.storage_account_id
+          eventhub_authorization_rule_id = v.eventhub_authorization_rule_id
+          eventhub_name                  = v.eventhub_name
+          log_categories                 = v.log_categories == null ? [] : sort(setintersection(v.log_categories, local.diagnostic_log_categories[target.type]))
+          log_category_groups            = v.log_categories == null ? ["allLogs"] : []
+          metrics_enabled                = v.metrics_enabled
+        } if v.log_categories == null ? true : v.metrics_enabled || length(setintersection(v.log_categories, local.diagnostic_log_categories[target.type])) > 0
+      ]
+    ]) : s.key => s
+  }
+  # The rules of the DNS forwarding ruleset of each hub, keyed by hub and rule name.
+  dns_forwarding_rules = {
+    for r in flatten([
+      for k, v in local.hub_virtual_networks : [
+        for name, rule in v.dns_resolver.forwarding_rules : {
+          key                = "${k}-${name}"
+          hub_key            = k
+          name               = name
+          domain_name        = rule.domain_name
+          enabled            = rule.enabled
+          target_dns_servers = rule.target_dns_servers
+        }
+      ] if v.dns_resolver != null
+    ]) : r.key => r
+  }
+  # The static address of the inbound endpoint of each DNS Private Resolver, the fifth address of its subnet by default as Azure
+  # reserves the first four. Being known at plan time it can be the DNS server of the virtual network the resolver is in.
+  dns_resolver_inbound_ip_addresses = {
+    for k, v in local.hub_virtual_networks : k => coalesce(v.dns_resolver.inbound_endpoint_ip_address, cidrhost(v.dns_resolver.inbound_subnet_address_prefix, 4)) if v.dns_resolver != null
+  }
+  dns_resolvers = {
+    for k, v in local.hub_virtual_networks : k => {
+      location                       = local.virtual_networks_modules[k].vnet_location
+      name                           = coalesce(v.dns_resolver.name, "dnspr-${k}")
+      resource_group_name            = v.resource_group_name
+      inbound_subnet_address_prefix  = v.dns_resolver.inbound_subnet_address_prefix
+      inbound_endpoint_ip_address    = local.dns_resolver_inbound_ip_addresses[k]
+      outbound_subnet_address_prefix = v.dns_resolver.outbound_subnet_address_prefix
+      forwarding_ruleset_name        = coalesce(v.dns_resolver.forwarding_ruleset_name, "dnsfrs-${k}")
+      tags                           = v.dns_resolver.tags
+    } if v.dns_resolver != null
+  }
+  # A firewall without policy uses the DNS Private Resolver of its hub unless it sets `dns_servers`, one with a policy takes its
+  # DNS servers from the policy.
   firewalls = {
-    for vnet_name, vnet in var.hub_virtual_networks : vnet_name => {
+    for vnet_name, vnet in local.hub_virtual_networks : vnet_name => {
       name                  = coalesce(vnet.firewall.name, "afw-${vnet_name}")
       sku_name              = vnet.firewall.sku_name
       sku_tier              = vnet.firewall.sku_tier
       subnet_address_prefix = vnet.firewall.subnet_address_prefix
       subnet_route_table_id = vnet.firewall.subnet_route_table_id
-      dns_servers           = vnet.firewall.dns_servers
-      firewall_policy_id    = vnet.firewall.firewall_policy_id
+      dns_servers           = vnet.firewall.dns_servers != null || try(local.firewall_policy_ids[vnet_name], vnet.firewall.firewall_policy_id) != null ? vnet.firewall.dns_servers : try([local.dns_resolver_inbound_ip_addresses[vnet_name]], null)
+      firewall_policy_id    = try(local.firewall_policy_ids[vnet_name], vnet.firewall.firewall_policy_id)
       private_ip_ranges     = vnet.firewall.private_ip_ranges
       tags                  = vnet.firewall.tags
       threat_intel_mode     = vnet.firewall.threat_intel_mode
       default_ip_configuration = {
-        name = try(coalesce(vnet.firewall.management_ip_configuration.name, "default"), "default")
+        name = try(coalesce(vnet.firewall.default_ip_configuration.name, "default"), "default")
       }
+      ip_configurations = [for name in keys(vnet.firewall.ip_configurations) : { name = name }]
       management_ip_configuration = {
         name = try(coalesce(vnet.firewall.management_ip_configuration.name, "defaultMgmt"), "defaultMgmt")
       }
@@ -21,7 +240,7 @@ locals {
     } if vnet.firewall != null
   }
   firewall_management_subnets = {
-    for k, v in var.hub_virtual_networks : k => {
+    for k, v in local.hub_virtual_networks : k => {
       address_prefixes     = [v.firewall.management_subnet_address_prefix]
       name                 = "AzureFirewallManagementSubnet"
       resource_group_name  = v.resource_group_name
@@ -29,47 +248,503 @@ locals {
     }
     if try(v.firewall.sku_tier, "FirewallNull") == "Basic" && v.firewall != null
   }
+  # The firewall policies the module creates, see `var.firewall_policies`. A policy keyed by a hub takes its defaults from
+  # the hub and its firewall, `hub_key` is null for any other policy.
+  firewall_policies = {
+    for k, p in var.firewall_policies : k => {
+      hub_key                       = contains(keys(var.hub_virtual_networks), k) ? k : null
+      name                          = coalesce(p.name, "afwp-${k}")
+      location                      = p.location != null ? p.location : try(local.virtual_wan_enabled ? var.hub_virtual_networks[k].location : local.virtual_networks_modules[k].vnet_location, null)
+      resource_group_name           = p.resource_group_name != null ? p.resource_group_name : try(var.hub_virtual_networks[k].resource_group_name, null)
+      base_policy_key               = p.base_policy_key
+      sku                           = coalesce(p.sku, try(var.hub_virtual_networks[k].firewall.sku_tier, null), "Standard")
+      threat_intelligence_mode      = coalesce(p.threat_intelligence_mode, try(var.hub_virtual_networks[k].firewall.threat_intel_mode, null), "Alert")
+      dns                           = try(p.dns.servers, null) != null || !contains(keys(local.dns_resolver_inbound_ip_addresses), k) ? p.dns : { proxy_enabled = try(p.dns.proxy_enabled, false), servers = [local.dns_resolver_inbound_ip_addresses[k]] }
+      threat_intelligence_allowlist = p.threat_intelligence_allowlist
+      intrusion_detection           = p.intrusion_detection
+      tls_certificate               = p.tls_certificate
+      identity                      = p.identity
+      tags                          = p.tags
+    }
+  }
+  # The firewall policies that do not fit the hub they are keyed by, or their own SKU.
+  firewall_policy_conflicts = concat(
+    [
+      for k, p in local.firewall_policies : {
+        policy_keys = [k]
+        message     = "firewall policy ${k} is keyed by hub ${k}, which has no firewall"
+      } if p.hub_key != null && try(var.hub_virtual_networks[k].firewall, null) == null
+    ],
+    [
+      for k, p in local.firewall_policies : {
+        policy_keys = [k]
+        message     = "firewall policy ${k} conflicts with the firewall_policy_id of the firewall of hub ${k}"
+      } if try(var.hub_virtual_networks[k].firewall.firewall_policy_id, null) != null
+    ],
+    [
+      for k, p in local.firewall_policies : {
+        policy_keys = [k]
+        message     = "firewall policy ${k} is not keyed by a hub and requires a location and a resource_group_name"
+      } if p.location == null || p.resource_group_name == null
+    ],
+    [
+      for k, p in local.firewall_policies : {
+        policy_keys = [k]
+        message     = "the sku ${p.sku} of firewall policy ${k} does not match the sku_tier ${var.hub_virtual_networks[k].firewall.sku_tier} of the firewall of hub ${k}"
+      } if try(p.sku != var.hub_virtual_networks[k].firewall.sku_tier, false)
+    ],
+    flatten([
+      for k, p in local.firewall_policies : [
+        for setting in ["intrusion_detection", "tls_certificate", "identity"] : {
+          policy_keys = [k]
+          message     = "${setting} of firewall policy ${k} requires the Premium SKU"
+        } if p[setting] != null
+      ] if p.sku != "Premium"
+    ]),
+    [
+      for k, p in var.firewall_policies : {
+        policy_keys = [k]
+        message     = "the rule collection groups of firewall policy ${k} must not be named hub-mesh nor use its mesh_rules_priority ${p.mesh_rules_priority}"
+      } if p.mesh_rules_enabled && local.firewall_policies[k].hub_key != null && (contains(keys(p.rule_collection_groups), "hub-mesh") || contains([for g in values(p.rule_collection_groups) : g.priority], p.mesh_rules_priority))
+    ],
+  )
+  # The network rules allowing the mesh traffic each firewall with a module managed policy forwards: from a hub to every hub
+  # it routes to, see `local.route_map`, when the firewall belongs to either hub or to the transit hub in between.
+  firewall_policy_mesh_rules = {
+    for k, v in var.hub_virtual_networks : k => flatten([
+      for k_src in keys(var.hub_virtual_networks) : [
+        for k_dst, k_next_hop in local.hub_mesh_next_hops[k_src] : {
+          name                  = "${k_src}-to-${k_dst}"
+          protocols             = ["Any"]
+          destination_ports     = ["*"]
+          source_addresses      = [for p in local.hub_mesh_prefixes[k_src] : p.address_prefix]
+          source_ip_groups      = null
+          destination_addresses = [for p in local.hub_mesh_prefixes[k_dst] : p.address_prefix]
+          destination_ip_groups = null
+          destination_fqdns     = null
+        } if contains([k_src, k_dst, k_next_hop], k) && length(local.hub_mesh_prefixes[k_src]) > 0 && length(local.hub_mesh_prefixes[k_dst]) > 0
+      ]
+    ]) if v.firewall != null && try(var.firewall_policies[k].mesh_rules_enabled, false)
+  }
+  # The rule collection groups of every firewall policy, keyed by `{policykey}-{name}`, with the generated `hub-mesh` group
+  # of the hub policies.
+  firewall_policy_rule_collection_groups = {
+    for g in flatten([
+      for k, p in var.firewall_policies : concat(
+        [
+          for name, group in p.rule_collection_groups : {
+            key                          = "${k}-${name}"
+            policy_key                   = k
+            name                         = name
+            priority                     = group.priority
+            network_rule_collections     = group.network_rule_collections
+            application_rule_collections = group.application_rule_collections
+            nat_rule_collections         = group.nat_rule_collections
+          }
+        ],
+        length(try(local.firewall_policy_mesh_rules[k], [])) == 0 ? [] : [{
+          key        = "${k}-hub-mesh"
+          policy_key = k
+          name       = "hub-mesh"
+          priority   = p.mesh_rules_priority
+          network_rule_collections = [{
+            name     = "allow-hub-mesh"
+            priority = 100
+            action   = "Allow"
+            rules    = local.firewall_policy_mesh_rules[k]
+          }]
+          application_rule_collections = []
+          nat_rule_collections         = []
+        }],
+      )
+    ]) : g.key => g
+  }
+  # The public IP addresses of each firewall, that of its default ip configuration first, and the public IP prefix the module
+  # creates for it, if any.
+  firewall_public_ips = {
+    for k, fw in local.firewalls : k => {
+      public_ip_addresses = [
+        for key in concat(["fw_default_ip_configuration_pip/${k}"], [for c in fw.ip_configurations : "fw_ip_configuration_pip/${k}-${c.name}"]) : local.fw_public_ip_addresses[key]
+      ]
+      public_ip_prefix_id = try(local.fw_public_ip_prefix_ids[k], null)
+    }
+  }
+  # The route tables of the firewall subnets without `subnet_route_table_id`: the firewall reaches the internet directly
+  # and the other hubs through the same mesh routes as the workloads of its hub.
+  firewall_route_tables = {
+    for k, v in local.hub_virtual_networks : k => {
+      bgp_route_propagation_enabled = v.firewall.route_table_bgp_route_propagation_enabled
+      location                      = local.virtual_networks_modules[k].vnet_location
+      name                          = coalesce(v.firewall.route_table_name, "route-afw-${k}")
+      resource_group_name           = v.resource_group_name
+      routes = concat(
+        [{ name = "internet", address_prefix = "0.0.0.0/0", next_hop_type = "Internet", next_hop_ip_address = null }],
+        local.route_map[k].mesh_routes,
+      )
+      tags = v.route_table_tags
+    } if v.firewall != null && try(v.firewall.subnet_route_table_id == null, false)
+  }
+  # The flow log of each hub virtual network, in the Network Watcher of `var.network_watchers` for the location of the hub or
+  # else the one Azure creates in the region.
+  flow_logs = {
+    for k, v in local.hub_virtual_networks : k => {
+      name                                = coalesce(v.flow_log.name, "fl-${k}")
+      location                            = v.location
+      network_watcher_name                = try(local.network_watchers[lower(replace(v.location, " ", ""))].name, "NetworkWatcher_${lower(replace(v.location, " ", ""))}")
+      network_watcher_resource_group_name = try(local.network_watchers[lower(replace(v.location, " ", ""))].resource_group_name, "NetworkWatcherRG")
+      storage_account_id                  = v.flow_log.storage_account_id
+      enabled                             = v.flow_log.enabled
+      retention_days                      = v.flow_log.retention_days
+      traffic_analytics = v.flow_log.traffic_analytics == null ? null : {
+        workspace_id          = v.flow_log.traffic_analytics.workspace_id
+        workspace_resource_id = v.flow_log.traffic_analytics.workspace_resource_id
+        workspace_region      = coalesce(v.flow_log.traffic_analytics.workspace_region, v.location)
+        interval_in_minutes   = v.flow_log.traffic_analytics.interval_in_minutes
+      }
+      tags = v.flow_log.tags
+    } if v.flow_log != null
+  }
+  # The public IPs of the default ip configuration of the firewalls. `public_ip_prefix_key` is the key of the
+  # `fw_public_ip_prefix` to allocate the public IP from, which must have the IP version of the public IP.
   fw_default_ip_configuration_pip = {
-    for vnet_name, vnet in var.hub_virtual_networks : vnet_name => {
-      location            = local.virtual_networks_modules[vnet_name].vnet_location
-      name                = try(vnet.firewall.default_ip_configuration.public_ip_config.name, "pip-afw-${vnet_name}")
-      resource_group_name = vnet.resource_group_name
-      tags                = vnet.firewall.default_ip_configuration.tags
-      ip_version          = try(vnet.firewall.default_ip_configuration.public_ip_config.ip_version, "IPv4")
-      sku_tier            = try(vnet.firewall.default_ip_configuration.public_ip_config.sku_tier, "Regional")
-      zones               = try(vnet.firewall.default_ip_configuration.public_ip_config.zones, null)
+    for vnet_name, vnet in local.hub_virtual_networks : vnet_name => {
+      location             = local.virtual_networks_modules[vnet_name].vnet_location
+      name                 = try(coalesce(vnet.firewall.default_ip_configuration.public_ip_config.name, "pip-afw-${vnet_name}"), "pip-afw-${vnet_name}")
+      resource_group_name  = vnet.resource_group_name
+      tags                 = try(vnet.firewall.default_ip_configuration.tags, null)
+      ip_version           = try(coalesce(vnet.firewall.default_ip_configuration.public_ip_config.ip_version, "IPv4"), "IPv4")
+      public_ip_prefix_id  = try(vnet.firewall.default_ip_configuration.public_ip_config.public_ip_prefix_id, null)
+      public_ip_prefix_key = try(vnet.firewall.default_ip_configuration.public_ip_config.public_ip_prefix_id, null) == null && try(vnet.firewall.public_ip_prefix.ip_version, null) == try(coalesce(vnet.firewall.default_ip_configuration.public_ip_config.ip_version, "IPv4"), "IPv4") ? vnet_name : null
+      sku_tier             = try(vnet.firewall.default_ip_configuration.public_ip_config.sku_tier, "Regional")
+      zones                = try(vnet.firewall.default_ip_configuration.public_ip_config.zones, null)
     } if vnet.firewall != null
   }
+  # The public IPs of the additional ip configurations of the firewalls, keyed by `{vnetname}-{ipconfigurationname}`.
+  fw_ip_configuration_pip = {
+    for p in flatten([
+      for k, v in local.hub_virtual_networks : [
+        for name, c in v.firewall.ip_configurations : {
+          key                   = "${k}-${name}"
+          hub_key               = k
+          ip_configuration_name = name
+          location              = local.virtual_networks_modules[k].vnet_location
+          name                  = try(coalesce(c.public_ip_config.name, "pip-afw-${k}-${name}"), "pip-afw-${k}-${name}")
+          resource_group_name   = v.resource_group_name
+          tags                  = c.tags
+          ip_version            = try(coalesce(c.public_ip_config.ip_version, "IPv4"), "IPv4")
+          public_ip_prefix_id   = try(c.public_ip_config.public_ip_prefix_id, null)
+          public_ip_prefix_key  = try(c.public_ip_config.public_ip_prefix_id, null) == null && try(v.firewall.public_ip_prefix.ip_version, null) == try(coalesce(c.public_ip_config.ip_version, "IPv4"), "IPv4") ? k : null
+          sku_tier              = try(c.public_ip_config.sku_tier, "Regional")
+          zones                 = try(c.public_ip_config.zones, null)
+        }
+      ] if v.firewall != null
+    ]) : p.key => p
+  }
   fw_management_ip_configuration_pip = {
-    for k, v in var.hub_virtual_networks : k => {
+    for k, v in local.hub_virtual_networks : k => {
       location            = local.virtual_networks_modules[k].vnet_location
       name                = try(v.firewall.management_ip_configuration.public_ip_config.name, "pip-afw-mgmt-${k}")
       resource_group_name = v.resource_group_name
-      tags                = v.firewall.management_ip_configuration.tags
+      tags                = try(v.firewall.management_ip_configuration.tags, null)
       ip_version          = try(v.firewall.management_ip_configuration.public_ip_config.ip_version, "IPv4")
       sku_tier            = try(v.firewall.management_ip_configuration.public_ip_config.sku_tier, "Regional")
       zones               = try(v.firewall.management_ip_configuration.public_ip_config.zones, null)
     } if try(v.firewall.sku_tier, "FirewallNull") == "Basic" && v.firewall != null
   }
+  fw_public_ip_prefix = {
+    for k, v in local.hub_virtual_networks : k => {
+      ip_version          = v.firewall.public_ip_prefix.ip_version
+      location            = local.virtual_networks_modules[k].vnet_location
+      name                = coalesce(v.firewall.public_ip_prefix.name, "ippre-afw-${k}")
+      prefix_length       = v.firewall.public_ip_prefix.prefix_length
+      resource_group_name = v.resource_group_name
+      tags                = v.firewall.public_ip_prefix.tags
+      zones               = v.firewall.public_ip_prefix.zones
+    } if try(v.firewall.public_ip_prefix, null) != null
+  }
+  # The `virtual_network_ddos_protection_plan` of each hub virtual network, its own `ddos_protection_plan_id` or else the plan of
+  # `var.ddos_protection_plan` when attached to it.
+  hub_ddos_protection_plans = {
+    for k, v in local.hub_virtual_networks : k => v.ddos_protection_plan_id == null && !contains(local.ddos_protection_plan_hub_keys, k) ? null : {
+      id     = coalesce(v.ddos_protection_plan_id, local.ddos_protection_plan_id)
+      enable = true
+    }
+  }
+  # The diagnostic settings of each hub virtual network, `var.diagnostic_settings` overridden attribute by attribute by the
+  # `diagnostic_settings` of the hub. `coalesce` fails on a null attribute, so `try` falls back to the module-wide value.
+  hub_diagnostic_settings = {
+    for k, v in local.hub_virtual_networks : k => {
+      name                           = try(coalesce(v.diagnostic_settings.name), var.diagnostic_settings.name, "diag")
+      log_analytics_workspace_id     = try(coalesce(v.diagnostic_settings.log_analytics_workspace_id), var.diagnostic_settings.log_analytics_workspace_id, null)
+      log_analytics_destination_type = try(coalesce(v.diagnostic_settings.log_analytics_destination_type), var.diagnostic_settings.log_analytics_destination_type, "Dedicated")
+      storage_account_id             = try(coalesce(v.diagnostic_settings.storage_account_id), var.diagnostic_settings.storage_account_id, null)
+      eventhub_authorization_rule_id = try(coalesce(v.diagnostic_settings.eventhub_authorization_rule_id), var.diagnostic_settings.eventhub_authorization_rule_id, null)
+      eventhub_name                  = try(coalesce(v.diagnostic_settings.eventhub_name), var.diagnostic_settings.eventhub_name, null)
+      log_categories                 = try(coalesce(v.diagnostic_settings.log_categories), var.diagnostic_settings.log_categories, null)
+      metrics_enabled                = try(coalesce(v.diagnostic_settings.metrics_enabled), var.diagnostic_settings.metrics_enabled, true)
+    } if (var.diagnostic_settings != null || v.diagnostic_settings != null) && try(v.diagnostic_settings.enabled, true)
+  }
+  # The DNS servers of each hub, its `dns_servers` or else the inbound endpoint of its DNS Private Resolver.
+  hub_dns_servers = {
+    for k, v in local.hub_virtual_networks : k => v.dns_servers != null ? v.dns_servers : try([local.dns_resolver_inbound_ip_addresses[k]], null)
+  }
+  # Whether each hub has a virtual network gateway, created by the module or deployed in a user defined `GatewaySubnet`,
+  # or a Route Server, which drives the default of `allow_gateway_transit` of its spoke peerings.
+  hub_gateway_enabled = {
+    for k, v in var.hub_virtual_networks : k => v.virtual_network_gateway != null || contains(keys(v.subnets), "GatewaySubnet") || v.route_server != null
+  }
+  # The hubs each hub routes mesh traffic to, mapped to the hub whose firewall or router is the next hop: the destination
+  # itself when both hubs are peered, the transit hub when they are only peered through it.
+  hub_mesh_next_hops = {
+    for k_src in keys(var.hub_virtual_networks) : k_src => {
+      for k_dst in keys(var.hub_virtual_networks) : k_dst => contains(local.hub_mesh_pairs[k_src], k_dst) ? k_dst : var.hub_mesh_topology.transit_hub_key
+      if k_src != k_dst && (
+        contains(local.hub_mesh_pairs[k_src], k_dst) ||
+        (var.hub_mesh_topology.type == "hub_and_spoke" && contains(local.hub_mesh_pairs[k_src], coalesce(var.hub_mesh_topology.transit_hub_key, k_src)) && contains(local.hub_mesh_pairs[k_dst], coalesce(var.hub_mesh_topology.transit_hub_key, k_dst)))
+      )
+    }
+  }
+  # The keys of the hubs each hub is peered with according to `var.hub_mesh_topology`.
+  hub_mesh_pairs = {
+    for k_src, v_src in var.hub_virtual_networks : k_src => [
+      for k_dst, v_dst in var.hub_virtual_networks : k_dst
+      if k_src != k_dst && v_src.mesh_peering_enabled && v_dst.mesh_peering_enabled && !contains(var.hub_mesh_topology.denied_pairs, toset([k_src, k_dst])) && (
+        contains(var.hub_mesh_topology.allowed_pairs, toset([k_src, k_dst])) ||
+        var.hub_mesh_topology.type == "full_mesh" ||
+        (var.hub_mesh_topology.type == "hub_and_spoke" && (var.hub_mesh_topology.transit_hub_key == k_src || var.hub_mesh_topology.transit_hub_key == k_dst)) ||
+        (var.hub_mesh_topology.type == "groups" && anytrue([for g in values(var.hub_mesh_topology.groups) : contains(g, k_src) && contains(g, k_dst)]))
+      )
+    ]
+  }
+  # The prefixes hubs and spokes route towards each hub through its firewall or router: its routing address space followed by
+  # the address space of its spokes with mesh routing, unless already within the routing address space.
+  hub_mesh_prefixes = {
+    for k, v in var.hub_virtual_networks : k => concat(
+      [for cidr in v.routing_address_space : { name = "${k}-${replace(replace(cidr, ":", "-"), "/", "-")}", address_prefix = cidr }],
+      flatten([
+        for k_spoke, v_spoke in var.spoke_virtual_networks : [
+          for cidr in v_spoke.address_space : { name = "${k_spoke}-${replace(replace(cidr, ":", "-"), "/", "-")}", address_prefix = cidr }
+          if !anytrue([for r in v.routing_address_space : try(tonumber(split("/", cidr)[1]) >= tonumber(split("/", r)[1]) && cidrhost("${cidrhost(cidr, 0)}/${split("/", r)[1]}", 0) == cidrhost(r, 0), false)])
+        ] if v_spoke.hub_key == k && v_spoke.mesh_routing_enabled
+      ]),
+    )
+  }
+  # Hub keys referenced by `var.hub_mesh_topology` that are not keys of `var.hub_virtual_networks`.
+  hub_mesh_topology_unknown_keys = sort(setsubtract(flatten([
+    var.hub_mesh_topology.transit_hub_key == null ? [] : [var.hub_mesh_topology.transit_hub_key],
+    [for g in values(var.hub_mesh_topology.groups) : [for k in g : k]],
+    [for p in concat(var.hub_mesh_topology.allowed_pairs, var.hub_mesh_topology.denied_pairs) : [for k in p : k]],
+  ]), keys(var.hub_virtual_networks)))
   hub_peering_map = {
     for peerconfig in flatten([
-      for k_src, v_src in var.hub_virtual_networks :
+      for k_src in keys(local.hub_virtual_networks) :
       [
-        for k_dst, v_dst in var.hub_virtual_networks :
+        for k_dst in local.hub_mesh_pairs[k_src] :
         {
           name                         = "${local.virtual_networks_modules[k_src].vnet_name}-${local.virtual_networks_modules[k_dst].vnet_name}"
           src_key                      = k_src
           dst_key                      = k_dst
           virtual_network_name         = local.virtual_networks_modules[k_src].vnet_name
           remote_virtual_network_id    = local.virtual_networks_modules[k_dst].vnet_id
-          allow_virtual_network_access = true
-          allow_forwarded_traffic      = true
-          allow_gateway_transit        = true
-          use_remote_gateways          = false
-        } if k_src != k_dst && v_dst.mesh_peering_enabled
-      ] if v_src.mesh_peering_enabled
+          allow_virtual_network_access = coalesce(try(var.hub_virtual_networks[k_src].mesh_peering_overrides[k_dst].allow_virtual_network_access, null), var.hub_virtual_networks[k_src].mesh_peering_settings.allow_virtual_network_access, true)
+          allow_forwarded_traffic      = coalesce(try(var.hub_virtual_networks[k_src].mesh_peering_overrides[k_dst].allow_forwarded_traffic, null), var.hub_virtual_networks[k_src].mesh_peering_settings.allow_forwarded_traffic, true)
+          allow_gateway_transit        = coalesce(try(var.hub_virtual_networks[k_src].mesh_peering_overrides[k_dst].allow_gateway_transit, null), var.hub_virtual_networks[k_src].mesh_peering_settings.allow_gateway_transit, !coalesce(try(var.hub_virtual_networks[k_src].mesh_peering_overrides[k_dst].use_remote_gateways, null), var.hub_virtual_networks[k_src].mesh_peering_settings.use_remote_gateways, false))
+          use_remote_gateways          = coalesce(try(var.hub_virtual_networks[k_src].mesh_peering_overrides[k_dst].use_remote_gateways, null), var.hub_virtual_networks[k_src].mesh_peering_settings.use_remote_gateways, false)
+        }
+      ]
     ]) : peerconfig.name => peerconfig
   }
+  hub_peering_map_by_keys = {
+    for p in values(local.hub_peering_map) : "${p.src_key}/${p.dst_key}" => p
+  }
+  # The subnets of each hub that take address prefixes, user defined subnets first followed by the firewall, gateway, Bastion,
+  # Route Server and DNS Private Resolver subnets.
+  hub_subnet_prefixes = {
+    for k, v in var.hub_virtual_networks : k => concat(
+      [for subnet_name, subnet in v.subnets : { name = subnet_name, address_prefixes = subnet.address_prefixes }],
+      try(v.firewall.subnet_address_prefix, null) == null ? [] : [{ name = "AzureFirewallSubnet", address_prefixes = [v.firewall.subnet_address_prefix] }],
+      try(v.firewall.management_subnet_address_prefix, null) == null ? [] : [{ name = "AzureFirewallManagementSubnet", address_prefixes = [v.firewall.management_subnet_address_prefix] }],
+      v.virtual_network_gateway == null ? [] : [{ name = "GatewaySubnet", address_prefixes = [v.virtual_network_gateway.subnet_address_prefix] }],
+      try(v.bastion.subnet_address_prefix, null) == null ? [] : [{ name = "AzureBastionSubnet", address_prefixes = [v.bastion.subnet_address_prefix] }],
+      v.route_server == null ? [] : [{ name = "RouteServerSubnet", address_prefixes = [v.route_server.subnet_address_prefix] }],
+      v.dns_resolver == null ? [] : [{ name = "DnsResolverInboundSubnet", address_prefixes = [v.dns_resolver.inbound_subnet_address_prefix] }],
+      try(v.dns_resolver.outbound_subnet_address_prefix, null) == null ? [] : [{ name = "DnsResolverOutboundSubnet", address_prefixes = [v.dns_resolver.outbound_subnet_address_prefix] }],
+    )
+  }
+  # The hubs deployed as virtual networks, none with `var.virtual_wan`.
+  hub_virtual_networks = local.virtual_wan_enabled ? {} : var.hub_virtual_networks
+  # The security rules a generated network security group starts from for a well-known subnet, keyed by subnet name and
+  # rule name, e.g. those Azure Bastion requires on its `AzureBastionSubnet`.
+  network_security_group_baseline_rules = {
+    AzureBastionSubnet = {
+      AllowHttpsInbound                     = { priority = 120, direction = "Inbound", access = "Allow", protocol = "Tcp", source_address_prefixes = ["Internet"], source_port_ranges = ["*"], destination_address_prefixes = ["*"], destination_port_ranges = ["443"], description = "Sessions of the Bastion clients" }
+      AllowGatewayManagerInbound            = { priority = 130, direction = "Inbound", access = "Allow", protocol = "Tcp", source_address_prefixes = ["GatewayManager"], source_port_ranges = ["*"], destination_address_prefixes = ["*"], destination_port_ranges = ["443"], description = "Control plane of Azure Bastion" }
+      AllowAzureLoadBalancerInbound         = { priority = 140, direction = "Inbound", access = "Allow", protocol = "Tcp", source_address_prefixes = ["AzureLoadBalancer"], source_port_ranges = ["*"], destination_address_prefixes = ["*"], destination_port_ranges = ["443"], description = "Health probes" }
+      AllowBastionHostCommunicationInbound  = { priority = 150, direction = "Inbound", access = "Allow", protocol = "*", source_address_prefixes = ["VirtualNetwork"], source_port_ranges = ["*"], destination_address_prefixes = ["VirtualNetwork"], destination_port_ranges = ["8080", "5701"], description = "Data plane between the Bastion instances" }
+      AllowSshRdpOutbound                   = { priority = 100, direction = "Outbound", access = "Allow", protocol = "*", source_address_prefixes = ["*"], source_port_ranges = ["*"], destination_address_prefixes = ["VirtualNetwork"], destination_port_ranges = ["22", "3389"], description = "Sessions to the target virtual machines" }
+      AllowAzureCloudOutbound               = { priority = 110, direction = "Outbound", access = "Allow", protocol = "Tcp", source_address_prefixes = ["*"], source_port_ranges = ["*"], destination_address_prefixes = ["AzureCloud"], destination_port_ranges = ["443"], description = "Diagnostics and metering" }
+      AllowBastionHostCommunicationOutbound = { priority = 120, direction = "Outbound", access = "Allow", protocol = "*", source_address_prefixes = ["VirtualNetwork"], source_port_ranges = ["*"], destination_address_prefixes = ["VirtualNetwork"], destination_port_ranges = ["8080", "5701"], description = "Data plane between the Bastion instances" }
+      AllowHttpOutbound                     = { priority = 130, direction = "Outbound", access = "Allow", protocol = "*", source_address_prefixes = ["*"], source_port_ranges = ["*"], destination_address_prefixes = ["Internet"], destination_port_ranges = ["80"], description = "Session and certificate validation" }
+    }
+  }
+  # The rules of each generated network security group sharing a direction and a priority, which Azure rejects. Each
+  # network security group checks its own.
+  network_security_group_conflicts = flatten([
+    for k, nsg in local.network_security_groups : [
+      for direction_priority, names in { for name, r in nsg.rules : "${r.direction} priority ${r.priority}" => name... } : {
+        hub_keys                    = [nsg.hub_key]
+        network_security_group_keys = [k]
+        message                     = "rules ${join(", ", names)} of network security group ${nsg.name} share the ${direction_priority}"
+      } if length(names) > 1
+    ]
+  ])
+  # The network security groups the module creates for the `subnets` with `generated_network_security_group`, keyed by
+  # `{vnetname}-{subnetname}`.
+  network_security_groups = {
+    for nsg in flatten([
+      for k, v in local.hub_virtual_networks : [
+        for subnet_name, subnet in v.subnets : {
+          key                 = "${k}-${subnet_name}"
+          hub_key             = k
+          subnet_name         = subnet_name
+          name                = coalesce(subnet.generated_network_security_group.name, "nsg-${k}-${subnet_name}")
+          location            = v.location
+          resource_group_name = v.resource_group_name
+          rules               = merge({ for name, rule in try(local.network_security_group_baseline_rules[subnet_name], {}) : name => rule if subnet.generated_network_security_group.baseline_rules_enabled }, subnet.generated_network_security_group.rules)
+          tags                = subnet.generated_network_security_group.tags
+        } if subnet.generated_network_security_group != null
+      ]
+    ]) : nsg.key => nsg
+  }
+  # `var.network_watchers` keyed by location in the normalized form, e.g. `eastus` for `East US`.
+  network_watchers = {
+    for location, w in var.network_watchers : lower(replace(location, " ", "")) => w
+  }
+  # Peering settings Azure would reject, each peering checks the conflicts it is involved in.
+  peering_conflicts = concat(
+    flatten([
+      for i, k_src in keys(var.hub_virtual_networks) : [
+        for j, k_dst in keys(var.hub_virtual_networks) : {
+          peering_names = [local.hub_peering_map_by_keys["${k_src}/${k_dst}"].name, local.hub_peering_map_by_keys["${k_dst}/${k_src}"].name]
+          message       = "peerings ${local.hub_peering_map_by_keys["${k_src}/${k_dst}"].name} and ${local.hub_peering_map_by_keys["${k_dst}/${k_src}"].name} both set use_remote_gateways"
+        } if i < j && try(local.hub_peering_map_by_keys["${k_src}/${k_dst}"].use_remote_gateways && local.hub_peering_map_by_keys["${k_dst}/${k_src}"].use_remote_gateways, false)
+      ]
+    ]),
+    [
+      for p in values(local.hub_peering_map) : {
+        peering_names = [p.name]
+        message       = "peering ${p.name} sets use_remote_gateways but hub ${p.dst_key} has no gateway"
+      } if p.use_remote_gateways && !local.hub_gateway_enabled[p.dst_key]
+    ],
+    [
+      for p in values(local.hub_peering_map) : {
+        peering_names = [p.name]
+        message       = "peering ${p.name} sets use_remote_gateways but hub ${p.src_key} has a gateway of its own"
+      } if p.use_remote_gateways && local.hub_gateway_enabled[p.src_key]
+    ],
+    [
+      for p in values(local.hub_peering_map) : {
+        peering_names = [p.name]
+        message       = "peering ${p.name} sets use_remote_gateways but the peering from hub ${p.dst_key} does not allow gateway transit"
+      } if p.use_remote_gateways && !try(local.hub_peering_map_by_keys["${p.dst_key}/${p.src_key}"].allow_gateway_transit, false)
+    ],
+  )
+  # The links of every private DNS zone to the hub virtual networks and the spokes with `private_dns_zone_links_enabled`, keyed
+  # by zone and link name.
+  private_dns_zone_virtual_network_links = {
+    for link in flatten([
+      for zone_name in keys(local.private_dns_zones) : concat(
+        [
+          for k in keys(local.hub_virtual_networks) : {
+            name                  = "link-${k}"
+            private_dns_zone_name = zone_name
+            virtual_network_id    = local.virtual_networks_modules[k].vnet_id
+          }
+        ],
+        [
+          for k, v in var.spoke_virtual_networks : {
+            name                  = "link-spoke-${k}"
+            private_dns_zone_name = zone_name
+            virtual_network_id    = try(local.spoke_virtual_networks_modules[k].vnet_id, v.virtual_network_id)
+          } if v.private_dns_zone_links_enabled
+        ],
+      )
+    ]) : "${link.private_dns_zone_name}/${link.name}" => link
+  }
+  # The private DNS zones the module creates, keyed by zone name.
+  private_dns_zones = var.private_dns_zones == null ? {} : {
+    for name in setunion(var.private_dns_zones.zone_names, var.private_dns_zones.private_link_zones_enabled ? setsubtract(local.private_link_dns_zone_names, var.private_dns_zones.private_link_zone_exclusions) : toset([])) : name => {
+      name                = name
+      resource_group_name = var.private_dns_zones.resource_group_name
+      tags                = var.private_dns_zones.tags
+    }
+  }
+  # The `privatelink` zones of the Azure public cloud services supporting Private Endpoints whose name does not depend on the
+  # region, created with `var.private_dns_zones.private_link_zones_enabled`.
+  private_link_dns_zone_names = [
+    "privatelink.adf.azure.com",
+    "privatelink.afs.azure.net",
+    "privatelink.agentsvc.azure-automation.net",
+    "privatelink.analysis.windows.net",
+    "privatelink.api.azureml.ms",
+    "privatelink.azconfig.io",
+    "privatelink.azure-api.net",
+    "privatelink.azure-automation.net",
+    "privatelink.azure-devices-provisioning.net",
+    "privatelink.azure-devices.net",
+    "privatelink.azurecr.io",
+    "privatelink.azuredatabricks.net",
+    "privatelink.azurehdinsight.net",
+    "privatelink.azurehealthcareapis.com",
+    "privatelink.azurestaticapps.net",
+    "privatelink.azuresynapse.net",
+    "privatelink.azurewebsites.net",
+    "privatelink.blob.core.windows.net",
+    "privatelink.cassandra.cosmos.azure.com",
+    "privatelink.cognitiveservices.azure.com",
+    "privatelink.database.windows.net",
+    "privatelink.datafactory.azure.net",
+    "privatelink.dev.azuresynapse.net",
+    "privatelink.dfs.core.windows.net",
+    "privatelink.digitaltwins.azure.net",
+    "privatelink.directline.botframework.com",
+    "privatelink.documents.azure.com",
+    "privatelink.eventgrid.azure.net",
+    "privatelink.file.core.windows.net",
+    "privatelink.gremlin.cosmos.azure.com",
+    "privatelink.guestconfiguration.azure.com",
+    "privatelink.his.arc.azure.com",
+    "privatelink.kubernetesconfiguration.azure.com",
+    "privatelink.managedhsm.azure.net",
+    "privatelink.mariadb.database.azure.com",
+    "privatelink.media.azure.net",
+    "privatelink.mongo.cosmos.azure.com",
+    "privatelink.monitor.azure.com",
+    "privatelink.mysql.database.azure.com",
+    "privatelink.notebooks.azure.net",
+    "privatelink.ods.opinsights.azure.com",
+    "privatelink.oms.opinsights.azure.com",
+    "privatelink.openai.azure.com",
+    "privatelink.postgres.database.azure.com",
+    "privatelink.prod.migration.windowsazure.com",
+    "privatelink.purview.azure.com",
+    "privatelink.purviewstudio.azure.com",
+    "privatelink.queue.core.windows.net",
+    "privatelink.redis.cache.windows.net",
+    "privatelink.redisenterprise.cache.azure.net",
+    "privatelink.search.windows.net",
+    "privatelink.service.signalr.net",
+    "privatelink.servicebus.windows.net",
+    "privatelink.siterecovery.windowsazure.com",
+    "privatelink.sql.azuresynapse.net",
+    "privatelink.table.core.windows.net",
+    "privatelink.table.cosmos.azure.com",
+    "privatelink.token.botframework.com",
+    "privatelink.vaultcore.azure.net",
+    "privatelink.web.core.windows.net",
+    "privatelink.webpubsub.azure.com",
+    "privatelink.wvd.microsoft.com",
+  ]
   resource_group_data = toset([
     for k, v in var.hub_virtual_networks : {
       name      = v.resource_group_name
@@ -80,24 +755,144 @@ locals {
     } if v.resource_group_creation_enabled
   ])
   route_map = {
-    for k_src, v_src in var.hub_virtual_networks : k_src => {
+    for k_src, v_src in local.hub_virtual_networks : k_src => {
       mesh_routes = flatten([
-        # Generated routes for hub mesh
-        for k_dst, v_dst in var.hub_virtual_networks : [
-          for cidr in v_dst.routing_address_space : {
-            name                = "${k_dst}-${replace(cidr, "/", "-")}"
-            address_prefix      = cidr
+        # Generated routes for hub mesh, except towards the hubs whose router, not a firewall, is the next hop when the hub has a
+        # Route Server with BGP connections and propagates BGP routes: its NVAs advertise those prefixes.
+        # IPv6 prefixes need an IPv6 next hop, only the `hub_router_ipv6_address` of the next hop hub, if any.
+        for k_dst, k_next_hop in local.hub_mesh_next_hops[k_src] : [
+          for p in local.hub_mesh_prefixes[k_dst] : {
+            name                = p.name
+            address_prefix      = p.address_prefix
             next_hop_type       = "VirtualAppliance"
-            next_hop_ip_address = try(local.firewall_private_ip[k_dst], v_dst.hub_router_ip_address)
-          }
-        ] if k_src != k_dst && v_dst.mesh_peering_enabled && can(v_dst.routing_address_space[0])
+            next_hop_ip_address = length(regexall(":", p.address_prefix)) > 0 ? var.hub_virtual_networks[k_next_hop].hub_router_ipv6_address : try(local.firewall_private_ip[k_next_hop], var.hub_virtual_networks[k_next_hop].hub_router_ip_address)
+          } if length(regexall(":", p.address_prefix)) == 0 || var.hub_virtual_networks[k_next_hop].hub_router_ipv6_address != null
+        ] if !(local.bgp_route_propagation_enabled[k_src] && length(try(v_src.route_server.bgp_connections, {})) > 0 && var.hub_virtual_networks[k_next_hop].firewall == null)
+      ])
+      bgp_route_propagation_enabled = local.bgp_route_propagation_enabled[k_src]
+      # A dual-stack hub sends `::/0` to its `hub_router_ipv6_address` too when its workloads go through an appliance.
+      default_routes = concat(local.default_route_next_hop_types[k_src] == "None" ? [] : [
+        {
+          name                = local.default_route_next_hop_types[k_src] == "Internet" ? "internet" : "default"
+          address_prefix      = "0.0.0.0/0"
+          next_hop_type       = local.default_route_next_hop_types[k_src] == "Firewall" ? "VirtualAppliance" : local.default_route_next_hop_types[k_src]
+          next_hop_ip_address = local.default_route_next_hop_types[k_src] == "Firewall" ? local.firewall_private_ip[k_src] : v_src.default_route.next_hop_ip_address
+        }
+      ], !local.default_route_ipv6_enabled[k_src] ? [] : [
+        {
+          name                = "default-ipv6"
+          address_prefix      = "::/0"
+          next_hop_type       = "VirtualAppliance"
+          next_hop_ip_address = v_src.hub_router_ipv6_address
+        }
       ])
       user_routes = v_src.route_table_entries
     }
   }
+  route_server_bgp_connections = {
+    for c in flatten([
+      for k, v in local.hub_virtual_networks : [
+        for name, connection in v.route_server.bgp_connections : {
+          key      = "${k}-${name}"
+          hub_key  = k
+          name     = name
+          peer_asn = connection.peer_asn
+          peer_ip  = connection.peer_ip
+        }
+      ] if v.route_server != null
+    ]) : c.key => c
+  }
+  route_server_pip = {
+    for k, v in local.hub_virtual_networks : k => {
+      location            = local.virtual_networks_modules[k].vnet_location
+      name                = coalesce(v.route_server.public_ip_name, "pip-rs-${k}")
+      resource_group_name = v.resource_group_name
+      tags                = v.route_server.tags
+      zones               = v.route_server.public_ip_zones
+    } if v.route_server != null
+  }
+  route_servers = {
+    for k, v in local.hub_virtual_networks : k => {
+      location                         = local.virtual_networks_modules[k].vnet_location
+      name                             = coalesce(v.route_server.name, "rs-${k}")
+      resource_group_name              = v.resource_group_name
+      branch_to_branch_traffic_enabled = v.route_server.branch_to_branch_traffic_enabled
+      tags                             = v.route_server.tags
+    } if v.route_server != null
+  }
+  # Peerings between each spoke and its hub, in both directions, keyed by peering name.
+  spoke_peering_map = merge([
+    for k, v in local.spokes : {
+      "${v.name}-${local.virtual_networks_modules[v.hub_key].vnet_name}" = {
+        spoke_key                    = k
+        hub_key                      = v.hub_key
+        virtual_network_name         = try(local.spoke_virtual_networks_modules[k].vnet_name, v.name)
+        resource_group_name          = v.resource_group_name
+        remote_virtual_network_id    = local.virtual_networks_modules[v.hub_key].vnet_id
+        allow_forwarded_traffic      = true
+        allow_gateway_transit        = false
+        allow_virtual_network_access = true
+        use_remote_gateways          = var.spoke_virtual_networks[k].use_remote_gateways
+      }
+      "${local.virtual_networks_modules[v.hub_key].vnet_name}-${v.name}" = {
+        spoke_key                    = k
+        hub_key                      = v.hub_key
+        virtual_network_name         = local.virtual_networks_modules[v.hub_key].vnet_name
+        resource_group_name          = var.hub_virtual_networks[v.hub_key].resource_group_name
+        remote_virtual_network_id    = try(local.spoke_virtual_networks_modules[k].vnet_id, var.spoke_virtual_networks[k].virtual_network_id)
+        allow_forwarded_traffic      = true
+        allow_gateway_transit        = local.hub_gateway_enabled[v.hub_key]
+        allow_virtual_network_access = true
+        use_remote_gateways          = false
+      }
+    } if !local.virtual_wan_enabled
+  ]...)
+  # The routes of each spoke's route table, all pointing at the firewall or router of its hub: the default routes, the prefixes of
+  # its hub and of the hubs its hub reaches, except its own address space, and `routed_address_prefixes`.
+  spoke_route_map = {
+    for k, v in var.spoke_virtual_networks : k => [
+      for p in flatten([
+        { name = "default", address_prefix = "0.0.0.0/0" },
+        { name = "default-ipv6", address_prefix = "::/0" },
+        [
+          for k_hub in concat([v.hub_key], keys(local.hub_mesh_next_hops[v.hub_key])) : [
+            for prefix in local.hub_mesh_prefixes[k_hub] : prefix if !contains(v.address_space, prefix.address_prefix)
+          ]
+        ],
+        [for cidr in v.routed_address_prefixes : { name = "routed-${replace(replace(cidr, ":", "-"), "/", "-")}", address_prefix = cidr }],
+      ]) : {
+        name                = p.name
+        address_prefix      = p.address_prefix
+        next_hop_type       = "VirtualAppliance"
+        next_hop_ip_address = length(regexall(":", p.address_prefix)) > 0 ? var.hub_virtual_networks[v.hub_key].hub_router_ipv6_address : try(local.firewall_private_ip[v.hub_key], var.hub_virtual_networks[v.hub_key].hub_router_ip_address)
+      } if length(regexall(":", p.address_prefix)) == 0 || var.hub_virtual_networks[v.hub_key].hub_router_ipv6_address != null
+    ] if !local.virtual_wan_enabled
+  }
+  spoke_subnet_route_table_association_map = {
+    for assoc in flatten([
+      for k, v in var.spoke_virtual_networks : [
+        for subnet_name, subnet in v.subnets : {
+          name           = "${k}-${subnet_name}"
+          subnet_id      = v.virtual_network_id == null ? lookup(local.spoke_virtual_networks_modules[k].vnet_subnets_name_id, subnet_name) : "${v.virtual_network_id}/subnets/${subnet_name}"
+          route_table_id = local.spoke_routing[k].id
+        } if subnet.assign_generated_route_table
+      ] if !local.virtual_wan_enabled
+    ]) : assoc.name => assoc
+  }
+  # The spokes with the attributes that default to their hub's resolved, existing virtual networks are described by their resource id.
+  spokes = {
+    for k, v in var.spoke_virtual_networks : k => {
+      hub_key             = v.hub_key
+      name                = v.virtual_network_id == null ? v.name : split("/", v.virtual_network_id)[8]
+      resource_group_name = v.virtual_network_id == null ? coalesce(v.resource_group_name, var.hub_virtual_networks[v.hub_key].resource_group_name) : split("/", v.virtual_network_id)[4]
+      location            = coalesce(v.location, var.hub_virtual_networks[v.hub_key].location)
+
+      bgp_route_propagation_enabled = coalesce(v.bgp_route_propagation_enabled, local.bgp_route_propagation_enabled[v.hub_key])
+    }
+  }
   subnet_external_route_table_association_map = {
     for assoc in flatten([
-      for k, v in var.hub_virtual_networks : [
+      for k, v in local.hub_virtual_networks : [
         for subnetName, subnet in v.subnets : {
           name           = "${k}-${subnetName}"
           subnet_id      = lookup(local.virtual_networks_modules[k].vnet_subnets_name_id, subnetName)
@@ -106,23 +901,25 @@ locals {
       ]
     ]) : assoc.name => assoc
   }
+  # Azure Bastion and Route Server do not support their subnet sending `0.0.0.0/0` through a firewall or an NVA, the
+  # route table of the hub is never associated with an `AzureBastionSubnet` or a `RouteServerSubnet`.
   subnet_route_table_association_map = {
     for assoc in flatten([
-      for k, v in var.hub_virtual_networks : [
+      for k, v in local.hub_virtual_networks : [
         for subnetName, subnet in v.subnets : {
           name           = "${k}-${subnetName}"
           subnet_id      = lookup(local.virtual_networks_modules[k].vnet_subnets_name_id, subnetName)
           route_table_id = local.hub_routing[k].id
-        } if subnet.assign_generated_route_table
+        } if subnet.assign_generated_route_table && !contains(["AzureBastionSubnet", "RouteServerSubnet"], subnetName)
       ]
     ]) : assoc.name => assoc
   }
   subnets_map = {
-    for k, v in var.hub_virtual_networks : k => {
+    for k, v in local.hub_virtual_networks : k => {
       for subnetKey, subnet in v.subnets : subnetKey => {
         address_prefixes                              = subnet.address_prefixes
         nat_gateway                                   = subnet.nat_gateway
-        network_security_group                        = subnet.network_security_group
+        network_security_group                        = subnet.generated_network_security_group == null ? subnet.network_security_group : { id = local.network_security_group_ids["${k}-${subnetKey}"] }
         private_endpoint_network_policies_enabled     = subnet.private_endpoint_network_policies_enabled
         private_link_service_network_policies_enabled = subnet.private_link_service_network_policies_enabled
         service_endpoints                             = subnet.service_endpoints
@@ -131,5 +928,138 @@ locals {
       }
     }
   }
+  # The connections of the spokes to the virtual hubs of their hubs with `var.virtual_wan`, keyed by spoke.
+  virtual_hub_connections = {
+    for k, v in local.spokes : k => {
+      name                      = "${v.name}-${var.hub_virtual_networks[v.hub_key].name}"
+      hub_key                   = v.hub_key
+      remote_virtual_network_id = try(local.spoke_virtual_networks_modules[k].vnet_id, var.spoke_virtual_networks[k].virtual_network_id)
+      internet_security_enabled = try(var.hub_virtual_networks[v.hub_key].firewall != null && var.hub_virtual_networks[v.hub_key].virtual_hub.internet_traffic_routing_enabled, false)
+    } if local.virtual_wan_enabled
+  }
+  virtual_hub_firewalls = {
+    for k, v in var.hub_virtual_networks : k => {
+      name                = coalesce(v.firewall.name, "afw-${k}")
+      location            = v.location
+      resource_group_name = v.resource_group_name
+      sku_name            = v.firewall.sku_name
+      sku_tier            = v.firewall.sku_tier
+      firewall_policy_id  = try(local.firewall_policy_ids[k], v.firewall.firewall_policy_id)
+      public_ip_count     = v.firewall.virtual_hub_public_ip_count
+      tags                = v.firewall.tags
+      zones               = v.firewall.zones
+    } if local.virtual_wan_enabled && v.firewall != null
+  }
+  # The routing policies sending the internet and private traffic of each virtual hub through its firewall.
+  virtual_hub_routing_intents = {
+    for k, v in local.virtual_hub_firewalls : k => {
+      name = "ri-${k}"
+      routing_policies = concat(
+        var.hub_virtual_networks[k].virtual_hub.internet_traffic_routing_enabled ? [{ name = "InternetTrafficPolicy", destinations = ["Internet"] }] : [],
+        var.hub_virtual_networks[k].virtual_hub.private_traffic_routing_enabled ? [{ name = "PrivateTrafficPolicy", destinations = ["PrivateTraffic"] }] : [],
+      )
+    } if var.hub_virtual_networks[k].virtual_hub.internet_traffic_routing_enabled || var.hub_virtual_networks[k].virtual_hub.private_traffic_routing_enabled
+  }
+  virtual_hubs = {
+    for k, v in var.hub_virtual_networks : k => {
+      name                   = v.name
+      location               = v.location
+      resource_group_name    = v.resource_group_name
+      address_prefix         = v.address_space[0]
+      sku                    = v.virtual_hub.sku
+      hub_routing_preference = v.virtual_hub.hub_routing_preference
+      tags                   = v.tags
+    } if local.virtual_wan_enabled
+  }
+  virtual_network_gateway_public_ips = {
+    for pip in flatten([
+      for k, v in local.hub_virtual_networks : [
+        for ip_configuration_name in v.virtual_network_gateway.active_active ? ["default", "activeActive"] : ["default"] : {
+          key                   = "${k}-${ip_configuration_name}"
+          hub_key               = k
+          ip_configuration_name = ip_configuration_name
+          location              = local.virtual_networks_modules[k].vnet_location
+          name                  = ip_configuration_name == "default" ? "pip-vgw-${k}" : "pip-vgw-${k}-${ip_configuration_name}"
+          resource_group_name   = v.resource_group_name
+          tags                  = v.virtual_network_gateway.tags
+          zones                 = v.virtual_network_gateway.public_ip_zones
+        }
+      ] if v.virtual_network_gateway != null
+    ]) : pip.key => pip
+  }
+  virtual_network_gateways = {
+    for k, v in local.hub_virtual_networks : k => {
+      name                = coalesce(v.virtual_network_gateway.name, "vgw-${k}")
+      location            = local.virtual_networks_modules[k].vnet_location
+      resource_group_name = v.resource_group_name
+      type                = v.virtual_network_gateway.type
+      sku                 = v.virtual_network_gateway.sku
+      vpn_type            = v.virtual_network_gateway.type == "Vpn" ? v.virtual_network_gateway.vpn_type : null
+      generation          = v.virtual_network_gateway.type == "Vpn" ? v.virtual_network_gateway.generation : null
+      active_active       = v.virtual_network_gateway.active_active
+      enable_bgp          = v.virtual_network_gateway.enable_bgp
+      bgp_settings        = v.virtual_network_gateway.bgp_settings
+      tags                = v.virtual_network_gateway.tags
+      ip_configurations = [
+        for ip_configuration_name in v.virtual_network_gateway.active_active ? ["default", "activeActive"] : ["default"] : {
+          name                 = ip_configuration_name
+          public_ip_address_id = local.virtual_network_gateway_public_ip_ids["${k}-${ip_configuration_name}"]
+          subnet_id            = local.gateway_subnet_ids[k]
+        }
+      ]
+    } if v.virtual_network_gateway != null
+  }
+  # Settings that do not fit the deployment mode, each hub's route table, or its virtual hub with `var.virtual_wan`, checks the
+  # conflicts of the hub.
+  virtual_wan_conflicts = concat(
+    [
+      for k, v in var.hub_virtual_networks : {
+        hub_keys = [k]
+        message  = "firewall of hub ${k} must use the AZFW_Hub SKU with virtual_wan"
+      } if local.virtual_wan_enabled && try(v.firewall.sku_name != "AZFW_Hub", false)
+    ],
+    [
+      for k, v in var.hub_virtual_networks : {
+        hub_keys = [k]
+        message  = "firewall of hub ${k} must use the AZFW_VNet SKU without virtual_wan"
+      } if !local.virtual_wan_enabled && try(v.firewall.sku_name != "AZFW_VNet", false)
+    ],
+    [
+      for k, v in var.hub_virtual_networks : {
+        hub_keys = [k]
+        message  = "firewall of hub ${k} requires a subnet_address_prefix without virtual_wan"
+      } if !local.virtual_wan_enabled && v.firewall != null && try(v.firewall.subnet_address_prefix == null, true)
+    ],
+    [
+      for k, v in var.hub_virtual_networks : {
+        hub_keys = [k]
+        message  = "hub ${k} must have exactly one address_space with virtual_wan, the address prefix of its virtual hub"
+      } if local.virtual_wan_enabled && length(v.address_space) != 1
+    ],
+    flatten([
+      for k, v in var.hub_virtual_networks : [
+        for attribute in concat(
+          v.bastion == null ? [] : ["bastion"],
+          v.diagnostic_settings == null ? [] : ["diagnostic_settings"],
+          v.dns_resolver == null ? [] : ["dns_resolver"],
+          v.flow_log == null ? [] : ["flow_log"],
+          v.route_server == null ? [] : ["route_server"],
+          length(v.route_table_entries) == 0 ? [] : ["route_table_entries"],
+          length(v.subnets) == 0 ? [] : ["subnets"],
+          v.virtual_network_gateway == null ? [] : ["virtual_network_gateway"],
+        ) : {
+          hub_keys = [k]
+          message  = "${attribute} of hub ${k} is not supported with virtual_wan"
+        }
+      ] if local.virtual_wan_enabled
+    ]),
+    [
+      for k, v in var.spoke_virtual_networks : {
+        hub_keys = [v.hub_key]
+        message  = "spoke ${k} sets use_remote_gateways, which is not supported with virtual_wan"
+      } if local.virtual_wan_enabled && v.use_remote_gateways
+    ],
+  )
+  virtual_wan_enabled = var.virtual_wan != null
 }
 
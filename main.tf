@@ -1,9 +1,40 @@
 # These locals defined here to avoid conflict with test framework
 locals {
+  ddos_protection_plan_id = try(azurerm_network_ddos_protection_plan.ddos_protection_plan[0].id, null)
+  diagnostic_setting_target_resource_ids = merge(
+    { for k, fw in azurerm_firewall.fw : "firewall/${k}" => fw.id },
+    { for k, pip in azurerm_public_ip.fw_default_ip_configuration_pip : "fw_default_ip_configuration_pip/${k}" => pip.id },
+    { for k, pip in azurerm_public_ip.fw_ip_configuration_pip : "fw_ip_configuration_pip/${k}" => pip.id },
+    { for k, pip in azurerm_public_ip.fw_management_ip_configuration_pip : "fw_management_ip_configuration_pip/${k}" => pip.id },
+    { for k, vnet_module in module.hub_virtual_networks : "virtual_network/${k}" => vnet_module.vnet_id },
+  )
+  firewall_policy_ids = {
+    for k, policy in merge(module.firewall_policy, module.inherited_firewall_policy) : k => policy.id
+  }
   firewall_private_ip = {
     for vnet_name, fw in azurerm_firewall.fw : vnet_name => fw.ip_configuration[0].private_ip_address
   }
+  fw_public_ip_addresses = merge(
+    { for k, pip in azurerm_public_ip.fw_default_ip_configuration_pip : "fw_default_ip_configuration_pip/${k}" => pip.ip_address },
+    { for k, pip in azurerm_public_ip.fw_ip_configuration_pip : "fw_ip_configuration_pip/${k}" => pip.ip_address },
+  )
+  fw_public_ip_prefix_ids = {
+    for k, prefix in azurerm_public_ip_prefix.fw_public_ip_prefix : k => prefix.id
+  }
+  gateway_subnet_ids = {
+    for vnet_name, subnet in azurerm_subnet.gateway_subnet : vnet_name => subnet.id
+  }
   hub_routing = azurerm_route_table.hub_routing
+  network_security_group_ids = {
+    for k, nsg in azurerm_network_security_group.nsg : k => nsg.id
+  }
+  spoke_routing = azurerm_route_table.spoke_routing
+  spoke_virtual_networks_modules = {
+    for spoke_key, vnet_module in module.spoke_virtual_networks : spoke_key => vnet_module
+  }
+  virtual_network_gateway_public_ip_ids = {
+    for pip_key, pip in azurerm_public_ip.vgw_pip : pip_key => pip.id
+  }
   virtual_networks_modules = {
     for vnet_key, vnet_module in module.hub_virtual_networks : vnet_key => vnet_module
   }
@@ -26,12 +57,64 @@ resource "azurerm_management_lock" "rg_lock" {
   scope      = azurerm_resource_group.rg[each.key].id
 }
 
+resource "azurerm_network_ddos_protection_plan" "ddos_protection_plan" {
+  count = var.ddos_protection_plan == null ? 0 : 1
+
+  location            = var.ddos_protection_plan.location
+  name                = var.ddos_protection_plan.name
+  resource_group_name = try(azurerm_resource_group.rg[var.ddos_protection_plan.resource_group_name].name, var.ddos_protection_plan.resource_group_name)
+  tags                = var.ddos_protection_plan.tags
+
+  lifecycle {
+    precondition {
+      condition     = length(local.ddos_protection_plan_conflicts) == 0
+      error_message = join("\n", [for c in local.ddos_protection_plan_conflicts : c.message])
+    }
+  }
+}
+
+resource "azurerm_network_security_group" "nsg" {
+  for_each = local.network_security_groups
+
+  location            = each.value.location
+  name                = each.value.name
+  resource_group_name = try(azurerm_resource_group.rg[each.value.resource_group_name].name, each.value.resource_group_name)
+  tags                = each.value.tags
+
+  dynamic "security_rule" {
+    for_each = each.value.rules
+
+    content {
+      access                       = security_rule.value.access
+      direction                    = security_rule.value.direction
+      name                         = security_rule.key
+      priority                     = security_rule.value.priority
+      protocol                     = security_rule.value.protocol
+      description                  = security_rule.value.description
+      destination_address_prefix   = length(security_rule.value.destination_address_prefixes) == 1 ? one(security_rule.value.destination_address_prefixes) : null
+      destination_address_prefixes = length(security_rule.value.destination_address_prefixes) == 1 ? null : security_rule.value.destination_address_prefixes
+      destination_port_range       = length(security_rule.value.destination_port_ranges) == 1 ? one(security_rule.value.destination_port_ranges) : null
+      destination_port_ranges      = length(security_rule.value.destination_port_ranges) == 1 ? null : security_rule.value.destination_port_ranges
+      source_address_prefix        = length(security_rule.value.source_address_prefixes) == 1 ? one(security_rule.value.source_address_prefixes) : null
+      source_address_prefixes      = length(security_rule.value.source_address_prefixes) == 1 ? null : security_rule.value.source_address_prefixes
+      source_port_range            = length(security_rule.value.source_port_ranges) == 1 ? one(security_rule.value.source_port_ranges) : null
+      source_port_ranges           = length(security_rule.value.source_port_ranges) == 1 ? null : security_rule.value.source_port_ranges
+    }
+  }
+  lifecycle {
+    precondition {
+      condition     = length([for c in local.network_security_group_conflicts : c if contains(c.network_security_group_keys, each.key)]) == 0
+      error_message = join("\n", [for c in local.network_security_group_conflicts : c.message if contains(c.network_security_group_keys, each.key)])
+    }
+  }
+}
+
 # Module to create virtual networks and subnets
 # Useful outputs:
 # - vnet_id - the resource id of vnet
 # - vnet_subnets_name_ids - a map of subnet name to subnet resource id, e.g. use lookup(module.hub_virtual_networks["key"].vnet_subnets_name_id, "subnet1")
 module "hub_virtual_networks" {
-  for_each = var.hub_virtual_networks
+  for_each = local.hub_virtual_networks
   source   = "Azure/subnets/azurerm"
   version  = "1.0.0"
   # ... TODO add required inputs
@@ -42,12 +125,9 @@ module "hub_virtual_networks" {
   virtual_network_location      = each.value.location
   resource_group_name           = try(azurerm_resource_group.rg[each.value.resource_group_name].name, each.value.resource_group_name)
   virtual_network_bgp_community = each.value.bgp_community
-  virtual_network_ddos_protection_plan = each.value.ddos_protection_plan_id == null ? null : {
-    id     = each.value.ddos_protection_plan_id
-    enable = true
-  }
-  virtual_network_dns_servers = each.value.dns_servers == null ? null : {
-    dns_servers = each.value.dns_servers
+  virtual_network_ddos_protection_plan = local.hub_ddos_protection_plans[each.key]
+  virtual_network_dns_servers = local.hub_dns_servers[each.key] == null ? null : {
+    dns_servers = local.hub_dns_servers[each.key]
   }
   virtual_network_flow_timeout_in_minutes = each.value.flow_timeout_in_minutes
   virtual_network_tags                    = each.value.tags
@@ -66,6 +146,19 @@ resource "azurerm_virtual_network_peering" "hub_peering" {
   allow_gateway_transit        = each.value.allow_gateway_transit
   allow_virtual_network_access = each.value.allow_virtual_network_access
   use_remote_gateways          = each.value.use_remote_gateways
+
+  # Gateway transit and remote gateways can only be enabled once the gateway exists
+  depends_on = [
+    azurerm_virtual_network_gateway.vgw,
+    azurerm_route_server.route_server,
+  ]
+
+  lifecycle {
+    precondition {
+      condition     = length([for c in local.peering_conflicts : c if contains(c.peering_names, each.key)]) == 0
+      error_message = join("\n", [for c in local.peering_conflicts : c.message if contains(c.peering_names, each.key)])
+    }
+  }
 }
 
 resource "azurerm_route_table" "hub_routing" {
@@ -74,13 +167,18 @@ resource "azurerm_route_table" "hub_routing" {
   location                      = var.hub_virtual_networks[each.key].location
   name                          = coalesce(var.hub_virtual_networks[each.key].route_table_name, "route-${each.key}")
   resource_group_name           = try(azurerm_resource_group.rg[var.hub_virtual_networks[each.key].resource_group_name].name, var.hub_virtual_networks[each.key].resource_group_name)
-  disable_bgp_route_propagation = false
+  disable_bgp_route_propagation = !each.value.bgp_route_propagation_enabled
   tags                          = var.hub_virtual_networks[each.key].route_table_tags
 
-  route {
-    address_prefix = "0.0.0.0/0"
-    name           = "internet"
-    next_hop_type  = "Internet"
+  dynamic "route" {
+    for_each = toset(each.value.default_routes)
+
+    content {
+      address_prefix         = route.value.address_prefix
+      name                   = route.value.name
+      next_hop_in_ip_address = route.value.next_hop_ip_address
+      next_hop_type          = route.value.next_hop_type
+    }
   }
   dynamic "route" {
     for_each = toset(each.value.mesh_routes)
@@ -102,6 +200,25 @@ resource "azurerm_route_table" "hub_routing" {
       next_hop_type          = route.value.next_hop_type
     }
   }
+
+  lifecycle {
+    precondition {
+      condition     = length([for c in local.cidr_conflicts : c if contains(c.hub_keys, each.key)]) == 0
+      error_message = join("\n", [for c in local.cidr_conflicts : c.message if contains(c.hub_keys, each.key)])
+    }
+    precondition {
+      condition     = length(local.hub_mesh_topology_unknown_keys) == 0
+      error_message = "The hub mesh topology references unknown hub keys: ${join(", ", local.hub_mesh_topology_unknown_keys)}."
+    }
+    precondition {
+      condition     = length([for c in local.virtual_wan_conflicts : c if contains(c.hub_keys, each.key)]) == 0
+      error_message = join("\n", [for c in local.virtual_wan_conflicts : c.message if contains(c.hub_keys, each.key)])
+    }
+    precondition {
+      condition     = length([for c in local.default_route_conflicts : c if contains(c.hub_keys, each.key)]) == 0
+      error_message = join("\n", [for c in local.default_route_conflicts : c.message if contains(c.hub_keys, each.key)])
+    }
+  }
 }
 
 resource "azurerm_subnet_route_table_association" "hub_routing_creat" {
@@ -118,6 +235,104 @@ resource "azurerm_subnet_route_table_association" "hub_routing_external" {
   subnet_id      = each.value.subnet_id
 }
 
+# Spoke virtual networks created by this module, existing spokes are referenced by `virtual_network_id`
+module "spoke_virtual_networks" {
+  for_each = { for k, v in var.spoke_virtual_networks : k => v if v.virtual_network_id == null }
+  source   = "Azure/subnets/azurerm"
+  version  = "1.0.0"
+
+  virtual_network_name          = each.value.name
+  virtual_network_address_space = each.value.address_space
+  virtual_network_location      = local.spokes[each.key].location
+  resource_group_name           = try(azurerm_resource_group.rg[local.spokes[each.key].resource_group_name].name, local.spokes[each.key].resource_group_name)
+  virtual_network_tags          = each.value.tags
+  subnets = {
+    for subnet_name, subnet in each.value.subnets : subnet_name => {
+      address_prefixes                              = subnet.address_prefixes
+      nat_gateway                                   = null
+      network_security_group                        = null
+      private_endpoint_network_policies_enabled     = true
+      private_link_service_network_policies_enabled = true
+      service_endpoints                             = null
+      service_endpoint_policy_ids                   = null
+      delegations                                   = null
+    }
+  }
+}
+
+resource "azurerm_virtual_network_peering" "spoke_peering" {
+  for_each = local.spoke_peering_map
+
+  name                         = each.key
+  remote_virtual_network_id    = each.value.remote_virtual_network_id
+  resource_group_name          = try(azurerm_resource_group.rg[each.value.resource_group_name].name, each.value.resource_group_name)
+  virtual_network_name         = each.value.virtual_network_name
+  allow_forwarded_traffic      = each.value.allow_forwarded_traffic
+  allow_gateway_transit        = each.value.allow_gateway_transit
+  allow_virtual_network_access = each.value.allow_virtual_network_access
+  use_remote_gateways          = each.value.use_remote_gateways
+
+  depends_on = [
+    azurerm_virtual_network_gateway.vgw,
+    azurerm_route_server.route_server,
+  ]
+
+  lifecycle {
+    precondition {
+      condition     = !each.value.use_remote_gateways || local.hub_gateway_enabled[each.value.hub_key]
+      error_message = "Spoke ${each.value.spoke_key} sets use_remote_gateways but hub ${each.value.hub_key} has no gateway."
+    }
+  }
+}
+
+resource "azurerm_route_table" "spoke_routing" {
+  for_each = local.spoke_route_map
+
+  location                      = local.spokes[each.key].location
+  name                          = coalesce(var.spoke_virtual_networks[each.key].route_table_name, "route-spoke-${each.key}")
+  resource_group_name           = try(azurerm_resource_group.rg[local.spokes[each.key].resource_group_name].name, local.spokes[each.key].resource_group_name)
+  disable_bgp_route_propagation = !local.spokes[each.key].bgp_route_propagation_enabled
+  tags                          = var.spoke_virtual_networks[each.key].tags
+
+  dynamic "route" {
+    for_each = toset(each.value)
+
+    content {
+      address_prefix         = route.value.address_prefix
+      name                   = route.value.name
+      next_hop_in_ip_address = route.value.next_hop_ip_address
+      next_hop_type          = route.value.next_hop_type
+    }
+  }
+
+  lifecycle {
+    precondition {
+      condition     = var.hub_virtual_networks[local.spokes[each.key].hub_key].firewall != null || var.hub_virtual_networks[local.spokes[each.key].hub_key].hub_router_ip_address != null
+      error_message = "Spoke ${each.key} is attached to hub ${local.spokes[each.key].hub_key} which has neither a firewall nor a hub_router_ip_address to route to."
+    }
+  }
+}
+
+resource "azurerm_subnet_route_table_association" "spoke_routing" {
+  for_each = local.spoke_subnet_route_table_association_map
+
+  route_table_id = each.value.route_table_id
+  subnet_id      = each.value.subnet_id
+}
+
+resource "azurerm_public_ip_prefix" "fw_public_ip_prefix" {
+  for_each = local.fw_public_ip_prefix
+
+  location            = each.value.location
+  name                = each.value.name
+  resource_group_name = each.value.resource_group_name
+  ip_version          = each.value.ip_version
+  prefix_length       = each.value.prefix_length
+  sku                 = "Standard"
+  tags                = each.value.tags
+  zones               = each.value.zones
+}
+
 resource "azurerm_public_ip" "fw_default_ip_configuration_pip" {
   for_each = local.fw_default_ip_configuration_pip
 
@@ -126,6 +341,22 @@ resource "azurerm_public_ip" "fw_default_ip_configuration_pip" {
   name                = each.value.name
   resource_group_name = each.value.resource_group_name
   ip_version          = each.value.ip_version
+  public_ip_prefix_id = each.value.public_ip_prefix_key == null ? each.value.public_ip_prefix_id : azurerm_public_ip_prefix.fw_public_ip_prefix[each.value.public_ip_prefix_key].id
+  sku                 = "Standard"
+  sku_tier            = each.value.sku_tier
+  tags                = each.value.tags
+  zones               = each.value.zones
+}
+
+resource "azurerm_public_ip" "fw_ip_configuration_pip" {
+  for_each = local.fw_ip_configuration_pip
+
+  allocation_method   = "Static"
+  location            = each.value.location
+  name                = each.value.name
+  resource_group_name = each.value.resource_group_name
+  ip_version          = each.value.ip_version
+  public_ip_prefix_id = each.value.public_ip_prefix_key == null ? each.value.public_ip_prefix_id : azurerm_public_ip_prefix.fw_public_ip_prefix[each.value.public_ip_prefix_key].id
   sku                 = "Standard"
   sku_tier            = each.value.sku_tier
   tags                = each.value.tags
@@ -168,10 +399,31 @@ resource "azurerm_subnet" "fw_management_subnet" {
   ]
 }
 
+resource "azurerm_route_table" "firewall_routing" {
+  for_each = local.firewall_route_tables
+
+  location                      = each.value.location
+  name                          = each.value.name
+  resource_group_name           = try(azurerm_resource_group.rg[each.value.resource_group_name].name, each.value.resource_group_name)
+  disable_bgp_route_propagation = !each.value.bgp_route_propagation_enabled
+  tags                          = each.value.tags
+
+  dynamic "route" {
+    for_each = toset(each.value.routes)
+
+    content {
+      address_prefix         = route.value.address_prefix
+      name                   = route.value.name
+      next_hop_in_ip_address = route.value.next_hop_ip_address
+      next_hop_type          = route.value.next_hop_type
+    }
+  }
+}
+
 resource "azurerm_subnet_route_table_association" "fw_subnet_routing_creat" {
-  for_each = { for vnet_name, fw in local.firewalls : vnet_name => fw if fw.subnet_route_table_id == null }
+  for_each = local.firewall_route_tables
 
-  route_table_id = azurerm_route_table.hub_routing[each.key].id
+  route_table_id = azurerm_route_table.firewall_routing[each.key].id
   subnet_id      = azurerm_subnet.fw_subnet[each.key].id
 }
 
@@ -202,6 +454,15 @@ resource "azurerm_firewall" "fw" {
     public_ip_address_id = azurerm_public_ip.fw_default_ip_configuration_pip[each.key].id
     subnet_id            = azurerm_subnet.fw_subnet[each.key].id
   }
+  # Only the first ip configuration is bound to the AzureFirewallSubnet
+  dynamic "ip_configuration" {
+    for_each = each.value.ip_configurations
+
+    content {
+      name                 = ip_configuration.value.name
+      public_ip_address_id = azurerm_public_ip.fw_ip_configuration_pip["${each.key}-${ip_configuration.value.name}"].id
+    }
+  }
 
   dynamic "management_ip_configuration" {
     for_each = each.value.sku_tier == "Basic" ? ["managementIpConfiguration"] : []
@@ -212,4 +473,545 @@ resource "azurerm_firewall" "fw" {
       subnet_id            = azurerm_subnet.fw_management_subnet[each.key].id
     }
   }
+
+  # Updating a policy while the firewall is created fails, so the rules go first
+  depends_on = [
+    azurerm_firewall_policy_rule_collection_group.rcg,
+  ]
+}
+
+module "firewall_policy" {
+  for_each = { for k, p in local.firewall_policies : k => p if p.base_policy_key == null }
+  source   = "./modules/firewall_policy"
+
+  firewall_policy = merge(each.value, { resource_group_name = try(azurerm_resource_group.rg[each.value.resource_group_name].name, each.value.resource_group_name) })
+  conflicts       = [for c in local.firewall_policy_conflicts : c.message if contains(c.policy_keys, each.key)]
+}
+
+# A policy cannot reference another instance of its own resource, so the policies inheriting from a parent are created apart
+module "inherited_firewall_policy" {
+  for_each = { for k, p in local.firewall_policies : k => p if p.base_policy_key != null }
+  source   = "./modules/firewall_policy"
+
+  firewall_policy = merge(each.value, { resource_group_name = try(azurerm_resource_group.rg[each.value.resource_group_name].name, each.value.resource_group_name) })
+  base_policy_id  = module.firewall_policy[each.value.base_policy_key].id
+  conflicts       = [for c in local.firewall_policy_conflicts : c.message if contains(c.policy_keys, each.key)]
+}
+
+resource "azurerm_firewall_policy_rule_collection_group" "rcg" {
+  for_each = local.firewall_policy_rule_collection_groups
+
+  firewall_policy_id = local.firewall_policy_ids[each.value.policy_key]
+  name               = each.value.name
+  priority           = each.value.priority
+
+  dynamic "network_rule_collection" {
+    for_each = each.value.network_rule_collections
+
+    content {
+      action   = network_rule_collection.value.action
+      name     = network_rule_collection.value.name
+      priority = network_rule_collection.value.priority
+
+      dynamic "rule" {
+        for_each = network_rule_collection.value.rules
+
+        content {
+          destination_ports     = rule.value.destination_ports
+          name                  = rule.value.name
+          protocols             = rule.value.protocols
+          destination_addresses = rule.value.destination_addresses
+          destination_fqdns     = rule.value.destination_fqdns
+          destination_ip_groups = rule.value.destination_ip_groups
+          source_addresses      = rule.value.source_addresses
+          source_ip_groups      = rule.value.source_ip_groups
+        }
+      }
+    }
+  }
+  dynamic "application_rule_collection" {
+    for_each = each.value.application_rule_collections
+
+    content {
+      action   = application_rule_collection.value.action
+      name     = application_rule_collection.value.name
+      priority = application_rule_collection.value.priority
+
+      dynamic "rule" {
+        for_each = application_rule_collection.value.rules
+
+        content {
+          name                  = rule.value.name
+          destination_addresses = rule.value.destination_addresses
+          destination_fqdn_tags = rule.value.destination_fqdn_tags
+          destination_fqdns     = rule.value.destination_fqdns
+          destination_urls      = rule.value.destination_urls
+          source_addresses      = rule.value.source_addresses
+          source_ip_groups      = rule.value.source_ip_groups
+          terminate_tls         = rule.value.terminate_tls
+          web_categories        = rule.value.web_categories
+
+          dynamic "protocols" {
+            for_each = rule.value.protocols == null ? [] : rule.value.protocols
+
+            content {
+              port = protocols.value.port
+              type = protocols.value.type
+            }
+          }
+        }
+      }
+    }
+  }
+  dynamic "nat_rule_collection" {
+    for_each = each.value.nat_rule_collections
+
+    content {
+      action   = nat_rule_collection.value.action
+      name     = nat_rule_collection.value.name
+      priority = nat_rule_collection.value.priority
+
+      dynamic "rule" {
+        for_each = nat_rule_collection.value.rules
+
+        content {
+          name                = rule.value.name
+          protocols           = rule.value.protocols
+          translated_port     = rule.value.translated_port
+          destination_address = rule.value.destination_address
+          destination_ports   = rule.value.destination_ports
+          source_addresses    = rule.value.source_addresses
+          source_ip_groups    = rule.value.source_ip_groups
+          translated_address  = rule.value.translated_address
+          translated_fqdn     = rule.value.translated_fqdn
+        }
+      }
+    }
+  }
+}
+
+resource "azurerm_subnet" "gateway_subnet" {
+  for_each = local.virtual_network_gateways
+
+  address_prefixes     = [var.hub_virtual_networks[each.key].virtual_network_gateway.subnet_address_prefix]
+  name                 = "GatewaySubnet"
+  resource_group_name  = var.hub_virtual_networks[each.key].resource_group_name
+  virtual_network_name = module.hub_virtual_networks[each.key].vnet_name
+}
+
+resource "azurerm_public_ip" "vgw_pip" {
+  for_each = local.virtual_network_gateway_public_ips
+
+  allocation_method   = "Static"
+  location            = each.value.location
+  name                = each.value.name
+  resource_group_name = each.value.resource_group_name
+  sku                 = "Standard"
+  tags                = each.value.tags
+  zones               = each.value.zones
+}
+
+resource "azurerm_virtual_network_gateway" "vgw" {
+  for_each = local.virtual_network_gateways
+
+  location            = each.value.location
+  name                = each.value.name
+  resource_group_name = each.value.resource_group_name
+  sku                 = each.value.sku
+  type                = each.value.type
+  active_active       = each.value.active_active
+  enable_bgp          = each.value.enable_bgp
+  generation          = each.value.generation
+  tags                = each.value.tags
+  vpn_type            = each.value.vpn_type
+
+  dynamic "ip_configuration" {
+    for_each = each.value.ip_configurations
+
+    content {
+      public_ip_address_id          = ip_configuration.value.public_ip_address_id
+      subnet_id                     = ip_configuration.value.subnet_id
+      name                          = ip_configuration.value.name
+      private_ip_address_allocation = "Dynamic"
+    }
+  }
+  dynamic "bgp_settings" {
+    for_each = each.value.bgp_settings == null ? [] : ["bgpSettings"]
+
+    content {
+      asn         = each.value.bgp_settings.asn
+      peer_weight = each.value.bgp_settings.peer_weight
+    }
+  }
+}
+
+resource "azurerm_subnet" "bastion_subnet" {
+  for_each = { for k, v in local.bastions : k => v if v.subnet_address_prefix != null }
+
+  address_prefixes     = [each.value.subnet_address_prefix]
+  name                 = "AzureBastionSubnet"
+  resource_group_name  = var.hub_virtual_networks[each.key].resource_group_name
+  virtual_network_name = module.hub_virtual_networks[each.key].vnet_name
+}
+
+resource "azurerm_public_ip" "bastion_pip" {
+  for_each = local.bastion_pip
+
+  allocation_method   = "Static"
+  location            = each.value.location
+  name                = each.value.name
+  resource_group_name = each.value.resource_group_name
+  sku                 = "Standard"
+  tags                = each.value.tags
+  zones               = each.value.zones
+}
+
+resource "azurerm_bastion_host" "bastion" {
+  for_each = local.bastions
+
+  location               = each.value.location
+  name                   = each.value.name
+  resource_group_name    = each.value.resource_group_name
+  copy_paste_enabled     = each.value.copy_paste_enabled
+  file_copy_enabled      = each.value.file_copy_enabled
+  ip_connect_enabled     = each.value.ip_connect_enabled
+  scale_units            = each.value.scale_units
+  shareable_link_enabled = each.value.shareable_link_enabled
+  sku                    = each.value.sku
+  tags                   = each.value.tags
+  tunneling_enabled      = each.value.tunneling_enabled
+
+  ip_configuration {
+    name                 = "default"
+    public_ip_address_id = azurerm_public_ip.bastion_pip[each.key].id
+    subnet_id            = try(azurerm_subnet.bastion_subnet[each.key].id, lookup(module.hub_virtual_networks[each.key].vnet_subnets_name_id, "AzureBastionSubnet"))
+  }
+}
+
+resource "azurerm_subnet" "route_server_subnet" {
+  for_each = local.route_servers
+
+  address_prefixes     = [var.hub_virtual_networks[each.key].route_server.subnet_address_prefix]
+  name                 = "RouteServerSubnet"
+  resource_group_name  = var.hub_virtual_networks[each.key].resource_group_name
+  virtual_network_name = module.hub_virtual_networks[each.key].vnet_name
+}
+
+resource "azurerm_public_ip" "route_server_pip" {
+  for_each = local.route_server_pip
+
+  allocation_method   = "Static"
+  location            = each.value.location
+  name                = each.value.name
+  resource_group_name = each.value.resource_group_name
+  sku                 = "Standard"
+  tags                = each.value.tags
+  zones               = each.value.zones
+}
+
+resource "azurerm_route_server" "route_server" {
+  for_each = local.route_servers
+
+  location                         = each.value.location
+  name                             = each.value.name
+  public_ip_address_id             = azurerm_public_ip.route_server_pip[each.key].id
+  resource_group_name              = each.value.resource_group_name
+  sku                              = "Standard"
+  subnet_id                        = azurerm_subnet.route_server_subnet[each.key].id
+  branch_to_branch_traffic_enabled = each.value.branch_to_branch_traffic_enabled
+  tags                             = each.value.tags
+}
+
+resource "azurerm_route_server_bgp_connection" "route_server" {
+  for_each = local.route_server_bgp_connections
+
+  name            = each.value.name
+  peer_asn        = each.value.peer_asn
+  peer_ip         = each.value.peer_ip
+  route_server_id = azurerm_route_server.route_server[each.value.hub_key].id
+}
+
+resource "azurerm_subnet" "dns_resolver_inbound_subnet" {
+  for_each = local.dns_resolvers
+
+  address_prefixes     = [each.value.inbound_subnet_address_prefix]
+  name                 = "DnsResolverInboundSubnet"
+  resource_group_name  = each.value.resource_group_name
+  virtual_network_name = module.hub_virtual_networks[each.key].vnet_name
+
+  delegation {
+    name = "Microsoft.Network.dnsResolvers"
+
+    service_delegation {
+      name    = "Microsoft.Network/dnsResolvers"
+      actions = ["Microsoft.Network/virtualNetworks/subnets/join/action"]
+    }
+  }
+}
+
+resource "azurerm_subnet" "dns_resolver_outbound_subnet" {
+  for_each = { for k, v in local.dns_resolvers : k => v if v.outbound_subnet_address_prefix != null }
+
+  address_prefixes     = [each.value.outbound_subnet_address_prefix]
+  name                 = "DnsResolverOutboundSubnet"
+  resource_group_name  = each.value.resource_group_name
+  virtual_network_name = module.hub_virtual_networks[each.key].vnet_name
+
+  delegation {
+    name = "Microsoft.Network.dnsResolvers"
+
+    service_delegation {
+      name    = "Microsoft.Network/dnsResolvers"
+      actions = ["Microsoft.Network/virtualNetworks/subnets/join/action"]
+    }
+  }
+}
+
+resource "azurerm_private_dns_resolver" "dns_resolver" {
+  for_each = local.dns_resolvers
+
+  location            = each.value.location
+  name                = each.value.name
+  resource_group_name = each.value.resource_group_name
+  virtual_network_id  = module.hub_virtual_networks[each.key].vnet_id
+  tags                = each.value.tags
+}
+
+resource "azurerm_private_dns_resolver_inbound_endpoint" "dns_resolver" {
+  for_each = local.dns_resolvers
+
+  location                = each.value.location
+  name                    = "in-${each.value.name}"
+  private_dns_resolver_id = azurerm_private_dns_resolver.dns_resolver[each.key].id
+  tags                    = each.value.tags
+
+  ip_configurations {
+    subnet_id                    = azurerm_subnet.dns_resolver_inbound_subnet[each.key].id
+    private_ip_address           = each.value.inbound_endpoint_ip_address
+    private_ip_allocation_method = "Static"
+  }
+}
+
+resource "azurerm_private_dns_resolver_outbound_endpoint" "dns_resolver" {
+  for_each = azurerm_subnet.dns_resolver_outbound_subnet
+
+  location                = local.dns_resolvers[each.key].location
+  name                    = "out-${local.dns_resolvers[each.key].name}"
+  private_dns_resolver_id = azurerm_private_dns_resolver.dns_resolver[each.key].id
+  subnet_id               = each.value.id
+  tags                    = local.dns_resolvers[each.key].tags
+}
+
+resource "azurerm_private_dns_resolver_dns_forwarding_ruleset" "dns_resolver" {
+  for_each = azurerm_private_dns_resolver_outbound_endpoint.dns_resolver
+
+  location                                   = local.dns_resolvers[each.key].location
+  name                                       = local.dns_resolvers[each.key].forwarding_ruleset_name
+  private_dns_resolver_outbound_endpoint_ids = [each.value.id]
+  resource_group_name                        = local.dns_resolvers[each.key].resource_group_name
+  tags                                       = local.dns_resolvers[each.key].tags
+}
+
+resource "azurerm_private_dns_resolver_forwarding_rule" "dns_resolver" {
+  for_each = local.dns_forwarding_rules
+
+  dns_forwarding_ruleset_id = azurerm_private_dns_resolver_dns_forwarding_ruleset.dns_resolver[each.value.hub_key].id
+  domain_name               = each.value.domain_name
+  name                      = each.value.name
+  enabled                   = each.value.enabled
+
+  dynamic "target_dns_servers" {
+    for_each = each.value.target_dns_servers
+
+    content {
+      ip_address = target_dns_servers.value.ip_address
+      port       = target_dns_servers.value.port
+    }
+  }
+}
+
+# The ruleset applies to the queries of the hub, including those received by the inbound endpoint of the resolver
+resource "azurerm_private_dns_resolver_virtual_network_link" "dns_resolver" {
+  for_each = azurerm_private_dns_resolver_dns_forwarding_ruleset.dns_resolver
+
+  dns_forwarding_ruleset_id = each.value.id
+  name                      = "link-${each.key}"
+  virtual_network_id        = module.hub_virtual_networks[each.key].vnet_id
+}
+
+resource "azurerm_private_dns_zone" "private_dns_zone" {
+  for_each = local.private_dns_zones
+
+  name                = each.value.name
+  resource_group_name = try(azurerm_resource_group.rg[each.value.resource_group_name].name, each.value.resource_group_name)
+  tags                = each.value.tags
+}
+
+resource "azurerm_private_dns_zone_virtual_network_link" "private_dns_zone" {
+  for_each = local.private_dns_zone_virtual_network_links
+
+  name                  = each.value.name
+  private_dns_zone_name = azurerm_private_dns_zone.private_dns_zone[each.value.private_dns_zone_name].name
+  resource_group_name   = azurerm_private_dns_zone.private_dns_zone[each.value.private_dns_zone_name].resource_group_name
+  virtual_network_id    = each.value.virtual_network_id
+  tags                  = var.private_dns_zones.tags
+}
+
+resource "azurerm_monitor_diagnostic_setting" "diagnostic_setting" {
+  for_each = local.diagnostic_settings
+
+  name                           = each.value.name
+  target_resource_id             = local.diagnostic_setting_target_resource_ids[each.key]
+  eventhub_authorization_rule_id = each.value.eventhub_authorization_rule_id
+  eventhub_name                  = each.value.eventhub_name
+  log_analytics_destination_type = each.value.log_analytics_destination_type
+  log_analytics_workspace_id     = each.value.log_analytics_workspace_id
+  storage_account_id             = each.value.storage_account_id
+
+  dynamic "enabled_log" {
+    for_each = toset(each.value.log_category_groups)
+
+    content {
+      category_group = enabled_log.value
+    }
+  }
+  dynamic "enabled_log" {
+    for_each = toset(each.value.log_categories)
+
+    content {
+      category = enabled_log.value
+    }
+  }
+  metric {
+    category = "AllMetrics"
+    enabled  = each.value.metrics_enabled
+  }
+
+  lifecycle {
+    precondition {
+      condition     = length([for c in local.diagnostic_setting_conflicts : c if contains(c.hub_keys, each.value.hub_key)]) == 0
+      error_message = join("\n", [for c in local.diagnostic_setting_conflicts : c.message if contains(c.hub_keys, each.value.hub_key)])
+    }
+  }
+}
+
+resource "azurerm_network_watcher_flow_log" "flow_log" {
+  for_each = local.flow_logs
+
+  name                 = each.value.name
+  network_watcher_name = each.value.network_watcher_name
+  resource_group_name  = each.value.network_watcher_resource_group_name
+  storage_account_id   = each.value.storage_account_id
+  enabled              = each.value.enabled
+  location             = each.value.location
+  tags                 = each.value.tags
+  target_resource_id   = module.hub_virtual_networks[each.key].vnet_id
+  version              = 2
+
+  retention_policy {
+    days    = each.value.retention_days
+    enabled = each.value.retention_days > 0
+  }
+  dynamic "traffic_analytics" {
+    for_each = each.value.traffic_analytics == null ? [] : [each.value.traffic_analytics]
+
+    content {
+      enabled               = true
+      workspace_id          = traffic_analytics.value.workspace_id
+      workspace_region      = traffic_analytics.value.workspace_region
+      workspace_resource_id = traffic_analytics.value.workspace_resource_id
+      interval_in_minutes   = traffic_analytics.value.interval_in_minutes
+    }
+  }
+}
+
+resource "azurerm_virtual_wan" "virtual_wan" {
+  count = local.virtual_wan_enabled ? 1 : 0
+
+  location                       = var.virtual_wan.location
+  name                           = var.virtual_wan.name
+  resource_group_name            = try(azurerm_resource_group.rg[var.virtual_wan.resource_group_name].name, var.virtual_wan.resource_group_name)
+  allow_branch_to_branch_traffic = var.virtual_wan.allow_branch_to_branch_traffic
+  disable_vpn_encryption         = var.virtual_wan.disable_vpn_encryption
+  tags                           = var.virtual_wan.tags
+  type                           = var.virtual_wan.type
+}
+
+resource "azurerm_virtual_hub" "hub" {
+  for_each = local.virtual_hubs
+
+  location               = each.value.location
+  name                   = each.value.name
+  resource_group_name    = try(azurerm_resource_group.rg[each.value.resource_group_name].name, each.value.resource_group_name)
+  address_prefix         = each.value.address_prefix
+  hub_routing_preference = each.value.hub_routing_preference
+  sku                    = each.value.sku
+  tags                   = each.value.tags
+  virtual_wan_id         = azurerm_virtual_wan.virtual_wan[0].id
+
+  lifecycle {
+    precondition {
+      condition     = length([for c in local.cidr_conflicts : c if contains(c.hub_keys, each.key)]) == 0
+      error_message = join("\n", [for c in local.cidr_conflicts : c.message if contains(c.hub_keys, each.key)])
+    }
+    precondition {
+      condition     = length([for c in local.virtual_wan_conflicts : c if contains(c.hub_keys, each.key)]) == 0
+      error_message = join("\n", [for c in local.virtual_wan_conflicts : c.message if contains(c.hub_keys, each.key)])
+    }
+  }
+}
+
+resource "azurerm_firewall" "virtual_hub" {
+  for_each = local.virtual_hub_firewalls
+
+  location            = each.value.location
+  name                = each.value.name
+  resource_group_name = try(azurerm_resource_group.rg[each.value.resource_group_name].name, each.value.resource_group_name)
+  sku_name            = each.value.sku_name
+  sku_tier            = each.value.sku_tier
+  firewall_policy_id  = each.value.firewall_policy_id
+  tags                = each.value.tags
+  # A secured hub firewall takes its threat intelligence mode from its policy
+  threat_intel_mode = ""
+  zones             = each.value.zones
+
+  virtual_hub {
+    virtual_hub_id  = azurerm_virtual_hub.hub[each.key].id
+    public_ip_count = each.value.public_ip_count
+  }
+
+  depends_on = [
+    azurerm_firewall_policy_rule_collection_group.rcg,
+  ]
+}
+
+resource "azurerm_virtual_hub_routing_intent" "hub" {
+  for_each = local.virtual_hub_routing_intents
+
+  name           = each.value.name
+  virtual_hub_id = azurerm_virtual_hub.hub[each.key].id
+
+  dynamic "routing_policy" {
+    for_each = each.value.routing_policies
+
+    content {
+      destinations = routing_policy.value.destinations
+      name         = routing_policy.value.name
+      next_hop     = azurerm_firewall.virtual_hub[each.key].id
+    }
+  }
+}
+
+resource "azurerm_virtual_hub_connection" "spoke" {
+  for_each = local.virtual_hub_connections
+
+  name                      = each.value.name
+  remote_virtual_network_id = each.value.remote_virtual_network_id
+  virtual_hub_id            = azurerm_virtual_hub.hub[each.value.hub_key].id
+  internet_security_enabled = each.value.internet_security_enabled
+
+  # Routing intent manages the routing of the connections once it exists
+  depends_on = [
+    azurerm_virtual_hub_routing_intent.hub
+  ]
 }
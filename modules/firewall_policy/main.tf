@@ -0,0 +1,77 @@
+resource "azurerm_firewall_policy" "this" {
+  location                 = var.firewall_policy.location
+  name                     = var.firewall_policy.name
+  resource_group_name      = var.firewall_policy.resource_group_name
+  base_policy_id           = var.base_policy_id
+  sku                      = var.firewall_policy.sku
+  tags                     = var.firewall_policy.tags
+  threat_intelligence_mode = var.firewall_policy.threat_intelligence_mode
+
+  dynamic "dns" {
+    for_each = var.firewall_policy.dns == null ? [] : ["dns"]
+
+    content {
+      proxy_enabled = var.firewall_policy.dns.proxy_enabled
+      servers       = var.firewall_policy.dns.servers
+    }
+  }
+  dynamic "identity" {
+    for_each = var.firewall_policy.identity == null ? [] : ["identity"]
+
+    content {
+      type         = "UserAssigned"
+      identity_ids = var.firewall_policy.identity.identity_ids
+    }
+  }
+  dynamic "intrusion_detection" {
+    for_each = var.firewall_policy.intrusion_detection == null ? [] : ["intrusionDetection"]
+
+    content {
+      mode           = var.firewall_policy.intrusion_detection.mode
+      private_ranges = var.firewall_policy.intrusion_detection.private_ranges
+
+      dynamic "signature_overrides" {
+        for_each = var.firewall_policy.intrusion_detection.signature_overrides
+
+        content {
+          id    = signature_overrides.value.id
+          state = signature_overrides.value.state
+        }
+      }
+      dynamic "traffic_bypass" {
+        for_each = var.firewall_policy.intrusion_detection.traffic_bypass
+
+        content {
+          name                  = traffic_bypass.value.name
+          protocol              = traffic_bypass.value.protocol
+          description           = traffic_bypass.value.description
+          destination_addresses = traffic_bypass.value.destination_addresses
+          destination_ports     = traffic_bypass.value.destination_ports
+          source_addresses      = traffic_bypass.value.source_addresses
+        }
+      }
+    }
+  }
+  dynamic "threat_intelligence_allowlist" {
+    for_each = var.firewall_policy.threat_intelligence_allowlist == null ? [] : ["threatIntelligenceAllowlist"]
+
+    content {
+      fqdns        = var.firewall_policy.threat_intelligence_allowlist.fqdns
+      ip_addresses = var.firewall_policy.threat_intelligence_allowlist.ip_addresses
+    }
+  }
+  dynamic "tls_certificate" {
+    for_each = var.firewall_policy.tls_certificate == null ? [] : ["tlsCertificate"]
+
+    content {
+      key_vault_secret_id = var.firewall_policy.tls_certificate.key_vault_secret_id
+      name                = var.firewall_policy.tls_certificate.name
+    }
+  }
+  lifecycle {
+    precondition {
+      condition     = length(var.conflicts) == 0
+      error_message = join("\n", var.conflicts)
+    }
+  }
+}
@@ -0,0 +1,14 @@
+output "base_policy_id" {
+  value       = azurerm_firewall_policy.this.base_policy_id
+  description = "The resource id of the parent policy, if any."
+}
+
+output "id" {
+  value       = azurerm_firewall_policy.this.id
+  description = "The resource id of the policy."
+}
+
+output "name" {
+  value       = azurerm_firewall_policy.this.name
+  description = "The name of the policy."
+}
@@ -0,0 +1,18 @@
+variable "firewall_policy" {
+  type        = any
+  description = "A value of `local.firewall_policies` of the root module, the settings of the policy with their defaults resolved."
+  nullable    = false
+}
+
+variable "base_policy_id" {
+  type        = string
+  default     = null
+  description = "The resource id of the parent policy to inherit from, if any."
+}
+
+variable "conflicts" {
+  type        = list(string)
+  default     = []
+  description = "The messages of the `local.firewall_policy_conflicts` of the root module about this policy, any of which fails the plan."
+  nullable    = false
+}
@@ -1,16 +1,79 @@
-output "firewalls" {
+output "bastion_hosts" {
+  value = {
+    for vnet_name, bastion in azurerm_bastion_host.bastion : vnet_name => {
+      id                = bastion.id
+      name              = bastion.name
+      dns_name          = bastion.dns_name
+      sku               = bastion.sku
+      public_ip_address = azurerm_public_ip.bastion_pip[vnet_name].ip_address
+    }
+  }
+  description = "A curated output of the Bastion hosts created by this module."
+}
+
+output "ddos_protection_plan" {
+  value = var.ddos_protection_plan == null ? null : {
+    id       = azurerm_network_ddos_protection_plan.ddos_protection_plan[0].id
+    name     = azurerm_network_ddos_protection_plan.ddos_protection_plan[0].name
+    hub_keys = local.ddos_protection_plan_hub_keys
+  }
+  description = "The DDoS Protection Plan created by this module with `ddos_protection_plan`, its ID and the keys of the hubs it is attached to."
+}
+
+output "dns_resolvers" {
   value = {
-    for vnet_name, fw in azurerm_firewall.fw : vnet_name => {
-      id                           = fw.id
-      name                         = fw.name
-      private_ip_address           = try(fw.ip_configuration[0].private_ip_address, null)
-      public_ip_address            = try(azurerm_public_ip.fw_default_ip_configuration_pip[vnet_name].ip_address)
-      management_public_ip_address = try(azurerm_public_ip.fw_management_ip_configuration_pip[vnet_name].ip_address, null)
+    for vnet_name, resolver in azurerm_private_dns_resolver.dns_resolver : vnet_name => {
+      id                          = resolver.id
+      name                        = resolver.name
+      inbound_endpoint_id         = azurerm_private_dns_resolver_inbound_endpoint.dns_resolver[vnet_name].id
+      inbound_endpoint_ip_address = local.dns_resolvers[vnet_name].inbound_endpoint_ip_address
+      outbound_endpoint_id        = try(azurerm_private_dns_resolver_outbound_endpoint.dns_resolver[vnet_name].id, null)
+      forwarding_ruleset_id       = try(azurerm_private_dns_resolver_dns_forwarding_ruleset.dns_resolver[vnet_name].id, null)
     }
   }
+  description = "A curated output of the DNS Private Resolvers created by this module."
+}
+
+output "firewalls" {
+  value = merge(
+    {
+      for vnet_name, fw in azurerm_firewall.fw : vnet_name => {
+        id                           = fw.id
+        name                         = fw.name
+        private_ip_address           = try(fw.ip_configuration[0].private_ip_address, null)
+        public_ip_address            = local.firewall_public_ips[vnet_name].public_ip_addresses[0]
+        public_ip_addresses          = local.firewall_public_ips[vnet_name].public_ip_addresses
+        public_ip_prefix_id          = local.firewall_public_ips[vnet_name].public_ip_prefix_id
+        management_public_ip_address = try(azurerm_public_ip.fw_management_ip_configuration_pip[vnet_name].ip_address, null)
+      }
+    },
+    {
+      for vnet_name, fw in azurerm_firewall.virtual_hub : vnet_name => {
+        id                           = fw.id
+        name                         = fw.name
+        private_ip_address           = try(fw.virtual_hub[0].private_ip_address, null)
+        public_ip_address            = try(fw.virtual_hub[0].public_ip_addresses[0], null)
+        public_ip_addresses          = try(fw.virtual_hub[0].public_ip_addresses, [])
+        public_ip_prefix_id          = null
+        management_public_ip_address = null
+      }
+    },
+  )
   description = "A curated output of the firewalls created by this module."
 }
 
+output "firewall_policies" {
+  value = {
+    for k, policy in merge(module.firewall_policy, module.inherited_firewall_policy) : k => {
+      id                     = policy.id
+      name                   = policy.name
+      base_policy_id         = policy.base_policy_id
+      rule_collection_groups = { for g in values(local.firewall_policy_rule_collection_groups) : g.name => azurerm_firewall_policy_rule_collection_group.rcg[g.key].id if g.policy_key == k }
+    }
+  }
+  description = "A curated output of the firewall policies created by this module, keyed like `firewall_policies`."
+}
+
 output "hub_route_tables" {
   value = {
     for vnet_name, rt in azurerm_route_table.hub_routing : vnet_name => {
@@ -24,9 +87,45 @@ output "hub_route_tables" {
           next_hop_in_ip_address = r.next_hop_in_ip_address
         }
       ]
+      firewall_subnet_route_table = try({
+        name = azurerm_route_table.firewall_routing[vnet_name].name
+        id   = azurerm_route_table.firewall_routing[vnet_name].id
+        routes = [
+          for r in azurerm_route_table.firewall_routing[vnet_name].route : {
+            name                   = r.name
+            address_prefix         = r.address_prefix
+            next_hop_type          = r.next_hop_type
+            next_hop_in_ip_address = r.next_hop_in_ip_address
+          }
+        ]
+      }, null)
+    }
+  }
+  description = "A curated output of the route tables created by this module, the route table of the workload subnets of each hub and the route table of its firewall subnet, if any."
+}
+
+output "network_security_groups" {
+  value = {
+    for k, nsg in azurerm_network_security_group.nsg : k => {
+      id          = nsg.id
+      name        = nsg.name
+      hub_key     = local.network_security_groups[k].hub_key
+      subnet_name = local.network_security_groups[k].subnet_name
     }
   }
-  description = "A curated output of the route tables created by this module."
+  description = "A curated output of the network security groups created by this module for the hub subnets, keyed by `{vnetname}-{subnetname}`."
+}
+
+output "private_dns_zones" {
+  value = {
+    for zone_name, zone in azurerm_private_dns_zone.private_dns_zone : zone_name => {
+      id                       = zone.id
+      name                     = zone.name
+      resource_group_name      = zone.resource_group_name
+      virtual_network_link_ids = { for k, link in azurerm_private_dns_zone_virtual_network_link.private_dns_zone : link.name => link.id if local.private_dns_zone_virtual_network_links[k].private_dns_zone_name == zone_name }
+    }
+  }
+  description = "A curated output of the private DNS zones created by this module, keyed by zone name."
 }
 
 output "resource_groups" {
@@ -40,6 +139,62 @@ output "resource_groups" {
   description = "A curated output of the resource groups created by this module."
 }
 
+output "route_servers" {
+  value = {
+    for vnet_name, rs in azurerm_route_server.route_server : vnet_name => {
+      id                 = rs.id
+      name               = rs.name
+      virtual_router_asn = rs.virtual_router_asn
+      virtual_router_ips = rs.virtual_router_ips
+      bgp_connections    = { for c in values(local.route_server_bgp_connections) : c.name => azurerm_route_server_bgp_connection.route_server[c.key].id if c.hub_key == vnet_name }
+    }
+  }
+  description = "A curated output of the Route Servers created by this module."
+}
+
+output "spoke_virtual_networks" {
+  value = {
+    for spoke_key, spoke in local.spokes : spoke_key => {
+      name                = spoke.name
+      resource_group_name = spoke.resource_group_name
+      id                  = try(module.spoke_virtual_networks[spoke_key].vnet_id, var.spoke_virtual_networks[spoke_key].virtual_network_id)
+      hub_key             = spoke.hub_key
+      subnets_name_id     = try(module.spoke_virtual_networks[spoke_key].vnet_subnets_name_id, { for subnet_name in keys(var.spoke_virtual_networks[spoke_key].subnets) : subnet_name => "${var.spoke_virtual_networks[spoke_key].virtual_network_id}/subnets/${subnet_name}" })
+      route_table_id      = try(azurerm_route_table.spoke_routing[spoke_key].id, null)
+      hub_connection_id   = try(azurerm_virtual_hub_connection.spoke[spoke_key].id, null)
+    }
+  }
+  description = "A curated output of the spoke virtual networks attached to the hubs by this module."
+}
+
+output "virtual_hubs" {
+  value = {
+    for vnet_name, hub in azurerm_virtual_hub.hub : vnet_name => {
+      id                = hub.id
+      name              = hub.name
+      address_prefix    = hub.address_prefix
+      virtual_wan_id    = hub.virtual_wan_id
+      routing_intent_id = try(azurerm_virtual_hub_routing_intent.hub[vnet_name].id, null)
+    }
+  }
+  description = "A curated output of the virtual hubs created by this module with `virtual_wan`."
+}
+
+output "virtual_network_gateways" {
+  value = {
+    for vnet_name, vgw in azurerm_virtual_network_gateway.vgw : vnet_name => {
+      id                  = vgw.id
+      name                = vgw.name
+      type                = vgw.type
+      sku                 = vgw.sku
+      subnet_id           = azurerm_subnet.gateway_subnet[vnet_name].id
+      public_ip_addresses = [for pip_key, pip in azurerm_public_ip.vgw_pip : pip.ip_address if local.virtual_network_gateway_public_ips[pip_key].hub_key == vnet_name]
+      bgp_settings        = try(vgw.bgp_settings[0], null)
+    }
+  }
+  description = "A curated output of the virtual network gateways created by this module."
+}
+
 output "virtual_networks" {
   value = {
     for vnet_name, vnet_mod in module.hub_virtual_networks : vnet_name => {
@@ -50,6 +205,7 @@ output "virtual_networks" {
       address_spaces        = vnet_mod.vnet_address_space
       subnets_name_id       = vnet_mod.vnet_subnets_name_id
       hub_router_ip_address = try(azurerm_firewall.fw[vnet_name].ip_configuration[0].private_ip_address, var.hub_virtual_networks[vnet_name].hub_router_ip_address)
+      flow_log_id           = try(azurerm_network_watcher_flow_log.flow_log[vnet_name].id, null)
     }
   }
   description = "A curated output of the virtual networks created by this module."
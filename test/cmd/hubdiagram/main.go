@@ -0,0 +1,57 @@
+// Command hubdiagram renders the hubs declared in a var file, their subnets, firewalls, peerings and route
+// next hops as a Mermaid flowchart or a Graphviz digraph.
+//
+//	hubdiagram -var-file terraform.tfvars -format dot | dot -Tsvg > hubs.svg
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Azure/terraform-azure-hubandspoke/test/hubnetworking"
+)
+
+func main() {
+	varFile := flag.String("var-file", "", "tfvars or tfvars.json file declaring hub_virtual_networks")
+	format := flag.String("format", "mermaid", "output format, mermaid or dot")
+	out := flag.String("out", "", "file to write the diagram to, stdout when empty")
+	flag.Parse()
+
+	if err := run(*varFile, *format, *out); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(varFile, format, out string) error {
+	if varFile == "" {
+		return fmt.Errorf("-var-file is required")
+	}
+	var render func(io.Writer, hubnetworking.Variables) error
+	switch format {
+	case "mermaid":
+		render = hubnetworking.RenderMermaid
+	case "dot":
+		render = hubnetworking.RenderDot
+	default:
+		return fmt.Errorf("unknown format %q, expected mermaid or dot", format)
+	}
+	v, err := hubnetworking.LoadVarFile(varFile)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		return render(os.Stdout, v)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := render(f, v); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,88 @@
+// Command hubplanner allocates subnet prefixes inside the address space of hubs and prints the
+// resulting `hub_virtual_networks` as a tfvars.json fragment.
+//
+//	hubplanner -var-file terraform.tfvars -hub weu-hub -subnet AzureFirewallSubnet=26 -subnet GatewaySubnet=27
+//
+// Prefixes already present in the var file are kept, so the command can be re-run as requirements grow.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/terraform-azure-hubandspoke/test/hubnetworking"
+)
+
+type subnetRequests []hubnetworking.SubnetRequest
+
+func (s *subnetRequests) String() string {
+	parts := make([]string, 0, len(*s))
+	for _, r := range *s {
+		parts = append(parts, fmt.Sprintf("%s=%d", r.Name, r.PrefixLength))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *subnetRequests) Set(v string) error {
+	name, length, ok := strings.Cut(v, "=")
+	if !ok {
+		return fmt.Errorf("expected name=prefix_length, got %q", v)
+	}
+	l, err := strconv.Atoi(strings.TrimPrefix(length, "/"))
+	if err != nil {
+		return fmt.Errorf("invalid prefix length in %q: %w", v, err)
+	}
+	*s = append(*s, hubnetworking.SubnetRequest{Name: name, PrefixLength: l})
+	return nil
+}
+
+func main() {
+	varFile := flag.String("var-file", "", "tfvars or tfvars.json file declaring hub_virtual_networks")
+	hub := flag.String("hub", "", "key of the hub to plan, all hubs when empty")
+	out := flag.String("out", "", "file to write the tfvars.json fragment to, stdout when empty")
+	var requests subnetRequests
+	flag.Var(&requests, "subnet", "subnet to allocate as name=prefix_length, may be repeated")
+	flag.Parse()
+
+	if err := run(*varFile, *hub, *out, requests); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(varFile, hub, out string, requests subnetRequests) error {
+	if varFile == "" {
+		return fmt.Errorf("-var-file is required")
+	}
+	v, err := hubnetworking.LoadVarFile(varFile)
+	if err != nil {
+		return err
+	}
+	planned := make(hubnetworking.HubVirtualNetworks)
+	for _, k := range v.HubVirtualNetworks.Keys() {
+		if hub != "" && k != hub {
+			continue
+		}
+		p, err := hubnetworking.PlanHub(v.HubVirtualNetworks[k], requests)
+		if err != nil {
+			return fmt.Errorf("hub %s: %w", k, err)
+		}
+		planned[k] = p
+	}
+	if len(planned) == 0 {
+		return fmt.Errorf("hub %q not found in %s", hub, varFile)
+	}
+	c, err := json.MarshalIndent(hubnetworking.Variables{HubVirtualNetworks: planned}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = fmt.Println(string(c))
+		return err
+	}
+	return os.WriteFile(out, c, 0600)
+}
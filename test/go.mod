@@ -6,9 +6,11 @@ require (
 	github.com/Azure/terraform-module-test-helper v0.14.0
 	github.com/ahmetb/go-linq/v3 v3.2.0
 	github.com/gruntwork-io/terratest v0.43.8
+	github.com/hashicorp/hcl/v2 v2.16.2
 	github.com/mitchellh/mapstructure v1.5.0
 	github.com/stretchr/testify v1.8.4
 	github.com/thanhpk/randstr v1.0.6
+	github.com/zclconf/go-cty v1.13.0
 )
 
 require (
@@ -51,7 +53,6 @@ require (
 	github.com/hashicorp/go-safetemp v1.0.0 // indirect
 	github.com/hashicorp/go-version v1.6.0 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
-	github.com/hashicorp/hcl/v2 v2.16.2 // indirect
 	github.com/hashicorp/terraform-config-inspect v0.0.0-20230313152339-7c9946b1df49 // indirect
 	github.com/hashicorp/terraform-json v0.16.0 // indirect
 	github.com/imdario/mergo v0.3.13 // indirect
@@ -84,7 +85,6 @@ require (
 	github.com/vmihailenco/msgpack/v5 v5.3.5 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
-	github.com/zclconf/go-cty v1.13.0 // indirect
 	go.opencensus.io v0.24.0 // indirect
 	golang.org/x/crypto v0.14.0 // indirect
 	golang.org/x/exp v0.0.0-20230310171629-522b1b587ee0 // indirect
@@ -0,0 +1,94 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DdosProtectionPlanConflict is an element of `local.ddos_protection_plan_conflicts`, a hub of `hub_keys` the DDoS
+// Protection Plan cannot be attached to.
+type DdosProtectionPlanConflict struct {
+	HubKeys []string `json:"hub_keys"`
+	Message string   `json:"message"`
+}
+
+func (c DdosProtectionPlanConflict) Error() string {
+	return c.Message
+}
+
+// VirtualNetworkDdosProtectionPlan mirrors a value of `local.hub_ddos_protection_plans`, the
+// `virtual_network_ddos_protection_plan` of a hub virtual network.
+type VirtualNetworkDdosProtectionPlan struct {
+	Id     string `json:"id"`
+	Enable bool   `json:"enable"`
+}
+
+// DdosProtectionPlanConflicts computes `local.ddos_protection_plan_conflicts` in the same order:
+//   - hub keys that match no hub,
+//   - hubs with their own ddos_protection_plan_id,
+//   - virtual hubs with a Virtual WAN.
+func (v Variables) DdosProtectionPlanConflicts() []DdosProtectionPlanConflict {
+	conflicts := make([]DdosProtectionPlanConflict, 0)
+	if v.DdosProtectionPlan == nil {
+		return conflicts
+	}
+	keys := append([]string{}, v.DdosProtectionPlan.HubKeys...)
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, ok := v.HubVirtualNetworks[k]; !ok {
+			conflicts = append(conflicts, DdosProtectionPlanConflict{HubKeys: []string{}, Message: fmt.Sprintf("hub_keys of ddos_protection_plan references hub %s, which does not exist", k)})
+		}
+	}
+	for _, k := range keys {
+		if hub, ok := v.HubVirtualNetworks[k]; ok && hub.DdosProtectionPlanId != nil {
+			conflicts = append(conflicts, DdosProtectionPlanConflict{HubKeys: []string{k}, Message: fmt.Sprintf("hub %s is listed in the hub_keys of ddos_protection_plan but sets its own ddos_protection_plan_id", k)})
+		}
+	}
+	for _, k := range keys {
+		if _, ok := v.HubVirtualNetworks[k]; ok && v.VirtualWan != nil {
+			conflicts = append(conflicts, DdosProtectionPlanConflict{HubKeys: []string{k}, Message: fmt.Sprintf("hub %s is listed in the hub_keys of ddos_protection_plan but a virtual hub cannot be attached to a DDoS Protection Plan with virtual_wan", k)})
+		}
+	}
+	return conflicts
+}
+
+// DdosProtectionPlanHubKeys computes `local.ddos_protection_plan_hub_keys`, the sorted keys of the hub virtual networks
+// the plan of `var.ddos_protection_plan` is attached to.
+func (v Variables) DdosProtectionPlanHubKeys() []string {
+	r := make([]string, 0)
+	if v.DdosProtectionPlan == nil {
+		return r
+	}
+	selected := make(map[string]bool)
+	for _, k := range v.DdosProtectionPlan.HubKeys {
+		selected[k] = true
+	}
+	hubs := v.hubVirtualNetworks()
+	for _, k := range hubs.Keys() {
+		if hubs[k].DdosProtectionPlanId == nil && (v.DdosProtectionPlan.HubKeys == nil || selected[k]) {
+			r = append(r, k)
+		}
+	}
+	return r
+}
+
+// HubDdosProtectionPlans computes `local.hub_ddos_protection_plans`, ddosProtectionPlanId playing the role of the ID of
+// the plan the module creates. A hub virtual network without plan maps to nil.
+func (v Variables) HubDdosProtectionPlans(ddosProtectionPlanId string) map[string]*VirtualNetworkDdosProtectionPlan {
+	attached := make(map[string]bool)
+	for _, k := range v.DdosProtectionPlanHubKeys() {
+		attached[k] = true
+	}
+	r := make(map[string]*VirtualNetworkDdosProtectionPlan)
+	for k, hub := range v.hubVirtualNetworks() {
+		switch {
+		case hub.DdosProtectionPlanId != nil:
+			r[k] = &VirtualNetworkDdosProtectionPlan{Id: *hub.DdosProtectionPlanId, Enable: true}
+		case attached[k]:
+			r[k] = &VirtualNetworkDdosProtectionPlan{Id: ddosProtectionPlanId, Enable: true}
+		default:
+			r[k] = nil
+		}
+	}
+	return r
+}
@@ -0,0 +1,67 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ddosVariables() Variables {
+	return Variables{
+		HubVirtualNetworks: HubVirtualNetworks{
+			"hub0": {AddressSpace: []string{"10.0.0.0/16"}},
+			"hub1": {AddressSpace: []string{"10.1.0.0/16"}, DdosProtectionPlanId: String("existing-plan-id")},
+			"hub2": {AddressSpace: []string{"10.2.0.0/16"}},
+		},
+		DdosProtectionPlan: &DdosProtectionPlan{Name: "ddos", Location: "eastus", ResourceGroupName: "rg-ddos"},
+	}
+}
+
+func TestHubDdosProtectionPlans_ShouldAttachThePlanToEveryHubWithoutItsOwn(t *testing.T) {
+	v := ddosVariables()
+	assert.Equal(t, []string{"hub0", "hub2"}, v.DdosProtectionPlanHubKeys())
+	assert.Equal(t, map[string]*VirtualNetworkDdosProtectionPlan{
+		"hub0": {Id: "ddos_id", Enable: true},
+		"hub1": {Id: "existing-plan-id", Enable: true},
+		"hub2": {Id: "ddos_id", Enable: true},
+	}, v.HubDdosProtectionPlans("ddos_id"))
+	assert.Empty(t, v.DdosProtectionPlanConflicts())
+}
+
+func TestHubDdosProtectionPlans_ShouldOnlyAttachThePlanToTheSelectedHubs(t *testing.T) {
+	v := ddosVariables()
+	v.DdosProtectionPlan.HubKeys = []string{"hub2"}
+	assert.Equal(t, []string{"hub2"}, v.DdosProtectionPlanHubKeys())
+	assert.Equal(t, map[string]*VirtualNetworkDdosProtectionPlan{
+		"hub0": nil,
+		"hub1": {Id: "existing-plan-id", Enable: true},
+		"hub2": {Id: "ddos_id", Enable: true},
+	}, v.HubDdosProtectionPlans("ddos_id"))
+}
+
+func TestHubDdosProtectionPlans_WithoutPlanShouldOnlyKeepTheExistingPlans(t *testing.T) {
+	v := ddosVariables()
+	v.DdosProtectionPlan = nil
+	assert.Empty(t, v.DdosProtectionPlanHubKeys())
+	assert.Equal(t, map[string]*VirtualNetworkDdosProtectionPlan{
+		"hub0": nil,
+		"hub1": {Id: "existing-plan-id", Enable: true},
+		"hub2": nil,
+	}, v.HubDdosProtectionPlans(""))
+}
+
+func TestDdosProtectionPlanConflicts(t *testing.T) {
+	v := ddosVariables()
+	v.DdosProtectionPlan.HubKeys = []string{"hub1", "hub3", "hub0"}
+	assert.Equal(t, []DdosProtectionPlanConflict{
+		{HubKeys: []string{}, Message: "hub_keys of ddos_protection_plan references hub hub3, which does not exist"},
+		{HubKeys: []string{"hub1"}, Message: "hub hub1 is listed in the hub_keys of ddos_protection_plan but sets its own ddos_protection_plan_id"},
+	}, v.DdosProtectionPlanConflicts())
+
+	v.VirtualWan = &VirtualWan{Name: "vwan", Location: "eastus", ResourceGroupName: "rg-vwan"}
+	v.DdosProtectionPlan.HubKeys = []string{"hub0"}
+	assert.Equal(t, []DdosProtectionPlanConflict{
+		{HubKeys: []string{"hub0"}, Message: "hub hub0 is listed in the hub_keys of ddos_protection_plan but a virtual hub cannot be attached to a DDoS Protection Plan with virtual_wan"},
+	}, v.DdosProtectionPlanConflicts())
+	assert.Empty(t, v.DdosProtectionPlanHubKeys(), "virtual hubs have no virtual network to attach the plan to")
+}
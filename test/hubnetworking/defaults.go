@@ -0,0 +1,380 @@
+package hubnetworking
+
+// WithDefaults returns a copy of the variables with every unset optional attribute replaced by its default.
+func (v Variables) WithDefaults() Variables {
+	v.HubVirtualNetworks = v.HubVirtualNetworks.WithDefaults()
+	t := v.HubMeshTopology.WithDefaults()
+	v.HubMeshTopology = &t
+	v.SpokeVirtualNetworks = v.SpokeVirtualNetworks.WithDefaults()
+	policies := make(map[string]FirewallPolicy, len(v.FirewallPolicies))
+	for k, p := range v.FirewallPolicies {
+		policies[k] = p.WithDefaults()
+	}
+	v.FirewallPolicies = policies
+	if v.VirtualWan != nil {
+		w := v.VirtualWan.WithDefaults()
+		v.VirtualWan = &w
+	}
+	if v.PrivateDnsZones != nil {
+		z := v.PrivateDnsZones.WithDefaults()
+		v.PrivateDnsZones = &z
+	}
+	if v.DiagnosticSettings != nil {
+		d := v.DiagnosticSettings.WithDefaults()
+		v.DiagnosticSettings = &d
+	}
+	return v
+}
+
+// WithDefaults returns a copy of the topology with every unset optional attribute replaced by its default,
+// a nil topology being the default full mesh.
+func (t *MeshTopology) WithDefaults() MeshTopology {
+	var r MeshTopology
+	if t != nil {
+		r = *t
+	}
+	r.Type = orDefault(r.Type, MeshTopologyFullMesh)
+	if r.Groups == nil {
+		r.Groups = map[string][]string{}
+	}
+	if r.AllowedPairs == nil {
+		r.AllowedPairs = [][]string{}
+	}
+	if r.DeniedPairs == nil {
+		r.DeniedPairs = [][]string{}
+	}
+	return r
+}
+
+// WithDefaults returns a copy of the hubs with every unset optional attribute replaced by the
+// default declared in variables.tf, as Terraform does when it converts the input.
+func (h HubVirtualNetworks) WithDefaults() HubVirtualNetworks {
+	if h == nil {
+		return HubVirtualNetworks{}
+	}
+	r := make(HubVirtualNetworks, len(h))
+	for k, v := range h {
+		r[k] = v.WithDefaults()
+	}
+	return r
+}
+
+// WithDefaults returns a copy of the hub with every unset optional attribute replaced by its default.
+func (n HubVirtualNetwork) WithDefaults() HubVirtualNetwork {
+	n.FlowTimeoutInMinutes = orDefault(n.FlowTimeoutInMinutes, 4)
+	n.MeshPeeringEnabled = orDefault(n.MeshPeeringEnabled, true)
+	n.MeshPeeringSettings = orDefault(n.MeshPeeringSettings, PeeringSettings{})
+	if n.MeshPeeringOverrides == nil {
+		n.MeshPeeringOverrides = map[string]PeeringSettings{}
+	}
+	n.ResourceGroupCreationEnabled = orDefault(n.ResourceGroupCreationEnabled, true)
+	n.ResourceGroupLockEnabled = orDefault(n.ResourceGroupLockEnabled, true)
+	if n.RoutingAddressSpace == nil {
+		n.RoutingAddressSpace = []string{}
+	}
+	if n.Tags == nil {
+		n.Tags = map[string]string{}
+	}
+	entries := make([]RouteTableEntry, 0, len(n.RouteTableEntries))
+	for _, e := range n.RouteTableEntries {
+		e.HasBgpOverride = orDefault(e.HasBgpOverride, false)
+		entries = append(entries, e)
+	}
+	n.RouteTableEntries = entries
+	n.BgpRoutePropagationEnabled = orDefault(n.BgpRoutePropagationEnabled, !hasBgpOverride(entries))
+	d := n.DefaultRoute.withDefaults(n.Firewall != nil)
+	n.DefaultRoute = &d
+	subnets := make(map[string]Subnet, len(n.Subnets))
+	for k, s := range n.Subnets {
+		subnets[k] = s.WithDefaults()
+	}
+	n.Subnets = subnets
+	if n.Firewall != nil {
+		fw := n.Firewall.WithDefaults()
+		n.Firewall = &fw
+	}
+	if n.VirtualNetworkGateway != nil {
+		gw := n.VirtualNetworkGateway.WithDefaults()
+		n.VirtualNetworkGateway = &gw
+	}
+	if n.Bastion != nil {
+		b := n.Bastion.WithDefaults()
+		n.Bastion = &b
+	}
+	if n.RouteServer != nil {
+		rs := n.RouteServer.WithDefaults()
+		n.RouteServer = &rs
+	}
+	if n.DnsResolver != nil {
+		d := n.DnsResolver.WithDefaults()
+		n.DnsResolver = &d
+	}
+	if n.DiagnosticSettings != nil {
+		d := *n.DiagnosticSettings
+		d.Enabled = orDefault(d.Enabled, true)
+		n.DiagnosticSettings = &d
+	}
+	if n.FlowLog != nil {
+		f := n.FlowLog.WithDefaults()
+		n.FlowLog = &f
+	}
+	h := n.VirtualHub.withDefaults()
+	n.VirtualHub = &h
+	return n
+}
+
+// WithDefaults returns a copy of the spokes with every unset optional attribute replaced by its default.
+func (s SpokeVirtualNetworks) WithDefaults() SpokeVirtualNetworks {
+	r := make(SpokeVirtualNetworks, len(s))
+	for k, v := range s {
+		r[k] = v.WithDefaults()
+	}
+	return r
+}
+
+// WithDefaults returns a copy of the spoke with every unset optional attribute replaced by its default.
+func (n SpokeVirtualNetwork) WithDefaults() SpokeVirtualNetwork {
+	subnets := make(map[string]SpokeSubnet, len(n.Subnets))
+	for k, s := range n.Subnets {
+		if s.AddressPrefixes == nil {
+			s.AddressPrefixes = []string{}
+		}
+		s.AssignGeneratedRouteTable = orDefault(s.AssignGeneratedRouteTable, true)
+		subnets[k] = s
+	}
+	n.Subnets = subnets
+	if n.RoutedAddressPrefixes == nil {
+		n.RoutedAddressPrefixes = []string{}
+	}
+	n.MeshRoutingEnabled = orDefault(n.MeshRoutingEnabled, true)
+	n.UseRemoteGateways = orDefault(n.UseRemoteGateways, false)
+	if n.Tags == nil {
+		n.Tags = map[string]string{}
+	}
+	n.PrivateDnsZoneLinksEnabled = orDefault(n.PrivateDnsZoneLinksEnabled, false)
+	return n
+}
+
+// WithDefaults returns a copy of the subnet with every unset optional attribute replaced by its default.
+func (s Subnet) WithDefaults() Subnet {
+	s.PrivateEndpointNetworkPoliciesEnabled = orDefault(s.PrivateEndpointNetworkPoliciesEnabled, true)
+	s.PrivateLinkServiceNetworkPoliciesEnabled = orDefault(s.PrivateLinkServiceNetworkPoliciesEnabled, true)
+	s.AssignGeneratedRouteTable = orDefault(s.AssignGeneratedRouteTable, true)
+	if s.GeneratedNetworkSecurityGroup != nil {
+		g := *s.GeneratedNetworkSecurityGroup
+		g.BaselineRulesEnabled = orDefault(g.BaselineRulesEnabled, true)
+		g.Rules = networkSecurityRulesWithDefaults(g.Rules)
+		s.GeneratedNetworkSecurityGroup = &g
+	}
+	return s
+}
+
+// networkSecurityRulesWithDefaults returns a copy of the rules with every unset optional attribute replaced by its default.
+func networkSecurityRulesWithDefaults(rules map[string]NetworkSecurityRule) map[string]NetworkSecurityRule {
+	r := make(map[string]NetworkSecurityRule, len(rules))
+	for name, rule := range rules {
+		for _, ranges := range []*[]string{&rule.SourceAddressPrefixes, &rule.SourcePortRanges, &rule.DestinationAddressPrefixes, &rule.DestinationPortRanges} {
+			if *ranges == nil {
+				*ranges = []string{"*"}
+			}
+		}
+		r[name] = rule
+	}
+	return r
+}
+
+// WithDefaults returns a copy of the firewall with every unset optional attribute replaced by its default.
+func (f Firewall) WithDefaults() Firewall {
+	f.ThreatIntelMode = orDefault(f.ThreatIntelMode, "Alert")
+	f.VirtualHubPublicIpCount = orDefault(f.VirtualHubPublicIpCount, 1)
+	f.RouteTableBgpRoutePropagationEnabled = orDefault(f.RouteTableBgpRoutePropagationEnabled, true)
+	f.DefaultIpConfiguration = f.DefaultIpConfiguration.withDefaults()
+	ipConfigurations := make(map[string]FirewallAdditionalIpConfiguration, len(f.IpConfigurations))
+	for name, c := range f.IpConfigurations {
+		c.PublicIpConfig = c.PublicIpConfig.withDefaults()
+		ipConfigurations[name] = c
+	}
+	f.IpConfigurations = ipConfigurations
+	f.ManagementIpConfiguration = f.ManagementIpConfiguration.withDefaults()
+	if f.PublicIpPrefix != nil {
+		p := *f.PublicIpPrefix
+		p.IpVersion = orDefault(p.IpVersion, "IPv4")
+		p.PrefixLength = orDefault(p.PrefixLength, 30)
+		f.PublicIpPrefix = &p
+	}
+	return f
+}
+
+// WithDefaults returns a copy of the gateway with every unset optional attribute replaced by its default.
+func (g VirtualNetworkGateway) WithDefaults() VirtualNetworkGateway {
+	g.VpnType = orDefault(g.VpnType, "RouteBased")
+	g.ActiveActive = orDefault(g.ActiveActive, false)
+	g.EnableBgp = orDefault(g.EnableBgp, false)
+	return g
+}
+
+// WithDefaults returns a copy of the Bastion with every unset optional attribute replaced by its default.
+func (b Bastion) WithDefaults() Bastion {
+	b.Sku = orDefault(b.Sku, "Basic")
+	b.ScaleUnits = orDefault(b.ScaleUnits, 2)
+	b.CopyPasteEnabled = orDefault(b.CopyPasteEnabled, true)
+	b.FileCopyEnabled = orDefault(b.FileCopyEnabled, false)
+	b.IpConnectEnabled = orDefault(b.IpConnectEnabled, false)
+	b.ShareableLinkEnabled = orDefault(b.ShareableLinkEnabled, false)
+	b.TunnelingEnabled = orDefault(b.TunnelingEnabled, false)
+	return b
+}
+
+// WithDefaults returns a copy of the Route Server with every unset optional attribute replaced by its default.
+func (s RouteServer) WithDefaults() RouteServer {
+	s.BranchToBranchTrafficEnabled = orDefault(s.BranchToBranchTrafficEnabled, false)
+	if s.BgpConnections == nil {
+		s.BgpConnections = map[string]RouteServerBgpConnection{}
+	}
+	return s
+}
+
+// WithDefaults returns a copy of the DNS resolver with every unset optional attribute replaced by its default.
+func (d DnsResolver) WithDefaults() DnsResolver {
+	rules := make(map[string]DnsForwardingRule, len(d.ForwardingRules))
+	for name, rule := range d.ForwardingRules {
+		servers := make([]DnsTargetServer, 0, len(rule.TargetDnsServers))
+		for _, server := range rule.TargetDnsServers {
+			server.Port = orDefault(server.Port, 53)
+			servers = append(servers, server)
+		}
+		rule.TargetDnsServers = servers
+		rule.Enabled = orDefault(rule.Enabled, true)
+		rules[name] = rule
+	}
+	d.ForwardingRules = rules
+	return d
+}
+
+// withDefaults returns a copy of the virtual hub settings with every unset optional attribute replaced by its default,
+// nil settings being all defaults.
+func (h *VirtualHub) withDefaults() VirtualHub {
+	var r VirtualHub
+	if h != nil {
+		r = *h
+	}
+	r.Sku = orDefault(r.Sku, "Standard")
+	r.HubRoutingPreference = orDefault(r.HubRoutingPreference, "ExpressRoute")
+	r.InternetTrafficRoutingEnabled = orDefault(r.InternetTrafficRoutingEnabled, true)
+	r.PrivateTrafficRoutingEnabled = orDefault(r.PrivateTrafficRoutingEnabled, true)
+	return r
+}
+
+// withDefaults mirrors `local.default_route_next_hop_types`, through the firewall of the hub if any.
+func (d *DefaultRoute) withDefaults(firewall bool) DefaultRoute {
+	var r DefaultRoute
+	if d != nil {
+		r = *d
+	}
+	if firewall {
+		r.NextHopType = orDefault(r.NextHopType, "Firewall")
+	} else {
+		r.NextHopType = orDefault(r.NextHopType, "Internet")
+	}
+	return r
+}
+
+// WithDefaults returns a copy of the Virtual WAN with every unset optional attribute replaced by its default.
+func (w VirtualWan) WithDefaults() VirtualWan {
+	w.Type = orDefault(w.Type, "Standard")
+	w.AllowBranchToBranchTraffic = orDefault(w.AllowBranchToBranchTraffic, true)
+	w.DisableVpnEncryption = orDefault(w.DisableVpnEncryption, false)
+	return w
+}
+
+// WithDefaults returns a copy of the private DNS zones with every unset optional attribute replaced by its default.
+func (z PrivateDnsZones) WithDefaults() PrivateDnsZones {
+	if z.ZoneNames == nil {
+		z.ZoneNames = []string{}
+	}
+	z.PrivateLinkZonesEnabled = orDefault(z.PrivateLinkZonesEnabled, false)
+	if z.PrivateLinkZoneExclusions == nil {
+		z.PrivateLinkZoneExclusions = []string{}
+	}
+	return z
+}
+
+// WithDefaults returns a copy of the policy with every unset optional attribute replaced by its default.
+func (p FirewallPolicy) WithDefaults() FirewallPolicy {
+	p.MeshRulesEnabled = orDefault(p.MeshRulesEnabled, true)
+	p.MeshRulesPriority = orDefault(p.MeshRulesPriority, 100)
+	if p.RuleCollectionGroups == nil {
+		p.RuleCollectionGroups = map[string]RuleCollectionGroup{}
+	}
+	p.IntrusionDetection = p.IntrusionDetection.withDefaults()
+	return p
+}
+
+func (d *IntrusionDetection) withDefaults() *IntrusionDetection {
+	if d == nil {
+		return nil
+	}
+	r := *d
+	r.Mode = orDefault(r.Mode, "Alert")
+	return &r
+}
+
+func (c *FirewallIpConfiguration) withDefaults() *FirewallIpConfiguration {
+	if c == nil || c.PublicIpConfig == nil {
+		return c
+	}
+	r := *c
+	r.PublicIpConfig = c.PublicIpConfig.withDefaults()
+	return &r
+}
+
+func (c *PublicIpConfig) withDefaults() *PublicIpConfig {
+	if c == nil {
+		return nil
+	}
+	r := *c
+	r.SkuTier = orDefault(r.SkuTier, "Regional")
+	return &r
+}
+
+func orDefault[T any](v *T, d T) *T {
+	if v != nil {
+		return v
+	}
+	return &d
+}
+
+// String returns a pointer to s, for populating optional attributes.
+func String(s string) *string {
+	return &s
+}
+
+// Bool returns a pointer to b, for populating optional attributes.
+func Bool(b bool) *bool {
+	return &b
+}
+
+// Int returns a pointer to i, for populating optional attributes.
+func Int(i int) *int {
+	return &i
+}
+
+// WithDefaults returns a copy of the diagnostic settings with every unset optional attribute replaced by its default.
+func (d DiagnosticSettings) WithDefaults() DiagnosticSettings {
+	d.Name = orDefault(d.Name, "diag")
+	d.LogAnalyticsDestinationType = orDefault(d.LogAnalyticsDestinationType, "Dedicated")
+	d.MetricsEnabled = orDefault(d.MetricsEnabled, true)
+	return d
+}
+
+// WithDefaults returns a copy of the flow log with every unset optional attribute replaced by its default.
+func (f FlowLog) WithDefaults() FlowLog {
+	f.Enabled = orDefault(f.Enabled, true)
+	f.RetentionDays = orDefault(f.RetentionDays, 0)
+	if f.TrafficAnalytics != nil {
+		a := *f.TrafficAnalytics
+		a.IntervalInMinutes = orDefault(a.IntervalInMinutes, 60)
+		f.TrafficAnalytics = &a
+	}
+	return f
+}
@@ -0,0 +1,74 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDefaults_UnsetOptionalAttributesShouldUseModuleDefaults(t *testing.T) {
+	hubs := HubVirtualNetworks{
+		"hub": {
+			Name:         "hub",
+			AddressSpace: []string{"10.0.0.0/16"},
+			RouteTableEntries: []RouteTableEntry{
+				{Name: "r", AddressPrefix: "0.0.0.0/0", NextHopType: "None"},
+			},
+			Subnets: map[string]Subnet{
+				"s": {AddressPrefixes: []string{"10.0.0.0/24"}},
+			},
+			Firewall: &Firewall{
+				SkuName:             "AZFW_VNet",
+				SkuTier:             "Standard",
+				SubnetAddressPrefix: "10.0.1.0/24",
+				DefaultIpConfiguration: &FirewallIpConfiguration{
+					PublicIpConfig: &PublicIpConfig{},
+				},
+				IpConfigurations: map[string]FirewallAdditionalIpConfiguration{
+					"snat": {PublicIpConfig: &PublicIpConfig{}},
+				},
+				PublicIpPrefix: &FirewallPublicIpPrefix{},
+			},
+		},
+	}.WithDefaults()
+
+	hub := hubs["hub"]
+	assert.Equal(t, 4, *hub.FlowTimeoutInMinutes)
+	assert.True(t, *hub.MeshPeeringEnabled)
+	assert.True(t, *hub.ResourceGroupCreationEnabled)
+	assert.True(t, *hub.ResourceGroupLockEnabled)
+	assert.Equal(t, []string{}, hub.RoutingAddressSpace)
+	assert.Equal(t, map[string]string{}, hub.Tags)
+	assert.False(t, *hub.RouteTableEntries[0].HasBgpOverride)
+	s := hub.Subnets["s"]
+	assert.True(t, *s.AssignGeneratedRouteTable)
+	assert.True(t, *s.PrivateEndpointNetworkPoliciesEnabled)
+	assert.True(t, *s.PrivateLinkServiceNetworkPoliciesEnabled)
+	assert.Equal(t, "Alert", *hub.Firewall.ThreatIntelMode)
+	assert.Equal(t, 1, *hub.Firewall.VirtualHubPublicIpCount)
+	assert.Equal(t, "Regional", *hub.Firewall.DefaultIpConfiguration.PublicIpConfig.SkuTier)
+	assert.Equal(t, "Regional", *hub.Firewall.IpConfigurations["snat"].PublicIpConfig.SkuTier)
+	assert.Equal(t, 30, *hub.Firewall.PublicIpPrefix.PrefixLength)
+	assert.Nil(t, hub.Firewall.ManagementIpConfiguration)
+	assert.Equal(t, &VirtualHub{
+		Sku:                           String("Standard"),
+		HubRoutingPreference:          String("ExpressRoute"),
+		InternetTrafficRoutingEnabled: Bool(true),
+		PrivateTrafficRoutingEnabled:  Bool(true),
+	}, hub.VirtualHub)
+}
+
+func TestWithDefaults_ExplicitValuesShouldBeKept(t *testing.T) {
+	original := HubVirtualNetwork{
+		MeshPeeringEnabled:   Bool(false),
+		FlowTimeoutInMinutes: Int(10),
+		Subnets: map[string]Subnet{
+			"s": {AssignGeneratedRouteTable: Bool(false)},
+		},
+	}
+	hub := original.WithDefaults()
+	assert.False(t, *hub.MeshPeeringEnabled)
+	assert.Equal(t, 10, *hub.FlowTimeoutInMinutes)
+	assert.False(t, *hub.Subnets["s"].AssignGeneratedRouteTable)
+	assert.Nil(t, original.ResourceGroupLockEnabled, "WithDefaults must not mutate its receiver")
+}
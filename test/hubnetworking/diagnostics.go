@@ -0,0 +1,174 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DiagnosticLogCategories mirrors `local.diagnostic_log_categories`, the log categories each type of resource with
+// diagnostic settings supports.
+var DiagnosticLogCategories = map[string][]string{
+	"firewall": {
+		"AZFWApplicationRule",
+		"AZFWApplicationRuleAggregation",
+		"AZFWDnsQuery",
+		"AZFWFatFlow",
+		"AZFWFlowTrace",
+		"AZFWFqdnResolveFailure",
+		"AZFWIdpsSignature",
+		"AZFWNatRule",
+		"AZFWNatRuleAggregation",
+		"AZFWNetworkRule",
+		"AZFWNetworkRuleAggregation",
+		"AZFWThreatIntel",
+		"AzureFirewallApplicationRule",
+		"AzureFirewallDnsProxy",
+		"AzureFirewallNetworkRule",
+	},
+	"public_ip":       {"DDoSMitigationFlowLogs", "DDoSMitigationReports", "DDoSProtectionNotifications"},
+	"virtual_network": {"VMProtectionAlerts"},
+}
+
+// DiagnosticSetting mirrors a value of `local.diagnostic_settings`, the diagnostic setting of a resource of a hub.
+type DiagnosticSetting struct {
+	Key                         string   `json:"key"`
+	HubKey                      string   `json:"hub_key"`
+	Name                        string   `json:"name"`
+	LogAnalyticsWorkspaceId     *string  `json:"log_analytics_workspace_id"`
+	LogAnalyticsDestinationType *string  `json:"log_analytics_destination_type"`
+	StorageAccountId            *string  `json:"storage_account_id"`
+	EventhubAuthorizationRuleId *string  `json:"eventhub_authorization_rule_id"`
+	EventhubName                *string  `json:"eventhub_name"`
+	LogCategories               []string `json:"log_categories"`
+	LogCategoryGroups           []string `json:"log_category_groups"`
+	MetricsEnabled              bool     `json:"metrics_enabled"`
+}
+
+// DiagnosticSettingConflict is an element of `local.diagnostic_setting_conflicts`, a hub whose diagnostic settings have
+// no destination.
+type DiagnosticSettingConflict struct {
+	HubKeys []string `json:"hub_keys"`
+	Message string   `json:"message"`
+}
+
+func (c DiagnosticSettingConflict) Error() string {
+	return c.Message
+}
+
+// HubDiagnosticSettings computes `local.hub_diagnostic_settings`, `var.diagnostic_settings` overridden attribute by
+// attribute by the `diagnostic_settings` of each hub virtual network. The log categories are sorted.
+func (v Variables) HubDiagnosticSettings() map[string]DiagnosticSettings {
+	r := make(map[string]DiagnosticSettings)
+	for k, hub := range v.hubVirtualNetworks() {
+		if v.DiagnosticSettings == nil && hub.DiagnosticSettings == nil || hub.DiagnosticSettings != nil && !*hub.DiagnosticSettings.Enabled {
+			continue
+		}
+		var d DiagnosticSettings
+		if v.DiagnosticSettings != nil {
+			d = *v.DiagnosticSettings
+		}
+		if o := hub.DiagnosticSettings; o != nil {
+			d.Name = firstNonNil(o.Name, d.Name)
+			d.LogAnalyticsWorkspaceId = firstNonNil(o.LogAnalyticsWorkspaceId, d.LogAnalyticsWorkspaceId)
+			d.LogAnalyticsDestinationType = firstNonNil(o.LogAnalyticsDestinationType, d.LogAnalyticsDestinationType)
+			d.StorageAccountId = firstNonNil(o.StorageAccountId, d.StorageAccountId)
+			d.EventhubAuthorizationRuleId = firstNonNil(o.EventhubAuthorizationRuleId, d.EventhubAuthorizationRuleId)
+			d.EventhubName = firstNonNil(o.EventhubName, d.EventhubName)
+			if o.LogCategories != nil {
+				d.LogCategories = o.LogCategories
+			}
+			d.MetricsEnabled = firstNonNil(o.MetricsEnabled, d.MetricsEnabled)
+		}
+		d = d.WithDefaults()
+		if d.LogCategories != nil {
+			d.LogCategories = append([]string{}, d.LogCategories...)
+			sort.Strings(d.LogCategories)
+		}
+		r[k] = d
+	}
+	return r
+}
+
+// DiagnosticSettingConflicts computes `local.diagnostic_setting_conflicts`.
+func (v Variables) DiagnosticSettingConflicts() []DiagnosticSettingConflict {
+	conflicts := make([]DiagnosticSettingConflict, 0)
+	settings := v.HubDiagnosticSettings()
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if d := settings[k]; d.LogAnalyticsWorkspaceId == nil && d.StorageAccountId == nil && d.EventhubAuthorizationRuleId == nil {
+			conflicts = append(conflicts, DiagnosticSettingConflict{
+				HubKeys: []string{k},
+				Message: fmt.Sprintf("diagnostic_settings of hub %s require a log_analytics_workspace_id, a storage_account_id or an eventhub_authorization_rule_id", k),
+			})
+		}
+	}
+	return conflicts
+}
+
+// ResourceDiagnosticSettings computes `local.diagnostic_settings`, the diagnostic settings of the virtual network, the
+// firewall and the firewall public IPs of each hub keyed by `{resource}/{key}`.
+func (v Variables) ResourceDiagnosticSettings() map[string]DiagnosticSetting {
+	r := make(map[string]DiagnosticSetting)
+	hubs := v.hubVirtualNetworks()
+	for k, d := range v.HubDiagnosticSettings() {
+		targets := map[string]string{fmt.Sprintf("virtual_network/%s", k): "virtual_network"}
+		if fw := hubs[k].Firewall; fw != nil {
+			targets[fmt.Sprintf("firewall/%s", k)] = "firewall"
+			targets[fmt.Sprintf("fw_default_ip_configuration_pip/%s", k)] = "public_ip"
+			for name := range fw.IpConfigurations {
+				targets[fmt.Sprintf("fw_ip_configuration_pip/%s-%s", k, name)] = "public_ip"
+			}
+			if fw.SkuTier == "Basic" {
+				targets[fmt.Sprintf("fw_management_ip_configuration_pip/%s", k)] = "public_ip"
+			}
+		}
+		for key, t := range targets {
+			s := DiagnosticSetting{
+				Key:                         key,
+				HubKey:                      k,
+				Name:                        *d.Name,
+				LogAnalyticsWorkspaceId:     d.LogAnalyticsWorkspaceId,
+				StorageAccountId:            d.StorageAccountId,
+				EventhubAuthorizationRuleId: d.EventhubAuthorizationRuleId,
+				EventhubName:                d.EventhubName,
+				LogCategories:               []string{},
+				LogCategoryGroups:           []string{},
+				MetricsEnabled:              *d.MetricsEnabled,
+			}
+			if t == "firewall" && d.LogAnalyticsWorkspaceId != nil {
+				s.LogAnalyticsDestinationType = d.LogAnalyticsDestinationType
+			}
+			if d.LogCategories == nil {
+				s.LogCategoryGroups = []string{"allLogs"}
+			} else {
+				supported := make(map[string]bool)
+				for _, c := range DiagnosticLogCategories[t] {
+					supported[c] = true
+				}
+				for _, c := range d.LogCategories {
+					if supported[c] {
+						s.LogCategories = append(s.LogCategories, c)
+					}
+				}
+				if len(s.LogCategories) == 0 && !s.MetricsEnabled {
+					continue
+				}
+			}
+			r[key] = s
+		}
+	}
+	return r
+}
+
+func firstNonNil[T any](v ...*T) *T {
+	for _, p := range v {
+		if p != nil {
+			return p
+		}
+	}
+	return nil
+}
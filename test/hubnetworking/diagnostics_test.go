@@ -0,0 +1,116 @@
+package hubnetworking
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func diagnosticVariables() Variables {
+	return Variables{
+		HubVirtualNetworks: HubVirtualNetworks{
+			"hub0": {
+				AddressSpace: []string{"10.0.0.0/16"},
+				Firewall: &Firewall{
+					SkuName:             "AZFW_VNet",
+					SkuTier:             "Standard",
+					SubnetAddressPrefix: "10.0.1.0/26",
+					IpConfigurations:    map[string]FirewallAdditionalIpConfiguration{"extra": {}},
+				},
+			},
+			"hub1": {
+				AddressSpace: []string{"10.1.0.0/16"},
+				DiagnosticSettings: &HubDiagnosticSettings{DiagnosticSettings: DiagnosticSettings{
+					StorageAccountId: String("hub1-storage-id"),
+					LogCategories:    []string{"VMProtectionAlerts"},
+					MetricsEnabled:   Bool(false),
+				}},
+			},
+			"hub2": {
+				AddressSpace:       []string{"10.2.0.0/16"},
+				DiagnosticSettings: &HubDiagnosticSettings{Enabled: Bool(false)},
+			},
+		},
+		DiagnosticSettings: &DiagnosticSettings{LogAnalyticsWorkspaceId: String("workspace-id")},
+	}
+}
+
+func TestHubDiagnosticSettings_HubShouldOverrideTheModuleWideSettings(t *testing.T) {
+	assert.Equal(t, map[string]DiagnosticSettings{
+		"hub0": {
+			Name:                        String("diag"),
+			LogAnalyticsWorkspaceId:     String("workspace-id"),
+			LogAnalyticsDestinationType: String("Dedicated"),
+			MetricsEnabled:              Bool(true),
+		},
+		"hub1": {
+			Name:                        String("diag"),
+			LogAnalyticsWorkspaceId:     String("workspace-id"),
+			LogAnalyticsDestinationType: String("Dedicated"),
+			StorageAccountId:            String("hub1-storage-id"),
+			LogCategories:               []string{"VMProtectionAlerts"},
+			MetricsEnabled:              Bool(false),
+		},
+	}, diagnosticVariables().HubDiagnosticSettings())
+}
+
+func TestHubDiagnosticSettings_WithoutModuleWideSettingsOnlyHubsWithTheirOwnShouldHaveSome(t *testing.T) {
+	v := diagnosticVariables()
+	v.DiagnosticSettings = nil
+	settings := v.HubDiagnosticSettings()
+	assert.Equal(t, []string{"hub1"}, keysOf(settings))
+	assert.Nil(t, settings["hub1"].LogAnalyticsWorkspaceId)
+	assert.Empty(t, v.DiagnosticSettingConflicts())
+}
+
+func TestResourceDiagnosticSettings_ShouldCoverTheVirtualNetworkTheFirewallAndItsPublicIps(t *testing.T) {
+	settings := diagnosticVariables().ResourceDiagnosticSettings()
+	assert.Equal(t, []string{
+		"firewall/hub0",
+		"fw_default_ip_configuration_pip/hub0",
+		"fw_ip_configuration_pip/hub0-extra",
+		"virtual_network/hub0",
+		"virtual_network/hub1",
+	}, keysOf(settings))
+	assert.Equal(t, DiagnosticSetting{
+		Key:                         "firewall/hub0",
+		HubKey:                      "hub0",
+		Name:                        "diag",
+		LogAnalyticsWorkspaceId:     String("workspace-id"),
+		LogAnalyticsDestinationType: String("Dedicated"),
+		LogCategories:               []string{},
+		LogCategoryGroups:           []string{"allLogs"},
+		MetricsEnabled:              true,
+	}, settings["firewall/hub0"])
+	assert.Nil(t, settings["fw_default_ip_configuration_pip/hub0"].LogAnalyticsDestinationType, "public IPs have no resource-specific tables")
+	assert.Equal(t, []string{"VMProtectionAlerts"}, settings["virtual_network/hub1"].LogCategories)
+	assert.Empty(t, settings["virtual_network/hub1"].LogCategoryGroups)
+}
+
+func TestResourceDiagnosticSettings_ShouldOnlyEnableTheSupportedLogCategories(t *testing.T) {
+	v := diagnosticVariables()
+	v.DiagnosticSettings.LogCategories = []string{"DDoSMitigationReports", "AZFWNetworkRule"}
+	v.DiagnosticSettings.MetricsEnabled = Bool(false)
+	settings := v.ResourceDiagnosticSettings()
+	assert.Equal(t, []string{"AZFWNetworkRule"}, settings["firewall/hub0"].LogCategories)
+	assert.Equal(t, []string{"DDoSMitigationReports"}, settings["fw_default_ip_configuration_pip/hub0"].LogCategories)
+	assert.NotContains(t, settings, "virtual_network/hub0", "a resource without logs nor metrics has nothing to send")
+}
+
+func TestDiagnosticSettingConflicts_ShouldRequireADestination(t *testing.T) {
+	v := diagnosticVariables()
+	v.DiagnosticSettings.LogAnalyticsWorkspaceId = nil
+	assert.Equal(t, []DiagnosticSettingConflict{
+		{HubKeys: []string{"hub0"}, Message: "diagnostic_settings of hub hub0 require a log_analytics_workspace_id, a storage_account_id or an eventhub_authorization_rule_id"},
+	}, v.DiagnosticSettingConflicts())
+}
+
+func keysOf[V any](m map[string]V) []string {
+	r := make([]string, 0, len(m))
+	for k := range m {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
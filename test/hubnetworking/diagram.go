@@ -0,0 +1,273 @@
+package hubnetworking
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type shape int
+
+const (
+	shapeVnet shape = iota
+	shapeSubnet
+	shapeFirewall
+	shapeRouter
+	shapeNextHop
+)
+
+type edgeKind int
+
+const (
+	edgeContains edgeKind = iota
+	edgePeering
+	edgeRoute
+)
+
+type node struct {
+	id    string
+	label []string
+	shape shape
+}
+
+type cluster struct {
+	id    string
+	label string
+	nodes []node
+}
+
+type edge struct {
+	from, to      string
+	label         []string
+	kind          edgeKind
+	bidirectional bool
+}
+
+// graph is the format independent view of the hubs both renderers work on. Node ids are derived
+// from the position of the hub key in lexical order, so they are valid identifiers in both formats
+// whatever the keys look like.
+type graph struct {
+	clusters []cluster
+	edges    []edge
+}
+
+// RenderMermaid writes a Mermaid flowchart of the hubs, showing their subnets, firewalls, the peerings of
+// `local.hub_peering_map` and the next hops of the routes in `local.route_map`.
+func RenderMermaid(w io.Writer, v Variables) error {
+	g := newGraph(v)
+	b := bufio.NewWriter(w)
+	_, _ = fmt.Fprintln(b, "flowchart LR")
+	for _, c := range g.clusters {
+		_, _ = fmt.Fprintf(b, "  subgraph %s[%s]\n", c.id, mermaidText([]string{c.label}))
+		for _, n := range c.nodes {
+			l := mermaidText(n.label)
+			var s string
+			switch n.shape {
+			case shapeVnet:
+				s = "([" + l + "])"
+			case shapeSubnet:
+				s = "[" + l + "]"
+			case shapeFirewall:
+				s = "{{" + l + "}}"
+			case shapeRouter:
+				s = "((" + l + "))"
+			case shapeNextHop:
+				s = ">" + l + "]"
+			}
+			_, _ = fmt.Fprintf(b, "    %s%s\n", n.id, s)
+		}
+		_, _ = fmt.Fprintln(b, "  end")
+	}
+	for _, e := range g.edges {
+		var arrow string
+		switch {
+		case e.kind == edgeContains:
+			arrow = "---"
+		case e.kind == edgeRoute:
+			arrow = "-.->"
+		case e.bidirectional:
+			arrow = "<-->"
+		default:
+			arrow = "-->"
+		}
+		if len(e.label) == 0 {
+			_, _ = fmt.Fprintf(b, "  %s %s %s\n", e.from, arrow, e.to)
+			continue
+		}
+		_, _ = fmt.Fprintf(b, "  %s %s|%s| %s\n", e.from, arrow, mermaidText(e.label), e.to)
+	}
+	return b.Flush()
+}
+
+// RenderDot writes the same view as RenderMermaid as a Graphviz digraph.
+func RenderDot(w io.Writer, v Variables) error {
+	g := newGraph(v)
+	b := bufio.NewWriter(w)
+	_, _ = fmt.Fprintln(b, "digraph hubs {")
+	_, _ = fmt.Fprintln(b, "  rankdir=LR;")
+	for _, c := range g.clusters {
+		_, _ = fmt.Fprintf(b, "  subgraph cluster_%s {\n", c.id)
+		_, _ = fmt.Fprintf(b, "    label=%s;\n", dotText([]string{c.label}))
+		for _, n := range c.nodes {
+			var attrs string
+			switch n.shape {
+			case shapeVnet:
+				attrs = "shape=box, style=rounded"
+			case shapeSubnet:
+				attrs = "shape=box"
+			case shapeFirewall:
+				attrs = "shape=hexagon"
+			case shapeRouter:
+				attrs = "shape=circle"
+			case shapeNextHop:
+				attrs = "shape=cds"
+			}
+			_, _ = fmt.Fprintf(b, "    %s [label=%s, %s];\n", n.id, dotText(n.label), attrs)
+		}
+		_, _ = fmt.Fprintln(b, "  }")
+	}
+	for _, e := range g.edges {
+		attrs := make([]string, 0, 2)
+		if len(e.label) > 0 {
+			attrs = append(attrs, "label="+dotText(e.label))
+		}
+		switch {
+		case e.kind == edgeContains:
+			attrs = append(attrs, "arrowhead=none")
+		case e.kind == edgeRoute:
+			attrs = append(attrs, "style=dashed")
+		case e.bidirectional:
+			attrs = append(attrs, "dir=both")
+		}
+		_, _ = fmt.Fprintf(b, "  %s -> %s [%s];\n", e.from, e.to, strings.Join(attrs, ", "))
+	}
+	_, _ = fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+func newGraph(v Variables) graph {
+	v = v.WithDefaults()
+	hubs := v.HubVirtualNetworks
+	keys := hubs.Keys()
+	ids := make(map[string]string, len(keys))
+	for i, k := range keys {
+		ids[k] = fmt.Sprintf("hub%d", i)
+	}
+	var g graph
+	clusters := make(map[string]int, len(keys))
+	for _, k := range keys {
+		hub := hubs[k]
+		id := ids[k]
+		c := cluster{id: id, label: k}
+		c.nodes = append(c.nodes, node{id: id + "_vnet", label: append([]string{hub.Name}, hub.AddressSpace...), shape: shapeVnet})
+		for i, s := range subnetPrefixes(hub) {
+			subnetId := fmt.Sprintf("%s_s%d", id, i)
+			c.nodes = append(c.nodes, node{id: subnetId, label: append([]string{s.name}, s.addressPrefixes...), shape: shapeSubnet})
+			g.edges = append(g.edges, edge{from: id + "_vnet", to: subnetId, kind: edgeContains})
+			if hub.Firewall != nil && s.name == FirewallSubnetName {
+				c.nodes = append(c.nodes, node{id: id + "_fw", label: []string{firewallName(k, *hub.Firewall), fmt.Sprintf("%s %s", hub.Firewall.SkuName, hub.Firewall.SkuTier)}, shape: shapeFirewall})
+				g.edges = append(g.edges, edge{from: subnetId, to: id + "_fw", kind: edgeContains})
+			}
+		}
+		if hub.Firewall == nil && hub.HubRouterIpAddress != nil {
+			c.nodes = append(c.nodes, node{id: id + "_router", label: []string{"router", *hub.HubRouterIpAddress}, shape: shapeRouter})
+		}
+		clusters[k] = len(g.clusters)
+		g.clusters = append(g.clusters, c)
+	}
+
+	peerings := v.PeeringMap()
+	for _, p := range SortedPeerings(peerings) {
+		_, reverse := peerings[PeeringName(hubs[p.DstKey].Name, hubs[p.SrcKey].Name)]
+		if reverse && p.SrcKey > p.DstKey {
+			continue
+		}
+		g.edges = append(g.edges, edge{from: ids[p.SrcKey] + "_vnet", to: ids[p.DstKey] + "_vnet", label: []string{"peering"}, kind: edgePeering, bidirectional: reverse})
+	}
+
+	routes := v.RouteMap(nil)
+	nextHops := v.MeshNextHops()
+	for _, kSrc := range keys {
+		table := routes[kSrc]
+		meshRoutes := make(map[string]bool, len(table.MeshRoutes))
+		for _, r := range table.MeshRoutes {
+			meshRoutes[r.Name] = true
+		}
+		for _, kDst := range keys {
+			var prefixes []string
+			for _, cidr := range hubs[kDst].RoutingAddressSpace {
+				if meshRoutes[MeshRouteName(kDst, cidr)] {
+					prefixes = append(prefixes, cidr)
+				}
+			}
+			if len(prefixes) == 0 {
+				continue
+			}
+			g.edges = append(g.edges, edge{from: ids[kSrc] + "_vnet", to: meshNextHop(ids[nextHops[kSrc][kDst]], hubs[nextHops[kSrc][kDst]]), label: prefixes, kind: edgeRoute})
+		}
+
+		userRoutes := append([]RouteTableEntry{}, table.UserRoutes...)
+		sort.Slice(userRoutes, func(i, j int) bool {
+			return userRoutes[i].Name < userRoutes[j].Name
+		})
+		userNextHops := make(map[string]int)
+		var nextHopPrefixes [][]string
+		for _, r := range userRoutes {
+			label := []string{r.NextHopType}
+			if r.NextHopIpAddress != nil {
+				label = append(label, *r.NextHopIpAddress)
+			}
+			key := strings.Join(label, " ")
+			i, ok := userNextHops[key]
+			if !ok {
+				i = len(nextHopPrefixes)
+				userNextHops[key] = i
+				nextHopPrefixes = append(nextHopPrefixes, nil)
+				c := &g.clusters[clusters[kSrc]]
+				c.nodes = append(c.nodes, node{id: fmt.Sprintf("%s_nh%d", ids[kSrc], i), label: label, shape: shapeNextHop})
+			}
+			nextHopPrefixes[i] = append(nextHopPrefixes[i], r.AddressPrefix)
+		}
+		for i, prefixes := range nextHopPrefixes {
+			g.edges = append(g.edges, edge{from: ids[kSrc] + "_vnet", to: fmt.Sprintf("%s_nh%d", ids[kSrc], i), label: prefixes, kind: edgeRoute})
+		}
+	}
+	return g
+}
+
+// meshNextHop returns the node the mesh routes through a hub point to, the firewall when there is one as
+// `local.firewall_private_ip` takes precedence over `hub_router_ip_address`.
+func meshNextHop(id string, hub HubVirtualNetwork) string {
+	if hub.Firewall != nil {
+		return id + "_fw"
+	}
+	if hub.HubRouterIpAddress != nil {
+		return id + "_router"
+	}
+	return id + "_vnet"
+}
+
+func firewallName(key string, f Firewall) string {
+	if f.Name != nil && *f.Name != "" {
+		return *f.Name
+	}
+	return fmt.Sprintf("afw-%s", key)
+}
+
+func mermaidText(lines []string) string {
+	escaped := make([]string, 0, len(lines))
+	for _, l := range lines {
+		escaped = append(escaped, strings.ReplaceAll(l, `"`, "#quot;"))
+	}
+	return `"` + strings.Join(escaped, "<br/>") + `"`
+}
+
+func dotText(lines []string) string {
+	escaped := make([]string, 0, len(lines))
+	for _, l := range lines {
+		escaped = append(escaped, strings.ReplaceAll(strings.ReplaceAll(l, `\`, `\\`), `"`, `\"`))
+	}
+	return `"` + strings.Join(escaped, `\n`) + `"`
+}
@@ -0,0 +1,51 @@
+package hubnetworking
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestRender_ShouldMatchGoldenFiles(t *testing.T) {
+	v, err := LoadVarFile("testdata/mesh.tfvars")
+	require.NoError(t, err)
+	inputs := []struct {
+		golden string
+		render func(io.Writer, Variables) error
+	}{
+		{golden: "testdata/mesh.mmd.golden", render: RenderMermaid},
+		{golden: "testdata/mesh.dot.golden", render: RenderDot},
+	}
+	for _, input := range inputs {
+		i := input
+		t.Run(i.golden, func(t *testing.T) {
+			var actual bytes.Buffer
+			require.NoError(t, i.render(&actual, v))
+			if *update {
+				require.NoError(t, os.WriteFile(i.golden, actual.Bytes(), 0600))
+			}
+			expected, err := os.ReadFile(i.golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), actual.String())
+		})
+	}
+}
+
+func TestRender_ShouldEscapeLabels(t *testing.T) {
+	hubs := HubVirtualNetworks{
+		`a"b`: {Name: "a", AddressSpace: []string{"10.0.0.0/16"}},
+	}
+	var mermaid, dot bytes.Buffer
+	require.NoError(t, RenderMermaid(&mermaid, Variables{HubVirtualNetworks: hubs}))
+	require.NoError(t, RenderDot(&dot, Variables{HubVirtualNetworks: hubs}))
+	assert.Contains(t, mermaid.String(), `subgraph hub0["a#quot;b"]`)
+	assert.Contains(t, dot.String(), `label="a\"b";`)
+	assert.NotContains(t, mermaid.String(), "peering")
+}
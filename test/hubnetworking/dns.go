@@ -0,0 +1,208 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// PrivateLinkDnsZoneNames mirrors `local.private_link_dns_zone_names`, the `privatelink` zones whose name does not depend on
+// the region.
+var PrivateLinkDnsZoneNames = []string{
+	"privatelink.adf.azure.com",
+	"privatelink.afs.azure.net",
+	"privatelink.agentsvc.azure-automation.net",
+	"privatelink.analysis.windows.net",
+	"privatelink.api.azureml.ms",
+	"privatelink.azconfig.io",
+	"privatelink.azure-api.net",
+	"privatelink.azure-automation.net",
+	"privatelink.azure-devices-provisioning.net",
+	"privatelink.azure-devices.net",
+	"privatelink.azurecr.io",
+	"privatelink.azuredatabricks.net",
+	"privatelink.azurehdinsight.net",
+	"privatelink.azurehealthcareapis.com",
+	"privatelink.azurestaticapps.net",
+	"privatelink.azuresynapse.net",
+	"privatelink.azurewebsites.net",
+	"privatelink.blob.core.windows.net",
+	"privatelink.cassandra.cosmos.azure.com",
+	"privatelink.cognitiveservices.azure.com",
+	"privatelink.database.windows.net",
+	"privatelink.datafactory.azure.net",
+	"privatelink.dev.azuresynapse.net",
+	"privatelink.dfs.core.windows.net",
+	"privatelink.digitaltwins.azure.net",
+	"privatelink.directline.botframework.com",
+	"privatelink.documents.azure.com",
+	"privatelink.eventgrid.azure.net",
+	"privatelink.file.core.windows.net",
+	"privatelink.gremlin.cosmos.azure.com",
+	"privatelink.guestconfiguration.azure.com",
+	"privatelink.his.arc.azure.com",
+	"privatelink.kubernetesconfiguration.azure.com",
+	"privatelink.managedhsm.azure.net",
+	"privatelink.mariadb.database.azure.com",
+	"privatelink.media.azure.net",
+	"privatelink.mongo.cosmos.azure.com",
+	"privatelink.monitor.azure.com",
+	"privatelink.mysql.database.azure.com",
+	"privatelink.notebooks.azure.net",
+	"privatelink.ods.opinsights.azure.com",
+	"privatelink.oms.opinsights.azure.com",
+	"privatelink.openai.azure.com",
+	"privatelink.postgres.database.azure.com",
+	"privatelink.prod.migration.windowsazure.com",
+	"privatelink.purview.azure.com",
+	"privatelink.purviewstudio.azure.com",
+	"privatelink.queue.core.windows.net",
+	"privatelink.redis.cache.windows.net",
+	"privatelink.redisenterprise.cache.azure.net",
+	"privatelink.search.windows.net",
+	"privatelink.service.signalr.net",
+	"privatelink.servicebus.windows.net",
+	"privatelink.siterecovery.windowsazure.com",
+	"privatelink.sql.azuresynapse.net",
+	"privatelink.table.core.windows.net",
+	"privatelink.table.cosmos.azure.com",
+	"privatelink.token.botframework.com",
+	"privatelink.vaultcore.azure.net",
+	"privatelink.web.core.windows.net",
+	"privatelink.webpubsub.azure.com",
+	"privatelink.wvd.microsoft.com",
+}
+
+// PrivateDnsZoneVirtualNetworkLink mirrors a value of `local.private_dns_zone_virtual_network_links`.
+type PrivateDnsZoneVirtualNetworkLink struct {
+	Name               string `json:"name"`
+	PrivateDnsZoneName string `json:"private_dns_zone_name"`
+	VirtualNetworkId   string `json:"virtual_network_id"`
+}
+
+// DnsResolverInboundIpAddress mirrors `local.dns_resolver_inbound_ip_addresses`, the static address of the inbound endpoint
+// of the DNS resolver of the hub, the fifth address of its subnet unless set. It reports false for a hub without resolver.
+func (n HubVirtualNetwork) DnsResolverInboundIpAddress() (string, bool) {
+	if n.DnsResolver == nil {
+		return "", false
+	}
+	if n.DnsResolver.InboundEndpointIpAddress != nil {
+		return *n.DnsResolver.InboundEndpointIpAddress, true
+	}
+	p, err := netip.ParsePrefix(n.DnsResolver.InboundSubnetAddressPrefix)
+	if err != nil {
+		return "", false
+	}
+	a := p.Masked().Addr()
+	for i := 0; i < 4; i++ {
+		a = a.Next()
+	}
+	return a.String(), true
+}
+
+// DnsServers computes `local.hub_dns_servers`, the `dns_servers` of each hub or else the inbound endpoint of its DNS resolver.
+// A hub using Azure provided DNS maps to nil.
+func (v Variables) DnsServers() map[string][]string {
+	r := make(map[string][]string)
+	for k, hub := range v.hubVirtualNetworks() {
+		r[k] = hub.DnsServers
+		if ip, ok := hub.DnsResolverInboundIpAddress(); ok && hub.DnsServers == nil {
+			r[k] = []string{ip}
+		}
+	}
+	return r
+}
+
+// FirewallDnsServers mirrors the `dns_servers` of `local.firewalls`: those of the firewall of hub k, or the inbound endpoint
+// of the DNS resolver of the hub for a firewall without policy, which takes its DNS servers from the policy otherwise.
+func (v Variables) FirewallDnsServers(k string) []string {
+	n := v.HubVirtualNetworks[k]
+	fw := n.Firewall
+	if fw == nil {
+		return nil
+	}
+	if _, ok := v.FirewallPolicies[k]; ok || fw.DnsServers != nil || fw.FirewallPolicyId != nil {
+		return fw.DnsServers
+	}
+	if ip, ok := n.DnsResolverInboundIpAddress(); ok {
+		return []string{ip}
+	}
+	return nil
+}
+
+// FirewallPolicyDns mirrors the `dns` of `local.firewall_policies`, the `dns` of policy k, its servers defaulting to the
+// inbound endpoint of the DNS resolver of the hub the policy is keyed by.
+func (v Variables) FirewallPolicyDns(k string) *FirewallPolicyDns {
+	p, ok := v.FirewallPolicies[k]
+	if !ok {
+		return nil
+	}
+	dns := p.Dns
+	ip, ok := v.HubVirtualNetworks[k].DnsResolverInboundIpAddress()
+	if !ok || dns != nil && dns.Servers != nil {
+		return dns
+	}
+	r := FirewallPolicyDns{ProxyEnabled: Bool(false), Servers: []string{ip}}
+	if dns != nil && dns.ProxyEnabled != nil {
+		r.ProxyEnabled = dns.ProxyEnabled
+	}
+	return &r
+}
+
+// PrivateDnsZoneNames computes the keys of `local.private_dns_zones`, `zone_names` and the Private Link zones not excluded,
+// sorted.
+func (v Variables) PrivateDnsZoneNames() []string {
+	if v.PrivateDnsZones == nil {
+		return []string{}
+	}
+	z := v.PrivateDnsZones.WithDefaults()
+	names := make(map[string]bool)
+	for _, name := range z.ZoneNames {
+		names[name] = true
+	}
+	if *z.PrivateLinkZonesEnabled {
+		excluded := make(map[string]bool)
+		for _, name := range z.PrivateLinkZoneExclusions {
+			excluded[name] = true
+		}
+		for _, name := range PrivateLinkDnsZoneNames {
+			if !excluded[name] {
+				names[name] = true
+			}
+		}
+	}
+	r := make([]string, 0, len(names))
+	for name := range names {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// PrivateDnsZoneVirtualNetworkLinks computes `local.private_dns_zone_virtual_network_links`, keyed by `${zone}/${link_name}`.
+// hubVirtualNetworkIds and spokeVirtualNetworkIds play the roles of the `vnet_id` of the hub and spoke virtual network modules,
+// an existing spoke is linked by its `virtual_network_id`.
+func (v Variables) PrivateDnsZoneVirtualNetworkLinks(hubVirtualNetworkIds, spokeVirtualNetworkIds map[string]string) map[string]PrivateDnsZoneVirtualNetworkLink {
+	r := make(map[string]PrivateDnsZoneVirtualNetworkLink)
+	hubs := v.hubVirtualNetworks()
+	spokes := v.SpokeVirtualNetworks.WithDefaults()
+	for _, zone := range v.PrivateDnsZoneNames() {
+		add := func(name, id string) {
+			r[fmt.Sprintf("%s/%s", zone, name)] = PrivateDnsZoneVirtualNetworkLink{Name: name, PrivateDnsZoneName: zone, VirtualNetworkId: id}
+		}
+		for k := range hubs {
+			add(fmt.Sprintf("link-%s", k), hubVirtualNetworkIds[k])
+		}
+		for k, spoke := range spokes {
+			if !*spoke.PrivateDnsZoneLinksEnabled {
+				continue
+			}
+			id := spokeVirtualNetworkIds[k]
+			if spoke.VirtualNetworkId != nil {
+				id = *spoke.VirtualNetworkId
+			}
+			add(fmt.Sprintf("link-spoke-%s", k), id)
+		}
+	}
+	return r
+}
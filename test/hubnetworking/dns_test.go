@@ -0,0 +1,109 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func dnsVariables() Variables {
+	return Variables{
+		HubVirtualNetworks: HubVirtualNetworks{
+			"hub0": {
+				AddressSpace: []string{"10.0.0.0/16"},
+				Firewall:     &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.0.1.0/26"},
+				DnsResolver:  &DnsResolver{InboundSubnetAddressPrefix: "10.0.2.0/28"},
+			},
+			"hub1": {
+				AddressSpace: []string{"10.1.0.0/16"},
+				DnsServers:   []string{"192.168.0.53"},
+				Firewall:     &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.1.1.0/26"},
+				DnsResolver:  &DnsResolver{InboundSubnetAddressPrefix: "10.1.2.0/28", InboundEndpointIpAddress: String("10.1.2.10")},
+			},
+			"hub2": {
+				AddressSpace: []string{"10.2.0.0/16"},
+				Firewall:     &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.2.1.0/26"},
+			},
+		},
+		SpokeVirtualNetworks: SpokeVirtualNetworks{
+			"spoke0": {HubKey: "hub0", AddressSpace: []string{"10.100.0.0/16"}, PrivateDnsZoneLinksEnabled: Bool(true)},
+			"spoke1": {HubKey: "hub1", AddressSpace: []string{"10.101.0.0/16"}, PrivateDnsZoneLinksEnabled: Bool(true), VirtualNetworkId: String("spoke1-existing-id")},
+			"spoke2": {HubKey: "hub1", AddressSpace: []string{"10.102.0.0/16"}},
+		},
+		FirewallPolicies: map[string]FirewallPolicy{
+			"hub1": {Dns: &FirewallPolicyDns{ProxyEnabled: Bool(true)}},
+		},
+		PrivateDnsZones: &PrivateDnsZones{ResourceGroupName: "rg-dns", ZoneNames: []string{"contoso.internal"}},
+	}
+}
+
+func TestDnsResolverInboundIpAddress_ShouldDefaultToTheFirstAddressAzureDoesNotReserve(t *testing.T) {
+	hubs := dnsVariables().HubVirtualNetworks
+	ip, ok := hubs["hub0"].DnsResolverInboundIpAddress()
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.2.4", ip)
+	ip, ok = hubs["hub1"].DnsResolverInboundIpAddress()
+	assert.True(t, ok)
+	assert.Equal(t, "10.1.2.10", ip)
+	_, ok = hubs["hub2"].DnsResolverInboundIpAddress()
+	assert.False(t, ok)
+}
+
+func TestDnsServers_ShouldDefaultToTheDnsResolverOfTheHub(t *testing.T) {
+	assert.Equal(t, map[string][]string{
+		"hub0": {"10.0.2.4"},
+		"hub1": {"192.168.0.53"},
+		"hub2": nil,
+	}, dnsVariables().DnsServers())
+}
+
+func TestFirewallDns_ShouldDefaultToTheDnsResolverOfTheHub(t *testing.T) {
+	v := dnsVariables()
+	assert.Equal(t, []string{"10.0.2.4"}, v.FirewallDnsServers("hub0"))
+	assert.Nil(t, v.FirewallDnsServers("hub1"), "a firewall with a policy takes its DNS servers from the policy")
+	assert.Nil(t, v.FirewallDnsServers("hub2"))
+
+	assert.Nil(t, v.FirewallPolicyDns("hub0"))
+	assert.Equal(t, &FirewallPolicyDns{ProxyEnabled: Bool(true), Servers: []string{"10.1.2.10"}}, v.FirewallPolicyDns("hub1"))
+	v.FirewallPolicies["hub1"] = FirewallPolicy{Dns: &FirewallPolicyDns{Servers: []string{"192.168.0.53"}}}
+	assert.Equal(t, &FirewallPolicyDns{Servers: []string{"192.168.0.53"}}, v.FirewallPolicyDns("hub1"), "explicit servers win over the resolver")
+}
+
+func TestPrivateDnsZoneNames_ShouldAddTheNotExcludedPrivateLinkZones(t *testing.T) {
+	v := dnsVariables()
+	assert.Equal(t, []string{"contoso.internal"}, v.PrivateDnsZoneNames())
+
+	v.PrivateDnsZones.PrivateLinkZonesEnabled = Bool(true)
+	v.PrivateDnsZones.PrivateLinkZoneExclusions = []string{"privatelink.blob.core.windows.net"}
+	names := v.PrivateDnsZoneNames()
+	assert.Len(t, names, len(PrivateLinkDnsZoneNames))
+	assert.Contains(t, names, "contoso.internal")
+	assert.Contains(t, names, "privatelink.vaultcore.azure.net")
+	assert.NotContains(t, names, "privatelink.blob.core.windows.net")
+
+	assert.Empty(t, Variables{}.PrivateDnsZoneNames())
+}
+
+func TestPrivateDnsZoneVirtualNetworkLinks_ShouldLinkEveryHubAndTheListedSpokes(t *testing.T) {
+	links := dnsVariables().PrivateDnsZoneVirtualNetworkLinks(
+		map[string]string{"hub0": "hub0-id", "hub1": "hub1-id", "hub2": "hub2-id"},
+		map[string]string{"spoke0": "spoke0-id", "spoke2": "spoke2-id"},
+	)
+	assert.Equal(t, map[string]PrivateDnsZoneVirtualNetworkLink{
+		"contoso.internal/link-hub0":         {Name: "link-hub0", PrivateDnsZoneName: "contoso.internal", VirtualNetworkId: "hub0-id"},
+		"contoso.internal/link-hub1":         {Name: "link-hub1", PrivateDnsZoneName: "contoso.internal", VirtualNetworkId: "hub1-id"},
+		"contoso.internal/link-hub2":         {Name: "link-hub2", PrivateDnsZoneName: "contoso.internal", VirtualNetworkId: "hub2-id"},
+		"contoso.internal/link-spoke-spoke0": {Name: "link-spoke-spoke0", PrivateDnsZoneName: "contoso.internal", VirtualNetworkId: "spoke0-id"},
+		"contoso.internal/link-spoke-spoke1": {Name: "link-spoke-spoke1", PrivateDnsZoneName: "contoso.internal", VirtualNetworkId: "spoke1-existing-id"},
+	}, links)
+}
+
+func TestPrivateDnsZoneVirtualNetworkLinks_VirtualWanShouldOnlyLinkTheSpokes(t *testing.T) {
+	v := dnsVariables()
+	v.VirtualWan = &VirtualWan{Name: "vwan", Location: "eastus", ResourceGroupName: "rg-vwan"}
+	links := v.PrivateDnsZoneVirtualNetworkLinks(map[string]string{}, map[string]string{"spoke0": "spoke0-id"})
+	assert.Equal(t, map[string]PrivateDnsZoneVirtualNetworkLink{
+		"contoso.internal/link-spoke-spoke0": {Name: "link-spoke-spoke0", PrivateDnsZoneName: "contoso.internal", VirtualNetworkId: "spoke0-id"},
+		"contoso.internal/link-spoke-spoke1": {Name: "link-spoke-spoke1", PrivateDnsZoneName: "contoso.internal", VirtualNetworkId: "spoke1-existing-id"},
+	}, links)
+}
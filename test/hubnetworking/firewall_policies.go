@@ -0,0 +1,192 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FirewallPolicyViolation is a firewall policy setting the variable validations of the module reject.
+type FirewallPolicyViolation struct {
+	PolicyKey string
+	Message   string
+}
+
+func (v FirewallPolicyViolation) Error() string {
+	return v.Message
+}
+
+// FirewallPolicyConflict mirrors an element of `local.firewall_policy_conflicts`.
+type FirewallPolicyConflict struct {
+	PolicyKeys []string `json:"policy_keys"`
+	Message    string   `json:"message"`
+}
+
+func (c FirewallPolicyConflict) Error() string {
+	return c.Message
+}
+
+// ValidateFirewallPolicies mirrors the validations of `var.firewall_policies` in variables.tf:
+//   - base_policy_key must be the key of another policy without base_policy_key,
+//   - tls_certificate requires identity,
+//   - the intrusion_detection mode and signature override states must be Off, Alert or Deny.
+func ValidateFirewallPolicies(v Variables) []FirewallPolicyViolation {
+	v = v.WithDefaults()
+	violations := make([]FirewallPolicyViolation, 0)
+	for _, k := range v.firewallPolicyKeys() {
+		p := v.FirewallPolicies[k]
+		add := func(format string, a ...any) {
+			violations = append(violations, FirewallPolicyViolation{PolicyKey: k, Message: fmt.Sprintf(format, a...)})
+		}
+		if p.BasePolicyKey != nil {
+			if base, ok := v.FirewallPolicies[*p.BasePolicyKey]; !ok || base.BasePolicyKey != nil {
+				add("the base_policy_key %s of firewall policy %s must be the key of a policy without base_policy_key", *p.BasePolicyKey, k)
+			}
+		}
+		if p.TlsCertificate != nil && p.Identity == nil {
+			add("tls_certificate of firewall policy %s requires an identity", k)
+		}
+		if d := p.IntrusionDetection; d != nil {
+			states := map[string]bool{"Off": true, "Alert": true, "Deny": true}
+			if !states[*d.Mode] {
+				add("intrusion_detection mode %s of firewall policy %s must be Off, Alert or Deny", *d.Mode, k)
+			}
+			for _, o := range d.SignatureOverrides {
+				if !states[o.State] {
+					add("state %s of signature override %s of firewall policy %s must be Off, Alert or Deny", o.State, o.Id, k)
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// FirewallPolicyConflicts computes `local.firewall_policy_conflicts` in the same order:
+//   - policies keyed by a hub without firewall,
+//   - policies keyed by a hub whose firewall sets firewall_policy_id,
+//   - policies not keyed by a hub without location or resource_group_name,
+//   - policies whose sku does not match the sku_tier of the firewall of their hub,
+//   - intrusion_detection, tls_certificate and identity without the Premium SKU,
+//   - rule collection groups taking the name or the priority of the generated hub-mesh group.
+func (v Variables) FirewallPolicyConflicts() []FirewallPolicyConflict {
+	v = v.WithDefaults()
+	keys := v.firewallPolicyKeys()
+	conflicts := make([]FirewallPolicyConflict, 0)
+	add := func(k string, format string, a ...any) {
+		conflicts = append(conflicts, FirewallPolicyConflict{PolicyKeys: []string{k}, Message: fmt.Sprintf(format, a...)})
+	}
+	for _, k := range keys {
+		if hub, ok := v.HubVirtualNetworks[k]; ok && hub.Firewall == nil {
+			add(k, "firewall policy %s is keyed by hub %s, which has no firewall", k, k)
+		}
+	}
+	for _, k := range keys {
+		if hub, ok := v.HubVirtualNetworks[k]; ok && hub.Firewall != nil && hub.Firewall.FirewallPolicyId != nil {
+			add(k, "firewall policy %s conflicts with the firewall_policy_id of the firewall of hub %s", k, k)
+		}
+	}
+	for _, k := range keys {
+		p := v.FirewallPolicies[k]
+		if _, ok := v.HubVirtualNetworks[k]; !ok && (p.Location == nil || p.ResourceGroupName == nil) {
+			add(k, "firewall policy %s is not keyed by a hub and requires a location and a resource_group_name", k)
+		}
+	}
+	for _, k := range keys {
+		if hub, ok := v.HubVirtualNetworks[k]; ok && hub.Firewall != nil && v.FirewallPolicySku(k) != hub.Firewall.SkuTier {
+			add(k, "the sku %s of firewall policy %s does not match the sku_tier %s of the firewall of hub %s", v.FirewallPolicySku(k), k, hub.Firewall.SkuTier, k)
+		}
+	}
+	for _, k := range keys {
+		p := v.FirewallPolicies[k]
+		if v.FirewallPolicySku(k) == "Premium" {
+			continue
+		}
+		if p.IntrusionDetection != nil {
+			add(k, "intrusion_detection of firewall policy %s requires the Premium SKU", k)
+		}
+		if p.TlsCertificate != nil {
+			add(k, "tls_certificate of firewall policy %s requires the Premium SKU", k)
+		}
+		if p.Identity != nil {
+			add(k, "identity of firewall policy %s requires the Premium SKU", k)
+		}
+	}
+	for _, k := range keys {
+		p := v.FirewallPolicies[k]
+		if _, ok := v.HubVirtualNetworks[k]; !ok || !*p.MeshRulesEnabled {
+			continue
+		}
+		_, reserved := p.RuleCollectionGroups["hub-mesh"]
+		for _, g := range p.RuleCollectionGroups {
+			reserved = reserved || g.Priority == *p.MeshRulesPriority
+		}
+		if reserved {
+			add(k, "the rule collection groups of firewall policy %s must not be named hub-mesh nor use its mesh_rules_priority %d", k, *p.MeshRulesPriority)
+		}
+	}
+	return conflicts
+}
+
+// FirewallPolicySku mirrors the `sku` of `local.firewall_policies`: that of the policy, or the sku_tier of the firewall
+// of the hub the policy is keyed by, or Standard.
+func (v Variables) FirewallPolicySku(k string) string {
+	if p := v.FirewallPolicies[k]; p.Sku != nil {
+		return *p.Sku
+	}
+	if hub, ok := v.HubVirtualNetworks[k]; ok && hub.Firewall != nil {
+		return hub.Firewall.SkuTier
+	}
+	return "Standard"
+}
+
+func (v Variables) firewallPolicyKeys() []string {
+	keys := make([]string, 0, len(v.FirewallPolicies))
+	for k := range v.FirewallPolicies {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FirewallPolicyMeshRules computes `local.firewall_policy_mesh_rules`, the network rules allowing the mesh traffic
+// each firewall with a module managed policy and `mesh_rules_enabled` forwards. There is a rule from every hub to every
+// hub it routes to, see RouteMap, when the firewall belongs to either hub or to the transit hub in between.
+func (v Variables) FirewallPolicyMeshRules() map[string][]NetworkRule {
+	v = v.WithDefaults()
+	nextHops := v.MeshNextHops()
+	prefixes := v.MeshPrefixes()
+	addresses := func(k string) []string {
+		r := make([]string, 0, len(prefixes[k]))
+		for _, p := range prefixes[k] {
+			r = append(r, p.AddressPrefix)
+		}
+		return r
+	}
+	r := make(map[string][]NetworkRule)
+	for k, hub := range v.HubVirtualNetworks {
+		if p, ok := v.FirewallPolicies[k]; hub.Firewall == nil || !ok || !*p.MeshRulesEnabled {
+			continue
+		}
+		rules := make([]NetworkRule, 0)
+		for _, kSrc := range v.HubVirtualNetworks.Keys() {
+			dsts := make([]string, 0, len(nextHops[kSrc]))
+			for kDst := range nextHops[kSrc] {
+				dsts = append(dsts, kDst)
+			}
+			sort.Strings(dsts)
+			for _, kDst := range dsts {
+				if !contains([]string{kSrc, kDst, nextHops[kSrc][kDst]}, k) || len(prefixes[kSrc]) == 0 || len(prefixes[kDst]) == 0 {
+					continue
+				}
+				rules = append(rules, NetworkRule{
+					Name:                 fmt.Sprintf("%s-to-%s", kSrc, kDst),
+					Protocols:            []string{"Any"},
+					DestinationPorts:     []string{"*"},
+					SourceAddresses:      addresses(kSrc),
+					DestinationAddresses: addresses(kDst),
+				})
+			}
+		}
+		r[k] = rules
+	}
+	return r
+}
@@ -0,0 +1,215 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirewallPolicyMeshRules_TransitFirewallShouldAllowTrafficItForwards(t *testing.T) {
+	fw := &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard"}
+	v := Variables{
+		HubVirtualNetworks: HubVirtualNetworks{
+			"hub0": {Name: "vnet0", RoutingAddressSpace: []string{"10.0.0.0/16"}, Firewall: fw},
+			"hub1": {Name: "vnet1", RoutingAddressSpace: []string{"10.1.0.0/16"}, Firewall: fw},
+			"hub2": {Name: "vnet2", RoutingAddressSpace: []string{"10.2.0.0/16"}, HubRouterIpAddress: String("10.2.0.4")},
+			"hub3": {Name: "vnet3", Firewall: fw},
+		},
+		HubMeshTopology: &MeshTopology{Type: String(MeshTopologyHubAndSpoke), TransitHubKey: String("hub0")},
+		FirewallPolicies: map[string]FirewallPolicy{
+			"hub0": {},
+			"hub1": {MeshRulesEnabled: Bool(true)},
+			"hub3": {MeshRulesEnabled: Bool(false)},
+		},
+	}
+	rule := func(src, dst, srcCidr, dstCidr string) NetworkRule {
+		return NetworkRule{
+			Name:                 src + "-to-" + dst,
+			Protocols:            []string{"Any"},
+			DestinationPorts:     []string{"*"},
+			SourceAddresses:      []string{srcCidr},
+			DestinationAddresses: []string{dstCidr},
+		}
+	}
+	assert.Equal(t, map[string][]NetworkRule{
+		"hub0": {
+			rule("hub0", "hub1", "10.0.0.0/16", "10.1.0.0/16"),
+			rule("hub0", "hub2", "10.0.0.0/16", "10.2.0.0/16"),
+			rule("hub1", "hub0", "10.1.0.0/16", "10.0.0.0/16"),
+			rule("hub1", "hub2", "10.1.0.0/16", "10.2.0.0/16"),
+			rule("hub2", "hub0", "10.2.0.0/16", "10.0.0.0/16"),
+			rule("hub2", "hub1", "10.2.0.0/16", "10.1.0.0/16"),
+		},
+		"hub1": {
+			rule("hub0", "hub1", "10.0.0.0/16", "10.1.0.0/16"),
+			rule("hub1", "hub0", "10.1.0.0/16", "10.0.0.0/16"),
+			rule("hub1", "hub2", "10.1.0.0/16", "10.2.0.0/16"),
+			rule("hub2", "hub1", "10.2.0.0/16", "10.1.0.0/16"),
+		},
+	}, v.FirewallPolicyMeshRules())
+}
+
+func TestValidateFirewallPolicies(t *testing.T) {
+	tls := &TlsCertificate{Name: "ca", KeyVaultSecretId: "https://kv.vault.azure.net/secrets/ca"}
+	identity := &PolicyIdentity{IdentityIds: []string{"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/afw"}}
+	policies := func(p map[string]FirewallPolicy) Variables {
+		return Variables{FirewallPolicies: p}
+	}
+	inputs := []struct {
+		name     string
+		v        Variables
+		expected []string
+	}{
+		{name: "policy inheriting from a parent", v: policies(map[string]FirewallPolicy{"base": {}, "hub0": {BasePolicyKey: String("base")}})},
+		{name: "tls inspection with identity", v: policies(map[string]FirewallPolicy{"hub0": {TlsCertificate: tls, Identity: identity}})},
+		{
+			name:     "unknown parent",
+			v:        policies(map[string]FirewallPolicy{"hub0": {BasePolicyKey: String("base")}}),
+			expected: []string{"the base_policy_key base of firewall policy hub0 must be the key of a policy without base_policy_key"},
+		},
+		{
+			name: "parent with a parent",
+			v:    policies(map[string]FirewallPolicy{"base": {BasePolicyKey: String("base")}, "hub0": {BasePolicyKey: String("base")}}),
+			expected: []string{
+				"the base_policy_key base of firewall policy base must be the key of a policy without base_policy_key",
+				"the base_policy_key base of firewall policy hub0 must be the key of a policy without base_policy_key",
+			},
+		},
+		{
+			name:     "tls inspection without identity",
+			v:        policies(map[string]FirewallPolicy{"hub0": {TlsCertificate: tls}}),
+			expected: []string{"tls_certificate of firewall policy hub0 requires an identity"},
+		},
+		{
+			name: "invalid intrusion detection states",
+			v: policies(map[string]FirewallPolicy{"hub0": {IntrusionDetection: &IntrusionDetection{
+				Mode:               String("Block"),
+				SignatureOverrides: []SignatureOverride{{Id: "2024897", State: "Drop"}},
+			}}}),
+			expected: []string{
+				"intrusion_detection mode Block of firewall policy hub0 must be Off, Alert or Deny",
+				"state Drop of signature override 2024897 of firewall policy hub0 must be Off, Alert or Deny",
+			},
+		},
+	}
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			messages := make([]string, 0)
+			for _, v := range ValidateFirewallPolicies(input.v) {
+				messages = append(messages, v.Message)
+			}
+			if input.expected == nil {
+				input.expected = []string{}
+			}
+			assert.Equal(t, input.expected, messages)
+		})
+	}
+}
+
+func TestFirewallPolicyConflicts(t *testing.T) {
+	idps := &IntrusionDetection{Mode: String("Deny"), SignatureOverrides: []SignatureOverride{{Id: "2024897", State: "Off"}}}
+	tls := &TlsCertificate{Name: "ca", KeyVaultSecretId: "https://kv.vault.azure.net/secrets/ca"}
+	identity := &PolicyIdentity{IdentityIds: []string{"/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/afw"}}
+	hub := func(tier string, p FirewallPolicy) Variables {
+		return Variables{
+			HubVirtualNetworks: HubVirtualNetworks{
+				"hub0": {Name: "vnet0", Firewall: &Firewall{SkuName: "AZFW_VNet", SkuTier: tier}},
+			},
+			FirewallPolicies: map[string]FirewallPolicy{"hub0": p},
+		}
+	}
+	inputs := []struct {
+		name     string
+		v        Variables
+		expected []string
+	}{
+		{name: "premium policy with every premium setting", v: hub("Premium", FirewallPolicy{IntrusionDetection: idps, TlsCertificate: tls, Identity: identity})},
+		{name: "premium policy without premium settings", v: hub("Premium", FirewallPolicy{})},
+		{name: "standard policy without premium settings", v: hub("Standard", FirewallPolicy{})},
+		{name: "no firewall policy", v: Variables{HubVirtualNetworks: HubVirtualNetworks{"hub0": {Firewall: &Firewall{SkuTier: "Standard"}}}}},
+		{
+			name: "standalone policy with location and resource group",
+			v:    Variables{FirewallPolicies: map[string]FirewallPolicy{"base": {Location: String("eastus"), ResourceGroupName: String("rg")}}},
+		},
+		{
+			name:     "standalone policy without resource group",
+			v:        Variables{FirewallPolicies: map[string]FirewallPolicy{"base": {Location: String("eastus")}}},
+			expected: []string{"firewall policy base is not keyed by a hub and requires a location and a resource_group_name"},
+		},
+		{
+			name: "hub policy without firewall",
+			v: Variables{
+				HubVirtualNetworks: HubVirtualNetworks{"hub0": {Name: "vnet0"}},
+				FirewallPolicies:   map[string]FirewallPolicy{"hub0": {}},
+			},
+			expected: []string{"firewall policy hub0 is keyed by hub hub0, which has no firewall"},
+		},
+		{
+			name: "hub policy and firewall_policy_id",
+			v: Variables{
+				HubVirtualNetworks: HubVirtualNetworks{"hub0": {Name: "vnet0", Firewall: &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", FirewallPolicyId: String("policy_id")}}},
+				FirewallPolicies:   map[string]FirewallPolicy{"hub0": {}},
+			},
+			expected: []string{"firewall policy hub0 conflicts with the firewall_policy_id of the firewall of hub hub0"},
+		},
+		{
+			name:     "standard policy with intrusion detection",
+			v:        hub("Standard", FirewallPolicy{IntrusionDetection: idps}),
+			expected: []string{"intrusion_detection of firewall policy hub0 requires the Premium SKU"},
+		},
+		{
+			name: "standard policy with tls inspection",
+			v:    hub("Standard", FirewallPolicy{TlsCertificate: tls, Identity: identity}),
+			expected: []string{
+				"tls_certificate of firewall policy hub0 requires the Premium SKU",
+				"identity of firewall policy hub0 requires the Premium SKU",
+			},
+		},
+		{
+			name:     "basic policy with identity only",
+			v:        hub("Basic", FirewallPolicy{Identity: identity}),
+			expected: []string{"identity of firewall policy hub0 requires the Premium SKU"},
+		},
+		{
+			name:     "premium policy on a standard firewall",
+			v:        hub("Standard", FirewallPolicy{Sku: String("Premium"), IntrusionDetection: idps}),
+			expected: []string{"the sku Premium of firewall policy hub0 does not match the sku_tier Standard of the firewall of hub hub0"},
+		},
+		{
+			name: "standalone standard policy with premium settings",
+			v: Variables{FirewallPolicies: map[string]FirewallPolicy{
+				"base": {Location: String("eastus"), ResourceGroupName: String("rg"), IntrusionDetection: idps, TlsCertificate: tls, Identity: identity},
+			}},
+			expected: []string{
+				"intrusion_detection of firewall policy base requires the Premium SKU",
+				"tls_certificate of firewall policy base requires the Premium SKU",
+				"identity of firewall policy base requires the Premium SKU",
+			},
+		},
+		{
+			name: "rule collection group with the mesh rules priority",
+			v: hub("Standard", FirewallPolicy{RuleCollectionGroups: map[string]RuleCollectionGroup{
+				"egress": {Priority: 100},
+			}}),
+			expected: []string{"the rule collection groups of firewall policy hub0 must not be named hub-mesh nor use its mesh_rules_priority 100"},
+		},
+		{
+			name: "standalone policy with the mesh rules priority",
+			v: Variables{FirewallPolicies: map[string]FirewallPolicy{
+				"base": {Location: String("eastus"), ResourceGroupName: String("rg"), RuleCollectionGroups: map[string]RuleCollectionGroup{"egress": {Priority: 100}}},
+			}},
+		},
+	}
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			messages := make([]string, 0)
+			for _, c := range input.v.FirewallPolicyConflicts() {
+				messages = append(messages, c.Message)
+			}
+			if input.expected == nil {
+				input.expected = []string{}
+			}
+			assert.Equal(t, input.expected, messages)
+		})
+	}
+}
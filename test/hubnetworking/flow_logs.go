@@ -0,0 +1,81 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NetworkWatcherFlowLog mirrors a value of `local.flow_logs`, the flow log of a hub virtual network.
+type NetworkWatcherFlowLog struct {
+	Name                            string                          `json:"name"`
+	Location                        string                          `json:"location"`
+	NetworkWatcherName              string                          `json:"network_watcher_name"`
+	NetworkWatcherResourceGroupName string                          `json:"network_watcher_resource_group_name"`
+	StorageAccountId                string                          `json:"storage_account_id"`
+	Enabled                         bool                            `json:"enabled"`
+	RetentionDays                   int                             `json:"retention_days"`
+	TrafficAnalytics                *NetworkWatcherTrafficAnalytics `json:"traffic_analytics"`
+	Tags                            map[string]string               `json:"tags"`
+}
+
+// NetworkWatcherTrafficAnalytics mirrors the `traffic_analytics` of a value of `local.flow_logs`.
+type NetworkWatcherTrafficAnalytics struct {
+	WorkspaceId         string `json:"workspace_id"`
+	WorkspaceResourceId string `json:"workspace_resource_id"`
+	WorkspaceRegion     string `json:"workspace_region"`
+	IntervalInMinutes   int    `json:"interval_in_minutes"`
+}
+
+// normalizedLocation turns an Azure location into the form of its programmatic name, e.g. `eastus` for `East US`.
+func normalizedLocation(location string) string {
+	return strings.ToLower(strings.ReplaceAll(location, " ", ""))
+}
+
+// NetworkWatcher returns the Network Watcher of the location, the one of `var.network_watchers` or else the one Azure
+// creates in the region.
+func (v Variables) NetworkWatcher(location string) NetworkWatcher {
+	for l, w := range v.NetworkWatchers {
+		if normalizedLocation(l) == normalizedLocation(location) {
+			return w
+		}
+	}
+	return NetworkWatcher{Name: fmt.Sprintf("NetworkWatcher_%s", normalizedLocation(location)), ResourceGroupName: "NetworkWatcherRG"}
+}
+
+// FlowLogs computes `local.flow_logs`, the flow log of each hub virtual network with a `flow_log`.
+func (v Variables) FlowLogs() map[string]NetworkWatcherFlowLog {
+	r := make(map[string]NetworkWatcherFlowLog)
+	for k, hub := range v.hubVirtualNetworks() {
+		f := hub.FlowLog
+		if f == nil {
+			continue
+		}
+		w := v.NetworkWatcher(hub.Location)
+		l := NetworkWatcherFlowLog{
+			Name:                            fmt.Sprintf("fl-%s", k),
+			Location:                        hub.Location,
+			NetworkWatcherName:              w.Name,
+			NetworkWatcherResourceGroupName: w.ResourceGroupName,
+			StorageAccountId:                f.StorageAccountId,
+			Enabled:                         *f.Enabled,
+			RetentionDays:                   *f.RetentionDays,
+			Tags:                            f.Tags,
+		}
+		if f.Name != nil {
+			l.Name = *f.Name
+		}
+		if a := f.TrafficAnalytics; a != nil {
+			l.TrafficAnalytics = &NetworkWatcherTrafficAnalytics{
+				WorkspaceId:         a.WorkspaceId,
+				WorkspaceResourceId: a.WorkspaceResourceId,
+				WorkspaceRegion:     hub.Location,
+				IntervalInMinutes:   *a.IntervalInMinutes,
+			}
+			if a.WorkspaceRegion != nil {
+				l.TrafficAnalytics.WorkspaceRegion = *a.WorkspaceRegion
+			}
+		}
+		r[k] = l
+	}
+	return r
+}
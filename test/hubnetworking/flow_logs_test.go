@@ -0,0 +1,77 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func flowLogVariables() Variables {
+	return Variables{
+		HubVirtualNetworks: HubVirtualNetworks{
+			"hub0": {
+				Location:     "eastus",
+				AddressSpace: []string{"10.0.0.0/16"},
+				FlowLog:      &FlowLog{StorageAccountId: "storage0-id"},
+			},
+			"hub1": {
+				Location:     "West Europe",
+				AddressSpace: []string{"10.1.0.0/16"},
+				FlowLog: &FlowLog{
+					StorageAccountId: "storage1-id",
+					Name:             String("flowlog1"),
+					RetentionDays:    Int(30),
+					TrafficAnalytics: &TrafficAnalytics{WorkspaceId: "workspace-guid", WorkspaceResourceId: "workspace-id"},
+				},
+			},
+			"hub2": {
+				Location:     "eastus",
+				AddressSpace: []string{"10.2.0.0/16"},
+			},
+		},
+		NetworkWatchers: map[string]NetworkWatcher{
+			"westeurope": {Name: "nw-weu", ResourceGroupName: "rg-nw"},
+		},
+	}
+}
+
+func TestNetworkWatcher_ShouldDefaultToTheOneAzureCreatesInTheRegion(t *testing.T) {
+	v := flowLogVariables()
+	assert.Equal(t, NetworkWatcher{Name: "NetworkWatcher_eastus", ResourceGroupName: "NetworkWatcherRG"}, v.NetworkWatcher("eastus"))
+	assert.Equal(t, NetworkWatcher{Name: "NetworkWatcher_northeurope", ResourceGroupName: "NetworkWatcherRG"}, v.NetworkWatcher("North Europe"))
+	assert.Equal(t, NetworkWatcher{Name: "nw-weu", ResourceGroupName: "rg-nw"}, v.NetworkWatcher("West Europe"))
+}
+
+func TestFlowLogs_ShouldOnlyCoverTheHubsWithAFlowLog(t *testing.T) {
+	assert.Equal(t, map[string]NetworkWatcherFlowLog{
+		"hub0": {
+			Name:                            "fl-hub0",
+			Location:                        "eastus",
+			NetworkWatcherName:              "NetworkWatcher_eastus",
+			NetworkWatcherResourceGroupName: "NetworkWatcherRG",
+			StorageAccountId:                "storage0-id",
+			Enabled:                         true,
+		},
+		"hub1": {
+			Name:                            "flowlog1",
+			Location:                        "West Europe",
+			NetworkWatcherName:              "nw-weu",
+			NetworkWatcherResourceGroupName: "rg-nw",
+			StorageAccountId:                "storage1-id",
+			Enabled:                         true,
+			RetentionDays:                   30,
+			TrafficAnalytics: &NetworkWatcherTrafficAnalytics{
+				WorkspaceId:         "workspace-guid",
+				WorkspaceResourceId: "workspace-id",
+				WorkspaceRegion:     "West Europe",
+				IntervalInMinutes:   60,
+			},
+		},
+	}, flowLogVariables().FlowLogs())
+}
+
+func TestFlowLogs_VirtualWanShouldHaveNone(t *testing.T) {
+	v := flowLogVariables()
+	v.VirtualWan = &VirtualWan{Name: "vwan", Location: "eastus", ResourceGroupName: "rg-vwan"}
+	assert.Empty(t, v.FlowLogs())
+}
@@ -0,0 +1,115 @@
+package hubnetworking
+
+import "fmt"
+
+// VirtualNetworkGatewayPublicIp mirrors a value of `local.virtual_network_gateway_public_ips`.
+type VirtualNetworkGatewayPublicIp struct {
+	Key                 string            `json:"key"`
+	HubKey              string            `json:"hub_key"`
+	IpConfigurationName string            `json:"ip_configuration_name"`
+	Location            string            `json:"location"`
+	Name                string            `json:"name"`
+	ResourceGroupName   string            `json:"resource_group_name"`
+	Tags                map[string]string `json:"tags"`
+	Zones               []string          `json:"zones"`
+}
+
+// VirtualNetworkGatewayIpConfiguration mirrors an element of `ip_configurations` in `local.virtual_network_gateways`.
+type VirtualNetworkGatewayIpConfiguration struct {
+	Name              string `json:"name"`
+	PublicIpAddressId string `json:"public_ip_address_id"`
+	SubnetId          string `json:"subnet_id"`
+}
+
+// VirtualNetworkGatewayConfig mirrors a value of `local.virtual_network_gateways`.
+type VirtualNetworkGatewayConfig struct {
+	Name              string                                 `json:"name"`
+	Location          string                                 `json:"location"`
+	ResourceGroupName string                                 `json:"resource_group_name"`
+	Type              string                                 `json:"type"`
+	Sku               string                                 `json:"sku"`
+	VpnType           *string                                `json:"vpn_type"`
+	Generation        *string                                `json:"generation"`
+	ActiveActive      bool                                   `json:"active_active"`
+	EnableBgp         bool                                   `json:"enable_bgp"`
+	BgpSettings       *BgpSettings                           `json:"bgp_settings"`
+	Tags              map[string]string                      `json:"tags"`
+	IpConfigurations  []VirtualNetworkGatewayIpConfiguration `json:"ip_configurations"`
+}
+
+// ipConfigurationNames returns the names of the ip configurations of the gateway, the second one only in active-active mode.
+func (g VirtualNetworkGateway) ipConfigurationNames() []string {
+	if *g.ActiveActive {
+		return []string{"default", "activeActive"}
+	}
+	return []string{"default"}
+}
+
+// VirtualNetworkGatewayPublicIps computes `local.virtual_network_gateway_public_ips`, one public ip per
+// ip configuration of each gateway keyed by `${hub_key}-${ip_configuration_name}`.
+func (h HubVirtualNetworks) VirtualNetworkGatewayPublicIps() map[string]VirtualNetworkGatewayPublicIp {
+	r := make(map[string]VirtualNetworkGatewayPublicIp)
+	for k, hub := range h.WithDefaults() {
+		if hub.VirtualNetworkGateway == nil {
+			continue
+		}
+		for _, ipConfigurationName := range hub.VirtualNetworkGateway.ipConfigurationNames() {
+			name := fmt.Sprintf("pip-vgw-%s", k)
+			if ipConfigurationName != "default" {
+				name = fmt.Sprintf("%s-%s", name, ipConfigurationName)
+			}
+			key := fmt.Sprintf("%s-%s", k, ipConfigurationName)
+			r[key] = VirtualNetworkGatewayPublicIp{
+				Key:                 key,
+				HubKey:              k,
+				IpConfigurationName: ipConfigurationName,
+				Location:            hub.Location,
+				Name:                name,
+				ResourceGroupName:   hub.ResourceGroupName,
+				Tags:                hub.VirtualNetworkGateway.Tags,
+				Zones:               hub.VirtualNetworkGateway.PublicIpZones,
+			}
+		}
+	}
+	return r
+}
+
+// VirtualNetworkGateways computes `local.virtual_network_gateways`. gatewaySubnetIds and publicIpIds play the roles of
+// `local.gateway_subnet_ids`, keyed by hub, and `local.virtual_network_gateway_public_ip_ids`, keyed as the public ips are.
+func (h HubVirtualNetworks) VirtualNetworkGateways(gatewaySubnetIds, publicIpIds map[string]string) map[string]VirtualNetworkGatewayConfig {
+	r := make(map[string]VirtualNetworkGatewayConfig)
+	for k, hub := range h.WithDefaults() {
+		gw := hub.VirtualNetworkGateway
+		if gw == nil {
+			continue
+		}
+		name := fmt.Sprintf("vgw-%s", k)
+		if gw.Name != nil {
+			name = *gw.Name
+		}
+		c := VirtualNetworkGatewayConfig{
+			Name:              name,
+			Location:          hub.Location,
+			ResourceGroupName: hub.ResourceGroupName,
+			Type:              gw.Type,
+			Sku:               gw.Sku,
+			ActiveActive:      *gw.ActiveActive,
+			EnableBgp:         *gw.EnableBgp,
+			BgpSettings:       gw.BgpSettings,
+			Tags:              gw.Tags,
+		}
+		if gw.Type == "Vpn" {
+			c.VpnType = gw.VpnType
+			c.Generation = gw.Generation
+		}
+		for _, ipConfigurationName := range gw.ipConfigurationNames() {
+			c.IpConfigurations = append(c.IpConfigurations, VirtualNetworkGatewayIpConfiguration{
+				Name:              ipConfigurationName,
+				PublicIpAddressId: publicIpIds[fmt.Sprintf("%s-%s", k, ipConfigurationName)],
+				SubnetId:          gatewaySubnetIds[k],
+			})
+		}
+		r[k] = c
+	}
+	return r
+}
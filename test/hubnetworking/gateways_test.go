@@ -0,0 +1,98 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func gatewayVariables() HubVirtualNetworks {
+	return HubVirtualNetworks{
+		"hub0": {
+			Name:              "vnet0",
+			Location:          "eastus",
+			ResourceGroupName: "rg0",
+			VirtualNetworkGateway: &VirtualNetworkGateway{
+				Type:                "Vpn",
+				Sku:                 "VpnGw1AZ",
+				SubnetAddressPrefix: "10.0.255.0/27",
+				ActiveActive:        Bool(true),
+				EnableBgp:           Bool(true),
+				BgpSettings:         &BgpSettings{Asn: Int(65515)},
+				PublicIpZones:       []string{"1", "2", "3"},
+			},
+		},
+		"hub1": {
+			Name:              "vnet1",
+			Location:          "westus",
+			ResourceGroupName: "rg1",
+			VirtualNetworkGateway: &VirtualNetworkGateway{
+				Type:                "ExpressRoute",
+				Sku:                 "ErGw1AZ",
+				SubnetAddressPrefix: "10.1.255.0/27",
+				Name:                String("ergw"),
+				Generation:          String("Generation2"),
+			},
+		},
+		"hub2": {Name: "vnet2", Location: "eastus", ResourceGroupName: "rg2"},
+	}
+}
+
+func TestVirtualNetworkGatewayPublicIps_ShouldCreateSecondIpForActiveActive(t *testing.T) {
+	assert.Equal(t, map[string]VirtualNetworkGatewayPublicIp{
+		"hub0-default":      {Key: "hub0-default", HubKey: "hub0", IpConfigurationName: "default", Location: "eastus", Name: "pip-vgw-hub0", ResourceGroupName: "rg0", Zones: []string{"1", "2", "3"}},
+		"hub0-activeActive": {Key: "hub0-activeActive", HubKey: "hub0", IpConfigurationName: "activeActive", Location: "eastus", Name: "pip-vgw-hub0-activeActive", ResourceGroupName: "rg0", Zones: []string{"1", "2", "3"}},
+		"hub1-default":      {Key: "hub1-default", HubKey: "hub1", IpConfigurationName: "default", Location: "westus", Name: "pip-vgw-hub1", ResourceGroupName: "rg1"},
+	}, gatewayVariables().VirtualNetworkGatewayPublicIps())
+}
+
+func TestVirtualNetworkGateways(t *testing.T) {
+	gateways := gatewayVariables().VirtualNetworkGateways(
+		map[string]string{"hub0": "hub0-subnet-id", "hub1": "hub1-subnet-id"},
+		map[string]string{"hub0-default": "pip0-id", "hub0-activeActive": "pip0-aa-id", "hub1-default": "pip1-id"},
+	)
+	assert.Equal(t, map[string]VirtualNetworkGatewayConfig{
+		"hub0": {
+			Name:              "vgw-hub0",
+			Location:          "eastus",
+			ResourceGroupName: "rg0",
+			Type:              "Vpn",
+			Sku:               "VpnGw1AZ",
+			VpnType:           String("RouteBased"),
+			ActiveActive:      true,
+			EnableBgp:         true,
+			BgpSettings:       &BgpSettings{Asn: Int(65515)},
+			IpConfigurations: []VirtualNetworkGatewayIpConfiguration{
+				{Name: "default", PublicIpAddressId: "pip0-id", SubnetId: "hub0-subnet-id"},
+				{Name: "activeActive", PublicIpAddressId: "pip0-aa-id", SubnetId: "hub0-subnet-id"},
+			},
+		},
+		"hub1": {
+			Name:              "ergw",
+			Location:          "westus",
+			ResourceGroupName: "rg1",
+			Type:              "ExpressRoute",
+			Sku:               "ErGw1AZ",
+			IpConfigurations: []VirtualNetworkGatewayIpConfiguration{
+				{Name: "default", PublicIpAddressId: "pip1-id", SubnetId: "hub1-subnet-id"},
+			},
+		},
+	}, gateways)
+}
+
+func TestPeeringMap_GatewayTransitShouldBeAllowedWithOrWithoutGateway(t *testing.T) {
+	peerings := Variables{HubVirtualNetworks: gatewayVariables()}.PeeringMap()
+	assert.True(t, peerings["vnet0-vnet2"].AllowGatewayTransit)
+	assert.True(t, peerings["vnet1-vnet2"].AllowGatewayTransit)
+	assert.True(t, peerings["vnet2-vnet0"].AllowGatewayTransit, "hub peerings keep allowing gateway transit without gateway")
+}
+
+func TestPeeringMap_RouteServerShouldAllowGatewayTransit(t *testing.T) {
+	hubs := HubVirtualNetworks{
+		"hub0": {Name: "vnet0", RouteServer: &RouteServer{SubnetAddressPrefix: "10.0.3.0/27"}},
+		"hub1": {Name: "vnet1", MeshPeeringSettings: &PeeringSettings{UseRemoteGateways: Bool(true)}},
+	}
+	peerings := Variables{HubVirtualNetworks: hubs}.PeeringMap()
+	assert.True(t, peerings["vnet0-vnet1"].AllowGatewayTransit)
+	assert.False(t, peerings["vnet1-vnet0"].AllowGatewayTransit, "a peering using the remote gateways cannot allow gateway transit")
+}
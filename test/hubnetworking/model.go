@@ -0,0 +1,533 @@
+// Package hubnetworking models the inputs of the hub networking module and re-implements
+// parts of its logic in Go, so that tooling and tests share one definition of the schema.
+package hubnetworking
+
+// Variables mirrors the root module input variables as they appear in a tfvars file.
+type Variables struct {
+	HubVirtualNetworks   HubVirtualNetworks        `json:"hub_virtual_networks,omitempty"`
+	HubMeshTopology      *MeshTopology             `json:"hub_mesh_topology,omitempty"`
+	SpokeVirtualNetworks SpokeVirtualNetworks      `json:"spoke_virtual_networks,omitempty"`
+	FirewallPolicies     map[string]FirewallPolicy `json:"firewall_policies,omitempty"`
+	VirtualWan           *VirtualWan               `json:"virtual_wan,omitempty"`
+	PrivateDnsZones      *PrivateDnsZones          `json:"private_dns_zones,omitempty"`
+	DdosProtectionPlan   *DdosProtectionPlan       `json:"ddos_protection_plan,omitempty"`
+	DiagnosticSettings   *DiagnosticSettings       `json:"diagnostic_settings,omitempty"`
+	NetworkWatchers      map[string]NetworkWatcher `json:"network_watchers,omitempty"`
+	TracingTagsEnabled   *bool                     `json:"tracing_tags_enabled,omitempty"`
+	TracingTagsPrefix    *string                   `json:"tracing_tags_prefix,omitempty"`
+}
+
+// MeshTopology mirrors `var.hub_mesh_topology`.
+type MeshTopology struct {
+	Type          *string             `json:"type,omitempty"`
+	TransitHubKey *string             `json:"transit_hub_key,omitempty"`
+	Groups        map[string][]string `json:"groups,omitempty"`
+	AllowedPairs  [][]string          `json:"allowed_pairs,omitempty"`
+	DeniedPairs   [][]string          `json:"denied_pairs,omitempty"`
+}
+
+// HubVirtualNetworks mirrors `var.hub_virtual_networks`, keyed by the arbitrary hub map key.
+type HubVirtualNetworks map[string]HubVirtualNetwork
+
+// HubVirtualNetwork mirrors one element of `var.hub_virtual_networks`.
+// Optional attributes whose Terraform default differs from the Go zero value are pointers,
+// so an unset attribute is omitted from the generated tfvars and Terraform applies its own default.
+type HubVirtualNetwork struct {
+	Name                         string                     `json:"name"`
+	AddressSpace                 []string                   `json:"address_space"`
+	Location                     string                     `json:"location"`
+	ResourceGroupName            string                     `json:"resource_group_name"`
+	RouteTableName               *string                    `json:"route_table_name,omitempty"`
+	RouteTableTags               map[string]string          `json:"route_table_tags,omitempty"`
+	BgpCommunity                 *string                    `json:"bgp_community,omitempty"`
+	BgpRoutePropagationEnabled   *bool                      `json:"bgp_route_propagation_enabled,omitempty"`
+	DdosProtectionPlanId         *string                    `json:"ddos_protection_plan_id,omitempty"`
+	DnsServers                   []string                   `json:"dns_servers,omitempty"`
+	FlowTimeoutInMinutes         *int                       `json:"flow_timeout_in_minutes,omitempty"`
+	MeshPeeringEnabled           *bool                      `json:"mesh_peering_enabled,omitempty"`
+	MeshPeeringSettings          *PeeringSettings           `json:"mesh_peering_settings,omitempty"`
+	MeshPeeringOverrides         map[string]PeeringSettings `json:"mesh_peering_overrides,omitempty"`
+	ResourceGroupCreationEnabled *bool                      `json:"resource_group_creation_enabled,omitempty"`
+	ResourceGroupLockEnabled     *bool                      `json:"resource_group_lock_enabled,omitempty"`
+	ResourceGroupLockName        *string                    `json:"resource_group_lock_name,omitempty"`
+	ResourceGroupTags            map[string]string          `json:"resource_group_tags,omitempty"`
+	RoutingAddressSpace          []string                   `json:"routing_address_space,omitempty"`
+	HubRouterIpAddress           *string                    `json:"hub_router_ip_address,omitempty"`
+	HubRouterIpv6Address         *string                    `json:"hub_router_ipv6_address,omitempty"`
+	Tags                         map[string]string          `json:"tags,omitempty"`
+	RouteTableEntries            []RouteTableEntry          `json:"route_table_entries,omitempty"`
+	DefaultRoute                 *DefaultRoute              `json:"default_route,omitempty"`
+	Subnets                      map[string]Subnet          `json:"subnets,omitempty"`
+	Firewall                     *Firewall                  `json:"firewall,omitempty"`
+	VirtualNetworkGateway        *VirtualNetworkGateway     `json:"virtual_network_gateway,omitempty"`
+	Bastion                      *Bastion                   `json:"bastion,omitempty"`
+	RouteServer                  *RouteServer               `json:"route_server,omitempty"`
+	DnsResolver                  *DnsResolver               `json:"dns_resolver,omitempty"`
+	DiagnosticSettings           *HubDiagnosticSettings     `json:"diagnostic_settings,omitempty"`
+	FlowLog                      *FlowLog                   `json:"flow_log,omitempty"`
+	VirtualHub                   *VirtualHub                `json:"virtual_hub,omitempty"`
+}
+
+// PeeringSettings mirrors `mesh_peering_settings` and the values of `mesh_peering_overrides`, unset fields
+// falling back to the next level of defaults.
+type PeeringSettings struct {
+	AllowVirtualNetworkAccess *bool `json:"allow_virtual_network_access,omitempty"`
+	AllowForwardedTraffic     *bool `json:"allow_forwarded_traffic,omitempty"`
+	AllowGatewayTransit       *bool `json:"allow_gateway_transit,omitempty"`
+	UseRemoteGateways         *bool `json:"use_remote_gateways,omitempty"`
+}
+
+// SpokeVirtualNetworks mirrors `var.spoke_virtual_networks`, keyed by the arbitrary spoke map key.
+type SpokeVirtualNetworks map[string]SpokeVirtualNetwork
+
+// SpokeVirtualNetwork mirrors one element of `var.spoke_virtual_networks`.
+type SpokeVirtualNetwork struct {
+	HubKey                string                 `json:"hub_key"`
+	AddressSpace          []string               `json:"address_space"`
+	VirtualNetworkId      *string                `json:"virtual_network_id,omitempty"`
+	Name                  *string                `json:"name,omitempty"`
+	Location              *string                `json:"location,omitempty"`
+	ResourceGroupName     *string                `json:"resource_group_name,omitempty"`
+	Subnets               map[string]SpokeSubnet `json:"subnets,omitempty"`
+	RouteTableName        *string                `json:"route_table_name,omitempty"`
+	RoutedAddressPrefixes []string               `json:"routed_address_prefixes,omitempty"`
+	MeshRoutingEnabled    *bool                  `json:"mesh_routing_enabled,omitempty"`
+	UseRemoteGateways     *bool                  `json:"use_remote_gateways,omitempty"`
+	Tags                  map[string]string      `json:"tags,omitempty"`
+
+	BgpRoutePropagationEnabled *bool `json:"bgp_route_propagation_enabled,omitempty"`
+	PrivateDnsZoneLinksEnabled *bool `json:"private_dns_zone_links_enabled,omitempty"`
+}
+
+// SpokeSubnet mirrors a value of the `subnets` map of a spoke.
+type SpokeSubnet struct {
+	AddressPrefixes           []string `json:"address_prefixes,omitempty"`
+	AssignGeneratedRouteTable *bool    `json:"assign_generated_route_table,omitempty"`
+}
+
+// RouteTableEntry mirrors an element of `route_table_entries`.
+type RouteTableEntry struct {
+	Name             string  `json:"name"`
+	AddressPrefix    string  `json:"address_prefix"`
+	NextHopType      string  `json:"next_hop_type"`
+	HasBgpOverride   *bool   `json:"has_bgp_override,omitempty"`
+	NextHopIpAddress *string `json:"next_hop_ip_address,omitempty"`
+}
+
+// DefaultRoute mirrors the `default_route` object of a hub.
+type DefaultRoute struct {
+	NextHopType      *string `json:"next_hop_type,omitempty"`
+	NextHopIpAddress *string `json:"next_hop_ip_address,omitempty"`
+}
+
+// Subnet mirrors a value of the `subnets` map.
+type Subnet struct {
+	AddressPrefixes                          []string                       `json:"address_prefixes"`
+	NatGateway                               *ResourceId                    `json:"nat_gateway,omitempty"`
+	NetworkSecurityGroup                     *ResourceId                    `json:"network_security_group,omitempty"`
+	GeneratedNetworkSecurityGroup            *GeneratedNetworkSecurityGroup `json:"generated_network_security_group,omitempty"`
+	PrivateEndpointNetworkPoliciesEnabled    *bool                          `json:"private_endpoint_network_policies_enabled,omitempty"`
+	PrivateLinkServiceNetworkPoliciesEnabled *bool                          `json:"private_link_service_network_policies_enabled,omitempty"`
+	AssignGeneratedRouteTable                *bool                          `json:"assign_generated_route_table,omitempty"`
+	ExternalRouteTableId                     *string                        `json:"external_route_table_id,omitempty"`
+	ServiceEndpoints                         []string                       `json:"service_endpoints,omitempty"`
+	ServiceEndpointPolicyIds                 []string                       `json:"service_endpoint_policy_ids,omitempty"`
+	Delegations                              []Delegation                   `json:"delegations,omitempty"`
+}
+
+// GeneratedNetworkSecurityGroup mirrors the `generated_network_security_group` object of a subnet, the network security
+// group the module creates for it.
+type GeneratedNetworkSecurityGroup struct {
+	Name                 *string                        `json:"name,omitempty"`
+	BaselineRulesEnabled *bool                          `json:"baseline_rules_enabled,omitempty"`
+	Rules                map[string]NetworkSecurityRule `json:"rules,omitempty"`
+	Tags                 map[string]string              `json:"tags,omitempty"`
+}
+
+// NetworkSecurityRule mirrors a value of the `rules` of a generated network security group, keyed by rule name.
+type NetworkSecurityRule struct {
+	Priority                   int      `json:"priority"`
+	Direction                  string   `json:"direction"`
+	Access                     string   `json:"access"`
+	Protocol                   string   `json:"protocol"`
+	SourceAddressPrefixes      []string `json:"source_address_prefixes,omitempty"`
+	SourcePortRanges           []string `json:"source_port_ranges,omitempty"`
+	DestinationAddressPrefixes []string `json:"destination_address_prefixes,omitempty"`
+	DestinationPortRanges      []string `json:"destination_port_ranges,omitempty"`
+	Description                *string  `json:"description,omitempty"`
+}
+
+// ResourceId is the `{ id = string }` object used to reference existing resources.
+type ResourceId struct {
+	Id string `json:"id"`
+}
+
+// Delegation mirrors an element of a subnet's `delegations`.
+type Delegation struct {
+	Name              string            `json:"name"`
+	ServiceDelegation ServiceDelegation `json:"service_delegation"`
+}
+
+// ServiceDelegation mirrors the `service_delegation` object of a delegation.
+type ServiceDelegation struct {
+	Name    string   `json:"name"`
+	Actions []string `json:"actions,omitempty"`
+}
+
+// Firewall mirrors the `firewall` object of a hub.
+type Firewall struct {
+	SkuName                       string                                       `json:"sku_name"`
+	SkuTier                       string                                       `json:"sku_tier"`
+	SubnetAddressPrefix           string                                       `json:"subnet_address_prefix,omitempty"`
+	DnsServers                    []string                                     `json:"dns_servers,omitempty"`
+	FirewallPolicyId              *string                                      `json:"firewall_policy_id,omitempty"`
+	ManagementSubnetAddressPrefix *string                                      `json:"management_subnet_address_prefix,omitempty"`
+	Name                          *string                                      `json:"name,omitempty"`
+	PrivateIpRanges               []string                                     `json:"private_ip_ranges,omitempty"`
+	RouteTableName                *string                                      `json:"route_table_name,omitempty"`
+	SubnetRouteTableId            *string                                      `json:"subnet_route_table_id,omitempty"`
+	Tags                          map[string]string                            `json:"tags,omitempty"`
+	ThreatIntelMode               *string                                      `json:"threat_intel_mode,omitempty"`
+	VirtualHubPublicIpCount       *int                                         `json:"virtual_hub_public_ip_count,omitempty"`
+	Zones                         []string                                     `json:"zones,omitempty"`
+	DefaultIpConfiguration        *FirewallIpConfiguration                     `json:"default_ip_configuration,omitempty"`
+	IpConfigurations              map[string]FirewallAdditionalIpConfiguration `json:"ip_configurations,omitempty"`
+	ManagementIpConfiguration     *FirewallIpConfiguration                     `json:"management_ip_configuration,omitempty"`
+	PublicIpPrefix                *FirewallPublicIpPrefix                      `json:"public_ip_prefix,omitempty"`
+
+	RouteTableBgpRoutePropagationEnabled *bool `json:"route_table_bgp_route_propagation_enabled,omitempty"`
+}
+
+// FirewallPolicy mirrors a value of `var.firewall_policies`, the policy of the firewall of the hub with the same key, or a
+// policy of its own, typically the parent of the hub policies.
+type FirewallPolicy struct {
+	Name                        *string                        `json:"name,omitempty"`
+	Location                    *string                        `json:"location,omitempty"`
+	ResourceGroupName           *string                        `json:"resource_group_name,omitempty"`
+	BasePolicyKey               *string                        `json:"base_policy_key,omitempty"`
+	Sku                         *string                        `json:"sku,omitempty"`
+	ThreatIntelligenceMode      *string                        `json:"threat_intelligence_mode,omitempty"`
+	Dns                         *FirewallPolicyDns             `json:"dns,omitempty"`
+	ThreatIntelligenceAllowlist *ThreatIntelligenceAllowlist   `json:"threat_intelligence_allowlist,omitempty"`
+	IntrusionDetection          *IntrusionDetection            `json:"intrusion_detection,omitempty"`
+	TlsCertificate              *TlsCertificate                `json:"tls_certificate,omitempty"`
+	Identity                    *PolicyIdentity                `json:"identity,omitempty"`
+	MeshRulesEnabled            *bool                          `json:"mesh_rules_enabled,omitempty"`
+	MeshRulesPriority           *int                           `json:"mesh_rules_priority,omitempty"`
+	RuleCollectionGroups        map[string]RuleCollectionGroup `json:"rule_collection_groups,omitempty"`
+	Tags                        map[string]string              `json:"tags,omitempty"`
+}
+
+// FirewallPolicyDns mirrors the `dns` object of a firewall policy.
+type FirewallPolicyDns struct {
+	ProxyEnabled *bool    `json:"proxy_enabled,omitempty"`
+	Servers      []string `json:"servers,omitempty"`
+}
+
+// ThreatIntelligenceAllowlist mirrors the `threat_intelligence_allowlist` object of a firewall policy.
+type ThreatIntelligenceAllowlist struct {
+	Fqdns       []string `json:"fqdns,omitempty"`
+	IpAddresses []string `json:"ip_addresses,omitempty"`
+}
+
+// IntrusionDetection mirrors the `intrusion_detection` object of a firewall policy.
+type IntrusionDetection struct {
+	Mode               *string             `json:"mode,omitempty"`
+	PrivateRanges      []string            `json:"private_ranges,omitempty"`
+	SignatureOverrides []SignatureOverride `json:"signature_overrides,omitempty"`
+	TrafficBypass      []TrafficBypass     `json:"traffic_bypass,omitempty"`
+}
+
+// SignatureOverride mirrors an element of `signature_overrides`.
+type SignatureOverride struct {
+	Id    string `json:"id"`
+	State string `json:"state"`
+}
+
+// TrafficBypass mirrors an element of `traffic_bypass`.
+type TrafficBypass struct {
+	Name                 string   `json:"name"`
+	Protocol             string   `json:"protocol"`
+	Description          *string  `json:"description,omitempty"`
+	SourceAddresses      []string `json:"source_addresses,omitempty"`
+	DestinationAddresses []string `json:"destination_addresses,omitempty"`
+	DestinationPorts     []string `json:"destination_ports,omitempty"`
+}
+
+// TlsCertificate mirrors the `tls_certificate` object of a firewall policy.
+type TlsCertificate struct {
+	Name             string `json:"name"`
+	KeyVaultSecretId string `json:"key_vault_secret_id"`
+}
+
+// PolicyIdentity mirrors the `identity` object of a firewall policy.
+type PolicyIdentity struct {
+	IdentityIds []string `json:"identity_ids"`
+}
+
+// RuleCollectionGroup mirrors a value of `rule_collection_groups` of a firewall policy.
+type RuleCollectionGroup struct {
+	Priority                   int                         `json:"priority"`
+	NetworkRuleCollections     []NetworkRuleCollection     `json:"network_rule_collections,omitempty"`
+	ApplicationRuleCollections []ApplicationRuleCollection `json:"application_rule_collections,omitempty"`
+	NatRuleCollections         []NatRuleCollection         `json:"nat_rule_collections,omitempty"`
+}
+
+// NetworkRuleCollection mirrors an element of `network_rule_collections`.
+type NetworkRuleCollection struct {
+	Name     string        `json:"name"`
+	Priority int           `json:"priority"`
+	Action   string        `json:"action"`
+	Rules    []NetworkRule `json:"rules"`
+}
+
+// NetworkRule mirrors a network rule, also the elements of `local.firewall_policy_mesh_rules`.
+type NetworkRule struct {
+	Name                 string   `json:"name"`
+	Protocols            []string `json:"protocols"`
+	DestinationPorts     []string `json:"destination_ports"`
+	SourceAddresses      []string `json:"source_addresses,omitempty"`
+	SourceIpGroups       []string `json:"source_ip_groups,omitempty"`
+	DestinationAddresses []string `json:"destination_addresses,omitempty"`
+	DestinationIpGroups  []string `json:"destination_ip_groups,omitempty"`
+	DestinationFqdns     []string `json:"destination_fqdns,omitempty"`
+}
+
+// ApplicationRuleCollection mirrors an element of `application_rule_collections`.
+type ApplicationRuleCollection struct {
+	Name     string            `json:"name"`
+	Priority int               `json:"priority"`
+	Action   string            `json:"action"`
+	Rules    []ApplicationRule `json:"rules"`
+}
+
+// ApplicationRule mirrors an application rule.
+type ApplicationRule struct {
+	Name                 string                    `json:"name"`
+	Protocols            []ApplicationRuleProtocol `json:"protocols,omitempty"`
+	SourceAddresses      []string                  `json:"source_addresses,omitempty"`
+	SourceIpGroups       []string                  `json:"source_ip_groups,omitempty"`
+	DestinationAddresses []string                  `json:"destination_addresses,omitempty"`
+	DestinationFqdns     []string                  `json:"destination_fqdns,omitempty"`
+	DestinationFqdnTags  []string                  `json:"destination_fqdn_tags,omitempty"`
+	DestinationUrls      []string                  `json:"destination_urls,omitempty"`
+	TerminateTls         *bool                     `json:"terminate_tls,omitempty"`
+	WebCategories        []string                  `json:"web_categories,omitempty"`
+}
+
+// ApplicationRuleProtocol mirrors an element of `protocols` of an application rule.
+type ApplicationRuleProtocol struct {
+	Type string `json:"type"`
+	Port int    `json:"port"`
+}
+
+// NatRuleCollection mirrors an element of `nat_rule_collections`.
+type NatRuleCollection struct {
+	Name     string    `json:"name"`
+	Priority int       `json:"priority"`
+	Action   *string   `json:"action,omitempty"`
+	Rules    []NatRule `json:"rules"`
+}
+
+// NatRule mirrors a DNAT rule.
+type NatRule struct {
+	Name               string   `json:"name"`
+	Protocols          []string `json:"protocols"`
+	SourceAddresses    []string `json:"source_addresses,omitempty"`
+	SourceIpGroups     []string `json:"source_ip_groups,omitempty"`
+	DestinationAddress string   `json:"destination_address"`
+	DestinationPorts   []string `json:"destination_ports"`
+	TranslatedAddress  *string  `json:"translated_address,omitempty"`
+	TranslatedFqdn     *string  `json:"translated_fqdn,omitempty"`
+	TranslatedPort     int      `json:"translated_port"`
+}
+
+// FirewallIpConfiguration mirrors `default_ip_configuration` and `management_ip_configuration`.
+type FirewallIpConfiguration struct {
+	Name           *string           `json:"name,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	PublicIpConfig *PublicIpConfig   `json:"public_ip_config,omitempty"`
+}
+
+// FirewallAdditionalIpConfiguration mirrors a value of the `ip_configurations` map of a firewall, named by its key.
+type FirewallAdditionalIpConfiguration struct {
+	Tags           map[string]string `json:"tags,omitempty"`
+	PublicIpConfig *PublicIpConfig   `json:"public_ip_config,omitempty"`
+}
+
+// PublicIpConfig mirrors the `public_ip_config` object of a firewall ip configuration.
+type PublicIpConfig struct {
+	IpVersion        *string  `json:"ip_version,omitempty"`
+	Name             *string  `json:"name,omitempty"`
+	PublicIpPrefixId *string  `json:"public_ip_prefix_id,omitempty"`
+	SkuTier          *string  `json:"sku_tier,omitempty"`
+	Zones            []string `json:"zones,omitempty"`
+}
+
+// FirewallPublicIpPrefix mirrors the `public_ip_prefix` object of a firewall.
+type FirewallPublicIpPrefix struct {
+	IpVersion    *string           `json:"ip_version,omitempty"`
+	Name         *string           `json:"name,omitempty"`
+	PrefixLength *int              `json:"prefix_length,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Zones        []string          `json:"zones,omitempty"`
+}
+
+// VirtualNetworkGateway mirrors the `virtual_network_gateway` object of a hub.
+type VirtualNetworkGateway struct {
+	Type                string            `json:"type"`
+	Sku                 string            `json:"sku"`
+	SubnetAddressPrefix string            `json:"subnet_address_prefix"`
+	Name                *string           `json:"name,omitempty"`
+	VpnType             *string           `json:"vpn_type,omitempty"`
+	Generation          *string           `json:"generation,omitempty"`
+	ActiveActive        *bool             `json:"active_active,omitempty"`
+	EnableBgp           *bool             `json:"enable_bgp,omitempty"`
+	BgpSettings         *BgpSettings      `json:"bgp_settings,omitempty"`
+	PublicIpZones       []string          `json:"public_ip_zones,omitempty"`
+	Tags                map[string]string `json:"tags,omitempty"`
+}
+
+// BgpSettings mirrors the `bgp_settings` object of a virtual network gateway.
+type BgpSettings struct {
+	Asn        *int `json:"asn,omitempty"`
+	PeerWeight *int `json:"peer_weight,omitempty"`
+}
+
+// Bastion mirrors the `bastion` object of a hub.
+// An empty SubnetAddressPrefix deploys the Bastion host in the `AzureBastionSubnet` of the hub's `subnets`.
+type Bastion struct {
+	SubnetAddressPrefix  string            `json:"subnet_address_prefix,omitempty"`
+	Name                 *string           `json:"name,omitempty"`
+	Sku                  *string           `json:"sku,omitempty"`
+	ScaleUnits           *int              `json:"scale_units,omitempty"`
+	CopyPasteEnabled     *bool             `json:"copy_paste_enabled,omitempty"`
+	FileCopyEnabled      *bool             `json:"file_copy_enabled,omitempty"`
+	IpConnectEnabled     *bool             `json:"ip_connect_enabled,omitempty"`
+	ShareableLinkEnabled *bool             `json:"shareable_link_enabled,omitempty"`
+	TunnelingEnabled     *bool             `json:"tunneling_enabled,omitempty"`
+	PublicIpName         *string           `json:"public_ip_name,omitempty"`
+	Zones                []string          `json:"zones,omitempty"`
+	Tags                 map[string]string `json:"tags,omitempty"`
+}
+
+// RouteServer mirrors the `route_server` object of a hub.
+type RouteServer struct {
+	SubnetAddressPrefix          string                              `json:"subnet_address_prefix"`
+	Name                         *string                             `json:"name,omitempty"`
+	BranchToBranchTrafficEnabled *bool                               `json:"branch_to_branch_traffic_enabled,omitempty"`
+	PublicIpName                 *string                             `json:"public_ip_name,omitempty"`
+	PublicIpZones                []string                            `json:"public_ip_zones,omitempty"`
+	BgpConnections               map[string]RouteServerBgpConnection `json:"bgp_connections,omitempty"`
+	Tags                         map[string]string                   `json:"tags,omitempty"`
+}
+
+// RouteServerBgpConnection mirrors a value of the `bgp_connections` map of a Route Server, an NVA peering with it.
+type RouteServerBgpConnection struct {
+	PeerAsn int    `json:"peer_asn"`
+	PeerIp  string `json:"peer_ip"`
+}
+
+// DnsResolver mirrors the `dns_resolver` object of a hub.
+type DnsResolver struct {
+	InboundSubnetAddressPrefix  string                       `json:"inbound_subnet_address_prefix"`
+	Name                        *string                      `json:"name,omitempty"`
+	InboundEndpointIpAddress    *string                      `json:"inbound_endpoint_ip_address,omitempty"`
+	OutboundSubnetAddressPrefix *string                      `json:"outbound_subnet_address_prefix,omitempty"`
+	ForwardingRulesetName       *string                      `json:"forwarding_ruleset_name,omitempty"`
+	ForwardingRules             map[string]DnsForwardingRule `json:"forwarding_rules,omitempty"`
+	Tags                        map[string]string            `json:"tags,omitempty"`
+}
+
+// DnsForwardingRule mirrors a value of the `forwarding_rules` map of a DNS resolver, named by its key.
+type DnsForwardingRule struct {
+	DomainName       string            `json:"domain_name"`
+	TargetDnsServers []DnsTargetServer `json:"target_dns_servers"`
+	Enabled          *bool             `json:"enabled,omitempty"`
+}
+
+// DnsTargetServer mirrors an element of `target_dns_servers` of a DNS forwarding rule.
+type DnsTargetServer struct {
+	IpAddress string `json:"ip_address"`
+	Port      *int   `json:"port,omitempty"`
+}
+
+// HubDiagnosticSettings mirrors the `diagnostic_settings` object of a hub, overriding `var.diagnostic_settings`.
+type HubDiagnosticSettings struct {
+	Enabled *bool `json:"enabled,omitempty"`
+	DiagnosticSettings
+}
+
+// FlowLog mirrors the `flow_log` object of a hub, the Network Watcher flow log of its virtual network.
+type FlowLog struct {
+	StorageAccountId string            `json:"storage_account_id"`
+	Name             *string           `json:"name,omitempty"`
+	Enabled          *bool             `json:"enabled,omitempty"`
+	RetentionDays    *int              `json:"retention_days,omitempty"`
+	TrafficAnalytics *TrafficAnalytics `json:"traffic_analytics,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+}
+
+// TrafficAnalytics mirrors the `traffic_analytics` object of a flow log.
+type TrafficAnalytics struct {
+	WorkspaceId         string  `json:"workspace_id"`
+	WorkspaceResourceId string  `json:"workspace_resource_id"`
+	WorkspaceRegion     *string `json:"workspace_region,omitempty"`
+	IntervalInMinutes   *int    `json:"interval_in_minutes,omitempty"`
+}
+
+// VirtualHub mirrors the `virtual_hub` object of a hub, the settings of its virtual hub with `var.virtual_wan`.
+type VirtualHub struct {
+	Sku                           *string `json:"sku,omitempty"`
+	HubRoutingPreference          *string `json:"hub_routing_preference,omitempty"`
+	InternetTrafficRoutingEnabled *bool   `json:"internet_traffic_routing_enabled,omitempty"`
+	PrivateTrafficRoutingEnabled  *bool   `json:"private_traffic_routing_enabled,omitempty"`
+}
+
+// VirtualWan mirrors `var.virtual_wan`, the Virtual WAN the hubs are deployed in as virtual hubs.
+type VirtualWan struct {
+	Name                       string            `json:"name"`
+	Location                   string            `json:"location"`
+	ResourceGroupName          string            `json:"resource_group_name"`
+	Type                       *string           `json:"type,omitempty"`
+	AllowBranchToBranchTraffic *bool             `json:"allow_branch_to_branch_traffic,omitempty"`
+	DisableVpnEncryption       *bool             `json:"disable_vpn_encryption,omitempty"`
+	Tags                       map[string]string `json:"tags,omitempty"`
+}
+
+// PrivateDnsZones mirrors `var.private_dns_zones`, the private DNS zones linked to the hubs.
+type PrivateDnsZones struct {
+	ResourceGroupName         string            `json:"resource_group_name"`
+	ZoneNames                 []string          `json:"zone_names,omitempty"`
+	PrivateLinkZonesEnabled   *bool             `json:"private_link_zones_enabled,omitempty"`
+	PrivateLinkZoneExclusions []string          `json:"private_link_zone_exclusions,omitempty"`
+	Tags                      map[string]string `json:"tags,omitempty"`
+}
+
+// DdosProtectionPlan mirrors `var.ddos_protection_plan`, the DDoS Protection Plan shared across the hubs.
+type DdosProtectionPlan struct {
+	Name              string            `json:"name"`
+	Location          string            `json:"location"`
+	ResourceGroupName string            `json:"resource_group_name"`
+	HubKeys           []string          `json:"hub_keys,omitempty"`
+	Tags              map[string]string `json:"tags,omitempty"`
+}
+
+// DiagnosticSettings mirrors `var.diagnostic_settings`, the diagnostic settings of the hubs, and the values of
+// `local.hub_diagnostic_settings`.
+type DiagnosticSettings struct {
+	Name                        *string  `json:"name,omitempty"`
+	LogAnalyticsWorkspaceId     *string  `json:"log_analytics_workspace_id,omitempty"`
+	LogAnalyticsDestinationType *string  `json:"log_analytics_destination_type,omitempty"`
+	StorageAccountId            *string  `json:"storage_account_id,omitempty"`
+	EventhubAuthorizationRuleId *string  `json:"eventhub_authorization_rule_id,omitempty"`
+	EventhubName                *string  `json:"eventhub_name,omitempty"`
+	LogCategories               []string `json:"log_categories,omitempty"`
+	MetricsEnabled              *bool    `json:"metrics_enabled,omitempty"`
+}
+
+// NetworkWatcher mirrors a value of `var.network_watchers`, the existing Network Watcher of a location.
+type NetworkWatcher struct {
+	Name              string `json:"name"`
+	ResourceGroupName string `json:"resource_group_name"`
+}
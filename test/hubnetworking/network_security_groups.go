@@ -0,0 +1,153 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NetworkSecurityGroupBaselineRules mirrors `local.network_security_group_baseline_rules`, the rules a generated network
+// security group of a well-known subnet starts from, keyed by subnet name and rule name.
+var NetworkSecurityGroupBaselineRules = map[string]map[string]NetworkSecurityRule{
+	"AzureBastionSubnet": {
+		"AllowHttpsInbound":                     baselineRule(120, "Inbound", "Tcp", []string{"Internet"}, []string{"*"}, []string{"443"}, "Sessions of the Bastion clients"),
+		"AllowGatewayManagerInbound":            baselineRule(130, "Inbound", "Tcp", []string{"GatewayManager"}, []string{"*"}, []string{"443"}, "Control plane of Azure Bastion"),
+		"AllowAzureLoadBalancerInbound":         baselineRule(140, "Inbound", "Tcp", []string{"AzureLoadBalancer"}, []string{"*"}, []string{"443"}, "Health probes"),
+		"AllowBastionHostCommunicationInbound":  baselineRule(150, "Inbound", "*", []string{"VirtualNetwork"}, []string{"VirtualNetwork"}, []string{"8080", "5701"}, "Data plane between the Bastion instances"),
+		"AllowSshRdpOutbound":                   baselineRule(100, "Outbound", "*", []string{"*"}, []string{"VirtualNetwork"}, []string{"22", "3389"}, "Sessions to the target virtual machines"),
+		"AllowAzureCloudOutbound":               baselineRule(110, "Outbound", "Tcp", []string{"*"}, []string{"AzureCloud"}, []string{"443"}, "Diagnostics and metering"),
+		"AllowBastionHostCommunicationOutbound": baselineRule(120, "Outbound", "*", []string{"VirtualNetwork"}, []string{"VirtualNetwork"}, []string{"8080", "5701"}, "Data plane between the Bastion instances"),
+		"AllowHttpOutbound":                     baselineRule(130, "Outbound", "*", []string{"*"}, []string{"Internet"}, []string{"80"}, "Session and certificate validation"),
+	},
+}
+
+func baselineRule(priority int, direction, protocol string, sourceAddressPrefixes, destinationAddressPrefixes, destinationPortRanges []string, description string) NetworkSecurityRule {
+	return NetworkSecurityRule{
+		Priority:                   priority,
+		Direction:                  direction,
+		Access:                     "Allow",
+		Protocol:                   protocol,
+		SourceAddressPrefixes:      sourceAddressPrefixes,
+		SourcePortRanges:           []string{"*"},
+		DestinationAddressPrefixes: destinationAddressPrefixes,
+		DestinationPortRanges:      destinationPortRanges,
+		Description:                String(description),
+	}
+}
+
+// NetworkSecurityGroup mirrors a value of `local.network_security_groups`, a network security group the module creates
+// for a hub subnet.
+type NetworkSecurityGroup struct {
+	Key               string                         `json:"key"`
+	HubKey            string                         `json:"hub_key"`
+	SubnetName        string                         `json:"subnet_name"`
+	Name              string                         `json:"name"`
+	Location          string                         `json:"location"`
+	ResourceGroupName string                         `json:"resource_group_name"`
+	Rules             map[string]NetworkSecurityRule `json:"rules"`
+	Tags              map[string]string              `json:"tags"`
+}
+
+// NetworkSecurityGroupConflict is an element of `local.network_security_group_conflicts`, rules of the network security
+// group of `network_security_group_keys` Azure would reject.
+type NetworkSecurityGroupConflict struct {
+	HubKeys                  []string `json:"hub_keys"`
+	NetworkSecurityGroupKeys []string `json:"network_security_group_keys"`
+	Message                  string   `json:"message"`
+}
+
+func (c NetworkSecurityGroupConflict) Error() string {
+	return c.Message
+}
+
+// NetworkSecurityGroupUnsupportedSubnets are the subnets Azure does not support a network security group on, which the
+// validation of `generated_network_security_group` rejects.
+var NetworkSecurityGroupUnsupportedSubnets = []string{GatewaySubnetName, FirewallSubnetName, FirewallManagementSubnetName, RouteServerSubnetName}
+
+// NetworkSecurityGroups computes `local.network_security_groups`, keyed by `${hub}-${subnet}`: one per subnet with a
+// `generated_network_security_group`. The rules of the group extend the baseline rules of the subnet, overriding those
+// of the same name, e.g. those Azure Bastion requires on an `AzureBastionSubnet`.
+func (v Variables) NetworkSecurityGroups() map[string]NetworkSecurityGroup {
+	r := make(map[string]NetworkSecurityGroup)
+	for k, hub := range v.hubVirtualNetworks() {
+		for subnetName, subnet := range hub.Subnets {
+			s := subnet.GeneratedNetworkSecurityGroup
+			if s == nil {
+				continue
+			}
+			key := fmt.Sprintf("%s-%s", k, subnetName)
+			g := NetworkSecurityGroup{
+				Key:               key,
+				HubKey:            k,
+				SubnetName:        subnetName,
+				Name:              fmt.Sprintf("nsg-%s", key),
+				Location:          hub.Location,
+				ResourceGroupName: hub.ResourceGroupName,
+				Rules:             make(map[string]NetworkSecurityRule),
+				Tags:              s.Tags,
+			}
+			if s.Name != nil {
+				g.Name = *s.Name
+			}
+			var baseline map[string]NetworkSecurityRule
+			if *s.BaselineRulesEnabled {
+				baseline = NetworkSecurityGroupBaselineRules[subnetName]
+			}
+			for _, m := range []map[string]NetworkSecurityRule{baseline, s.Rules} {
+				for ruleName, rule := range m {
+					g.Rules[ruleName] = rule
+				}
+			}
+			r[key] = g
+		}
+	}
+	return r
+}
+
+// NetworkSecurityGroupConflicts computes `local.network_security_group_conflicts` in the same order: by network
+// security group key, the rules sharing a direction and a priority, by `${direction} priority ${priority}` compared as
+// strings. The network security groups of NetworkSecurityGroupUnsupportedSubnets, which the variable validation rejects
+// before, come first.
+func (v Variables) NetworkSecurityGroupConflicts() []NetworkSecurityGroupConflict {
+	conflicts := make([]NetworkSecurityGroupConflict, 0)
+	groups := v.NetworkSecurityGroups()
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if g := groups[k]; contains(NetworkSecurityGroupUnsupportedSubnets, g.SubnetName) {
+			conflicts = append(conflicts, NetworkSecurityGroupConflict{
+				HubKeys:                  []string{g.HubKey},
+				NetworkSecurityGroupKeys: []string{k},
+				Message:                  fmt.Sprintf("subnet %s of hub %s cannot have a generated_network_security_group, Azure does not support a network security group on it", g.SubnetName, g.HubKey),
+			})
+		}
+	}
+	for _, k := range keys {
+		g := groups[k]
+		names := make(map[string][]string)
+		for name, rule := range g.Rules {
+			dp := fmt.Sprintf("%s priority %d", rule.Direction, rule.Priority)
+			names[dp] = append(names[dp], name)
+		}
+		dps := make([]string, 0, len(names))
+		for dp := range names {
+			dps = append(dps, dp)
+		}
+		sort.Strings(dps)
+		for _, dp := range dps {
+			if len(names[dp]) < 2 {
+				continue
+			}
+			sort.Strings(names[dp])
+			conflicts = append(conflicts, NetworkSecurityGroupConflict{
+				HubKeys:                  []string{g.HubKey},
+				NetworkSecurityGroupKeys: []string{k},
+				Message:                  fmt.Sprintf("rules %s of network security group %s share the %s", strings.Join(names[dp], ", "), g.Name, dp),
+			})
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,136 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func networkSecurityGroupVariables() Variables {
+	return Variables{
+		HubVirtualNetworks: HubVirtualNetworks{
+			"hub0": {
+				Location:          "eastus",
+				ResourceGroupName: "rg-hub0",
+				AddressSpace:      []string{"10.0.0.0/16"},
+				Subnets: map[string]Subnet{
+					"workload": {
+						AddressPrefixes: []string{"10.0.1.0/24"},
+						GeneratedNetworkSecurityGroup: &GeneratedNetworkSecurityGroup{
+							Rules: map[string]NetworkSecurityRule{
+								"AllowHttpsInbound": {Priority: 100, Direction: "Inbound", Access: "Allow", Protocol: "Tcp", DestinationPortRanges: []string{"443"}},
+							},
+						},
+					},
+					"AzureBastionSubnet": {
+						AddressPrefixes:               []string{"10.0.254.0/26"},
+						GeneratedNetworkSecurityGroup: &GeneratedNetworkSecurityGroup{BaselineRulesEnabled: Bool(false)},
+					},
+					"other": {AddressPrefixes: []string{"10.0.2.0/24"}},
+				},
+			},
+			"hub1": {
+				Location:          "westeurope",
+				ResourceGroupName: "rg-hub1",
+				AddressSpace:      []string{"10.1.0.0/16"},
+				Subnets: map[string]Subnet{
+					"AzureBastionSubnet": {
+						AddressPrefixes: []string{"10.1.254.0/26"},
+						GeneratedNetworkSecurityGroup: &GeneratedNetworkSecurityGroup{
+							Name: String("nsg-bastion"),
+							Rules: map[string]NetworkSecurityRule{
+								"AllowHttpsInbound": {Priority: 100, Direction: "Inbound", Access: "Allow", Protocol: "Tcp", SourceAddressPrefixes: []string{"192.168.0.0/16"}, DestinationPortRanges: []string{"443"}},
+							},
+						},
+					},
+				},
+				Bastion: &Bastion{},
+			},
+		},
+	}
+}
+
+func TestNetworkSecurityGroups_ShouldExtendTheBaselineRulesOfTheSubnet(t *testing.T) {
+	groups := networkSecurityGroupVariables().NetworkSecurityGroups()
+	require.Len(t, groups, 3)
+
+	workload := groups["hub0-workload"]
+	assert.Equal(t, "nsg-hub0-workload", workload.Name)
+	assert.Equal(t, "hub0", workload.HubKey)
+	assert.Equal(t, "workload", workload.SubnetName)
+	assert.Equal(t, map[string]NetworkSecurityRule{
+		"AllowHttpsInbound": {
+			Priority:                   100,
+			Direction:                  "Inbound",
+			Access:                     "Allow",
+			Protocol:                   "Tcp",
+			SourceAddressPrefixes:      []string{"*"},
+			SourcePortRanges:           []string{"*"},
+			DestinationAddressPrefixes: []string{"*"},
+			DestinationPortRanges:      []string{"443"},
+		},
+	}, workload.Rules)
+
+	assert.Empty(t, groups["hub0-AzureBastionSubnet"].Rules, "baseline rules can be disabled for a subnet")
+
+	bastion := groups["hub1-AzureBastionSubnet"]
+	assert.Equal(t, "nsg-bastion", bastion.Name)
+	assert.Equal(t, "westeurope", bastion.Location)
+	assert.Len(t, bastion.Rules, len(NetworkSecurityGroupBaselineRules["AzureBastionSubnet"]))
+	assert.Equal(t, []string{"192.168.0.0/16"}, bastion.Rules["AllowHttpsInbound"].SourceAddressPrefixes, "a rule overrides the baseline rule of the same name")
+	assert.Equal(t, NetworkSecurityGroupBaselineRules["AzureBastionSubnet"]["AllowHttpOutbound"], bastion.Rules["AllowHttpOutbound"])
+}
+
+func TestNetworkSecurityGroups_VirtualWanShouldCreateNone(t *testing.T) {
+	v := networkSecurityGroupVariables()
+	v.VirtualWan = &VirtualWan{Name: "vwan", Location: "eastus", ResourceGroupName: "rg-vwan"}
+	assert.Empty(t, v.NetworkSecurityGroups())
+}
+
+func TestNetworkSecurityGroupBaselineRules_ShouldNotConflict(t *testing.T) {
+	v := Variables{
+		HubVirtualNetworks: HubVirtualNetworks{
+			"hub0": {
+				Subnets: map[string]Subnet{
+					"AzureBastionSubnet": {AddressPrefixes: []string{"10.0.254.0/26"}, GeneratedNetworkSecurityGroup: &GeneratedNetworkSecurityGroup{}},
+				},
+				Bastion: &Bastion{},
+			},
+		},
+	}
+	assert.Empty(t, v.NetworkSecurityGroupConflicts())
+}
+
+func TestNetworkSecurityGroupConflicts_ShouldReportRulesSharingADirectionAndAPriority(t *testing.T) {
+	v := networkSecurityGroupVariables()
+	v.HubVirtualNetworks["hub1"].Subnets["AzureBastionSubnet"].GeneratedNetworkSecurityGroup.Rules = map[string]NetworkSecurityRule{
+		"AllowCorporateHttpsInbound": {Priority: 120, Direction: "Inbound", Access: "Allow", Protocol: "Tcp"},
+		"AllowCorporateSshOutbound":  {Priority: 100, Direction: "Outbound", Access: "Allow", Protocol: "Tcp"},
+		"DenyAllInbound":             {Priority: 1000, Direction: "Inbound", Access: "Deny", Protocol: "*"},
+		"DenyAllOutbound":            {Priority: 1000, Direction: "Outbound", Access: "Deny", Protocol: "*"},
+	}
+	v.HubVirtualNetworks["hub0"].Subnets["workload"].GeneratedNetworkSecurityGroup.Rules["DenyAllInbound"] = NetworkSecurityRule{Priority: 100, Direction: "Inbound", Access: "Deny", Protocol: "*"}
+	assert.Equal(t, []NetworkSecurityGroupConflict{
+		{HubKeys: []string{"hub0"}, NetworkSecurityGroupKeys: []string{"hub0-workload"}, Message: "rules AllowHttpsInbound, DenyAllInbound of network security group nsg-hub0-workload share the Inbound priority 100"},
+		{HubKeys: []string{"hub1"}, NetworkSecurityGroupKeys: []string{"hub1-AzureBastionSubnet"}, Message: "rules AllowCorporateHttpsInbound, AllowHttpsInbound of network security group nsg-bastion share the Inbound priority 120"},
+		{HubKeys: []string{"hub1"}, NetworkSecurityGroupKeys: []string{"hub1-AzureBastionSubnet"}, Message: "rules AllowCorporateSshOutbound, AllowSshRdpOutbound of network security group nsg-bastion share the Outbound priority 100"},
+	}, v.NetworkSecurityGroupConflicts())
+}
+
+func TestNetworkSecurityGroupConflicts_ShouldRejectSubnetsAzureDoesNotSupportANetworkSecurityGroupOn(t *testing.T) {
+	v := networkSecurityGroupVariables()
+	for i, name := range NetworkSecurityGroupUnsupportedSubnets {
+		v.HubVirtualNetworks["hub0"].Subnets[name] = Subnet{
+			AddressPrefixes:               []string{fmt.Sprintf("10.0.%d.0/26", 100+i)},
+			GeneratedNetworkSecurityGroup: &GeneratedNetworkSecurityGroup{},
+		}
+	}
+	assert.Equal(t, []NetworkSecurityGroupConflict{
+		{HubKeys: []string{"hub0"}, NetworkSecurityGroupKeys: []string{"hub0-AzureFirewallManagementSubnet"}, Message: "subnet AzureFirewallManagementSubnet of hub hub0 cannot have a generated_network_security_group, Azure does not support a network security group on it"},
+		{HubKeys: []string{"hub0"}, NetworkSecurityGroupKeys: []string{"hub0-AzureFirewallSubnet"}, Message: "subnet AzureFirewallSubnet of hub hub0 cannot have a generated_network_security_group, Azure does not support a network security group on it"},
+		{HubKeys: []string{"hub0"}, NetworkSecurityGroupKeys: []string{"hub0-GatewaySubnet"}, Message: "subnet GatewaySubnet of hub hub0 cannot have a generated_network_security_group, Azure does not support a network security group on it"},
+		{HubKeys: []string{"hub0"}, NetworkSecurityGroupKeys: []string{"hub0-RouteServerSubnet"}, Message: "subnet RouteServerSubnet of hub hub0 cannot have a generated_network_security_group, Azure does not support a network security group on it"},
+	}, v.NetworkSecurityGroupConflicts())
+}
@@ -0,0 +1,154 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Peering mirrors a value of `local.hub_peering_map`. `remote_virtual_network_id` is left out
+// since it is only known once the remote virtual network exists.
+type Peering struct {
+	Name                      string `json:"name"`
+	SrcKey                    string `json:"src_key"`
+	DstKey                    string `json:"dst_key"`
+	VirtualNetworkName        string `json:"virtual_network_name"`
+	AllowVirtualNetworkAccess bool   `json:"allow_virtual_network_access"`
+	AllowForwardedTraffic     bool   `json:"allow_forwarded_traffic"`
+	AllowGatewayTransit       bool   `json:"allow_gateway_transit"`
+	UseRemoteGateways         bool   `json:"use_remote_gateways"`
+}
+
+// PeeringMap computes `local.hub_peering_map`, keyed by peering name, empty with a Virtual WAN.
+// Unset optional attributes are treated as their defaults.
+func (v Variables) PeeringMap() map[string]Peering {
+	hubs := v.hubVirtualNetworks()
+	pairs := v.MeshPairs()
+	r := make(map[string]Peering)
+	for _, kSrc := range hubs.Keys() {
+		vSrc := hubs[kSrc]
+		for _, kDst := range pairs[kSrc] {
+			name := PeeringName(vSrc.Name, hubs[kDst].Name)
+			useRemoteGateways := peeringSetting(vSrc, kDst, func(s PeeringSettings) *bool { return s.UseRemoteGateways }, false)
+			r[name] = Peering{
+				Name:                      name,
+				SrcKey:                    kSrc,
+				DstKey:                    kDst,
+				VirtualNetworkName:        vSrc.Name,
+				AllowVirtualNetworkAccess: peeringSetting(vSrc, kDst, func(s PeeringSettings) *bool { return s.AllowVirtualNetworkAccess }, true),
+				AllowForwardedTraffic:     peeringSetting(vSrc, kDst, func(s PeeringSettings) *bool { return s.AllowForwardedTraffic }, true),
+				AllowGatewayTransit:       peeringSetting(vSrc, kDst, func(s PeeringSettings) *bool { return s.AllowGatewayTransit }, !useRemoteGateways),
+				UseRemoteGateways:         useRemoteGateways,
+			}
+		}
+	}
+	return r
+}
+
+// PeeringConflict is an element of `local.peering_conflicts`, peering settings Azure would reject.
+type PeeringConflict struct {
+	PeeringNames []string `json:"peering_names"`
+	Message      string   `json:"message"`
+}
+
+func (c PeeringConflict) Error() string {
+	return c.Message
+}
+
+// PeeringConflicts computes `local.peering_conflicts`.
+func (v Variables) PeeringConflicts() []PeeringConflict {
+	hubs := v.HubVirtualNetworks.WithDefaults()
+	peeringMap := v.PeeringMap()
+	names := make([]string, 0, len(peeringMap))
+	for name := range peeringMap {
+		names = append(names, name)
+	}
+	// Terraform iterates `values(local.hub_peering_map)` by peering name.
+	sort.Strings(names)
+	peerings := make([]Peering, 0, len(names))
+	for _, name := range names {
+		peerings = append(peerings, peeringMap[name])
+	}
+	byKeys := make(map[[2]string]Peering, len(peerings))
+	for _, p := range peerings {
+		byKeys[[2]string{p.SrcKey, p.DstKey}] = p
+	}
+	conflicts := make([]PeeringConflict, 0)
+	keys := hubs.Keys()
+	for i, kSrc := range keys {
+		for _, kDst := range keys[i+1:] {
+			p, ok1 := byKeys[[2]string{kSrc, kDst}]
+			r, ok2 := byKeys[[2]string{kDst, kSrc}]
+			if ok1 && ok2 && p.UseRemoteGateways && r.UseRemoteGateways {
+				conflicts = append(conflicts, PeeringConflict{
+					PeeringNames: []string{p.Name, r.Name},
+					Message:      fmt.Sprintf("peerings %s and %s both set use_remote_gateways", p.Name, r.Name),
+				})
+			}
+		}
+	}
+	for _, p := range peerings {
+		if p.UseRemoteGateways && !hubs[p.DstKey].GatewayEnabled() {
+			conflicts = append(conflicts, PeeringConflict{
+				PeeringNames: []string{p.Name},
+				Message:      fmt.Sprintf("peering %s sets use_remote_gateways but hub %s has no gateway", p.Name, p.DstKey),
+			})
+		}
+	}
+	for _, p := range peerings {
+		if p.UseRemoteGateways && hubs[p.SrcKey].GatewayEnabled() {
+			conflicts = append(conflicts, PeeringConflict{
+				PeeringNames: []string{p.Name},
+				Message:      fmt.Sprintf("peering %s sets use_remote_gateways but hub %s has a gateway of its own", p.Name, p.SrcKey),
+			})
+		}
+	}
+	for _, p := range peerings {
+		if r, ok := byKeys[[2]string{p.DstKey, p.SrcKey}]; p.UseRemoteGateways && (!ok || !r.AllowGatewayTransit) {
+			conflicts = append(conflicts, PeeringConflict{
+				PeeringNames: []string{p.Name},
+				Message:      fmt.Sprintf("peering %s sets use_remote_gateways but the peering from hub %s does not allow gateway transit", p.Name, p.DstKey),
+			})
+		}
+	}
+	return conflicts
+}
+
+// GatewayEnabled mirrors `local.hub_gateway_enabled`, whether the hub has a virtual network gateway,
+// created by the module or deployed in a user defined GatewaySubnet, or a Route Server, which drives the default of
+// `allow_gateway_transit` of its spoke peerings.
+func (n HubVirtualNetwork) GatewayEnabled() bool {
+	_, ok := n.Subnets[GatewaySubnetName]
+	return ok || n.VirtualNetworkGateway != nil || n.RouteServer != nil
+}
+
+// peeringSetting resolves a setting of the peering from hub src to hub dstKey: the pair override,
+// then the hub settings, then def.
+func peeringSetting(src HubVirtualNetwork, dstKey string, get func(PeeringSettings) *bool, def bool) bool {
+	if o, ok := src.MeshPeeringOverrides[dstKey]; ok && get(o) != nil {
+		return *get(o)
+	}
+	if src.MeshPeeringSettings != nil && get(*src.MeshPeeringSettings) != nil {
+		return *get(*src.MeshPeeringSettings)
+	}
+	return def
+}
+
+// PeeringName returns the name the module gives to the peering from one virtual network to another.
+func PeeringName(srcVnetName, dstVnetName string) string {
+	return fmt.Sprintf("%s-%s", srcVnetName, dstVnetName)
+}
+
+// SortedPeerings returns the values of a peering map ordered by source then destination key.
+func SortedPeerings(peerings map[string]Peering) []Peering {
+	r := make([]Peering, 0, len(peerings))
+	for _, p := range peerings {
+		r = append(r, p)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].SrcKey != r[j].SrcKey {
+			return r[i].SrcKey < r[j].SrcKey
+		}
+		return r[i].DstKey < r[j].DstKey
+	})
+	return r
+}
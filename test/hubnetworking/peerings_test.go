@@ -0,0 +1,91 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func gatewayHub(name string) HubVirtualNetwork {
+	return HubVirtualNetwork{
+		Name: name,
+		Subnets: map[string]Subnet{
+			GatewaySubnetName: {AddressPrefixes: []string{"10.0.255.0/27"}},
+		},
+	}
+}
+
+func TestPeeringMap_SettingsShouldResolveOverrideThenHubThenDefault(t *testing.T) {
+	hub0 := gatewayHub("vnet0")
+	hub1 := HubVirtualNetwork{
+		Name: "vnet1",
+		MeshPeeringSettings: &PeeringSettings{
+			AllowForwardedTraffic: Bool(false),
+			UseRemoteGateways:     Bool(true),
+		},
+		MeshPeeringOverrides: map[string]PeeringSettings{
+			"hub2": {UseRemoteGateways: Bool(false), AllowGatewayTransit: Bool(true)},
+		},
+	}
+	hub2 := HubVirtualNetwork{Name: "vnet2"}
+	peerings := Variables{HubVirtualNetworks: HubVirtualNetworks{"hub0": hub0, "hub1": hub1, "hub2": hub2}}.PeeringMap()
+
+	assert.Equal(t, Peering{Name: "vnet0-vnet1", SrcKey: "hub0", DstKey: "hub1", VirtualNetworkName: "vnet0", AllowVirtualNetworkAccess: true, AllowForwardedTraffic: true, AllowGatewayTransit: true}, peerings["vnet0-vnet1"])
+	assert.Equal(t, Peering{Name: "vnet1-vnet0", SrcKey: "hub1", DstKey: "hub0", VirtualNetworkName: "vnet1", AllowVirtualNetworkAccess: true, UseRemoteGateways: true}, peerings["vnet1-vnet0"])
+	assert.Equal(t, Peering{Name: "vnet1-vnet2", SrcKey: "hub1", DstKey: "hub2", VirtualNetworkName: "vnet1", AllowVirtualNetworkAccess: true, AllowGatewayTransit: true}, peerings["vnet1-vnet2"])
+	assert.Equal(t, Peering{Name: "vnet2-vnet1", SrcKey: "hub2", DstKey: "hub1", VirtualNetworkName: "vnet2", AllowVirtualNetworkAccess: true, AllowForwardedTraffic: true, AllowGatewayTransit: true}, peerings["vnet2-vnet1"])
+}
+
+func TestPeeringConflicts(t *testing.T) {
+	inputs := []struct {
+		name     string
+		hubs     HubVirtualNetworks
+		expected []PeeringConflict
+	}{
+		{
+			name: "using the gateway of the remote hub",
+			hubs: HubVirtualNetworks{
+				"hub0": gatewayHub("vnet0"),
+				"hub1": {Name: "vnet1", MeshPeeringSettings: &PeeringSettings{UseRemoteGateways: Bool(true)}},
+			},
+			expected: []PeeringConflict{},
+		},
+		{
+			name: "both sides use remote gateways",
+			hubs: HubVirtualNetworks{
+				"hub0": {Name: "vnet0", MeshPeeringSettings: &PeeringSettings{UseRemoteGateways: Bool(true), AllowGatewayTransit: Bool(true)}},
+				"hub1": {Name: "vnet1", MeshPeeringSettings: &PeeringSettings{UseRemoteGateways: Bool(true), AllowGatewayTransit: Bool(true)}},
+			},
+			expected: []PeeringConflict{
+				{PeeringNames: []string{"vnet0-vnet1", "vnet1-vnet0"}, Message: "peerings vnet0-vnet1 and vnet1-vnet0 both set use_remote_gateways"},
+				{PeeringNames: []string{"vnet0-vnet1"}, Message: "peering vnet0-vnet1 sets use_remote_gateways but hub hub1 has no gateway"},
+				{PeeringNames: []string{"vnet1-vnet0"}, Message: "peering vnet1-vnet0 sets use_remote_gateways but hub hub0 has no gateway"},
+			},
+		},
+		{
+			name: "local gateway and remote gateway without transit",
+			hubs: HubVirtualNetworks{
+				"hub0": func() HubVirtualNetwork {
+					h := gatewayHub("vnet0")
+					h.MeshPeeringSettings = &PeeringSettings{AllowGatewayTransit: Bool(false)}
+					return h
+				}(),
+				"hub1": func() HubVirtualNetwork {
+					h := gatewayHub("vnet1")
+					h.MeshPeeringOverrides = map[string]PeeringSettings{"hub0": {UseRemoteGateways: Bool(true)}}
+					return h
+				}(),
+			},
+			expected: []PeeringConflict{
+				{PeeringNames: []string{"vnet1-vnet0"}, Message: "peering vnet1-vnet0 sets use_remote_gateways but hub hub1 has a gateway of its own"},
+				{PeeringNames: []string{"vnet1-vnet0"}, Message: "peering vnet1-vnet0 sets use_remote_gateways but the peering from hub hub0 does not allow gateway transit"},
+			},
+		},
+	}
+	for _, input := range inputs {
+		i := input
+		t.Run(i.name, func(t *testing.T) {
+			assert.Equal(t, i.expected, Variables{HubVirtualNetworks: i.hubs}.PeeringConflicts())
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"sort"
+)
+
+const (
+	FirewallSubnetName            = "AzureFirewallSubnet"
+	FirewallManagementSubnetName  = "AzureFirewallManagementSubnet"
+	GatewaySubnetName             = "GatewaySubnet"
+	BastionSubnetName             = "AzureBastionSubnet"
+	RouteServerSubnetName         = "RouteServerSubnet"
+	DnsResolverInboundSubnetName  = "DnsResolverInboundSubnet"
+	DnsResolverOutboundSubnetName = "DnsResolverOutboundSubnet"
+)
+
+// SubnetRequest asks the planner for a subnet of the given prefix length.
+type SubnetRequest struct {
+	Name         string
+	PrefixLength int
+}
+
+// FirewallSubnet requests the /26 AzureFirewallSubnet.
+func FirewallSubnet() SubnetRequest {
+	return SubnetRequest{Name: FirewallSubnetName, PrefixLength: 26}
+}
+
+// FirewallManagementSubnet requests the /26 AzureFirewallManagementSubnet required by the Basic firewall tier.
+func FirewallManagementSubnet() SubnetRequest {
+	return SubnetRequest{Name: FirewallManagementSubnetName, PrefixLength: 26}
+}
+
+// GatewaySubnet requests the /27 GatewaySubnet recommended for virtual network gateways.
+func GatewaySubnet() SubnetRequest {
+	return SubnetRequest{Name: GatewaySubnetName, PrefixLength: 27}
+}
+
+// BastionSubnet requests the /26 AzureBastionSubnet.
+func BastionSubnet() SubnetRequest {
+	return SubnetRequest{Name: BastionSubnetName, PrefixLength: 26}
+}
+
+// RouteServerSubnet requests the /27 RouteServerSubnet.
+func RouteServerSubnet() SubnetRequest {
+	return SubnetRequest{Name: RouteServerSubnetName, PrefixLength: 27}
+}
+
+// DnsResolverInboundSubnet requests the /28 DnsResolverInboundSubnet, the smallest a DNS resolver endpoint accepts.
+func DnsResolverInboundSubnet() SubnetRequest {
+	return SubnetRequest{Name: DnsResolverInboundSubnetName, PrefixLength: 28}
+}
+
+// DnsResolverOutboundSubnet requests the /28 DnsResolverOutboundSubnet.
+func DnsResolverOutboundSubnet() SubnetRequest {
+	return SubnetRequest{Name: DnsResolverOutboundSubnetName, PrefixLength: 28}
+}
+
+// PlanSubnets allocates a prefix for every request inside addressSpace, avoiding the prefixes in existing.
+// Requests already present in existing keep their prefix, so re-running a plan never moves a subnet.
+// New requests are placed largest first, then by name, each at the lowest free aligned block,
+// which makes the result depend only on the inputs.
+func PlanSubnets(addressSpace []string, requests []SubnetRequest, existing map[string]string) (map[string]string, error) {
+	return planSubnets(addressSpace, requests, existing, nil)
+}
+
+// planSubnets is PlanSubnets also avoiding the reserved prefixes, those of the subnets existing cannot name, e.g. the
+// prefixes of a dual-stack subnet.
+func planSubnets(addressSpace []string, requests []SubnetRequest, existing map[string]string, reserved []string) (map[string]string, error) {
+	spaces := make([]netip.Prefix, 0, len(addressSpace))
+	for _, cidr := range addressSpace {
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address space %q: %w", cidr, err)
+		}
+		spaces = append(spaces, p.Masked())
+	}
+	r := make(map[string]string, len(requests))
+	allocated := make([]netip.Prefix, 0, len(existing)+len(requests))
+	for name, cidr := range existing {
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %q of existing subnet %s: %w", cidr, name, err)
+		}
+		allocated = append(allocated, p.Masked())
+	}
+	for _, cidr := range reserved {
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prefix %q of existing subnet: %w", cidr, err)
+		}
+		allocated = append(allocated, p.Masked())
+	}
+	pending := make([]SubnetRequest, 0, len(requests))
+	seen := make(map[string]bool, len(requests))
+	for _, req := range requests {
+		if seen[req.Name] {
+			return nil, fmt.Errorf("subnet %s is requested more than once", req.Name)
+		}
+		seen[req.Name] = true
+		if cidr, ok := existing[req.Name]; ok {
+			r[req.Name] = cidr
+			continue
+		}
+		pending = append(pending, req)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].PrefixLength != pending[j].PrefixLength {
+			return pending[i].PrefixLength < pending[j].PrefixLength
+		}
+		return pending[i].Name < pending[j].Name
+	})
+	for _, req := range pending {
+		p, ok := firstFreeBlock(spaces, allocated, req.PrefixLength)
+		if !ok {
+			return nil, fmt.Errorf("no room for subnet %s (/%d) in address space %v", req.Name, req.PrefixLength, addressSpace)
+		}
+		allocated = append(allocated, p)
+		r[req.Name] = p.String()
+	}
+	return r, nil
+}
+
+// PlanHub plans the requested subnets of a hub, keeping the prefixes the hub already uses and avoiding every prefix of
+// its dual-stack subnets, and returns the hub with the planned prefixes filled in. See ApplySubnetPrefixes.
+func PlanHub(hub HubVirtualNetwork, requests []SubnetRequest) (HubVirtualNetwork, error) {
+	prefixes, err := planSubnets(hub.AddressSpace, requests, ExistingSubnetPrefixes(hub), reservedSubnetPrefixes(hub))
+	if err != nil {
+		return hub, err
+	}
+	return hub.ApplySubnetPrefixes(prefixes)
+}
+
+// ExistingSubnetPrefixes returns the single prefix subnets the hub already declares, including the firewall, gateway, Bastion,
+// Route Server and DNS resolver subnets.
+func ExistingSubnetPrefixes(hub HubVirtualNetwork) map[string]string {
+	r := make(map[string]string)
+	for _, s := range subnetPrefixes(hub) {
+		if len(s.addressPrefixes) == 1 && s.addressPrefixes[0] != "" {
+			r[s.name] = s.addressPrefixes[0]
+		}
+	}
+	return r
+}
+
+// reservedSubnetPrefixes returns every prefix of every subnet the hub already declares, so that planning avoids the
+// subnets ExistingSubnetPrefixes leaves out.
+func reservedSubnetPrefixes(hub HubVirtualNetwork) []string {
+	r := make([]string, 0)
+	for _, s := range subnetPrefixes(hub) {
+		for _, cidr := range s.addressPrefixes {
+			if cidr != "" {
+				r = append(r, cidr)
+			}
+		}
+	}
+	return r
+}
+
+// ApplySubnetPrefixes writes planned prefixes into a copy of the hub:
+//   - the AzureFirewallSubnet and AzureFirewallManagementSubnet go to the `subnet_address_prefix` and
+//     `management_subnet_address_prefix` of the firewall,
+//   - the GatewaySubnet and RouteServerSubnet go to the `subnet_address_prefix` of the gateway and the Route Server,
+//   - the AzureBastionSubnet goes to the `subnet_address_prefix` of the Bastion host, unless `subnets` declares it,
+//   - the DNS resolver subnets go to the subnet address prefixes of the `dns_resolver`,
+//   - every other subnet goes to `subnets`.
+//
+// It returns an error for a firewall, gateway or Route Server subnet of a hub without firewall, gateway or Route Server
+// rather than adding it to `subnets`, unless `subnets` already declares it.
+func (n HubVirtualNetwork) ApplySubnetPrefixes(prefixes map[string]string) (HubVirtualNetwork, error) {
+	owners := map[string]struct {
+		name    string
+		present bool
+	}{
+		FirewallSubnetName:           {"firewall", n.Firewall != nil},
+		FirewallManagementSubnetName: {"firewall", n.Firewall != nil},
+		GatewaySubnetName:            {"virtual_network_gateway", n.VirtualNetworkGateway != nil},
+		RouteServerSubnetName:        {"route_server", n.RouteServer != nil},
+	}
+	names := make([]string, 0, len(prefixes))
+	for name := range prefixes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, declared := n.Subnets[name]
+		if owner, ok := owners[name]; ok && !owner.present && !declared {
+			return n, fmt.Errorf("hub %s has no %s for the planned %s", n.Name, owner.name, name)
+		}
+	}
+	subnets := make(map[string]Subnet, len(n.Subnets)+len(prefixes))
+	for k, s := range n.Subnets {
+		subnets[k] = s
+	}
+	if n.Firewall != nil {
+		fw := *n.Firewall
+		n.Firewall = &fw
+	}
+	if n.VirtualNetworkGateway != nil {
+		gw := *n.VirtualNetworkGateway
+		n.VirtualNetworkGateway = &gw
+	}
+	if n.Bastion != nil {
+		b := *n.Bastion
+		n.Bastion = &b
+	}
+	if n.RouteServer != nil {
+		rs := *n.RouteServer
+		n.RouteServer = &rs
+	}
+	if n.DnsResolver != nil {
+		d := *n.DnsResolver
+		n.DnsResolver = &d
+	}
+	_, declaresBastionSubnet := n.Subnets[BastionSubnetName]
+	for name, cidr := range prefixes {
+		switch {
+		case name == FirewallSubnetName && n.Firewall != nil:
+			n.Firewall.SubnetAddressPrefix = cidr
+		case name == FirewallManagementSubnetName && n.Firewall != nil:
+			n.Firewall.ManagementSubnetAddressPrefix = String(cidr)
+		case name == GatewaySubnetName && n.VirtualNetworkGateway != nil:
+			n.VirtualNetworkGateway.SubnetAddressPrefix = cidr
+		case name == BastionSubnetName && n.Bastion != nil && !declaresBastionSubnet:
+			n.Bastion.SubnetAddressPrefix = cidr
+		case name == RouteServerSubnetName && n.RouteServer != nil:
+			n.RouteServer.SubnetAddressPrefix = cidr
+		case name == DnsResolverInboundSubnetName && n.DnsResolver != nil:
+			n.DnsResolver.InboundSubnetAddressPrefix = cidr
+		case name == DnsResolverOutboundSubnetName && n.DnsResolver != nil:
+			n.DnsResolver.OutboundSubnetAddressPrefix = String(cidr)
+		default:
+			s := subnets[name]
+			s.AddressPrefixes = []string{cidr}
+			subnets[name] = s
+		}
+	}
+	n.Subnets = subnets
+	return n, nil
+}
+
+func firstFreeBlock(spaces, allocated []netip.Prefix, bits int) (netip.Prefix, bool) {
+	for _, space := range spaces {
+		if bits < space.Bits() || bits > space.Addr().BitLen() {
+			continue
+		}
+		size := new(big.Int).Lsh(big.NewInt(1), uint(space.Addr().BitLen()-bits))
+		end := new(big.Int).Add(addrToInt(space.Addr()), new(big.Int).Lsh(big.NewInt(1), uint(space.Addr().BitLen()-space.Bits())))
+		for start := addrToInt(space.Addr()); start.Cmp(end) < 0; start.Add(start, size) {
+			candidate := netip.PrefixFrom(intToAddr(start, space.Addr().Is4()), bits)
+			if !overlapsAny(candidate, allocated) {
+				return candidate, true
+			}
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+func overlapsAny(p netip.Prefix, others []netip.Prefix) bool {
+	for _, o := range others {
+		if p.Overlaps(o) {
+			return true
+		}
+	}
+	return false
+}
+
+func addrToInt(a netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(a.AsSlice())
+}
+
+func intToAddr(i *big.Int, is4 bool) netip.Addr {
+	if is4 {
+		return netip.AddrFrom4(*(*[4]byte)(i.FillBytes(make([]byte, 4))))
+	}
+	return netip.AddrFrom16(*(*[16]byte)(i.FillBytes(make([]byte, 16))))
+}
@@ -0,0 +1,217 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanSubnets_ShouldPackLargestSubnetsFirst(t *testing.T) {
+	actual, err := PlanSubnets([]string{"10.0.0.0/24"}, []SubnetRequest{
+		GatewaySubnet(),
+		FirewallSubnet(),
+		BastionSubnet(),
+		FirewallManagementSubnet(),
+		{Name: "dns", PrefixLength: 28},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"AzureBastionSubnet":            "10.0.0.0/26",
+		"AzureFirewallManagementSubnet": "10.0.0.64/26",
+		"AzureFirewallSubnet":           "10.0.0.128/26",
+		"GatewaySubnet":                 "10.0.0.192/27",
+		"dns":                           "10.0.0.224/28",
+	}, actual)
+}
+
+func TestPlanSubnets_ExistingSubnetsShouldNotMove(t *testing.T) {
+	existing := map[string]string{
+		"AzureFirewallSubnet": "10.0.0.64/26",
+		"workload":            "10.0.0.0/26",
+	}
+	actual, err := PlanSubnets([]string{"10.0.0.0/24"}, []SubnetRequest{
+		FirewallSubnet(),
+		BastionSubnet(),
+	}, existing)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"AzureFirewallSubnet": "10.0.0.64/26",
+		"AzureBastionSubnet":  "10.0.0.128/26",
+	}, actual)
+
+	again, err := PlanSubnets([]string{"10.0.0.0/24"}, []SubnetRequest{
+		BastionSubnet(),
+		FirewallSubnet(),
+	}, existing)
+	require.NoError(t, err)
+	assert.Equal(t, actual, again)
+}
+
+func TestPlanSubnets_ShouldUseNextAddressSpaceWhenFull(t *testing.T) {
+	actual, err := PlanSubnets([]string{"10.0.0.0/26", "10.1.0.0/24"}, []SubnetRequest{
+		FirewallSubnet(),
+		BastionSubnet(),
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/26", actual["AzureBastionSubnet"])
+	assert.Equal(t, "10.1.0.0/26", actual["AzureFirewallSubnet"])
+}
+
+func TestPlanSubnets_Ipv6(t *testing.T) {
+	actual, err := PlanSubnets([]string{"fd00:db8::/56"}, []SubnetRequest{
+		{Name: "a", PrefixLength: 64},
+		{Name: "b", PrefixLength: 64},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"a": "fd00:db8::/64",
+		"b": "fd00:db8:0:1::/64",
+	}, actual)
+}
+
+func TestPlanSubnets_Errors(t *testing.T) {
+	inputs := []struct {
+		name         string
+		addressSpace []string
+		requests     []SubnetRequest
+	}{
+		{
+			name:         "no room",
+			addressSpace: []string{"10.0.0.0/26"},
+			requests:     []SubnetRequest{FirewallSubnet(), BastionSubnet()},
+		},
+		{
+			name:         "subnet larger than address space",
+			addressSpace: []string{"10.0.0.0/26"},
+			requests:     []SubnetRequest{{Name: "big", PrefixLength: 24}},
+		},
+		{
+			name:         "duplicated request",
+			addressSpace: []string{"10.0.0.0/16"},
+			requests:     []SubnetRequest{FirewallSubnet(), FirewallSubnet()},
+		},
+		{
+			name:         "invalid address space",
+			addressSpace: []string{"10.0.0.0"},
+			requests:     []SubnetRequest{FirewallSubnet()},
+		},
+	}
+	for _, input := range inputs {
+		i := input
+		t.Run(i.name, func(t *testing.T) {
+			_, err := PlanSubnets(i.addressSpace, i.requests, nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPlanHub_ShouldFillFirewallPrefixesAndSubnets(t *testing.T) {
+	hub := HubVirtualNetwork{
+		AddressSpace: []string{"10.0.0.0/24"},
+		Subnets: map[string]Subnet{
+			"workload": {AddressPrefixes: []string{"10.0.0.0/26"}},
+		},
+		Firewall: &Firewall{SkuName: "AZFW_VNet", SkuTier: "Basic"},
+	}
+	planned, err := PlanHub(hub, []SubnetRequest{FirewallSubnet(), FirewallManagementSubnet(), {Name: "app", PrefixLength: 27}})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.128/26", planned.Firewall.SubnetAddressPrefix)
+	assert.Equal(t, "10.0.0.64/26", *planned.Firewall.ManagementSubnetAddressPrefix)
+	assert.Equal(t, []string{"10.0.0.192/27"}, planned.Subnets["app"].AddressPrefixes)
+	assert.Equal(t, []string{"10.0.0.0/26"}, planned.Subnets["workload"].AddressPrefixes)
+	assert.Empty(t, ValidateCidrs(HubVirtualNetworks{"hub": planned}))
+	assert.Equal(t, "", hub.Firewall.SubnetAddressPrefix, "PlanHub must not mutate its input")
+
+	replanned, err := PlanHub(planned, []SubnetRequest{FirewallSubnet(), FirewallManagementSubnet(), {Name: "app", PrefixLength: 27}})
+	require.NoError(t, err)
+	assert.Equal(t, planned, replanned)
+
+	dualStack := HubVirtualNetwork{
+		AddressSpace: []string{"10.0.0.0/24", "fd00:db8::/56"},
+		Subnets: map[string]Subnet{
+			"workload": {AddressPrefixes: []string{"10.0.0.0/26", "fd00:db8::/64"}},
+		},
+		Firewall: &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard"},
+	}
+	planned, err = PlanHub(dualStack, []SubnetRequest{FirewallSubnet()})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.64/26", planned.Firewall.SubnetAddressPrefix, "the prefixes of a dual-stack subnet must be avoided")
+	assert.Equal(t, []string{"10.0.0.0/26", "fd00:db8::/64"}, planned.Subnets["workload"].AddressPrefixes)
+	assert.Empty(t, ValidateCidrs(HubVirtualNetworks{"hub": planned}))
+}
+
+func TestPlanHub_ShouldFillGatewayBastionAndRouteServerPrefixes(t *testing.T) {
+	hub := HubVirtualNetwork{
+		AddressSpace:          []string{"10.0.0.0/24"},
+		VirtualNetworkGateway: &VirtualNetworkGateway{Type: "Vpn", Sku: "VpnGw1AZ"},
+		Bastion:               &Bastion{},
+		RouteServer:           &RouteServer{},
+	}
+	requests := []SubnetRequest{GatewaySubnet(), BastionSubnet(), RouteServerSubnet()}
+	planned, err := PlanHub(hub, requests)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.64/27", planned.VirtualNetworkGateway.SubnetAddressPrefix)
+	assert.Equal(t, "10.0.0.0/26", planned.Bastion.SubnetAddressPrefix)
+	assert.Equal(t, "10.0.0.96/27", planned.RouteServer.SubnetAddressPrefix)
+	assert.Empty(t, planned.Subnets)
+	assert.Equal(t, "", hub.Bastion.SubnetAddressPrefix, "PlanHub must not mutate its input")
+	assert.Equal(t, "", hub.RouteServer.SubnetAddressPrefix, "PlanHub must not mutate its input")
+
+	replanned, err := PlanHub(planned, requests)
+	require.NoError(t, err)
+	assert.Equal(t, planned, replanned)
+}
+
+func TestPlanHub_SubnetOfMissingFirewallGatewayOrRouteServerShouldFail(t *testing.T) {
+	inputs := []SubnetRequest{FirewallSubnet(), FirewallManagementSubnet(), GatewaySubnet(), RouteServerSubnet()}
+	for _, input := range inputs {
+		req := input
+		t.Run(req.Name, func(t *testing.T) {
+			hub := HubVirtualNetwork{Name: "vnet0", AddressSpace: []string{"10.0.0.0/24"}}
+			_, err := PlanHub(hub, []SubnetRequest{req})
+			assert.Error(t, err)
+
+			hub.Subnets = map[string]Subnet{req.Name: {AddressPrefixes: []string{"10.0.0.0/26"}}}
+			planned, err := PlanHub(hub, []SubnetRequest{req})
+			require.NoError(t, err, "a subnet subnets already declares keeps its place")
+			assert.Equal(t, hub.Subnets, planned.Subnets)
+		})
+	}
+}
+
+func TestPlanHub_DeclaredBastionSubnetShouldStayInSubnets(t *testing.T) {
+	hub := HubVirtualNetwork{
+		AddressSpace: []string{"10.0.0.0/24"},
+		Subnets: map[string]Subnet{
+			BastionSubnetName: {GeneratedNetworkSecurityGroup: &GeneratedNetworkSecurityGroup{}},
+		},
+		Bastion: &Bastion{},
+	}
+	planned, err := PlanHub(hub, []SubnetRequest{BastionSubnet()})
+	require.NoError(t, err)
+	assert.Equal(t, "", planned.Bastion.SubnetAddressPrefix)
+	assert.Equal(t, []string{"10.0.0.0/26"}, planned.Subnets[BastionSubnetName].AddressPrefixes)
+	assert.NotNil(t, planned.Subnets[BastionSubnetName].GeneratedNetworkSecurityGroup)
+}
+
+func TestPlanHub_ShouldFillDnsResolverPrefixes(t *testing.T) {
+	hub := HubVirtualNetwork{
+		AddressSpace: []string{"10.0.0.0/24"},
+		Subnets: map[string]Subnet{
+			"workload": {AddressPrefixes: []string{"10.0.0.0/25"}},
+		},
+		DnsResolver: &DnsResolver{},
+	}
+	requests := []SubnetRequest{DnsResolverInboundSubnet(), DnsResolverOutboundSubnet()}
+	planned, err := PlanHub(hub, requests)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.128/28", planned.DnsResolver.InboundSubnetAddressPrefix)
+	assert.Equal(t, "10.0.0.144/28", *planned.DnsResolver.OutboundSubnetAddressPrefix)
+	assert.Empty(t, ValidateCidrs(HubVirtualNetworks{"hub": planned}))
+	assert.Nil(t, hub.DnsResolver.OutboundSubnetAddressPrefix, "PlanHub must not mutate its input")
+
+	replanned, err := PlanHub(planned, requests)
+	require.NoError(t, err)
+	assert.Equal(t, planned, replanned)
+}
@@ -0,0 +1,259 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// RandomHubVirtualNetworks generates count hubs with random mesh, peering, routing, firewall, gateway, Route Server,
+// default route and user route settings.
+// Every generated hub satisfies the module's variable validations, so the result can be fed to Terraform
+// as well as to the Go re-implementations to compare them.
+func RandomHubVirtualNetworks(r *rand.Rand, count int) HubVirtualNetworks {
+	hubs := make(HubVirtualNetworks, count)
+	for i := 0; i < count; i++ {
+		key := fmt.Sprintf("hub%d", i)
+		hub := HubVirtualNetwork{
+			Name:                         fmt.Sprintf("vnet-%s", key),
+			AddressSpace:                 []string{fmt.Sprintf("10.%d.0.0/16", i)},
+			Location:                     "eastus",
+			ResourceGroupName:            fmt.Sprintf("rg-%s", key),
+			MeshPeeringEnabled:           Bool(r.Intn(4) != 0),
+			ResourceGroupCreationEnabled: Bool(false),
+			ResourceGroupLockEnabled:     Bool(false),
+		}
+		candidates := []string{
+			fmt.Sprintf("10.%d.0.0/16", i),
+			fmt.Sprintf("192.168.%d.0/24", i),
+		}
+		for _, cidr := range candidates[:r.Intn(len(candidates)+1)] {
+			hub.RoutingAddressSpace = append(hub.RoutingAddressSpace, cidr)
+		}
+		if r.Intn(2) == 0 {
+			hub.Firewall = &Firewall{
+				SkuName:             "AZFW_VNet",
+				SkuTier:             "Standard",
+				SubnetAddressPrefix: fmt.Sprintf("10.%d.1.0/24", i),
+			}
+			if r.Intn(6) == 0 {
+				hub.Firewall.SkuTier = "Premium"
+			}
+		} else {
+			hub.HubRouterIpAddress = String(fmt.Sprintf("10.%d.0.4", i))
+			if r.Intn(3) == 0 {
+				hub.RouteServer = randomRouteServer(r, fmt.Sprintf("10.%d.3.0/27", i), *hub.HubRouterIpAddress)
+			}
+		}
+		hub.DefaultRoute = randomDefaultRoute(r, hub, i)
+		switch r.Intn(4) {
+		case 0:
+			hub.Subnets = map[string]Subnet{
+				GatewaySubnetName: {AddressPrefixes: []string{fmt.Sprintf("10.%d.2.0/27", i)}, AssignGeneratedRouteTable: Bool(false)},
+			}
+		case 1:
+			hub.VirtualNetworkGateway = randomVirtualNetworkGateway(r, fmt.Sprintf("10.%d.2.0/27", i))
+		}
+		if r.Intn(2) == 0 {
+			hub.MeshPeeringSettings = randomPeeringSettings(r)
+		}
+		if r.Intn(2) == 0 {
+			hub.MeshPeeringOverrides = make(map[string]PeeringSettings)
+			for j := 0; j < count; j++ {
+				if j != i && r.Intn(2) == 0 {
+					hub.MeshPeeringOverrides[fmt.Sprintf("hub%d", j)] = *randomPeeringSettings(r)
+				}
+			}
+		}
+		userRoutes := r.Intn(3)
+		for j := 0; j < userRoutes; j++ {
+			entry := RouteTableEntry{
+				Name:          fmt.Sprintf("%s-user-%d", key, j),
+				AddressPrefix: fmt.Sprintf("172.%d.%d.0/24", 16+i, j),
+				NextHopType:   "None",
+			}
+			if r.Intn(2) == 0 {
+				entry.NextHopType = "VirtualAppliance"
+				entry.NextHopIpAddress = String(fmt.Sprintf("10.%d.0.%d", i, 10+j))
+			}
+			if r.Intn(4) == 0 {
+				entry.HasBgpOverride = Bool(true)
+			}
+			hub.RouteTableEntries = append(hub.RouteTableEntries, entry)
+		}
+		if !hasBgpOverride(hub.RouteTableEntries) && r.Intn(4) == 0 {
+			hub.BgpRoutePropagationEnabled = Bool(false)
+		}
+		hubs[key] = hub
+	}
+	return hubs
+}
+
+// RandomFirewallPolicies generates a policy with random mesh rules for some of the hubs with a firewall, with random
+// IDPS settings for a Premium firewall.
+func RandomFirewallPolicies(r *rand.Rand, hubs HubVirtualNetworks) map[string]FirewallPolicy {
+	policies := make(map[string]FirewallPolicy)
+	for _, k := range hubs.Keys() {
+		fw := hubs[k].Firewall
+		if fw == nil || r.Intn(2) != 0 {
+			continue
+		}
+		p := FirewallPolicy{MeshRulesEnabled: Bool(r.Intn(4) != 0)}
+		if fw.SkuTier == "Premium" {
+			p.IntrusionDetection = &IntrusionDetection{
+				Mode:               String([]string{"Off", "Alert", "Deny"}[r.Intn(3)]),
+				SignatureOverrides: []SignatureOverride{{Id: fmt.Sprintf("20%05d", r.Intn(100000)), State: "Off"}},
+			}
+		}
+		policies[k] = p
+	}
+	return policies
+}
+
+// RandomSpokeVirtualNetworks generates up to three spokes attached to random hubs, some of them existing virtual networks.
+// A spoke's address space either lies outside every hub or within the routing address space its hub may have.
+func RandomSpokeVirtualNetworks(r *rand.Rand, hubs HubVirtualNetworks) SpokeVirtualNetworks {
+	keys := hubs.Keys()
+	count := r.Intn(4)
+	spokes := make(SpokeVirtualNetworks, count)
+	for i := 0; i < count; i++ {
+		key := fmt.Sprintf("spoke%d", i)
+		hubIndex := r.Intn(len(keys))
+		spoke := SpokeVirtualNetwork{
+			HubKey:             keys[hubIndex],
+			AddressSpace:       []string{fmt.Sprintf("10.%d.0.0/16", 100+i)},
+			MeshRoutingEnabled: Bool(r.Intn(4) != 0),
+			Subnets: map[string]SpokeSubnet{
+				"workload": {AssignGeneratedRouteTable: Bool(r.Intn(4) != 0)},
+			},
+		}
+		if r.Intn(2) == 0 {
+			spoke.AddressSpace = []string{fmt.Sprintf("192.168.%s.128/25", strings.TrimPrefix(keys[hubIndex], "hub"))}
+		}
+		if r.Intn(2) == 0 {
+			spoke.VirtualNetworkId = String(fmt.Sprintf("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg-%s/providers/Microsoft.Network/virtualNetworks/vnet-%s", key, key))
+		} else {
+			spoke.Name = String(fmt.Sprintf("vnet-%s", key))
+			spoke.Subnets["workload"] = SpokeSubnet{
+				AddressPrefixes:           spoke.AddressSpace,
+				AssignGeneratedRouteTable: spoke.Subnets["workload"].AssignGeneratedRouteTable,
+			}
+		}
+		if r.Intn(2) == 0 {
+			spoke.RoutedAddressPrefixes = []string{fmt.Sprintf("172.31.%d.0/24", i)}
+		}
+		if r.Intn(4) == 0 {
+			spoke.BgpRoutePropagationEnabled = Bool(r.Intn(2) == 0)
+		}
+		spokes[key] = spoke
+	}
+	return spokes
+}
+
+// randomVirtualNetworkGateway generates a VPN or ExpressRoute gateway in the given GatewaySubnet prefix.
+func randomVirtualNetworkGateway(r *rand.Rand, subnetAddressPrefix string) *VirtualNetworkGateway {
+	if r.Intn(2) == 0 {
+		return &VirtualNetworkGateway{Type: "ExpressRoute", Sku: "ErGw1AZ", SubnetAddressPrefix: subnetAddressPrefix}
+	}
+	gw := &VirtualNetworkGateway{
+		Type:                "Vpn",
+		Sku:                 "VpnGw1AZ",
+		SubnetAddressPrefix: subnetAddressPrefix,
+		ActiveActive:        Bool(r.Intn(2) == 0),
+		EnableBgp:           Bool(r.Intn(2) == 0),
+	}
+	if *gw.EnableBgp {
+		gw.BgpSettings = &BgpSettings{Asn: Int(65000 + r.Intn(500))}
+	}
+	return gw
+}
+
+// randomDefaultRoute leaves the default route of hub i unset or sends it to the internet, nowhere, the gateway, an NVA
+// or the firewall of the hub.
+func randomDefaultRoute(r *rand.Rand, hub HubVirtualNetwork, i int) *DefaultRoute {
+	switch r.Intn(6) {
+	case 0:
+		return &DefaultRoute{NextHopType: String("Internet")}
+	case 1:
+		return &DefaultRoute{NextHopType: String("None")}
+	case 2:
+		return &DefaultRoute{NextHopType: String("VirtualNetworkGateway")}
+	case 3:
+		return &DefaultRoute{NextHopType: String("VirtualAppliance"), NextHopIpAddress: String(fmt.Sprintf("10.%d.0.5", i))}
+	case 4:
+		if hub.Firewall != nil {
+			return &DefaultRoute{NextHopType: String("Firewall")}
+		}
+	}
+	return nil
+}
+
+// randomRouteServer generates a Route Server in the given RouteServerSubnet prefix, peering over BGP with the router of
+// the hub or with no NVA at all.
+func randomRouteServer(r *rand.Rand, subnetAddressPrefix, routerIpAddress string) *RouteServer {
+	rs := &RouteServer{
+		SubnetAddressPrefix:          subnetAddressPrefix,
+		BranchToBranchTrafficEnabled: Bool(r.Intn(2) == 0),
+	}
+	if r.Intn(4) != 0 {
+		rs.BgpConnections = map[string]RouteServerBgpConnection{
+			"nva": {PeerAsn: 64512 + r.Intn(500), PeerIp: routerIpAddress},
+		}
+	}
+	return rs
+}
+
+// randomPeeringSettings leaves every setting unset or sets it to a random value.
+func randomPeeringSettings(r *rand.Rand) *PeeringSettings {
+	pick := func() *bool {
+		switch r.Intn(3) {
+		case 0:
+			return Bool(true)
+		case 1:
+			return Bool(false)
+		}
+		return nil
+	}
+	return &PeeringSettings{
+		AllowVirtualNetworkAccess: pick(),
+		AllowForwardedTraffic:     pick(),
+		AllowGatewayTransit:       pick(),
+		UseRemoteGateways:         pick(),
+	}
+}
+
+// RandomMeshTopology picks a random topology for the hubs, nil standing for the default full mesh.
+// Every key the topology references is a key of hubs.
+func RandomMeshTopology(r *rand.Rand, hubs HubVirtualNetworks) *MeshTopology {
+	keys := hubs.Keys()
+	randomPairs := func() [][]string {
+		var pairs [][]string
+		if len(keys) < 2 {
+			return pairs
+		}
+		for i := r.Intn(3); i > 0; i-- {
+			a := r.Intn(len(keys))
+			b := (a + 1 + r.Intn(len(keys)-1)) % len(keys)
+			pairs = append(pairs, []string{keys[a], keys[b]})
+		}
+		return pairs
+	}
+	var t *MeshTopology
+	switch r.Intn(4) {
+	case 0:
+		return nil
+	case 1:
+		t = &MeshTopology{Type: String(MeshTopologyFullMesh)}
+	case 2:
+		t = &MeshTopology{Type: String(MeshTopologyHubAndSpoke), TransitHubKey: String(keys[r.Intn(len(keys))])}
+	case 3:
+		t = &MeshTopology{Type: String(MeshTopologyGroups), Groups: map[string][]string{}}
+		for _, k := range keys {
+			g := fmt.Sprintf("group%d", r.Intn(3))
+			t.Groups[g] = append(t.Groups[g], k)
+		}
+	}
+	t.AllowedPairs = randomPairs()
+	t.DeniedPairs = randomPairs()
+	return t
+}
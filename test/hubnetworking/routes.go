@@ -0,0 +1,271 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Route mirrors an entry of `mesh_routes` in `local.route_map`.
+type Route struct {
+	Name             string  `json:"name"`
+	AddressPrefix    string  `json:"address_prefix"`
+	NextHopType      string  `json:"next_hop_type"`
+	NextHopIpAddress *string `json:"next_hop_ip_address"`
+}
+
+// RouteTable mirrors a value of `local.route_map`.
+type RouteTable struct {
+	BgpRoutePropagationEnabled bool              `json:"bgp_route_propagation_enabled"`
+	DefaultRoutes              []Route           `json:"default_routes"`
+	MeshRoutes                 []Route           `json:"mesh_routes"`
+	UserRoutes                 []RouteTableEntry `json:"user_routes"`
+}
+
+// FirewallRouteTable mirrors a value of `local.firewall_route_tables`, the route table of a firewall subnet.
+type FirewallRouteTable struct {
+	BgpRoutePropagationEnabled bool    `json:"bgp_route_propagation_enabled"`
+	Name                       string  `json:"name"`
+	Routes                     []Route `json:"routes"`
+}
+
+// DefaultRouteConflict is an element of `local.default_route_conflicts`, a user route claiming `0.0.0.0/0`, or `::/0`,
+// in a hub whose `default_route` already does.
+type DefaultRouteConflict struct {
+	HubKeys []string `json:"hub_keys"`
+	Message string   `json:"message"`
+}
+
+func (c DefaultRouteConflict) Error() string {
+	return c.Message
+}
+
+// GatewaySubnetRouteTableViolation is a hub whose user defined GatewaySubnet the validation of `default_route` in
+// variables.tf rejects.
+type GatewaySubnetRouteTableViolation struct {
+	HubKey  string
+	Message string
+}
+
+func (v GatewaySubnetRouteTableViolation) Error() string {
+	return v.Message
+}
+
+// RouteMap computes `local.route_map`, empty with a Virtual WAN. firewallPrivateIps plays the role of
+// `local.firewall_private_ip`, mapping a hub key to the private ip address of its firewall.
+// Unset optional attributes are treated as their defaults.
+func (v Variables) RouteMap(firewallPrivateIps map[string]string) map[string]RouteTable {
+	hubs := v.hubVirtualNetworks()
+	nextHops := v.MeshNextHops()
+	prefixes := v.MeshPrefixes()
+	r := make(map[string]RouteTable, len(hubs))
+	for _, kSrc := range hubs.Keys() {
+		vSrc := hubs[kSrc]
+		meshRoutes := make([]Route, 0)
+		for _, kDst := range hubs.Keys() {
+			kNextHop, ok := nextHops[kSrc][kDst]
+			if !ok || vSrc.learnsMeshRoutesOverBgp(hubs[kNextHop]) {
+				continue
+			}
+			for _, p := range prefixes[kDst] {
+				nextHop, ok := meshRouteNextHop(hubs[kNextHop], kNextHop, p.AddressPrefix, firewallPrivateIps)
+				if !ok {
+					continue
+				}
+				meshRoutes = append(meshRoutes, Route{
+					Name:             p.Name,
+					AddressPrefix:    p.AddressPrefix,
+					NextHopType:      "VirtualAppliance",
+					NextHopIpAddress: nextHop,
+				})
+			}
+		}
+		r[kSrc] = RouteTable{
+			BgpRoutePropagationEnabled: *vSrc.BgpRoutePropagationEnabled,
+			DefaultRoutes:              vSrc.defaultRoutes(firewallPrivateIps[kSrc]),
+			MeshRoutes:                 meshRoutes,
+			UserRoutes:                 vSrc.RouteTableEntries,
+		}
+	}
+	return r
+}
+
+// defaultRoutes mirrors `default_routes` in `local.route_map`, the `0.0.0.0/0` route of the hub, none with the `None`
+// next hop type, followed by the `::/0` route of a dual-stack hub, see defaultRouteIpv6Enabled. firewallPrivateIp is
+// the private ip address of the firewall of the hub, if any.
+func (n HubVirtualNetwork) defaultRoutes(firewallPrivateIp string) []Route {
+	var r []Route
+	switch nextHopType := *n.DefaultRoute.NextHopType; nextHopType {
+	case "None":
+		return []Route{}
+	case "Internet":
+		r = []Route{{Name: "internet", AddressPrefix: "0.0.0.0/0", NextHopType: nextHopType}}
+	case "Firewall":
+		r = []Route{{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String(firewallPrivateIp)}}
+	default:
+		r = []Route{{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: nextHopType, NextHopIpAddress: n.DefaultRoute.NextHopIpAddress}}
+	}
+	if n.defaultRouteIpv6Enabled() {
+		r = append(r, Route{Name: "default-ipv6", AddressPrefix: "::/0", NextHopType: "VirtualAppliance", NextHopIpAddress: n.HubRouterIpv6Address})
+	}
+	return r
+}
+
+// defaultRouteIpv6Enabled mirrors `local.default_route_ipv6_enabled`: the route table of a hub with a
+// `hub_router_ipv6_address` also sends `::/0` to it when the `default_route` goes through the firewall or an NVA.
+func (n HubVirtualNetwork) defaultRouteIpv6Enabled() bool {
+	nextHopType := *n.DefaultRoute.NextHopType
+	return n.HubRouterIpv6Address != nil && (nextHopType == "Firewall" || nextHopType == "VirtualAppliance")
+}
+
+// FirewallRouteTables computes the name and routes of `local.firewall_route_tables`, for the firewalls without
+// `subnet_route_table_id`: the internet route followed by the mesh routes of the hub. firewallPrivateIps plays the role
+// of `local.firewall_private_ip` as in RouteMap.
+func (v Variables) FirewallRouteTables(firewallPrivateIps map[string]string) map[string]FirewallRouteTable {
+	hubs := v.hubVirtualNetworks()
+	routes := v.RouteMap(firewallPrivateIps)
+	r := make(map[string]FirewallRouteTable)
+	for k, hub := range hubs {
+		if hub.Firewall == nil || hub.Firewall.SubnetRouteTableId != nil {
+			continue
+		}
+		name := fmt.Sprintf("route-afw-%s", k)
+		if hub.Firewall.RouteTableName != nil {
+			name = *hub.Firewall.RouteTableName
+		}
+		r[k] = FirewallRouteTable{
+			BgpRoutePropagationEnabled: *hub.Firewall.RouteTableBgpRoutePropagationEnabled,
+			Name:                       name,
+			Routes:                     append([]Route{{Name: "internet", AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"}}, routes[k].MeshRoutes...),
+		}
+	}
+	return r
+}
+
+// DefaultRouteConflicts computes `local.default_route_conflicts`.
+func (v Variables) DefaultRouteConflicts() []DefaultRouteConflict {
+	hubs := v.hubVirtualNetworks()
+	conflicts := make([]DefaultRouteConflict, 0)
+	for _, k := range hubs.Keys() {
+		hub := hubs[k]
+		if *hub.DefaultRoute.NextHopType == "None" {
+			continue
+		}
+		for _, e := range hub.RouteTableEntries {
+			if e.AddressPrefix == "0.0.0.0/0" || e.AddressPrefix == "::/0" && hub.defaultRouteIpv6Enabled() {
+				conflicts = append(conflicts, DefaultRouteConflict{
+					HubKeys: []string{k},
+					Message: fmt.Sprintf("route %s of hub %s claims %s, which its default_route already routes to %s; set the next_hop_type of the default_route to None to route it with route_table_entries", e.Name, k, e.AddressPrefix, *hub.DefaultRoute.NextHopType),
+				})
+			}
+		}
+	}
+	return conflicts
+}
+
+// gatewaySubnetRouteTableMessage is the `error_message` of the validation ValidateGatewaySubnetRouteTables mirrors.
+const gatewaySubnetRouteTableMessage = "A GatewaySubnet with assign_generated_route_table must not get a default_route other than `Internet` or `None`, the gateway would send 0.0.0.0/0 away from itself. Set assign_generated_route_table of the GatewaySubnet to false, or the next_hop_type of the default_route to `Internet` or `None`."
+
+// ValidateGatewaySubnetRouteTables mirrors the validation of `var.hub_virtual_networks` rejecting a GatewaySubnet in
+// `subnets` with `assign_generated_route_table` in a hub whose `default_route` is neither `Internet` nor `None`, with
+// one violation carrying its `error_message` per hub it rejects.
+func ValidateGatewaySubnetRouteTables(v Variables) []GatewaySubnetRouteTableViolation {
+	hubs := v.HubVirtualNetworks.WithDefaults()
+	violations := make([]GatewaySubnetRouteTableViolation, 0)
+	for _, k := range hubs.Keys() {
+		hub := hubs[k]
+		subnet, ok := hub.Subnets[GatewaySubnetName]
+		if !ok || !*subnet.AssignGeneratedRouteTable {
+			continue
+		}
+		if nextHopType := *hub.DefaultRoute.NextHopType; nextHopType != "Internet" && nextHopType != "None" {
+			violations = append(violations, GatewaySubnetRouteTableViolation{HubKey: k, Message: gatewaySubnetRouteTableMessage})
+		}
+	}
+	return violations
+}
+
+// learnsMeshRoutesOverBgp tells whether the hub learns the mesh prefixes routed through nextHop over BGP, so
+// `local.route_map` generates no static routes for them: the hub propagates BGP routes, has a Route Server with BGP
+// connections and nextHop is the router of a hub without firewall, an NVA advertising the prefixes.
+func (n HubVirtualNetwork) learnsMeshRoutesOverBgp(nextHop HubVirtualNetwork) bool {
+	return *n.BgpRoutePropagationEnabled && n.RouteServer != nil && len(n.RouteServer.BgpConnections) > 0 && nextHop.Firewall == nil
+}
+
+// hasBgpOverride tells whether a route table entry has `has_bgp_override`, which turns off the BGP route propagation
+// of the route table by default, see `local.bgp_route_propagation_enabled`.
+func hasBgpOverride(entries []RouteTableEntry) bool {
+	for _, e := range entries {
+		if e.HasBgpOverride != nil && *e.HasBgpOverride {
+			return true
+		}
+	}
+	return false
+}
+
+// meshRouteNextHop returns the next hop of the route towards cidr through hub k: its firewall, or else its router, for an
+// IPv4 prefix, its `hub_router_ipv6_address` for an IPv6 prefix since Azure Firewall has no IPv6 private address.
+// It returns false when the hub has no IPv6 router for an IPv6 prefix, the module creates no route then.
+func meshRouteNextHop(hub HubVirtualNetwork, k, cidr string, firewallPrivateIps map[string]string) (*string, bool) {
+	if isIpv6(cidr) {
+		return hub.HubRouterIpv6Address, hub.HubRouterIpv6Address != nil
+	}
+	if ip, ok := firewallPrivateIps[k]; ok {
+		return String(ip), true
+	}
+	return hub.HubRouterIpAddress, true
+}
+
+// isIpv6 mirrors `length(regexall(":", cidr)) > 0`, which tells IPv6 prefixes apart in the module.
+func isIpv6(cidr string) bool {
+	return strings.Contains(cidr, ":")
+}
+
+// MeshPrefix mirrors an element of a value of `local.hub_mesh_prefixes`.
+type MeshPrefix struct {
+	Name          string
+	AddressPrefix string
+}
+
+// MeshPrefixes computes `local.hub_mesh_prefixes`, the prefixes routed towards each hub through its firewall or router:
+// its routing address space followed by the address space of its spokes with mesh routing that is not already
+// within the routing address space.
+func (v Variables) MeshPrefixes() map[string][]MeshPrefix {
+	v = v.WithDefaults()
+	r := make(map[string][]MeshPrefix, len(v.HubVirtualNetworks))
+	for _, k := range v.HubVirtualNetworks.Keys() {
+		hub := v.HubVirtualNetworks[k]
+		r[k] = make([]MeshPrefix, 0)
+		for _, cidr := range hub.RoutingAddressSpace {
+			r[k] = append(r[k], MeshPrefix{Name: MeshRouteName(k, cidr), AddressPrefix: cidr})
+		}
+		for _, kSpoke := range v.SpokeVirtualNetworks.Keys() {
+			spoke := v.SpokeVirtualNetworks[kSpoke]
+			if spoke.HubKey != k || !*spoke.MeshRoutingEnabled {
+				continue
+			}
+			for _, cidr := range spoke.AddressSpace {
+				if !cidrWithinAny(cidr, hub.RoutingAddressSpace) {
+					r[k] = append(r[k], MeshPrefix{Name: MeshRouteName(kSpoke, cidr), AddressPrefix: cidr})
+				}
+			}
+		}
+	}
+	return r
+}
+
+// MeshRouteName returns the name the module gives to the route towards cidr in hub or spoke key,
+// `${key}-${replace(replace(cidr, ":", "-"), "/", "-")}`, since route names do not allow the colons of IPv6 prefixes.
+func MeshRouteName(key, cidr string) string {
+	return fmt.Sprintf("%s-%s", key, strings.NewReplacer(":", "-", "/", "-").Replace(cidr))
+}
+
+// Keys returns the hub keys in the lexical order Terraform iterates a map in.
+func (h HubVirtualNetworks) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,443 @@
+package hubnetworking
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func aHub(meshPeering bool, routingAddressSpace ...string) HubVirtualNetwork {
+	return HubVirtualNetwork{
+		MeshPeeringEnabled:  Bool(meshPeering),
+		RoutingAddressSpace: routingAddressSpace,
+		HubRouterIpAddress:  String("dummyIp"),
+	}
+}
+
+func aRouteServerHub(bgpConnections map[string]RouteServerBgpConnection, routingAddressSpace ...string) HubVirtualNetwork {
+	hub := aHub(true, routingAddressSpace...)
+	hub.RouteServer = &RouteServer{SubnetAddressPrefix: "10.0.3.0/27", BgpConnections: bgpConnections}
+	return hub
+}
+
+func aFirewallHub(routingAddressSpace ...string) HubVirtualNetwork {
+	hub := aHub(true, routingAddressSpace...)
+	hub.Firewall = &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.1.1.0/26"}
+	return hub
+}
+
+func TestRouteMap_MeshRoutes(t *testing.T) {
+	inputs := []struct {
+		name        string
+		hubs        HubVirtualNetworks
+		firewallIps map[string]string
+		expected    map[string][]Route
+	}{
+		{
+			name: "no routing address space should create no mesh routes",
+			hubs: HubVirtualNetworks{
+				"vnet0": aHub(true),
+				"vnet1": aHub(true),
+			},
+			expected: map[string][]Route{
+				"vnet0": {},
+				"vnet1": {},
+			},
+		},
+		{
+			name: "uni-directional route",
+			hubs: HubVirtualNetworks{
+				"vnet0": aHub(true),
+				"vnet1": aHub(true, "10.0.0.0/16"),
+			},
+			expected: map[string][]Route{
+				"vnet0": {
+					{Name: "vnet1-10.0.0.0-16", AddressPrefix: "10.0.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+				},
+				"vnet1": {},
+			},
+		},
+		{
+			name: "firewall private ip should take precedence over hub router ip",
+			hubs: HubVirtualNetworks{
+				"vnet0": aHub(true, "10.0.0.0/16"),
+				"vnet1": aHub(true, "10.1.0.0/16", "192.168.1.0/24"),
+			},
+			firewallIps: map[string]string{
+				"vnet1": "vnet1-fw-ip",
+			},
+			expected: map[string][]Route{
+				"vnet0": {
+					{Name: "vnet1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet1-fw-ip")},
+					{Name: "vnet1-192.168.1.0-24", AddressPrefix: "192.168.1.0/24", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet1-fw-ip")},
+				},
+				"vnet1": {
+					{Name: "vnet0-10.0.0.0-16", AddressPrefix: "10.0.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+				},
+			},
+		},
+		{
+			name: "hub without mesh peering should neither route nor be routed to",
+			hubs: HubVirtualNetworks{
+				"vnet0":       aHub(true, "10.0.0.0/16"),
+				"nonMeshVnet": aHub(false, "10.2.0.0/16"),
+			},
+			expected: map[string][]Route{
+				"vnet0":       {},
+				"nonMeshVnet": {},
+			},
+		},
+		{
+			name: "route server with bgp connections should learn the prefixes of router hubs",
+			hubs: HubVirtualNetworks{
+				"vnet0": aRouteServerHub(map[string]RouteServerBgpConnection{"nva": {PeerAsn: 65001, PeerIp: "10.0.0.4"}}, "10.0.0.0/16"),
+				"vnet1": aHub(true, "10.1.0.0/16"),
+				"vnet2": aFirewallHub("10.2.0.0/16"),
+			},
+			firewallIps: map[string]string{
+				"vnet2": "vnet2-fw-ip",
+			},
+			expected: map[string][]Route{
+				"vnet0": {
+					{Name: "vnet2-10.2.0.0-16", AddressPrefix: "10.2.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet2-fw-ip")},
+				},
+				"vnet1": {
+					{Name: "vnet0-10.0.0.0-16", AddressPrefix: "10.0.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+					{Name: "vnet2-10.2.0.0-16", AddressPrefix: "10.2.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet2-fw-ip")},
+				},
+				"vnet2": {
+					{Name: "vnet0-10.0.0.0-16", AddressPrefix: "10.0.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+					{Name: "vnet1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+				},
+			},
+		},
+		{
+			name: "route server should not suppress mesh routes when the hub does not propagate bgp routes",
+			hubs: HubVirtualNetworks{
+				"vnet0": func() HubVirtualNetwork {
+					hub := aRouteServerHub(map[string]RouteServerBgpConnection{"nva": {PeerAsn: 65001, PeerIp: "10.0.0.4"}}, "10.0.0.0/16")
+					hub.BgpRoutePropagationEnabled = Bool(false)
+					return hub
+				}(),
+				"vnet1": aHub(true, "10.1.0.0/16"),
+			},
+			expected: map[string][]Route{
+				"vnet0": {
+					{Name: "vnet1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+				},
+				"vnet1": {
+					{Name: "vnet0-10.0.0.0-16", AddressPrefix: "10.0.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+				},
+			},
+		},
+		{
+			name: "route server without bgp connections should not suppress mesh routes",
+			hubs: HubVirtualNetworks{
+				"vnet0": aRouteServerHub(nil, "10.0.0.0/16"),
+				"vnet1": aHub(true, "10.1.0.0/16"),
+			},
+			expected: map[string][]Route{
+				"vnet0": {
+					{Name: "vnet1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+				},
+				"vnet1": {
+					{Name: "vnet0-10.0.0.0-16", AddressPrefix: "10.0.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+				},
+			},
+		},
+	}
+
+	for _, input := range inputs {
+		i := input
+		t.Run(i.name, func(t *testing.T) {
+			actual := Variables{HubVirtualNetworks: i.hubs}.RouteMap(i.firewallIps)
+			assert.Equal(t, len(i.expected), len(actual))
+			for k, routes := range i.expected {
+				assert.Equal(t, routes, actual[k].MeshRoutes)
+			}
+		})
+	}
+}
+
+func TestRouteMap_DualStackMeshShouldRouteIpv6PrefixesToIpv6Routers(t *testing.T) {
+	firewall := aFirewallHub("10.0.0.0/16", "fd00:0:0::/48")
+	router := aHub(true, "10.1.0.0/16", "fd00:0:1::/48")
+	router.HubRouterIpv6Address = String("fd00:0:1::4")
+	ipv4Router := aHub(true, "10.2.0.0/16", "fd00:0:2::/48")
+	hubs := HubVirtualNetworks{"vnet0": firewall, "vnet1": router, "vnet2": ipv4Router}
+	actual := Variables{HubVirtualNetworks: hubs}.RouteMap(map[string]string{"vnet0": "vnet0-fw-ip"})
+	assert.Equal(t, []Route{
+		{Name: "vnet1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+		{Name: "vnet1-fd00-0-1---48", AddressPrefix: "fd00:0:1::/48", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00:0:1::4")},
+		{Name: "vnet2-10.2.0.0-16", AddressPrefix: "10.2.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+	}, actual["vnet0"].MeshRoutes)
+	assert.Equal(t, []Route{
+		{Name: "vnet0-10.0.0.0-16", AddressPrefix: "10.0.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet0-fw-ip")},
+		{Name: "vnet1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+		{Name: "vnet1-fd00-0-1---48", AddressPrefix: "fd00:0:1::/48", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00:0:1::4")},
+	}, actual["vnet2"].MeshRoutes, "the firewall has no IPv6 address to route to")
+}
+
+func TestMeshRouteName_ShouldReplaceTheColonsOfIpv6Prefixes(t *testing.T) {
+	assert.Equal(t, "hub0-10.0.0.0-16", MeshRouteName("hub0", "10.0.0.0/16"))
+	assert.Equal(t, "hub0-fd00-db8---48", MeshRouteName("hub0", "fd00:db8::/48"))
+}
+
+func TestRouteMap_UserRoutesShouldBePassedThroughWithDefaults(t *testing.T) {
+	hub := aHub(true)
+	hub.RouteTableEntries = []RouteTableEntry{
+		{Name: "no_internet", AddressPrefix: "0.0.0.0/0", NextHopType: "None"},
+	}
+	actual := Variables{HubVirtualNetworks: HubVirtualNetworks{"vnet0": hub}}.RouteMap(nil)
+	assert.Equal(t, []RouteTableEntry{
+		{Name: "no_internet", AddressPrefix: "0.0.0.0/0", NextHopType: "None", HasBgpOverride: Bool(false)},
+	}, actual["vnet0"].UserRoutes)
+}
+
+func TestRouteMap_BgpRoutePropagation(t *testing.T) {
+	inputs := []struct {
+		name       string
+		enabled    *bool
+		entries    []RouteTableEntry
+		firewall   *bool
+		expected   bool
+		expectedFw bool
+	}{
+		{
+			name:       "unset should propagate bgp routes",
+			expected:   true,
+			expectedFw: true,
+		},
+		{
+			name:       "bgp override entry should stop propagating bgp routes",
+			entries:    []RouteTableEntry{{Name: "onprem", AddressPrefix: "192.168.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.0.0.5"), HasBgpOverride: Bool(true)}},
+			expected:   false,
+			expectedFw: true,
+		},
+		{
+			name:       "entries without bgp override should keep propagating bgp routes",
+			entries:    []RouteTableEntry{{Name: "onprem", AddressPrefix: "192.168.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.0.0.5"), HasBgpOverride: Bool(false)}},
+			expected:   true,
+			expectedFw: true,
+		},
+		{
+			name:       "explicit false should only apply to the workload route table",
+			enabled:    Bool(false),
+			expected:   false,
+			expectedFw: true,
+		},
+		{
+			name:       "firewall route table should have its own setting",
+			firewall:   Bool(false),
+			expected:   true,
+			expectedFw: false,
+		},
+	}
+
+	for _, input := range inputs {
+		i := input
+		t.Run(i.name, func(t *testing.T) {
+			hub := aFirewallHub()
+			hub.BgpRoutePropagationEnabled = i.enabled
+			hub.RouteTableEntries = i.entries
+			hub.Firewall.RouteTableBgpRoutePropagationEnabled = i.firewall
+			v := Variables{HubVirtualNetworks: HubVirtualNetworks{"vnet0": hub}}
+			ips := map[string]string{"vnet0": "vnet0-fw-ip"}
+			assert.Equal(t, i.expected, v.RouteMap(ips)["vnet0"].BgpRoutePropagationEnabled)
+			assert.Equal(t, i.expectedFw, v.FirewallRouteTables(ips)["vnet0"].BgpRoutePropagationEnabled)
+		})
+	}
+}
+
+func TestRouteMap_RandomTopologiesShouldRouteToEveryOtherMeshHub(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 500; n++ {
+		hubs := RandomHubVirtualNetworks(r, 1+r.Intn(8))
+		firewallIps := make(map[string]string)
+		for k, hub := range hubs {
+			if hub.Firewall != nil {
+				firewallIps[k] = k + "-fw-ip"
+			}
+		}
+		routes := Variables{HubVirtualNetworks: hubs}.RouteMap(firewallIps)
+		for kSrc, src := range hubs {
+			expected := make(map[string]bool)
+			for kDst, dst := range hubs {
+				if kSrc == kDst || !*src.MeshPeeringEnabled || !*dst.MeshPeeringEnabled {
+					continue
+				}
+				if *src.WithDefaults().BgpRoutePropagationEnabled && src.RouteServer != nil && len(src.RouteServer.BgpConnections) > 0 && dst.Firewall == nil {
+					// learnt from the NVAs over BGP
+					continue
+				}
+				for _, cidr := range dst.RoutingAddressSpace {
+					expected[MeshRouteName(kDst, cidr)] = true
+				}
+			}
+			actual := make(map[string]bool)
+			for _, route := range routes[kSrc].MeshRoutes {
+				assert.False(t, actual[route.Name], "duplicate route %s", route.Name)
+				actual[route.Name] = true
+				assert.NotNil(t, route.NextHopIpAddress)
+			}
+			assert.Equal(t, expected, actual)
+		}
+	}
+}
+
+func TestRouteMap_DefaultRoutes(t *testing.T) {
+	inputs := []struct {
+		name         string
+		firewall     bool
+		defaultRoute *DefaultRoute
+		expected     []Route
+	}{
+		{
+			name:     "unset default route should go to the internet",
+			expected: []Route{{Name: "internet", AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"}},
+		},
+		{
+			name:     "unset default route of a firewall hub should go to the firewall",
+			firewall: true,
+			expected: []Route{{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet0-fw-ip")}},
+		},
+		{
+			name:         "firewall default route should go to the firewall private ip",
+			defaultRoute: &DefaultRoute{NextHopType: String("Firewall")},
+			expected:     []Route{{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet0-fw-ip")}},
+		},
+		{
+			name:         "virtual appliance default route should go to the nva",
+			defaultRoute: &DefaultRoute{NextHopType: String("VirtualAppliance"), NextHopIpAddress: String("10.0.0.5")},
+			expected:     []Route{{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.0.0.5")}},
+		},
+		{
+			name:         "virtual network gateway default route should go to the gateway",
+			defaultRoute: &DefaultRoute{NextHopType: String("VirtualNetworkGateway")},
+			expected:     []Route{{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualNetworkGateway"}},
+		},
+		{
+			name:         "none default route should create no route",
+			defaultRoute: &DefaultRoute{NextHopType: String("None")},
+			expected:     []Route{},
+		},
+	}
+
+	for _, input := range inputs {
+		i := input
+		t.Run(i.name, func(t *testing.T) {
+			hub := aHub(true)
+			if i.firewall {
+				hub = aFirewallHub()
+			}
+			hub.DefaultRoute = i.defaultRoute
+			actual := Variables{HubVirtualNetworks: HubVirtualNetworks{"vnet0": hub}}.RouteMap(map[string]string{"vnet0": "vnet0-fw-ip"})
+			assert.Equal(t, i.expected, actual["vnet0"].DefaultRoutes)
+		})
+	}
+}
+
+func TestRouteMap_DualStackDefaultRoutesShouldSendIpv6ToTheIpv6Router(t *testing.T) {
+	firewall := aFirewallHub("10.0.0.0/16", "fd00:0:0::/48")
+	firewall.HubRouterIpv6Address = String("fd00:0:0::4")
+	nva := aHub(true, "10.1.0.0/16", "fd00:0:1::/48")
+	nva.HubRouterIpv6Address = String("fd00:0:1::4")
+	nva.DefaultRoute = &DefaultRoute{NextHopType: String("VirtualAppliance"), NextHopIpAddress: String("10.1.0.5")}
+	internet := aHub(true, "10.2.0.0/16", "fd00:0:2::/48")
+	internet.HubRouterIpv6Address = String("fd00:0:2::4")
+	ipv4Router := aFirewallHub("10.3.0.0/16", "fd00:0:3::/48")
+
+	actual := Variables{HubVirtualNetworks: HubVirtualNetworks{"vnet0": firewall, "vnet1": nva, "vnet2": internet, "vnet3": ipv4Router}}.RouteMap(map[string]string{"vnet0": "vnet0-fw-ip", "vnet3": "vnet3-fw-ip"})
+	assert.Equal(t, []Route{
+		{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet0-fw-ip")},
+		{Name: "default-ipv6", AddressPrefix: "::/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00:0:0::4")},
+	}, actual["vnet0"].DefaultRoutes, "the firewall has no IPv6 address")
+	assert.Equal(t, []Route{
+		{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.1.0.5")},
+		{Name: "default-ipv6", AddressPrefix: "::/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00:0:1::4")},
+	}, actual["vnet1"].DefaultRoutes)
+	assert.Equal(t, []Route{
+		{Name: "internet", AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"},
+	}, actual["vnet2"].DefaultRoutes, "the system routes send ::/0 to the internet")
+	assert.Equal(t, []Route{
+		{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet3-fw-ip")},
+	}, actual["vnet3"].DefaultRoutes, "without an IPv6 router there is no next hop for ::/0")
+}
+
+func TestDefaultRouteConflicts_UserIpv6DefaultRouteShouldConflictWithTheIpv6DefaultRoute(t *testing.T) {
+	userDefaultRoute := []RouteTableEntry{{Name: "nva6", AddressPrefix: "::/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00::5")}}
+	dualStack := aFirewallHub()
+	dualStack.HubRouterIpv6Address = String("fd00::4")
+	dualStack.RouteTableEntries = userDefaultRoute
+	internet := aHub(true)
+	internet.HubRouterIpv6Address = String("fd00::4")
+	internet.RouteTableEntries = userDefaultRoute
+
+	conflicts := Variables{HubVirtualNetworks: HubVirtualNetworks{"vnet0": dualStack, "vnet1": internet}}.DefaultRouteConflicts()
+	assert.Equal(t, []DefaultRouteConflict{
+		{HubKeys: []string{"vnet0"}, Message: "route nva6 of hub vnet0 claims ::/0, which its default_route already routes to Firewall; set the next_hop_type of the default_route to None to route it with route_table_entries"},
+	}, conflicts)
+}
+
+func TestDefaultRouteConflicts_UserDefaultRouteShouldConflictUnlessDefaultRouteIsNone(t *testing.T) {
+	userDefaultRoute := []RouteTableEntry{{Name: "nva", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.0.0.5")}}
+	internet := aHub(true)
+	internet.RouteTableEntries = userDefaultRoute
+	none := aHub(true)
+	none.RouteTableEntries = userDefaultRoute
+	none.DefaultRoute = &DefaultRoute{NextHopType: String("None")}
+
+	conflicts := Variables{HubVirtualNetworks: HubVirtualNetworks{"vnet0": internet, "vnet1": none}}.DefaultRouteConflicts()
+	assert.Equal(t, []DefaultRouteConflict{
+		{HubKeys: []string{"vnet0"}, Message: "route nva of hub vnet0 claims 0.0.0.0/0, which its default_route already routes to Internet; set the next_hop_type of the default_route to None to route it with route_table_entries"},
+	}, conflicts)
+}
+
+func TestValidateGatewaySubnetRouteTables_GeneratedRouteTableShouldNotSendTheDefaultRouteAway(t *testing.T) {
+	withGatewaySubnet := func(assign bool, nextHopType *string) HubVirtualNetwork {
+		hub := aHub(true)
+		hub.Subnets = map[string]Subnet{GatewaySubnetName: {AddressPrefixes: []string{"10.0.2.0/27"}, AssignGeneratedRouteTable: Bool(assign)}}
+		hub.DefaultRoute = &DefaultRoute{NextHopType: nextHopType}
+		return hub
+	}
+	firewall := withGatewaySubnet(true, nil)
+	firewall.Firewall = &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard"}
+	unassigned := withGatewaySubnet(false, nil)
+	unassigned.Firewall = &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard"}
+
+	violations := ValidateGatewaySubnetRouteTables(Variables{HubVirtualNetworks: HubVirtualNetworks{
+		"vnet0": firewall,
+		"vnet1": unassigned,
+		"vnet2": withGatewaySubnet(true, nil),
+		"vnet3": withGatewaySubnet(true, String("None")),
+		"vnet4": withGatewaySubnet(true, String("VirtualNetworkGateway")),
+	}})
+	message := "A GatewaySubnet with assign_generated_route_table must not get a default_route other than `Internet` or `None`, the gateway would send 0.0.0.0/0 away from itself. Set assign_generated_route_table of the GatewaySubnet to false, or the next_hop_type of the default_route to `Internet` or `None`."
+	assert.Equal(t, []GatewaySubnetRouteTableViolation{
+		{HubKey: "vnet0", Message: message},
+		{HubKey: "vnet4", Message: message},
+	}, violations)
+}
+
+func TestFirewallRouteTables_FirewallSubnetShouldRouteToTheInternetAndTheMesh(t *testing.T) {
+	external := aFirewallHub("10.2.0.0/16")
+	external.Firewall.SubnetRouteTableId = String("external_route_table_id")
+	hubs := HubVirtualNetworks{
+		"vnet0": aFirewallHub("10.0.0.0/16"),
+		"vnet1": aHub(true, "10.1.0.0/16"),
+		"vnet2": external,
+	}
+	firewallIps := map[string]string{"vnet0": "vnet0-fw-ip", "vnet2": "vnet2-fw-ip"}
+	assert.Equal(t, map[string]FirewallRouteTable{
+		"vnet0": {
+			BgpRoutePropagationEnabled: true,
+			Name:                       "route-afw-vnet0",
+			Routes: []Route{
+				{Name: "internet", AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"},
+				{Name: "vnet1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+				{Name: "vnet2-10.2.0.0-16", AddressPrefix: "10.2.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet2-fw-ip")},
+			},
+		},
+	}, Variables{HubVirtualNetworks: hubs}.FirewallRouteTables(firewallIps))
+}
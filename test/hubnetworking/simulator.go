@@ -0,0 +1,263 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+const (
+	// RouteSourceDefault marks the system routes Azure creates for every subnet.
+	RouteSourceDefault = "Default"
+	// RouteSourceUser marks the routes of the route table associated with the subnet.
+	RouteSourceUser = "User"
+)
+
+// EffectiveRoute is a route as listed by the effective routes of a subnet.
+type EffectiveRoute struct {
+	Source           string
+	Name             string
+	AddressPrefix    string
+	NextHopType      string
+	NextHopIpAddress *string
+	// HubKey is the hub whose address space a VnetLocal or VNetPeering system route covers.
+	HubKey string
+}
+
+// Hop is one route lookup on the way of a packet, made in the subnet the packet is in.
+type Hop struct {
+	HubKey     string
+	SubnetName string
+	Route      EffectiveRoute
+}
+
+// Path is the sequence of lookups a packet goes through, the route of the last hop tells where the packet leaves the hubs.
+type Path []Hop
+
+// Simulator answers where a packet goes by longest prefix match on the effective routes of hub subnets.
+// The routes of the route table generated by the module are computed as `local.route_map` does, routes of
+// external route tables are unknown so subnets using them only get the system routes.
+type Simulator struct {
+	hubs               HubVirtualNetworks
+	routes             map[string]RouteTable
+	firewallRoutes     map[string]FirewallRouteTable
+	peerings           map[string]Peering
+	firewallPrivateIps map[string]string
+}
+
+// NewSimulator creates a Simulator for the hubs declared in the variables. firewallPrivateIps maps a hub key to
+// the private ip address of its firewall, see FirewallPrivateIps.
+func NewSimulator(v Variables, firewallPrivateIps map[string]string) *Simulator {
+	v = v.WithDefaults()
+	return &Simulator{
+		hubs:               v.HubVirtualNetworks,
+		routes:             v.RouteMap(firewallPrivateIps),
+		firewallRoutes:     v.FirewallRouteTables(firewallPrivateIps),
+		peerings:           v.PeeringMap(),
+		firewallPrivateIps: firewallPrivateIps,
+	}
+}
+
+// FirewallPrivateIps returns the private ip address Azure gives to the firewall of every hub that has one,
+// the first usable address of `AzureFirewallSubnet`.
+func FirewallPrivateIps(hubs HubVirtualNetworks) map[string]string {
+	r := make(map[string]string)
+	for k, hub := range hubs {
+		if hub.Firewall == nil {
+			continue
+		}
+		p, err := netip.ParsePrefix(hub.Firewall.SubnetAddressPrefix)
+		if err != nil {
+			continue
+		}
+		ip := p.Masked().Addr()
+		for i := 0; i < 4; i++ {
+			ip = ip.Next()
+		}
+		r[k] = ip.String()
+	}
+	return r
+}
+
+// EffectiveRoutes lists the routes of a subnet, system routes first followed by the routes of the generated
+// route table when the subnet is associated with it, the route table of the firewall subnet for `AzureFirewallSubnet`.
+func (s *Simulator) EffectiveRoutes(hubKey, subnetName string) ([]EffectiveRoute, error) {
+	hub, ok := s.hubs[hubKey]
+	if !ok {
+		return nil, fmt.Errorf("hub %s not found", hubKey)
+	}
+	generated, err := s.usesGeneratedRouteTable(hub, subnetName)
+	if err != nil {
+		return nil, fmt.Errorf("hub %s: %w", hubKey, err)
+	}
+	var r []EffectiveRoute
+	for _, cidr := range hub.AddressSpace {
+		r = append(r, EffectiveRoute{Source: RouteSourceDefault, AddressPrefix: cidr, NextHopType: "VnetLocal", HubKey: hubKey})
+	}
+	for _, k := range s.hubs.Keys() {
+		if !s.connected(hubKey, k) {
+			continue
+		}
+		for _, cidr := range s.hubs[k].AddressSpace {
+			r = append(r, EffectiveRoute{Source: RouteSourceDefault, AddressPrefix: cidr, NextHopType: "VNetPeering", HubKey: k})
+		}
+	}
+	r = append(r, EffectiveRoute{Source: RouteSourceDefault, AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"})
+	for _, cidr := range hub.AddressSpace {
+		if isIpv6(cidr) {
+			r = append(r, EffectiveRoute{Source: RouteSourceDefault, AddressPrefix: "::/0", NextHopType: "Internet"})
+			break
+		}
+	}
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10"} {
+		r = append(r, EffectiveRoute{Source: RouteSourceDefault, AddressPrefix: cidr, NextHopType: "None"})
+	}
+	if !generated {
+		return r, nil
+	}
+	if subnetName == FirewallSubnetName && hub.Firewall != nil {
+		for _, route := range s.firewallRoutes[hubKey].Routes {
+			r = append(r, EffectiveRoute{Source: RouteSourceUser, Name: route.Name, AddressPrefix: route.AddressPrefix, NextHopType: route.NextHopType, NextHopIpAddress: route.NextHopIpAddress})
+		}
+		return r, nil
+	}
+	table := s.routes[hubKey]
+	for _, route := range table.DefaultRoutes {
+		r = append(r, EffectiveRoute{Source: RouteSourceUser, Name: route.Name, AddressPrefix: route.AddressPrefix, NextHopType: route.NextHopType, NextHopIpAddress: route.NextHopIpAddress})
+	}
+	for _, route := range table.MeshRoutes {
+		r = append(r, EffectiveRoute{Source: RouteSourceUser, Name: route.Name, AddressPrefix: route.AddressPrefix, NextHopType: route.NextHopType, NextHopIpAddress: route.NextHopIpAddress})
+	}
+	userRoutes := append([]RouteTableEntry{}, table.UserRoutes...)
+	sort.Slice(userRoutes, func(i, j int) bool {
+		return userRoutes[i].Name < userRoutes[j].Name
+	})
+	for _, route := range userRoutes {
+		r = append(r, EffectiveRoute{Source: RouteSourceUser, Name: route.Name, AddressPrefix: route.AddressPrefix, NextHopType: route.NextHopType, NextHopIpAddress: route.NextHopIpAddress})
+	}
+	return r, nil
+}
+
+// Lookup returns the route a packet to destination takes from a subnet. The longest matching prefix wins and
+// user routes take precedence over system routes with the same prefix, as Azure does.
+func (s *Simulator) Lookup(hubKey, subnetName, destination string) (EffectiveRoute, error) {
+	ip, err := netip.ParseAddr(destination)
+	if err != nil {
+		return EffectiveRoute{}, fmt.Errorf("invalid destination %q: %w", destination, err)
+	}
+	routes, err := s.EffectiveRoutes(hubKey, subnetName)
+	if err != nil {
+		return EffectiveRoute{}, err
+	}
+	var best *EffectiveRoute
+	bestBits := -1
+	for i, route := range routes {
+		p, err := netip.ParsePrefix(route.AddressPrefix)
+		if err != nil {
+			return EffectiveRoute{}, fmt.Errorf("invalid address prefix %q of route %s in hub %s: %w", route.AddressPrefix, route.Name, hubKey, err)
+		}
+		if !p.Masked().Contains(ip) {
+			continue
+		}
+		if p.Bits() > bestBits || (p.Bits() == bestBits && best.Source == RouteSourceDefault && route.Source == RouteSourceUser) {
+			best = &routes[i]
+			bestBits = p.Bits()
+		}
+	}
+	if best == nil {
+		return EffectiveRoute{Source: RouteSourceDefault, AddressPrefix: destination, NextHopType: "None"}, nil
+	}
+	return *best, nil
+}
+
+// Trace follows a packet from a subnet to destination. When a route points to the private ip address of a hub
+// firewall the lookup goes on from the `AzureFirewallSubnet` of that hub. The path ends when the packet is
+// delivered by a VnetLocal or VNetPeering route, leaves the hubs or reaches a virtual appliance other than a firewall.
+func (s *Simulator) Trace(hubKey, subnetName, destination string) (Path, error) {
+	var path Path
+	visited := make(map[string]bool)
+	for {
+		location := hubKey + "/" + subnetName
+		if visited[location] {
+			return path, fmt.Errorf("routing loop towards %s through %s", destination, location)
+		}
+		visited[location] = true
+		route, err := s.Lookup(hubKey, subnetName, destination)
+		if err != nil {
+			return path, err
+		}
+		path = append(path, Hop{HubKey: hubKey, SubnetName: subnetName, Route: route})
+		if route.NextHopType != "VirtualAppliance" || route.NextHopIpAddress == nil {
+			return path, nil
+		}
+		next, ok := s.firewallOf(*route.NextHopIpAddress)
+		if !ok {
+			return path, nil
+		}
+		hubKey, subnetName = next, FirewallSubnetName
+	}
+}
+
+// Delivered reports whether the packet ended up in one of the hubs.
+func (p Path) Delivered() bool {
+	if len(p) == 0 {
+		return false
+	}
+	t := p[len(p)-1].Route.NextHopType
+	return t == "VnetLocal" || t == "VNetPeering"
+}
+
+// DeliveredTo returns the key of the hub the packet ended up in, empty when it was not delivered.
+func (p Path) DeliveredTo() string {
+	if !p.Delivered() {
+		return ""
+	}
+	return p[len(p)-1].Route.HubKey
+}
+
+// Firewalls returns the keys of the hubs whose firewall the packet went through, in order.
+func (p Path) Firewalls() []string {
+	r := make([]string, 0)
+	for i, hop := range p {
+		if i > 0 && hop.SubnetName == FirewallSubnetName {
+			r = append(r, hop.HubKey)
+		}
+	}
+	return r
+}
+
+func (s *Simulator) usesGeneratedRouteTable(hub HubVirtualNetwork, subnetName string) (bool, error) {
+	if subnet, ok := hub.Subnets[subnetName]; ok {
+		if subnetName == BastionSubnetName || subnetName == RouteServerSubnetName {
+			return false, nil
+		}
+		return *subnet.AssignGeneratedRouteTable && subnet.ExternalRouteTableId == nil, nil
+	}
+	switch {
+	case hub.Firewall != nil && subnetName == FirewallSubnetName:
+		return hub.Firewall.SubnetRouteTableId == nil, nil
+	case hub.Firewall != nil && subnetName == FirewallManagementSubnetName && hub.Firewall.ManagementSubnetAddressPrefix != nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("subnet %s not found", subnetName)
+}
+
+// connected reports whether hub a reaches hub b through peering, which needs the peerings in both directions
+// to allow virtual network access.
+func (s *Simulator) connected(a, b string) bool {
+	if a == b {
+		return false
+	}
+	ab, ok1 := s.peerings[PeeringName(s.hubs[a].Name, s.hubs[b].Name)]
+	ba, ok2 := s.peerings[PeeringName(s.hubs[b].Name, s.hubs[a].Name)]
+	return ok1 && ok2 && ab.AllowVirtualNetworkAccess && ba.AllowVirtualNetworkAccess
+}
+
+func (s *Simulator) firewallOf(ip string) (string, bool) {
+	for _, k := range s.hubs.Keys() {
+		if fwIp, ok := s.firewallPrivateIps[k]; ok && fwIp == ip && s.hubs[k].Firewall != nil {
+			return k, true
+		}
+	}
+	return "", false
+}
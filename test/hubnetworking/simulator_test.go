@@ -0,0 +1,200 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func simulatorHubs() HubVirtualNetworks {
+	return HubVirtualNetworks{
+		"hub0": {
+			Name:                "vnet0",
+			AddressSpace:        []string{"10.0.0.0/22"},
+			RoutingAddressSpace: []string{"10.0.0.0/16"},
+			RouteTableEntries: []RouteTableEntry{
+				{Name: "onprem", AddressPrefix: "172.16.0.0/12", NextHopType: "VirtualNetworkGateway"},
+			},
+			Subnets: map[string]Subnet{
+				"app":             {AddressPrefixes: []string{"10.0.1.0/24"}},
+				"external":        {AddressPrefixes: []string{"10.0.2.0/24"}, ExternalRouteTableId: String("external_route_table_id")},
+				BastionSubnetName: {AddressPrefixes: []string{"10.0.3.0/26"}},
+			},
+			Firewall: &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.0.0.0/26"},
+		},
+		"hub1": {
+			Name:                "vnet1",
+			AddressSpace:        []string{"10.1.0.0/22"},
+			RoutingAddressSpace: []string{"10.1.0.0/16"},
+			Subnets: map[string]Subnet{
+				"app": {AddressPrefixes: []string{"10.1.1.0/24"}},
+			},
+			Firewall: &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.1.0.0/26"},
+		},
+		"hub2": {
+			Name:                "vnet2",
+			AddressSpace:        []string{"10.2.0.0/22"},
+			RoutingAddressSpace: []string{"10.2.0.0/16"},
+			HubRouterIpAddress:  String("10.2.0.4"),
+			Subnets: map[string]Subnet{
+				"app": {AddressPrefixes: []string{"10.2.1.0/24"}},
+			},
+		},
+	}
+}
+
+func TestFirewallPrivateIps(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"hub0": "10.0.0.4",
+		"hub1": "10.1.0.4",
+	}, FirewallPrivateIps(simulatorHubs()))
+}
+
+func TestSimulator_Trace(t *testing.T) {
+	hubs := simulatorHubs()
+	s := NewSimulator(Variables{HubVirtualNetworks: hubs}, FirewallPrivateIps(hubs))
+	inputs := []struct {
+		name                string
+		subnet              string
+		destination         string
+		expectedNextHopType string
+		expectedDelivery    string
+		expectedFirewalls   []string
+	}{
+		{
+			name:                "same hub",
+			subnet:              "app",
+			destination:         "10.0.1.10",
+			expectedNextHopType: "VnetLocal",
+			expectedDelivery:    "hub0",
+			expectedFirewalls:   []string{},
+		},
+		{
+			name:                "peered hub address space wins over mesh route",
+			subnet:              "app",
+			destination:         "10.1.1.10",
+			expectedNextHopType: "VNetPeering",
+			expectedDelivery:    "hub1",
+			expectedFirewalls:   []string{},
+		},
+		{
+			name:                "routing address space goes through remote firewall",
+			subnet:              "app",
+			destination:         "10.1.200.1",
+			expectedNextHopType: "None",
+			expectedFirewalls:   []string{"hub1"},
+		},
+		{
+			name:                "internet goes through the local firewall",
+			subnet:              "app",
+			destination:         "8.8.8.8",
+			expectedNextHopType: "Internet",
+			expectedFirewalls:   []string{"hub0"},
+		},
+		{
+			name:                "user route",
+			subnet:              "app",
+			destination:         "172.16.1.1",
+			expectedNextHopType: "VirtualNetworkGateway",
+			expectedFirewalls:   []string{},
+		},
+		{
+			name:                "hub router",
+			subnet:              "app",
+			destination:         "10.2.100.1",
+			expectedNextHopType: "VirtualAppliance",
+			expectedFirewalls:   []string{},
+		},
+		{
+			name:                "external route table only has system routes",
+			subnet:              "external",
+			destination:         "10.1.200.1",
+			expectedNextHopType: "None",
+			expectedFirewalls:   []string{},
+		},
+		{
+			name:                "bastion subnet is not associated with the generated route table",
+			subnet:              BastionSubnetName,
+			destination:         "8.8.8.8",
+			expectedNextHopType: "Internet",
+			expectedFirewalls:   []string{},
+		},
+	}
+	for _, input := range inputs {
+		i := input
+		t.Run(i.name, func(t *testing.T) {
+			path, err := s.Trace("hub0", i.subnet, i.destination)
+			require.NoError(t, err)
+			require.NotEmpty(t, path)
+			assert.Equal(t, i.expectedNextHopType, path[len(path)-1].Route.NextHopType)
+			assert.Equal(t, i.expectedDelivery, path.DeliveredTo())
+			assert.Equal(t, i.expectedFirewalls, path.Firewalls())
+		})
+	}
+}
+
+func TestSimulator_LookupShouldPreferUserRouteOverSystemRouteWithSamePrefix(t *testing.T) {
+	s := NewSimulator(Variables{HubVirtualNetworks: simulatorHubs()}, nil)
+	route, err := s.Lookup("hub0", "app", "1.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, RouteSourceUser, route.Source)
+	assert.Equal(t, "default", route.Name)
+}
+
+func TestSimulator_TraceShouldDetectRoutingLoop(t *testing.T) {
+	hubs := simulatorHubs()
+	// hub1 claims the routing address space of hub0, so the firewalls keep sending the packet to each other
+	hub1 := hubs["hub1"]
+	hub1.RoutingAddressSpace = []string{"10.0.0.0/8"}
+	hubs["hub1"] = hub1
+	s := NewSimulator(Variables{HubVirtualNetworks: hubs}, FirewallPrivateIps(hubs))
+	_, err := s.Trace("hub0", "app", "10.0.200.1")
+	assert.Error(t, err)
+}
+
+func TestSimulator_FirewallSubnetShouldSendInternetTrafficToTheInternet(t *testing.T) {
+	hubs := simulatorHubs()
+	s := NewSimulator(Variables{HubVirtualNetworks: hubs}, FirewallPrivateIps(hubs))
+	route, err := s.Lookup("hub0", FirewallSubnetName, "8.8.8.8")
+	require.NoError(t, err)
+	assert.Equal(t, EffectiveRoute{Source: RouteSourceUser, Name: "internet", AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"}, route)
+	route, err = s.Lookup("hub0", "app", "8.8.8.8")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.4", *route.NextHopIpAddress)
+}
+
+func TestSimulator_DualStackHubsShouldRouteIpv6ThroughTheIpv6Router(t *testing.T) {
+	hubs := simulatorHubs()
+	hub0 := hubs["hub0"]
+	hub0.AddressSpace = append(hub0.AddressSpace, "fd00:0:0::/56")
+	hub0.RoutingAddressSpace = append(hub0.RoutingAddressSpace, "fd00:0:0::/48")
+	hubs["hub0"] = hub0
+	hub2 := hubs["hub2"]
+	hub2.AddressSpace = append(hub2.AddressSpace, "fd00:0:2::/56")
+	hub2.RoutingAddressSpace = append(hub2.RoutingAddressSpace, "fd00:0:2::/48")
+	hub2.HubRouterIpv6Address = String("fd00:0:2::4")
+	hubs["hub2"] = hub2
+	s := NewSimulator(Variables{HubVirtualNetworks: hubs}, FirewallPrivateIps(hubs))
+
+	path, err := s.Trace("hub0", "app", "fd00:0:2:ff00::1")
+	require.NoError(t, err)
+	require.Len(t, path, 1)
+	assert.Equal(t, "fd00:0:2::4", *path[0].Route.NextHopIpAddress)
+	path, err = s.Trace("hub0", "app", "fd00:0:2::1")
+	require.NoError(t, err)
+	assert.Equal(t, "hub2", path.DeliveredTo())
+	route, err := s.Lookup("hub0", "app", "2001:db8::1")
+	require.NoError(t, err)
+	assert.Equal(t, EffectiveRoute{Source: RouteSourceDefault, AddressPrefix: "::/0", NextHopType: "Internet"}, route, "the firewall does not route IPv6")
+}
+
+func TestSimulator_Errors(t *testing.T) {
+	s := NewSimulator(Variables{HubVirtualNetworks: simulatorHubs()}, nil)
+	_, err := s.EffectiveRoutes("hub9", "app")
+	assert.Error(t, err)
+	_, err = s.EffectiveRoutes("hub2", "AzureFirewallSubnet")
+	assert.Error(t, err)
+	_, err = s.Lookup("hub0", "app", "10.0.0")
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SpokePeering mirrors a value of `local.spoke_peering_map`. `remote_virtual_network_id` is left out
+// since it is only known once the remote virtual network exists.
+type SpokePeering struct {
+	Name                      string `json:"name"`
+	SpokeKey                  string `json:"spoke_key"`
+	HubKey                    string `json:"hub_key"`
+	VirtualNetworkName        string `json:"virtual_network_name"`
+	ResourceGroupName         string `json:"resource_group_name"`
+	AllowForwardedTraffic     bool   `json:"allow_forwarded_traffic"`
+	AllowGatewayTransit       bool   `json:"allow_gateway_transit"`
+	AllowVirtualNetworkAccess bool   `json:"allow_virtual_network_access"`
+	UseRemoteGateways         bool   `json:"use_remote_gateways"`
+}
+
+// SpokePeeringMap computes `local.spoke_peering_map`, the peerings from each spoke to its hub and back, keyed by peering name.
+// Spokes are connected to their virtual hub instead with a Virtual WAN.
+func (v Variables) SpokePeeringMap() map[string]SpokePeering {
+	v = v.WithDefaults()
+	r := make(map[string]SpokePeering, 2*len(v.SpokeVirtualNetworks))
+	if v.VirtualWan != nil {
+		return r
+	}
+	for _, k := range v.SpokeVirtualNetworks.Keys() {
+		spoke := v.SpokeVirtualNetworks[k]
+		hub := v.HubVirtualNetworks[spoke.HubKey]
+		toHub := PeeringName(spoke.VirtualNetworkName(), hub.Name)
+		r[toHub] = SpokePeering{
+			Name:                      toHub,
+			SpokeKey:                  k,
+			HubKey:                    spoke.HubKey,
+			VirtualNetworkName:        spoke.VirtualNetworkName(),
+			ResourceGroupName:         spoke.resourceGroupName(hub),
+			AllowForwardedTraffic:     true,
+			AllowVirtualNetworkAccess: true,
+			UseRemoteGateways:         *spoke.UseRemoteGateways,
+		}
+		fromHub := PeeringName(hub.Name, spoke.VirtualNetworkName())
+		r[fromHub] = SpokePeering{
+			Name:                      fromHub,
+			SpokeKey:                  k,
+			HubKey:                    spoke.HubKey,
+			VirtualNetworkName:        hub.Name,
+			ResourceGroupName:         hub.ResourceGroupName,
+			AllowForwardedTraffic:     true,
+			AllowGatewayTransit:       hub.GatewayEnabled(),
+			AllowVirtualNetworkAccess: true,
+		}
+	}
+	return r
+}
+
+// SpokeRouteMap computes `local.spoke_route_map`, the routes of the route table of each spoke. Every route points
+// at the firewall, or the router, of the spoke's hub: the default routes, the mesh prefixes of the hub and of the hubs
+// it reaches except the spoke's own address space, then `routed_address_prefixes`. `::/0` and the IPv6 prefixes are
+// only routed to the `hub_router_ipv6_address` of the hub.
+// firewallPrivateIps plays the role of `local.firewall_private_ip` as in RouteMap. Routing intent replaces the
+// route tables with a Virtual WAN.
+func (v Variables) SpokeRouteMap(firewallPrivateIps map[string]string) map[string][]Route {
+	v = v.WithDefaults()
+	prefixes := v.MeshPrefixes()
+	nextHops := v.MeshNextHops()
+	r := make(map[string][]Route, len(v.SpokeVirtualNetworks))
+	if v.VirtualWan != nil {
+		return r
+	}
+	for _, k := range v.SpokeVirtualNetworks.Keys() {
+		spoke := v.SpokeVirtualNetworks[k]
+		routed := []MeshPrefix{{Name: "default", AddressPrefix: "0.0.0.0/0"}, {Name: "default-ipv6", AddressPrefix: "::/0"}}
+		reachable := []string{spoke.HubKey}
+		for _, kHub := range v.HubVirtualNetworks.Keys() {
+			if _, ok := nextHops[spoke.HubKey][kHub]; ok {
+				reachable = append(reachable, kHub)
+			}
+		}
+		for _, kHub := range reachable {
+			for _, p := range prefixes[kHub] {
+				if !contains(spoke.AddressSpace, p.AddressPrefix) {
+					routed = append(routed, p)
+				}
+			}
+		}
+		for _, cidr := range spoke.RoutedAddressPrefixes {
+			routed = append(routed, MeshPrefix{Name: MeshRouteName("routed", cidr), AddressPrefix: cidr})
+		}
+		r[k] = make([]Route, 0, len(routed))
+		for _, p := range routed {
+			nextHop, ok := meshRouteNextHop(v.HubVirtualNetworks[spoke.HubKey], spoke.HubKey, p.AddressPrefix, firewallPrivateIps)
+			if !ok {
+				continue
+			}
+			r[k] = append(r[k], Route{
+				Name:             p.Name,
+				AddressPrefix:    p.AddressPrefix,
+				NextHopType:      "VirtualAppliance",
+				NextHopIpAddress: nextHop,
+			})
+		}
+	}
+	return r
+}
+
+// VirtualNetworkName returns the name of the spoke virtual network, taken from `virtual_network_id` for existing spokes.
+func (n SpokeVirtualNetwork) VirtualNetworkName() string {
+	if n.VirtualNetworkId != nil {
+		return resourceIdSegment(*n.VirtualNetworkId, 8)
+	}
+	if n.Name == nil {
+		return ""
+	}
+	return *n.Name
+}
+
+// SpokeBgpRoutePropagation computes `bgp_route_propagation_enabled` of `local.spokes`, whether the route table of each
+// spoke learns routes over BGP, by default as the route table of its hub does.
+func (v Variables) SpokeBgpRoutePropagation() map[string]bool {
+	v = v.WithDefaults()
+	r := make(map[string]bool, len(v.SpokeVirtualNetworks))
+	for k, spoke := range v.SpokeVirtualNetworks {
+		enabled := v.HubVirtualNetworks[spoke.HubKey].BgpRoutePropagationEnabled
+		if spoke.BgpRoutePropagationEnabled != nil {
+			enabled = spoke.BgpRoutePropagationEnabled
+		}
+		r[k] = enabled != nil && *enabled
+	}
+	return r
+}
+
+// resourceGroupName mirrors `resource_group_name` of `local.spokes`.
+func (n SpokeVirtualNetwork) resourceGroupName(hub HubVirtualNetwork) string {
+	switch {
+	case n.VirtualNetworkId != nil:
+		return resourceIdSegment(*n.VirtualNetworkId, 4)
+	case n.ResourceGroupName != nil:
+		return *n.ResourceGroupName
+	}
+	return hub.ResourceGroupName
+}
+
+// resourceIdSegment returns `split("/", id)[i]`, empty when id has fewer segments.
+func resourceIdSegment(id string, i int) string {
+	segments := strings.Split(id, "/")
+	if i >= len(segments) {
+		return ""
+	}
+	return segments[i]
+}
+
+// SpokeSubnetId returns the id the module associates the spoke route table with for a subnet of an existing spoke.
+func SpokeSubnetId(virtualNetworkId, subnetName string) string {
+	return fmt.Sprintf("%s/subnets/%s", virtualNetworkId, subnetName)
+}
+
+// Keys returns the spoke keys in the lexical order Terraform iterates a map in.
+func (s SpokeVirtualNetworks) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,151 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func spokeVariables() Variables {
+	return Variables{
+		HubVirtualNetworks: HubVirtualNetworks{
+			"hub0": {Name: "vnet0", ResourceGroupName: "rg0", RoutingAddressSpace: []string{"10.0.0.0/16", "192.168.0.0/24"}, HubRouterIpAddress: String("hub0-router-ip")},
+			"hub1": {Name: "vnet1", ResourceGroupName: "rg1", RoutingAddressSpace: []string{"10.1.0.0/16"}, HubRouterIpAddress: String("hub1-router-ip")},
+			"hub2": {Name: "vnet2", ResourceGroupName: "rg2", MeshPeeringEnabled: Bool(false), HubRouterIpAddress: String("hub2-router-ip")},
+		},
+		SpokeVirtualNetworks: SpokeVirtualNetworks{
+			"inside": {HubKey: "hub0", Name: String("inside"), AddressSpace: []string{"192.168.0.128/25"}},
+			"outside": {
+				HubKey:                "hub0",
+				VirtualNetworkId:      String("/subscriptions/sub/resourceGroups/spoke-rg/providers/Microsoft.Network/virtualNetworks/outside-vnet"),
+				AddressSpace:          []string{"172.20.0.0/16"},
+				RoutedAddressPrefixes: []string{"172.16.0.0/12"},
+			},
+			"quiet":    {HubKey: "hub1", Name: String("quiet"), AddressSpace: []string{"172.21.0.0/16"}, MeshRoutingEnabled: Bool(false)},
+			"isolated": {HubKey: "hub2", Name: String("isolated"), AddressSpace: []string{"172.22.0.0/16"}},
+		},
+	}
+}
+
+func TestMeshPrefixes_ShouldIncludeSpokesOutsideRoutingAddressSpace(t *testing.T) {
+	assert.Equal(t, map[string][]MeshPrefix{
+		"hub0": {
+			{Name: "hub0-10.0.0.0-16", AddressPrefix: "10.0.0.0/16"},
+			{Name: "hub0-192.168.0.0-24", AddressPrefix: "192.168.0.0/24"},
+			{Name: "outside-172.20.0.0-16", AddressPrefix: "172.20.0.0/16"},
+		},
+		"hub1": {
+			{Name: "hub1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16"},
+		},
+		"hub2": {
+			{Name: "isolated-172.22.0.0-16", AddressPrefix: "172.22.0.0/16"},
+		},
+	}, spokeVariables().MeshPrefixes())
+}
+
+func TestRouteMap_ShouldRouteOtherHubsSpokesThroughTheirHub(t *testing.T) {
+	routes := spokeVariables().RouteMap(map[string]string{"hub0": "hub0-fw-ip"})
+	assert.Equal(t, []Route{
+		{Name: "hub0-10.0.0.0-16", AddressPrefix: "10.0.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("hub0-fw-ip")},
+		{Name: "hub0-192.168.0.0-24", AddressPrefix: "192.168.0.0/24", NextHopType: "VirtualAppliance", NextHopIpAddress: String("hub0-fw-ip")},
+		{Name: "outside-172.20.0.0-16", AddressPrefix: "172.20.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("hub0-fw-ip")},
+	}, routes["hub1"].MeshRoutes)
+	assert.Empty(t, routes["hub2"].MeshRoutes)
+}
+
+func TestSpokeRouteMap(t *testing.T) {
+	routes := spokeVariables().SpokeRouteMap(map[string]string{"hub0": "hub0-fw-ip"})
+	route := func(name, prefix, nextHop string) Route {
+		return Route{Name: name, AddressPrefix: prefix, NextHopType: "VirtualAppliance", NextHopIpAddress: String(nextHop)}
+	}
+	assert.Equal(t, []Route{
+		route("default", "0.0.0.0/0", "hub0-fw-ip"),
+		route("hub0-10.0.0.0-16", "10.0.0.0/16", "hub0-fw-ip"),
+		route("hub0-192.168.0.0-24", "192.168.0.0/24", "hub0-fw-ip"),
+		route("hub1-10.1.0.0-16", "10.1.0.0/16", "hub0-fw-ip"),
+		route("routed-172.16.0.0-12", "172.16.0.0/12", "hub0-fw-ip"),
+	}, routes["outside"])
+	assert.Equal(t, []Route{
+		route("default", "0.0.0.0/0", "hub1-router-ip"),
+		route("hub1-10.1.0.0-16", "10.1.0.0/16", "hub1-router-ip"),
+		route("hub0-10.0.0.0-16", "10.0.0.0/16", "hub1-router-ip"),
+		route("hub0-192.168.0.0-24", "192.168.0.0/24", "hub1-router-ip"),
+		route("outside-172.20.0.0-16", "172.20.0.0/16", "hub1-router-ip"),
+	}, routes["quiet"])
+	assert.Equal(t, []Route{
+		route("default", "0.0.0.0/0", "hub2-router-ip"),
+	}, routes["isolated"])
+}
+
+func TestSpokeRouteMap_Ipv6PrefixesShouldOnlyGoToTheIpv6RouterOfTheHub(t *testing.T) {
+	v := spokeVariables()
+	hub0 := v.HubVirtualNetworks["hub0"]
+	hub0.RoutingAddressSpace = append(hub0.RoutingAddressSpace, "fd00:0:0::/48")
+	v.HubVirtualNetworks["hub0"] = hub0
+	hub1 := v.HubVirtualNetworks["hub1"]
+	hub1.RoutingAddressSpace = append(hub1.RoutingAddressSpace, "fd00:0:1::/48")
+	hub1.HubRouterIpv6Address = String("fd00:0:1::4")
+	v.HubVirtualNetworks["hub1"] = hub1
+	inside := v.SpokeVirtualNetworks["inside"]
+	inside.RoutedAddressPrefixes = []string{"fd00:ffff::/48"}
+	v.SpokeVirtualNetworks["inside"] = inside
+	quiet := v.SpokeVirtualNetworks["quiet"]
+	quiet.RoutedAddressPrefixes = []string{"fd00:ffff::/48"}
+	v.SpokeVirtualNetworks["quiet"] = quiet
+
+	routes := v.SpokeRouteMap(map[string]string{"hub0": "hub0-fw-ip"})
+	for _, route := range routes["inside"] {
+		assert.False(t, isIpv6(route.AddressPrefix), "hub0 has no IPv6 router for %s", route.Name)
+	}
+	assert.Contains(t, routes["quiet"], Route{Name: "hub1-fd00-0-1---48", AddressPrefix: "fd00:0:1::/48", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00:0:1::4")})
+	assert.Contains(t, routes["quiet"], Route{Name: "routed-fd00-ffff---48", AddressPrefix: "fd00:ffff::/48", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00:0:1::4")})
+	assert.Contains(t, routes["quiet"], Route{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("hub1-router-ip")})
+}
+
+func TestSpokeBgpRoutePropagation_ShouldDefaultToTheHub(t *testing.T) {
+	v := spokeVariables()
+	hub1 := v.HubVirtualNetworks["hub1"]
+	hub1.RouteTableEntries = []RouteTableEntry{{Name: "onprem", AddressPrefix: "172.16.0.0/12", NextHopType: "VirtualNetworkGateway", HasBgpOverride: Bool(true)}}
+	v.HubVirtualNetworks["hub1"] = hub1
+	isolated := v.SpokeVirtualNetworks["isolated"]
+	isolated.BgpRoutePropagationEnabled = Bool(false)
+	v.SpokeVirtualNetworks["isolated"] = isolated
+	assert.Equal(t, map[string]bool{
+		"inside":   true,
+		"outside":  true,
+		"quiet":    false,
+		"isolated": false,
+	}, v.SpokeBgpRoutePropagation())
+}
+
+func TestSpokePeeringMap(t *testing.T) {
+	v := spokeVariables()
+	v.HubVirtualNetworks["hub0"] = func() HubVirtualNetwork {
+		h := v.HubVirtualNetworks["hub0"]
+		h.Subnets = map[string]Subnet{GatewaySubnetName: {AddressPrefixes: []string{"10.0.255.0/27"}}}
+		return h
+	}()
+	peerings := v.SpokePeeringMap()
+	assert.Len(t, peerings, 8)
+	assert.Equal(t, SpokePeering{
+		Name:                      "outside-vnet-vnet0",
+		SpokeKey:                  "outside",
+		HubKey:                    "hub0",
+		VirtualNetworkName:        "outside-vnet",
+		ResourceGroupName:         "spoke-rg",
+		AllowForwardedTraffic:     true,
+		AllowVirtualNetworkAccess: true,
+	}, peerings["outside-vnet-vnet0"])
+	assert.Equal(t, SpokePeering{
+		Name:                      "vnet0-outside-vnet",
+		SpokeKey:                  "outside",
+		HubKey:                    "hub0",
+		VirtualNetworkName:        "vnet0",
+		ResourceGroupName:         "rg0",
+		AllowForwardedTraffic:     true,
+		AllowGatewayTransit:       true,
+		AllowVirtualNetworkAccess: true,
+	}, peerings["vnet0-outside-vnet"])
+	assert.Equal(t, "rg1", peerings["quiet-vnet1"].ResourceGroupName)
+	assert.False(t, peerings["vnet1-quiet"].AllowGatewayTransit)
+}
@@ -0,0 +1,114 @@
+package hubnetworking
+
+import "sort"
+
+const (
+	MeshTopologyFullMesh    = "full_mesh"
+	MeshTopologyHubAndSpoke = "hub_and_spoke"
+	MeshTopologyGroups      = "groups"
+)
+
+// MeshPairs computes `local.hub_mesh_pairs`, the keys of the hubs each hub is peered with, in lexical order.
+func (v Variables) MeshPairs() map[string][]string {
+	v = v.WithDefaults()
+	t := v.HubMeshTopology
+	r := make(map[string][]string, len(v.HubVirtualNetworks))
+	for _, kSrc := range v.HubVirtualNetworks.Keys() {
+		vSrc := v.HubVirtualNetworks[kSrc]
+		r[kSrc] = make([]string, 0)
+		for _, kDst := range v.HubVirtualNetworks.Keys() {
+			vDst := v.HubVirtualNetworks[kDst]
+			if kSrc == kDst || !*vSrc.MeshPeeringEnabled || !*vDst.MeshPeeringEnabled || containsPair(t.DeniedPairs, kSrc, kDst) {
+				continue
+			}
+			if containsPair(t.AllowedPairs, kSrc, kDst) || t.peers(kSrc, kDst) {
+				r[kSrc] = append(r[kSrc], kDst)
+			}
+		}
+	}
+	return r
+}
+
+// MeshNextHops computes `local.hub_mesh_next_hops`, mapping the hubs each hub routes mesh traffic to,
+// to the hub whose firewall or router is the next hop.
+func (v Variables) MeshNextHops() map[string]map[string]string {
+	v = v.WithDefaults()
+	pairs := v.MeshPairs()
+	transit := v.HubMeshTopology.TransitHubKey
+	r := make(map[string]map[string]string, len(pairs))
+	for _, kSrc := range v.HubVirtualNetworks.Keys() {
+		r[kSrc] = make(map[string]string)
+		for _, kDst := range v.HubVirtualNetworks.Keys() {
+			switch {
+			case kSrc == kDst:
+			case contains(pairs[kSrc], kDst):
+				r[kSrc][kDst] = kDst
+			case *v.HubMeshTopology.Type == MeshTopologyHubAndSpoke && transit != nil && contains(pairs[kSrc], *transit) && contains(pairs[kDst], *transit):
+				r[kSrc][kDst] = *transit
+			}
+		}
+	}
+	return r
+}
+
+// UnknownMeshTopologyKeys computes `local.hub_mesh_topology_unknown_keys`, the hub keys referenced by the
+// topology that are not keys of the hubs.
+func (v Variables) UnknownMeshTopologyKeys() []string {
+	t := v.HubMeshTopology.WithDefaults()
+	var referenced []string
+	if t.TransitHubKey != nil {
+		referenced = append(referenced, *t.TransitHubKey)
+	}
+	for _, g := range t.Groups {
+		referenced = append(referenced, g...)
+	}
+	for _, p := range append(append([][]string{}, t.AllowedPairs...), t.DeniedPairs...) {
+		referenced = append(referenced, p...)
+	}
+	unknown := make(map[string]bool)
+	for _, k := range referenced {
+		if _, ok := v.HubVirtualNetworks[k]; !ok {
+			unknown[k] = true
+		}
+	}
+	r := make([]string, 0, len(unknown))
+	for k := range unknown {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (t MeshTopology) peers(a, b string) bool {
+	switch *t.Type {
+	case MeshTopologyFullMesh:
+		return true
+	case MeshTopologyHubAndSpoke:
+		return t.TransitHubKey != nil && (*t.TransitHubKey == a || *t.TransitHubKey == b)
+	case MeshTopologyGroups:
+		for _, g := range t.Groups {
+			if contains(g, a) && contains(g, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsPair(pairs [][]string, a, b string) bool {
+	for _, p := range pairs {
+		if len(p) == 2 && ((p[0] == a && p[1] == b) || (p[0] == b && p[1] == a)) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
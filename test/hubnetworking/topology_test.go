@@ -0,0 +1,137 @@
+package hubnetworking
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func topologyHubs() HubVirtualNetworks {
+	return HubVirtualNetworks{
+		"hub0":    aHub(true, "10.0.0.0/16"),
+		"hub1":    aHub(true, "10.1.0.0/16"),
+		"hub2":    aHub(true, "10.2.0.0/16"),
+		"hub3":    aHub(true, "10.3.0.0/16"),
+		"nonMesh": aHub(false, "10.4.0.0/16"),
+	}
+}
+
+func TestMeshPairs(t *testing.T) {
+	inputs := []struct {
+		name     string
+		topology *MeshTopology
+		expected map[string][]string
+	}{
+		{
+			name: "default full mesh",
+			expected: map[string][]string{
+				"hub0":    {"hub1", "hub2", "hub3"},
+				"hub1":    {"hub0", "hub2", "hub3"},
+				"hub2":    {"hub0", "hub1", "hub3"},
+				"hub3":    {"hub0", "hub1", "hub2"},
+				"nonMesh": {},
+			},
+		},
+		{
+			name:     "hub and spoke",
+			topology: &MeshTopology{Type: String(MeshTopologyHubAndSpoke), TransitHubKey: String("hub0")},
+			expected: map[string][]string{
+				"hub0":    {"hub1", "hub2", "hub3"},
+				"hub1":    {"hub0"},
+				"hub2":    {"hub0"},
+				"hub3":    {"hub0"},
+				"nonMesh": {},
+			},
+		},
+		{
+			name: "groups",
+			topology: &MeshTopology{Type: String(MeshTopologyGroups), Groups: map[string][]string{
+				"europe": {"hub0", "hub1"},
+				"us":     {"hub2", "hub3", "nonMesh"},
+			}},
+			expected: map[string][]string{
+				"hub0":    {"hub1"},
+				"hub1":    {"hub0"},
+				"hub2":    {"hub3"},
+				"hub3":    {"hub2"},
+				"nonMesh": {},
+			},
+		},
+		{
+			name: "allowed and denied pairs",
+			topology: &MeshTopology{
+				Type:         String(MeshTopologyGroups),
+				Groups:       map[string][]string{"europe": {"hub0", "hub1", "hub2"}},
+				AllowedPairs: [][]string{{"hub3", "hub0"}, {"hub1", "hub2"}, {"hub3", "nonMesh"}},
+				DeniedPairs:  [][]string{{"hub2", "hub1"}},
+			},
+			expected: map[string][]string{
+				"hub0":    {"hub1", "hub2", "hub3"},
+				"hub1":    {"hub0"},
+				"hub2":    {"hub0"},
+				"hub3":    {"hub0"},
+				"nonMesh": {},
+			},
+		},
+	}
+	for _, input := range inputs {
+		i := input
+		t.Run(i.name, func(t *testing.T) {
+			assert.Equal(t, i.expected, Variables{HubVirtualNetworks: topologyHubs(), HubMeshTopology: i.topology}.MeshPairs())
+		})
+	}
+}
+
+func TestRouteMap_HubAndSpokeShouldRouteThroughTransitHub(t *testing.T) {
+	v := Variables{
+		HubVirtualNetworks: topologyHubs(),
+		HubMeshTopology:    &MeshTopology{Type: String(MeshTopologyHubAndSpoke), TransitHubKey: String("hub0")},
+	}
+	assert.Equal(t, map[string]string{"hub0": "hub0", "hub2": "hub0", "hub3": "hub0"}, v.MeshNextHops()["hub1"])
+	routes := v.RouteMap(map[string]string{"hub0": "hub0-fw-ip", "hub2": "hub2-fw-ip"})
+	assert.Equal(t, []Route{
+		{Name: "hub0-10.0.0.0-16", AddressPrefix: "10.0.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("hub0-fw-ip")},
+		{Name: "hub2-10.2.0.0-16", AddressPrefix: "10.2.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("hub0-fw-ip")},
+		{Name: "hub3-10.3.0.0-16", AddressPrefix: "10.3.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("hub0-fw-ip")},
+	}, routes["hub1"].MeshRoutes)
+	assert.Equal(t, []Route{
+		{Name: "hub1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+		{Name: "hub2-10.2.0.0-16", AddressPrefix: "10.2.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("hub2-fw-ip")},
+		{Name: "hub3-10.3.0.0-16", AddressPrefix: "10.3.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("dummyIp")},
+	}, routes["hub0"].MeshRoutes)
+	assert.Empty(t, routes["nonMesh"].MeshRoutes)
+}
+
+func TestUnknownMeshTopologyKeys(t *testing.T) {
+	v := Variables{
+		HubVirtualNetworks: topologyHubs(),
+		HubMeshTopology: &MeshTopology{
+			Type:          String(MeshTopologyHubAndSpoke),
+			TransitHubKey: String("transit"),
+			Groups:        map[string][]string{"g": {"hub0", "missing"}},
+			DeniedPairs:   [][]string{{"hub1", "missing"}, {"hub2", "other"}},
+		},
+	}
+	assert.Equal(t, []string{"missing", "other", "transit"}, v.UnknownMeshTopologyKeys())
+	assert.Empty(t, Variables{HubVirtualNetworks: topologyHubs()}.UnknownMeshTopologyKeys())
+}
+
+func TestPeeringMap_RandomTopologiesShouldBeSymmetric(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 500; n++ {
+		hubs := RandomHubVirtualNetworks(r, 1+r.Intn(8))
+		v := Variables{HubVirtualNetworks: hubs, HubMeshTopology: RandomMeshTopology(r, hubs)}
+		peerings := v.PeeringMap()
+		for _, p := range peerings {
+			_, ok := peerings[PeeringName(hubs[p.DstKey].Name, hubs[p.SrcKey].Name)]
+			assert.True(t, ok, "peering %s has no reverse peering", p.Name)
+		}
+		for kSrc, nextHops := range v.MeshNextHops() {
+			for kDst, kNextHop := range nextHops {
+				_, ok := peerings[PeeringName(hubs[kSrc].Name, hubs[kNextHop].Name)]
+				assert.True(t, ok, "hub %s routes to %s through %s without being peered with it", kSrc, kDst, kNextHop)
+			}
+		}
+	}
+}
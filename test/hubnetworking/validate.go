@@ -0,0 +1,184 @@
+package hubnetworking
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// CidrConflict describes an overlap or containment problem between the CIDRs of one or more hubs.
+// Message is worded exactly as the matching entry of `local.cidr_conflicts`.
+type CidrConflict struct {
+	HubKeys    []string
+	SubnetKeys []string
+	Message    string
+}
+
+func (c CidrConflict) Error() string {
+	return c.Message
+}
+
+type hubSubnetPrefixes struct {
+	name            string
+	addressPrefixes []string
+}
+
+// ValidateCidrs reports every CIDR conflict in the hubs:
+//   - address spaces of two hubs that overlap,
+//   - subnet prefixes, including the firewall subnets, outside their hub's address space,
+//   - subnet prefixes overlapping each other within a hub,
+//   - a non-empty routing_address_space that does not contain the hub's own address space.
+//
+// Prefixes that cannot be parsed are reported as conflicts too.
+func ValidateCidrs(hubs HubVirtualNetworks) []CidrConflict {
+	conflicts := make([]CidrConflict, 0)
+	keys := hubs.Keys()
+	for i, kSrc := range keys {
+		conflicts = append(conflicts, invalidCidrs(kSrc, hubs[kSrc])...)
+		for _, kDst := range keys[i+1:] {
+			for _, a := range hubs[kSrc].AddressSpace {
+				for _, b := range hubs[kDst].AddressSpace {
+					if cidrsOverlap(a, b) {
+						conflicts = append(conflicts, CidrConflict{
+							HubKeys: []string{kSrc, kDst},
+							Message: fmt.Sprintf("address_space %s of hub %s overlaps with address_space %s of hub %s", a, kSrc, b, kDst),
+						})
+					}
+				}
+			}
+		}
+	}
+	for _, k := range keys {
+		hub := hubs[k]
+		subnets := subnetPrefixes(hub)
+		for _, s := range subnets {
+			for _, p := range s.addressPrefixes {
+				if !cidrWithinAny(p, hub.AddressSpace) {
+					conflicts = append(conflicts, CidrConflict{
+						HubKeys:    []string{k},
+						SubnetKeys: []string{s.name},
+						Message:    fmt.Sprintf("address prefix %s of subnet %s in hub %s is not within the address_space of the hub", p, s.name, k),
+					})
+				}
+			}
+		}
+		for i, s1 := range subnets {
+			for _, s2 := range subnets[i+1:] {
+				for _, p1 := range s1.addressPrefixes {
+					for _, p2 := range s2.addressPrefixes {
+						if cidrsOverlap(p1, p2) {
+							conflicts = append(conflicts, CidrConflict{
+								HubKeys:    []string{k},
+								SubnetKeys: []string{s1.name, s2.name},
+								Message:    fmt.Sprintf("address prefix %s of subnet %s overlaps with address prefix %s of subnet %s in hub %s", p1, s1.name, p2, s2.name, k),
+							})
+						}
+					}
+				}
+			}
+		}
+		if len(hub.RoutingAddressSpace) == 0 {
+			continue
+		}
+		for _, a := range hub.AddressSpace {
+			if !cidrWithinAny(a, hub.RoutingAddressSpace) {
+				conflicts = append(conflicts, CidrConflict{
+					HubKeys: []string{k},
+					Message: fmt.Sprintf("address_space %s of hub %s is not within its routing_address_space", a, k),
+				})
+			}
+		}
+	}
+	return conflicts
+}
+
+// subnetPrefixes lists the subnets of a hub in the order `local.hub_subnet_prefixes` does,
+// user defined subnets by key followed by the firewall, gateway, Bastion, Route Server and DNS resolver subnets.
+func subnetPrefixes(hub HubVirtualNetwork) []hubSubnetPrefixes {
+	names := make([]string, 0, len(hub.Subnets))
+	for name := range hub.Subnets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r := make([]hubSubnetPrefixes, 0, len(names)+7)
+	for _, name := range names {
+		r = append(r, hubSubnetPrefixes{name: name, addressPrefixes: hub.Subnets[name].AddressPrefixes})
+	}
+	if hub.Firewall != nil {
+		if hub.Firewall.SubnetAddressPrefix != "" {
+			r = append(r, hubSubnetPrefixes{name: "AzureFirewallSubnet", addressPrefixes: []string{hub.Firewall.SubnetAddressPrefix}})
+		}
+		if hub.Firewall.ManagementSubnetAddressPrefix != nil {
+			r = append(r, hubSubnetPrefixes{name: "AzureFirewallManagementSubnet", addressPrefixes: []string{*hub.Firewall.ManagementSubnetAddressPrefix}})
+		}
+	}
+	if hub.VirtualNetworkGateway != nil {
+		r = append(r, hubSubnetPrefixes{name: GatewaySubnetName, addressPrefixes: []string{hub.VirtualNetworkGateway.SubnetAddressPrefix}})
+	}
+	if hub.Bastion != nil && hub.Bastion.SubnetAddressPrefix != "" {
+		r = append(r, hubSubnetPrefixes{name: BastionSubnetName, addressPrefixes: []string{hub.Bastion.SubnetAddressPrefix}})
+	}
+	if hub.RouteServer != nil {
+		r = append(r, hubSubnetPrefixes{name: RouteServerSubnetName, addressPrefixes: []string{hub.RouteServer.SubnetAddressPrefix}})
+	}
+	if hub.DnsResolver != nil {
+		r = append(r, hubSubnetPrefixes{name: DnsResolverInboundSubnetName, addressPrefixes: []string{hub.DnsResolver.InboundSubnetAddressPrefix}})
+		if hub.DnsResolver.OutboundSubnetAddressPrefix != nil {
+			r = append(r, hubSubnetPrefixes{name: DnsResolverOutboundSubnetName, addressPrefixes: []string{*hub.DnsResolver.OutboundSubnetAddressPrefix}})
+		}
+	}
+	return r
+}
+
+func invalidCidrs(k string, hub HubVirtualNetwork) []CidrConflict {
+	var r []CidrConflict
+	check := func(cidr, field string, subnetKeys ...string) {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			r = append(r, CidrConflict{
+				HubKeys:    []string{k},
+				SubnetKeys: subnetKeys,
+				Message:    fmt.Sprintf("%s %q of hub %s is not a valid CIDR", field, cidr, k),
+			})
+		}
+	}
+	for _, a := range hub.AddressSpace {
+		check(a, "address_space")
+	}
+	for _, a := range hub.RoutingAddressSpace {
+		check(a, "routing_address_space")
+	}
+	for _, s := range subnetPrefixes(hub) {
+		for _, p := range s.addressPrefixes {
+			check(p, fmt.Sprintf("address prefix of subnet %s", s.name), s.name)
+		}
+	}
+	return r
+}
+
+func cidrsOverlap(a, b string) bool {
+	pa, errA := netip.ParsePrefix(a)
+	pb, errB := netip.ParsePrefix(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return pa.Masked().Overlaps(pb.Masked())
+}
+
+// cidrWithin reports whether inner is entirely contained in outer.
+func cidrWithin(inner, outer string) bool {
+	pi, errI := netip.ParsePrefix(inner)
+	po, errO := netip.ParsePrefix(outer)
+	if errI != nil || errO != nil {
+		return false
+	}
+	return pi.Bits() >= po.Bits() && po.Masked().Contains(pi.Masked().Addr())
+}
+
+func cidrWithinAny(inner string, outers []string) bool {
+	for _, outer := range outers {
+		if cidrWithin(inner, outer) {
+			return true
+		}
+	}
+	return false
+}
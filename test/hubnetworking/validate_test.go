@@ -0,0 +1,167 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCidrs(t *testing.T) {
+	inputs := []struct {
+		name     string
+		hubs     HubVirtualNetworks
+		expected []CidrConflict
+	}{
+		{
+			name: "disjoint hubs should have no conflict",
+			hubs: HubVirtualNetworks{
+				"hub0": {
+					AddressSpace:        []string{"10.0.0.0/16"},
+					RoutingAddressSpace: []string{"10.0.0.0/8"},
+					Subnets: map[string]Subnet{
+						"subnet0": {AddressPrefixes: []string{"10.0.0.0/24"}},
+					},
+					Firewall: &Firewall{SubnetAddressPrefix: "10.0.1.0/24"},
+				},
+				"hub1": {AddressSpace: []string{"10.1.0.0/16"}},
+			},
+			expected: []CidrConflict{},
+		},
+		{
+			name: "overlapping hubs",
+			hubs: HubVirtualNetworks{
+				"hub0": {AddressSpace: []string{"10.0.0.0/16"}},
+				"hub1": {AddressSpace: []string{"10.0.128.0/17", "10.1.0.0/16"}},
+			},
+			expected: []CidrConflict{
+				{
+					HubKeys: []string{"hub0", "hub1"},
+					Message: "address_space 10.0.0.0/16 of hub hub0 overlaps with address_space 10.0.128.0/17 of hub hub1",
+				},
+			},
+		},
+		{
+			name: "subnet outside of hub address space",
+			hubs: HubVirtualNetworks{
+				"hub0": {
+					AddressSpace: []string{"10.0.0.0/16"},
+					Subnets: map[string]Subnet{
+						"subnet0": {AddressPrefixes: []string{"10.1.0.0/24"}},
+					},
+				},
+			},
+			expected: []CidrConflict{
+				{
+					HubKeys:    []string{"hub0"},
+					SubnetKeys: []string{"subnet0"},
+					Message:    "address prefix 10.1.0.0/24 of subnet subnet0 in hub hub0 is not within the address_space of the hub",
+				},
+			},
+		},
+		{
+			name: "firewall subnet colliding with subnet",
+			hubs: HubVirtualNetworks{
+				"hub0": {
+					AddressSpace: []string{"10.0.0.0/16"},
+					Subnets: map[string]Subnet{
+						"subnet0": {AddressPrefixes: []string{"10.0.0.0/23"}},
+					},
+					Firewall: &Firewall{
+						SubnetAddressPrefix:           "10.0.1.0/26",
+						ManagementSubnetAddressPrefix: String("10.0.2.0/26"),
+					},
+				},
+			},
+			expected: []CidrConflict{
+				{
+					HubKeys:    []string{"hub0"},
+					SubnetKeys: []string{"subnet0", "AzureFirewallSubnet"},
+					Message:    "address prefix 10.0.0.0/23 of subnet subnet0 overlaps with address prefix 10.0.1.0/26 of subnet AzureFirewallSubnet in hub hub0",
+				},
+			},
+		},
+		{
+			name: "routing address space not containing hub address space",
+			hubs: HubVirtualNetworks{
+				"hub0": {
+					AddressSpace:        []string{"10.0.0.0/16", "192.168.0.0/24"},
+					RoutingAddressSpace: []string{"10.0.0.0/8"},
+				},
+			},
+			expected: []CidrConflict{
+				{
+					HubKeys: []string{"hub0"},
+					Message: "address_space 192.168.0.0/24 of hub hub0 is not within its routing_address_space",
+				},
+			},
+		},
+		{
+			name: "dual-stack hubs should only conflict within an ip version",
+			hubs: HubVirtualNetworks{
+				"hub0": {
+					AddressSpace:        []string{"10.0.0.0/16", "fd00:0:0:0::/64"},
+					RoutingAddressSpace: []string{"10.0.0.0/8", "fd00::/48"},
+					Subnets: map[string]Subnet{
+						"subnet0": {AddressPrefixes: []string{"10.0.0.0/24", "fd00::/64"}},
+					},
+				},
+				"hub1": {AddressSpace: []string{"10.1.0.0/16", "fd00:0:0:1::/64"}},
+				"hub2": {AddressSpace: []string{"10.2.0.0/16", "fd00::/56"}},
+			},
+			expected: []CidrConflict{
+				{
+					HubKeys: []string{"hub0", "hub2"},
+					Message: "address_space fd00:0:0:0::/64 of hub hub0 overlaps with address_space fd00::/56 of hub hub2",
+				},
+				{
+					HubKeys: []string{"hub1", "hub2"},
+					Message: "address_space fd00:0:0:1::/64 of hub hub1 overlaps with address_space fd00::/56 of hub hub2",
+				},
+			},
+		},
+		{
+			name: "dns resolver subnets should not overlap the other subnets",
+			hubs: HubVirtualNetworks{
+				"hub0": {
+					AddressSpace: []string{"10.0.0.0/16"},
+					Bastion:      &Bastion{SubnetAddressPrefix: "10.0.1.0/26"},
+					DnsResolver: &DnsResolver{
+						InboundSubnetAddressPrefix:  "10.0.1.32/28",
+						OutboundSubnetAddressPrefix: String("10.1.0.0/28"),
+					},
+				},
+			},
+			expected: []CidrConflict{
+				{
+					HubKeys:    []string{"hub0"},
+					SubnetKeys: []string{"DnsResolverOutboundSubnet"},
+					Message:    "address prefix 10.1.0.0/28 of subnet DnsResolverOutboundSubnet in hub hub0 is not within the address_space of the hub",
+				},
+				{
+					HubKeys:    []string{"hub0"},
+					SubnetKeys: []string{"AzureBastionSubnet", "DnsResolverInboundSubnet"},
+					Message:    "address prefix 10.0.1.0/26 of subnet AzureBastionSubnet overlaps with address prefix 10.0.1.32/28 of subnet DnsResolverInboundSubnet in hub hub0",
+				},
+			},
+		},
+		{
+			name: "invalid cidr",
+			hubs: HubVirtualNetworks{
+				"hub0": {AddressSpace: []string{"10.0.0.0"}},
+			},
+			expected: []CidrConflict{
+				{
+					HubKeys: []string{"hub0"},
+					Message: `address_space "10.0.0.0" of hub hub0 is not a valid CIDR`,
+				},
+			},
+		},
+	}
+
+	for _, input := range inputs {
+		i := input
+		t.Run(i.name, func(t *testing.T) {
+			assert.Equal(t, i.expected, ValidateCidrs(i.hubs))
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package hubnetworking
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// LoadVarFile reads a `.tfvars.json` or HCL `.tfvars` file. The format is chosen by the file extension.
+func LoadVarFile(path string) (Variables, error) {
+	src, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return Variables{}, err
+	}
+	return ParseVarFile(src, path)
+}
+
+// ParseVarFile decodes the content of a var file, filename is used to pick the format and in diagnostics.
+func ParseVarFile(src []byte, filename string) (Variables, error) {
+	var v Variables
+	if isJsonVarFile(filename) {
+		if err := json.Unmarshal(src, &v); err != nil {
+			return Variables{}, fmt.Errorf("cannot decode %s: %w", filename, err)
+		}
+		return v, nil
+	}
+	c, err := hclToJson(src, filename)
+	if err != nil {
+		return Variables{}, err
+	}
+	if err = json.Unmarshal(c, &v); err != nil {
+		return Variables{}, fmt.Errorf("cannot decode %s: %w", filename, err)
+	}
+	return v, nil
+}
+
+// SaveVarFile writes the variables to path, as HCL for `.tfvars` and as JSON otherwise.
+func SaveVarFile(path string, v Variables) error {
+	var c []byte
+	var err error
+	if isJsonVarFile(path) {
+		c, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		c, err = v.MarshalHCL()
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Clean(path), c, 0600)
+}
+
+// MarshalHCL renders the variables in the native tfvars syntax.
+func (v Variables) MarshalHCL() ([]byte, error) {
+	c, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var attrs map[string]json.RawMessage
+	if err = json.Unmarshal(c, &attrs); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	f := hclwrite.NewEmptyFile()
+	for _, name := range names {
+		ty, err := ctyjson.ImpliedType(attrs[name])
+		if err != nil {
+			return nil, err
+		}
+		value, err := ctyjson.Unmarshal(attrs[name], ty)
+		if err != nil {
+			return nil, err
+		}
+		f.Body().SetAttributeValue(name, value)
+	}
+	return hclwrite.Format(f.Bytes()), nil
+}
+
+func hclToJson(src []byte, filename string) ([]byte, error) {
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	values := make(map[string]cty.Value, len(attrs))
+	for name, attr := range attrs {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		values[name] = value
+	}
+	obj := cty.ObjectVal(values)
+	return ctyjson.Marshal(obj, obj.Type())
+}
+
+func isJsonVarFile(filename string) bool {
+	return strings.HasSuffix(filename, ".json")
+}
@@ -0,0 +1,51 @@
+package hubnetworking
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadVarFile_HclAndJsonShouldDecodeToSameVariables(t *testing.T) {
+	fromHcl, err := LoadVarFile("testdata/hubs.tfvars")
+	require.NoError(t, err)
+	fromJson, err := LoadVarFile("testdata/hubs.tfvars.json")
+	require.NoError(t, err)
+	assert.Equal(t, fromJson, fromHcl)
+
+	hub := fromHcl.HubVirtualNetworks["eastus-hub"]
+	assert.Equal(t, "eastus-hub", hub.Name)
+	assert.Equal(t, []string{"10.0.0.0/16", "192.168.0.0/24"}, hub.RoutingAddressSpace)
+	assert.Equal(t, "nat_gateway_id", hub.Subnets["workload"].NatGateway.Id)
+	assert.Equal(t, "Microsoft.ContainerInstance/containerGroups", hub.Subnets["workload"].Delegations[0].ServiceDelegation.Name)
+	assert.Equal(t, "pip-eastus", *hub.Firewall.DefaultIpConfiguration.PublicIpConfig.Name)
+	assert.Equal(t, 10, *fromHcl.HubVirtualNetworks["eastus2-hub"].FlowTimeoutInMinutes)
+	assert.True(t, *fromHcl.TracingTagsEnabled)
+}
+
+func TestSaveVarFile_RoundTrip(t *testing.T) {
+	expected, err := LoadVarFile("testdata/hubs.tfvars.json")
+	require.NoError(t, err)
+	for _, name := range []string{"terraform.tfvars", "terraform.tfvars.json"} {
+		n := name
+		t.Run(n, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), n)
+			require.NoError(t, SaveVarFile(path, expected))
+			actual, err := LoadVarFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestParseVarFile_InvalidHclShouldReturnError(t *testing.T) {
+	_, err := ParseVarFile([]byte(`hub_virtual_networks = {`), "broken.tfvars")
+	assert.Error(t, err)
+}
+
+func TestParseVarFile_HclWithReferenceShouldReturnError(t *testing.T) {
+	_, err := ParseVarFile([]byte(`tracing_tags_prefix = var.prefix`), "reference.tfvars")
+	assert.Error(t, err)
+}
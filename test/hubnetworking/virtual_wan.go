@@ -0,0 +1,124 @@
+package hubnetworking
+
+import "fmt"
+
+// VirtualWanConflict is an element of `local.virtual_wan_conflicts`, a setting of a hub that does not fit the
+// deployment mode, with or without `var.virtual_wan`.
+type VirtualWanConflict struct {
+	HubKeys []string `json:"hub_keys"`
+	Message string   `json:"message"`
+}
+
+func (c VirtualWanConflict) Error() string {
+	return c.Message
+}
+
+// VirtualHubRoutingPolicy mirrors an element of `routing_policies` in `local.virtual_hub_routing_intents`.
+type VirtualHubRoutingPolicy struct {
+	Name         string   `json:"name"`
+	Destinations []string `json:"destinations"`
+}
+
+// VirtualHubRoutingIntent mirrors a value of `local.virtual_hub_routing_intents`.
+type VirtualHubRoutingIntent struct {
+	Name            string                    `json:"name"`
+	RoutingPolicies []VirtualHubRoutingPolicy `json:"routing_policies"`
+}
+
+// hubVirtualNetworks mirrors `local.hub_virtual_networks`, the hubs deployed as virtual networks, none with a Virtual WAN.
+func (v Variables) hubVirtualNetworks() HubVirtualNetworks {
+	if v.VirtualWan != nil {
+		return HubVirtualNetworks{}
+	}
+	return v.HubVirtualNetworks.WithDefaults()
+}
+
+// VirtualWanConflicts computes `local.virtual_wan_conflicts` in the same order:
+//   - firewalls not using the AZFW_Hub SKU with a Virtual WAN, or the AZFW_VNet SKU without,
+//   - firewalls without subnet_address_prefix without a Virtual WAN,
+//   - hubs without exactly one address space with a Virtual WAN,
+//   - hub attributes a virtual hub does not support,
+//   - spokes using remote gateways with a Virtual WAN.
+func (v Variables) VirtualWanConflicts() []VirtualWanConflict {
+	v = v.WithDefaults()
+	hubs := v.HubVirtualNetworks
+	enabled := v.VirtualWan != nil
+	conflicts := make([]VirtualWanConflict, 0)
+	add := func(k string, format string, a ...any) {
+		conflicts = append(conflicts, VirtualWanConflict{HubKeys: []string{k}, Message: fmt.Sprintf(format, a...)})
+	}
+	for _, k := range hubs.Keys() {
+		if fw := hubs[k].Firewall; enabled && fw != nil && fw.SkuName != "AZFW_Hub" {
+			add(k, "firewall of hub %s must use the AZFW_Hub SKU with virtual_wan", k)
+		}
+	}
+	for _, k := range hubs.Keys() {
+		if fw := hubs[k].Firewall; !enabled && fw != nil && fw.SkuName != "AZFW_VNet" {
+			add(k, "firewall of hub %s must use the AZFW_VNet SKU without virtual_wan", k)
+		}
+	}
+	for _, k := range hubs.Keys() {
+		if fw := hubs[k].Firewall; !enabled && fw != nil && fw.SubnetAddressPrefix == "" {
+			add(k, "firewall of hub %s requires a subnet_address_prefix without virtual_wan", k)
+		}
+	}
+	if !enabled {
+		return conflicts
+	}
+	for _, k := range hubs.Keys() {
+		if len(hubs[k].AddressSpace) != 1 {
+			add(k, "hub %s must have exactly one address_space with virtual_wan, the address prefix of its virtual hub", k)
+		}
+	}
+	for _, k := range hubs.Keys() {
+		hub := hubs[k]
+		for _, unsupported := range []struct {
+			attribute string
+			used      bool
+		}{
+			{"bastion", hub.Bastion != nil},
+			{"diagnostic_settings", hub.DiagnosticSettings != nil},
+			{"dns_resolver", hub.DnsResolver != nil},
+			{"flow_log", hub.FlowLog != nil},
+			{"route_server", hub.RouteServer != nil},
+			{"route_table_entries", len(hub.RouteTableEntries) > 0},
+			{"subnets", len(hub.Subnets) > 0},
+			{"virtual_network_gateway", hub.VirtualNetworkGateway != nil},
+		} {
+			if unsupported.used {
+				add(k, "%s of hub %s is not supported with virtual_wan", unsupported.attribute, k)
+			}
+		}
+	}
+	for _, k := range v.SpokeVirtualNetworks.Keys() {
+		if spoke := v.SpokeVirtualNetworks[k]; *spoke.UseRemoteGateways {
+			add(spoke.HubKey, "spoke %s sets use_remote_gateways, which is not supported with virtual_wan", k)
+		}
+	}
+	return conflicts
+}
+
+// VirtualHubRoutingIntents computes `local.virtual_hub_routing_intents`, the routing policies sending the internet and
+// private traffic of each virtual hub with a firewall through it.
+func (v Variables) VirtualHubRoutingIntents() map[string]VirtualHubRoutingIntent {
+	r := make(map[string]VirtualHubRoutingIntent)
+	if v.VirtualWan == nil {
+		return r
+	}
+	for k, hub := range v.HubVirtualNetworks.WithDefaults() {
+		if hub.Firewall == nil {
+			continue
+		}
+		var policies []VirtualHubRoutingPolicy
+		if *hub.VirtualHub.InternetTrafficRoutingEnabled {
+			policies = append(policies, VirtualHubRoutingPolicy{Name: "InternetTrafficPolicy", Destinations: []string{"Internet"}})
+		}
+		if *hub.VirtualHub.PrivateTrafficRoutingEnabled {
+			policies = append(policies, VirtualHubRoutingPolicy{Name: "PrivateTrafficPolicy", Destinations: []string{"PrivateTraffic"}})
+		}
+		if len(policies) > 0 {
+			r[k] = VirtualHubRoutingIntent{Name: fmt.Sprintf("ri-%s", k), RoutingPolicies: policies}
+		}
+	}
+	return r
+}
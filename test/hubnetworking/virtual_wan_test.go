@@ -0,0 +1,101 @@
+package hubnetworking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func virtualWanVariables() Variables {
+	return Variables{
+		HubVirtualNetworks: HubVirtualNetworks{
+			"hub0": {
+				Name:              "vhub0",
+				AddressSpace:      []string{"10.0.0.0/23"},
+				Location:          "eastus",
+				ResourceGroupName: "rg0",
+				Firewall:          &Firewall{SkuName: "AZFW_Hub", SkuTier: "Standard"},
+			},
+			"hub1": {
+				Name:              "vhub1",
+				AddressSpace:      []string{"10.1.0.0/23"},
+				Location:          "westus",
+				ResourceGroupName: "rg1",
+				Firewall:          &Firewall{SkuName: "AZFW_Hub", SkuTier: "Standard"},
+				VirtualHub:        &VirtualHub{InternetTrafficRoutingEnabled: Bool(false)},
+			},
+			"hub2": {
+				Name:              "vhub2",
+				AddressSpace:      []string{"10.2.0.0/23"},
+				Location:          "eastus",
+				ResourceGroupName: "rg2",
+			},
+		},
+		SpokeVirtualNetworks: SpokeVirtualNetworks{
+			"spoke0": {HubKey: "hub0", AddressSpace: []string{"10.10.0.0/24"}, Name: String("spoke0")},
+		},
+		VirtualWan: &VirtualWan{Name: "vwan", Location: "eastus", ResourceGroupName: "rg0"},
+	}
+}
+
+func TestVirtualWanConflicts_ValidVirtualWanShouldHaveNone(t *testing.T) {
+	assert.Empty(t, virtualWanVariables().VirtualWanConflicts())
+}
+
+func TestVirtualWanConflicts_ShouldReportSettingsNotFittingTheMode(t *testing.T) {
+	v := virtualWanVariables()
+	hub0 := v.HubVirtualNetworks["hub0"]
+	hub0.Firewall = &Firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.0.0.0/26"}
+	hub0.AddressSpace = append(hub0.AddressSpace, "10.0.2.0/24")
+	hub0.Subnets = map[string]Subnet{"s": {AddressPrefixes: []string{"10.0.1.0/24"}}}
+	hub0.Bastion = &Bastion{SubnetAddressPrefix: "10.0.1.0/26"}
+	hub0.DnsResolver = &DnsResolver{InboundSubnetAddressPrefix: "10.0.1.64/28"}
+	hub0.DiagnosticSettings = &HubDiagnosticSettings{Enabled: Bool(false)}
+	hub0.FlowLog = &FlowLog{StorageAccountId: "storage-id"}
+	v.HubVirtualNetworks["hub0"] = hub0
+	spoke0 := v.SpokeVirtualNetworks["spoke0"]
+	spoke0.UseRemoteGateways = Bool(true)
+	v.SpokeVirtualNetworks["spoke0"] = spoke0
+
+	assert.Equal(t, []VirtualWanConflict{
+		{HubKeys: []string{"hub0"}, Message: "firewall of hub hub0 must use the AZFW_Hub SKU with virtual_wan"},
+		{HubKeys: []string{"hub0"}, Message: "hub hub0 must have exactly one address_space with virtual_wan, the address prefix of its virtual hub"},
+		{HubKeys: []string{"hub0"}, Message: "bastion of hub hub0 is not supported with virtual_wan"},
+		{HubKeys: []string{"hub0"}, Message: "diagnostic_settings of hub hub0 is not supported with virtual_wan"},
+		{HubKeys: []string{"hub0"}, Message: "dns_resolver of hub hub0 is not supported with virtual_wan"},
+		{HubKeys: []string{"hub0"}, Message: "flow_log of hub hub0 is not supported with virtual_wan"},
+		{HubKeys: []string{"hub0"}, Message: "subnets of hub hub0 is not supported with virtual_wan"},
+		{HubKeys: []string{"hub0"}, Message: "spoke spoke0 sets use_remote_gateways, which is not supported with virtual_wan"},
+	}, v.VirtualWanConflicts())
+}
+
+func TestVirtualWanConflicts_WithoutVirtualWanShouldRequireVNetFirewalls(t *testing.T) {
+	v := virtualWanVariables()
+	v.VirtualWan = nil
+	assert.Equal(t, []VirtualWanConflict{
+		{HubKeys: []string{"hub0"}, Message: "firewall of hub hub0 must use the AZFW_VNet SKU without virtual_wan"},
+		{HubKeys: []string{"hub1"}, Message: "firewall of hub hub1 must use the AZFW_VNet SKU without virtual_wan"},
+		{HubKeys: []string{"hub0"}, Message: "firewall of hub hub0 requires a subnet_address_prefix without virtual_wan"},
+		{HubKeys: []string{"hub1"}, Message: "firewall of hub hub1 requires a subnet_address_prefix without virtual_wan"},
+	}, v.VirtualWanConflicts())
+}
+
+func TestVirtualHubRoutingIntents(t *testing.T) {
+	assert.Equal(t, map[string]VirtualHubRoutingIntent{
+		"hub0": {Name: "ri-hub0", RoutingPolicies: []VirtualHubRoutingPolicy{
+			{Name: "InternetTrafficPolicy", Destinations: []string{"Internet"}},
+			{Name: "PrivateTrafficPolicy", Destinations: []string{"PrivateTraffic"}},
+		}},
+		"hub1": {Name: "ri-hub1", RoutingPolicies: []VirtualHubRoutingPolicy{
+			{Name: "PrivateTrafficPolicy", Destinations: []string{"PrivateTraffic"}},
+		}},
+	}, virtualWanVariables().VirtualHubRoutingIntents())
+}
+
+func TestVirtualWan_ShouldReplacePeeringsAndRouteTables(t *testing.T) {
+	v := virtualWanVariables()
+	assert.Empty(t, v.PeeringMap())
+	assert.Empty(t, v.RouteMap(nil))
+	assert.Empty(t, v.SpokePeeringMap())
+	assert.Empty(t, v.SpokeRouteMap(nil))
+}
@@ -3,12 +3,17 @@ package unit
 import (
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/Azure/terraform-azure-hubandspoke/test/hubnetworking"
 	test_helper "github.com/Azure/terraform-module-test-helper"
 	"github.com/ahmetb/go-linq/v3"
 	"github.com/gruntwork-io/terratest/modules/logger"
@@ -25,72 +30,101 @@ func (v vars) toFile(t *testing.T) string {
 	return varFile(t, v, fmt.Sprintf("../../unit-fixture/terraform%s.tfvars.json", randstr.Hex(8)))
 }
 
-type vnet struct {
-	Name                     string            `json:"name"`
-	MeshPeeringEnabled       bool              `json:"mesh_peering_enabled"`
-	Subnets                  map[string]subnet `json:"subnets"`
-	AddressSpace             []string          `json:"address_space"`
-	ResourceGroupName        string            `json:"resource_group_name"`
-	Location                 string            `json:"location"`
-	ResourceGroupLockEnabled bool              `json:"resource_group_lock_enabled"`
-	ResourceGroupLockName    string            `json:"resource_group_lock_name"`
-	ResourceGroupCreation    bool              `json:"resource_group_creation_enabled"`
-	RoutingAddressSpace      []string          `json:"routing_address_space"`
-	Firewall                 *firewall         `json:"firewall"`
-	HubRouterIpAddress       *string           `json:"hub_router_ip_address"`
-	Routes                   []routeEntry      `json:"route_table_entries"`
+type vnet hubnetworking.HubVirtualNetwork
+
+type routeEntry hubnetworking.RouteTableEntry
+
+type firewall hubnetworking.Firewall
+
+type firewallOutputEntry struct {
+	Name                          string                `mapstructure:"name"`
+	SkuName                       string                `mapstructure:"sku_name"`
+	SkuTier                       string                `mapstructure:"sku_tier"`
+	SubnetAddressPrefix           string                `mapstructure:"subnet_address_prefix"`
+	ManagementSubnetAddressPrefix string                `mapstructure:"management_subnet_address_prefix"`
+	SubnetRouteTableId            *string               `mapstructure:"subnet_route_table_id"`
+	DnsServers                    []string              `mapstructure:"dns_servers"`
+	FirewallPolicyId              *string               `mapstructure:"firewall_policy_id"`
+	PrivateIpRanges               []string              `mapstructure:"private_ip_ranges"`
+	Tags                          map[string]string     `mapstructure:"tags"`
+	ThreatIntelMode               string                `mapstructure:"threat_intel_mode"`
+	Zones                         []string              `mapstructure:"zones"`
+	DefaultIpConfig               *IpConfigOutputEntry  `mapstructure:"default_ip_configuration"`
+	IpConfigs                     []IpConfigOutputEntry `mapstructure:"ip_configurations"`
 }
 
-type routeEntry struct {
-	Name            string  `json:"name"`
-	AddressPrefix   string  `json:"address_prefix"`
-	NextHopType     string  `json:"next_hop_type"`
-	NextHopIpAddres *string `json:"next_hop_ip_address"`
+type bastionOutputEntry struct {
+	Location             string            `mapstructure:"location"`
+	Name                 string            `mapstructure:"name"`
+	ResourceGroupName    string            `mapstructure:"resource_group_name"`
+	Sku                  string            `mapstructure:"sku"`
+	ScaleUnits           int               `mapstructure:"scale_units"`
+	CopyPasteEnabled     bool              `mapstructure:"copy_paste_enabled"`
+	FileCopyEnabled      bool              `mapstructure:"file_copy_enabled"`
+	IpConnectEnabled     bool              `mapstructure:"ip_connect_enabled"`
+	ShareableLinkEnabled bool              `mapstructure:"shareable_link_enabled"`
+	TunnelingEnabled     bool              `mapstructure:"tunneling_enabled"`
+	Tags                 map[string]string `mapstructure:"tags"`
 }
 
-type firewall struct {
-	Name                          *string `json:"name"`
-	SkuName                       string  `json:"sku_name"`
-	SkuTier                       string  `json:"sku_tier"`
-	SubnetAddressPrefix           string  `json:"subnet_address_prefix"`
-	ManagementSubnetAddressPrefix string  `json:"management_subnet_address_prefix"`
-	SubnetRouteTableId            *string `json:"subnet_route_table_id"`
+type cidrConflictOutput struct {
+	HubKeys    []string `mapstructure:"hub_keys"`
+	SubnetKeys []string `mapstructure:"subnet_keys"`
+	Message    string   `mapstructure:"message"`
 }
 
-type firewallOutputEntry struct {
-	Name                          string               `mapstructure:"name"`
-	SkuName                       string               `mapstructure:"sku_name"`
-	SkuTier                       string               `mapstructure:"sku_tier"`
-	SubnetAddressPrefix           string               `mapstructure:"subnet_address_prefix"`
-	ManagementSubnetAddressPrefix string               `mapstructure:"management_subnet_address_prefix"`
-	SubnetRouteTableId            *string              `mapstructure:"subnet_route_table_id"`
-	DnsServers                    []string             `mapstructure:"dns_servers"`
-	FirewallPolicyId              *string              `mapstructure:"firewall_policy_id"`
-	PrivateIpRanges               []string             `mapstructure:"private_ip_ranges"`
-	Tags                          map[string]string    `mapstructure:"tags"`
-	ThreatIntelMode               string               `mapstructure:"threat_intel_mode"`
-	Zones                         []string             `mapstructure:"zones"`
-	DefaultIpConfig               *IpConfigOutputEntry `mapstructure:"default_ip_configuration"`
+type peeringOutput struct {
+	Name                      string `mapstructure:"name"`
+	SrcKey                    string `mapstructure:"src_key"`
+	DstKey                    string `mapstructure:"dst_key"`
+	VirtualNetworkName        string `mapstructure:"virtual_network_name"`
+	RemoteVirtualNetworkId    string `mapstructure:"remote_virtual_network_id"`
+	AllowVirtualNetworkAccess bool   `mapstructure:"allow_virtual_network_access"`
+	AllowForwardedTraffic     bool   `mapstructure:"allow_forwarded_traffic"`
+	AllowGatewayTransit       bool   `mapstructure:"allow_gateway_transit"`
+	UseRemoteGateways         bool   `mapstructure:"use_remote_gateways"`
+}
+
+type peeringConflictOutput struct {
+	PeeringNames []string `mapstructure:"peering_names"`
+	Message      string   `mapstructure:"message"`
+}
+
+type hubPeeringOutput struct {
+	hubnetworking.Peering
+	RemoteVirtualNetworkId string `json:"remote_virtual_network_id"`
+}
+
+type spokePeeringOutput struct {
+	hubnetworking.SpokePeering
+	RemoteVirtualNetworkId string `json:"remote_virtual_network_id"`
+}
+
+type spokeOutput struct {
+	BgpRoutePropagationEnabled bool `json:"bgp_route_propagation_enabled"`
+}
+
+type subnetRouteTableAssociationOutput struct {
+	Name         string `mapstructure:"name"`
+	SubnetId     string `mapstructure:"subnet_id"`
+	RouteTableId string `mapstructure:"route_table_id"`
 }
 
 type IpConfigOutputEntry struct {
 	Name string `mapstructure:"name"`
 }
 
-type subnet struct {
-	AddressPrefixes           []string `json:"address_prefixes"`
-	AssignGeneratedRouteTable bool     `json:"assign_generated_route_table"`
-	ExternalRouteTableId      *string  `json:"external_route_table_id"`
-}
+type subnet hubnetworking.Subnet
 
 func aSubnet(addressSpace string) subnet {
 	return subnet{
-		AddressPrefixes: []string{addressSpace},
+		AddressPrefixes:           []string{addressSpace},
+		AssignGeneratedRouteTable: Bool(false),
 	}
 }
 
 func (s subnet) UseGenerateRouteTable() subnet {
-	s.AssignGeneratedRouteTable = true
+	s.AssignGeneratedRouteTable = Bool(true)
 	return s
 }
 
@@ -101,13 +135,14 @@ func (s subnet) WithExternalRouteTableId(rtId string) subnet {
 
 func aVnet(name string, meshPeering bool) vnet {
 	return vnet{
-		Name:                  name,
-		Location:              "eastus",
-		MeshPeeringEnabled:    meshPeering,
-		Subnets:               make(map[string]subnet, 0),
-		ResourceGroupCreation: false,
-		HubRouterIpAddress:    String("dummyIp"),
-		AddressSpace:          make([]string, 0, 2),
+		Name:                         name,
+		Location:                     "eastus",
+		MeshPeeringEnabled:           Bool(meshPeering),
+		Subnets:                      make(map[string]hubnetworking.Subnet, 0),
+		ResourceGroupCreationEnabled: Bool(false),
+		ResourceGroupLockEnabled:     Bool(false),
+		HubRouterIpAddress:           String("dummyIp"),
+		AddressSpace:                 make([]string, 0, 2),
 	}
 }
 
@@ -117,7 +152,7 @@ func (n vnet) withAddressSpace(cidr string) vnet {
 }
 
 func (n vnet) withResourceGroupCreation(b bool) vnet {
-	n.ResourceGroupCreation = b
+	n.ResourceGroupCreationEnabled = Bool(b)
 	return n
 }
 
@@ -137,32 +172,202 @@ func (n vnet) withEmptyRoutingAddressSpace() vnet {
 }
 
 func (n vnet) withSubnet(name string, s subnet) vnet {
-	n.Subnets[name] = s
+	n.Subnets[name] = hubnetworking.Subnet(s)
 	return n
 }
 
 func (n vnet) withFirewall(f firewall) vnet {
-	n.Firewall = &f
+	fw := hubnetworking.Firewall(f)
+	n.Firewall = &fw
 	n.HubRouterIpAddress = nil
 	return n
 }
 
+func (n vnet) withHubRouterIpv6Address(ip string) vnet {
+	n.HubRouterIpv6Address = String(ip)
+	return n
+}
+
 func (n vnet) withHubRouterIpAddress(ip string) vnet {
 	n.HubRouterIpAddress = String(ip)
 	return n
 }
 
 func (n vnet) withUserRouteEntry(r routeEntry) vnet {
-	if n.Routes == nil {
-		n.Routes = make([]routeEntry, 0)
+	n.RouteTableEntries = append(n.RouteTableEntries, hubnetworking.RouteTableEntry(r))
+	return n
+}
+
+func (n vnet) withBgpRoutePropagation(b bool) vnet {
+	n.BgpRoutePropagationEnabled = Bool(b)
+	return n
+}
+
+func (n vnet) withDefaultRoute(r defaultRoute) vnet {
+	d := hubnetworking.DefaultRoute(r)
+	n.DefaultRoute = &d
+	return n
+}
+
+func (n vnet) withGatewaySubnet(cidr string) vnet {
+	return n.withSubnet(hubnetworking.GatewaySubnetName, aSubnet(cidr))
+}
+
+func (n vnet) withMeshPeeringSettings(s peeringSettings) vnet {
+	settings := hubnetworking.PeeringSettings(s)
+	n.MeshPeeringSettings = &settings
+	return n
+}
+
+func (n vnet) withMeshPeeringOverride(dstKey string, s peeringSettings) vnet {
+	overrides := make(map[string]hubnetworking.PeeringSettings, len(n.MeshPeeringOverrides)+1)
+	for k, o := range n.MeshPeeringOverrides {
+		overrides[k] = o
 	}
-	n.Routes = append(n.Routes, r)
+	overrides[dstKey] = hubnetworking.PeeringSettings(s)
+	n.MeshPeeringOverrides = overrides
+	return n
+}
+
+func (n vnet) withVirtualNetworkGateway(g gateway) vnet {
+	gw := hubnetworking.VirtualNetworkGateway(g)
+	n.VirtualNetworkGateway = &gw
+	return n
+}
+
+func (n vnet) withBastion(b bastion) vnet {
+	bas := hubnetworking.Bastion(b)
+	n.Bastion = &bas
+	return n
+}
+
+func (n vnet) withRouteServer(r routeServer) vnet {
+	rs := hubnetworking.RouteServer(r)
+	n.RouteServer = &rs
+	return n
+}
+
+func (n vnet) withVirtualHub(h virtualHub) vnet {
+	vh := hubnetworking.VirtualHub(h)
+	n.VirtualHub = &vh
+	return n
+}
+
+func (n vnet) withDdosProtectionPlanId(id string) vnet {
+	n.DdosProtectionPlanId = String(id)
 	return n
 }
 
+func (n vnet) withDiagnosticSettings(d hubnetworking.DiagnosticSettings) vnet {
+	n.DiagnosticSettings = &hubnetworking.HubDiagnosticSettings{DiagnosticSettings: d}
+	return n
+}
+
+func (n vnet) withoutDiagnosticSettings() vnet {
+	n.DiagnosticSettings = &hubnetworking.HubDiagnosticSettings{Enabled: Bool(false)}
+	return n
+}
+
+func (n vnet) withFlowLog(f hubnetworking.FlowLog) vnet {
+	n.FlowLog = &f
+	return n
+}
+
+func (n vnet) withDnsResolver(r dnsResolver) vnet {
+	dr := hubnetworking.DnsResolver(r)
+	n.DnsResolver = &dr
+	return n
+}
+
+type defaultRoute hubnetworking.DefaultRoute
+
+type gateway hubnetworking.VirtualNetworkGateway
+
+type bastion hubnetworking.Bastion
+
+type routeServer hubnetworking.RouteServer
+
+type virtualHub hubnetworking.VirtualHub
+
+type dnsResolver hubnetworking.DnsResolver
+
+type peeringSettings hubnetworking.PeeringSettings
+
+func (s peeringSettings) allowVirtualNetworkAccess(b bool) peeringSettings {
+	s.AllowVirtualNetworkAccess = Bool(b)
+	return s
+}
+
+func (s peeringSettings) allowForwardedTraffic(b bool) peeringSettings {
+	s.AllowForwardedTraffic = Bool(b)
+	return s
+}
+
+func (s peeringSettings) allowGatewayTransit(b bool) peeringSettings {
+	s.AllowGatewayTransit = Bool(b)
+	return s
+}
+
+func (s peeringSettings) useRemoteGateways(b bool) peeringSettings {
+	s.UseRemoteGateways = Bool(b)
+	return s
+}
+
+type spoke hubnetworking.SpokeVirtualNetwork
+
+func aSpoke(name, hubKey, cidr string) spoke {
+	return spoke{
+		HubKey:       hubKey,
+		Name:         String(name),
+		AddressSpace: []string{cidr},
+		Subnets:      make(map[string]hubnetworking.SpokeSubnet),
+	}
+}
+
+func anExistingSpoke(virtualNetworkId, hubKey, cidr string) spoke {
+	return spoke{
+		HubKey:           hubKey,
+		VirtualNetworkId: String(virtualNetworkId),
+		AddressSpace:     []string{cidr},
+		Subnets:          make(map[string]hubnetworking.SpokeSubnet),
+	}
+}
+
+func (s spoke) withSubnet(name string, addressPrefixes ...string) spoke {
+	s.Subnets[name] = hubnetworking.SpokeSubnet{AddressPrefixes: addressPrefixes}
+	return s
+}
+
+func (s spoke) withRoutedAddressPrefix(cidr string) spoke {
+	s.RoutedAddressPrefixes = append(s.RoutedAddressPrefixes, cidr)
+	return s
+}
+
+func (s spoke) withMeshRouting(b bool) spoke {
+	s.MeshRoutingEnabled = Bool(b)
+	return s
+}
+
+func (s spoke) withBgpRoutePropagation(b bool) spoke {
+	s.BgpRoutePropagationEnabled = Bool(b)
+	return s
+}
+
+func (s spoke) withRemoteGateways(b bool) spoke {
+	s.UseRemoteGateways = Bool(b)
+	return s
+}
+
+func (s spoke) withPrivateDnsZoneLinks(b bool) spoke {
+	s.PrivateDnsZoneLinksEnabled = Bool(b)
+	return s
+}
+
 type routeMap struct {
-	MeshRoutes []routeEntryOutput `mapstructure:"mesh_routes"`
-	UserRoutes []routeEntryOutput `mapstructure:"user_routes"`
+	BgpRoutePropagationEnabled bool               `mapstructure:"bgp_route_propagation_enabled"`
+	DefaultRoutes              []routeEntryOutput `mapstructure:"default_routes"`
+	MeshRoutes                 []routeEntryOutput `mapstructure:"mesh_routes"`
+	UserRoutes                 []routeEntryOutput `mapstructure:"user_routes"`
 }
 
 type routeEntryOutput struct {
@@ -480,6 +685,209 @@ func TestUnit_VnetWithUserRouteEntriesWouldProvisionUserRouteEntries(t *testing.
 	}
 }
 
+func TestUnit_DefaultRouteShouldShapeTheDefaultRouteOfTheHub(t *testing.T) {
+	inputs := []struct {
+		name     string
+		network  vnet
+		expected []routeEntryOutput
+	}{
+		{
+			name: "default route should go to the internet by default",
+			network: aVnet("vnet0", false).
+				withAddressSpace("10.0.0.0/16"),
+			expected: []routeEntryOutput{
+				{Name: "internet", AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"},
+			},
+		},
+		{
+			name: "default route of a firewall hub should go to the firewall private ip by default",
+			network: aVnet("vnet0", false).
+				withAddressSpace("10.0.0.0/16").
+				withFirewall(firewall{
+					SkuName:             "AZFW_VNet",
+					SkuTier:             "Standard",
+					SubnetAddressPrefix: "10.0.255.0/24",
+				}),
+			expected: []routeEntryOutput{
+				{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet0-fake-fw-private-ip")},
+			},
+		},
+		{
+			name: "internet default route of a firewall hub should bypass the firewall",
+			network: aVnet("vnet0", false).
+				withAddressSpace("10.0.0.0/16").
+				withFirewall(firewall{
+					SkuName:             "AZFW_VNet",
+					SkuTier:             "Standard",
+					SubnetAddressPrefix: "10.0.255.0/24",
+				}).
+				withDefaultRoute(defaultRoute{NextHopType: String("Internet")}),
+			expected: []routeEntryOutput{
+				{Name: "internet", AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"},
+			},
+		},
+		{
+			name: "virtual appliance default route should force tunnel to the nva",
+			network: aVnet("vnet0", false).
+				withAddressSpace("10.0.0.0/16").
+				withDefaultRoute(defaultRoute{NextHopType: String("VirtualAppliance"), NextHopIpAddress: String("10.0.0.5")}),
+			expected: []routeEntryOutput{
+				{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.0.0.5")},
+			},
+		},
+		{
+			name: "virtual network gateway default route should force tunnel to on-premises",
+			network: aVnet("vnet0", false).
+				withAddressSpace("10.0.0.0/16").
+				withDefaultRoute(defaultRoute{NextHopType: String("VirtualNetworkGateway")}),
+			expected: []routeEntryOutput{
+				{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualNetworkGateway"},
+			},
+		},
+		{
+			name: "none default route should leave 0.0.0.0/0 to user routes",
+			network: aVnet("vnet0", false).
+				withAddressSpace("10.0.0.0/16").
+				withDefaultRoute(defaultRoute{NextHopType: String("None")}).
+				withUserRouteEntry(routeEntry{Name: "on-premises", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualNetworkGateway"}),
+			expected: []routeEntryOutput{},
+		},
+	}
+
+	for i := 0; i < len(inputs); i++ {
+		input := inputs[i]
+		t.Run(input.name, func(t *testing.T) {
+			varFilePath := vars{
+				"hub_virtual_networks": map[string]any{
+					input.network.Name: input.network,
+				},
+			}.toFile(t)
+			defer func() { _ = os.Remove(varFilePath) }()
+			test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+				Upgrade:  true,
+				VarFiles: []string{varFilePath},
+				Logger:   logger.Discard,
+			}, func(t *testing.T, output test_helper.TerraformOutput) {
+				var actual map[string]routeMap
+				err := mapstructure.Decode(output["route_map"], &actual)
+				require.NoError(t, err)
+				assert.Equal(t, input.expected, actual[input.network.Name].DefaultRoutes)
+				assert.Equal(t, []any{}, output["default_route_conflicts"])
+			})
+		})
+	}
+}
+
+func TestUnit_FirewallSubnetShouldGetItsOwnRouteTable(t *testing.T) {
+	hubs := hubnetworking.HubVirtualNetworks{
+		"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", true).
+			withResourceGroupName("rg0").
+			withAddressSpace("10.0.0.0/16").
+			withRoutingAddressSpace("10.0.0.0/16").
+			withFirewall(firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.0.255.0/24"})),
+		"vnet1": hubnetworking.HubVirtualNetwork(aVnet("vnet1", true).
+			withResourceGroupName("rg1").
+			withAddressSpace("10.1.0.0/16").
+			withRoutingAddressSpace("10.1.0.0/16").
+			withFirewall(firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.1.255.0/24", RouteTableName: String("rt-afw")})),
+		"vnet2": hubnetworking.HubVirtualNetwork(aVnet("vnet2", true).
+			withResourceGroupName("rg2").
+			withAddressSpace("10.2.0.0/16").
+			withFirewall(firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.2.255.0/24", SubnetRouteTableId: String("external_route_table_id")})),
+	}
+	varFilePath := variables(t, hubnetworking.Variables{HubVirtualNetworks: hubs}).toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		var actual map[string]struct {
+			Location          string             `mapstructure:"location"`
+			Name              string             `mapstructure:"name"`
+			ResourceGroupName string             `mapstructure:"resource_group_name"`
+			Routes            []routeEntryOutput `mapstructure:"routes"`
+		}
+		require.NoError(t, mapstructure.Decode(output["firewall_route_tables"], &actual))
+		require.Len(t, actual, 2, "the firewall with subnet_route_table_id keeps its route table")
+		assert.Equal(t, "route-afw-vnet0", actual["vnet0"].Name)
+		assert.Equal(t, "rg0", actual["vnet0"].ResourceGroupName)
+		assert.Equal(t, []routeEntryOutput{
+			{Name: "internet", AddressPrefix: "0.0.0.0/0", NextHopType: "Internet"},
+			{Name: "vnet1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet1-fake-fw-private-ip")},
+		}, actual["vnet0"].Routes)
+		assert.Equal(t, "rt-afw", actual["vnet1"].Name)
+
+		var routes map[string]routeMap
+		require.NoError(t, mapstructure.Decode(output["route_map"], &routes))
+		assert.Equal(t, []routeEntryOutput{
+			{Name: "default", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet0-fake-fw-private-ip")},
+		}, routes["vnet0"].DefaultRoutes, "the workloads of the hub go through its firewall")
+	})
+}
+
+func TestUnit_BgpRoutePropagationShouldFlowToTheRouteTables(t *testing.T) {
+	varFilePath := vars{
+		"hub_virtual_networks": map[string]vnet{
+			"vnet0": aVnet("vnet0", true).
+				withResourceGroupName("rg-vnet0").
+				withAddressSpace("10.0.0.0/16").
+				withFirewall(firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.0.255.0/24", RouteTableBgpRoutePropagationEnabled: Bool(false)}).
+				withUserRouteEntry(routeEntry{Name: "onprem", AddressPrefix: "192.168.0.0/16", NextHopType: "VirtualNetworkGateway", HasBgpOverride: Bool(true)}),
+			"vnet1": aVnet("vnet1", true).
+				withResourceGroupName("rg-vnet1").
+				withAddressSpace("10.1.0.0/16").
+				withHubRouterIpAddress("10.1.0.4"),
+			"vnet2": aVnet("vnet2", true).
+				withResourceGroupName("rg-vnet2").
+				withAddressSpace("10.2.0.0/16").
+				withHubRouterIpAddress("10.2.0.4").
+				withBgpRoutePropagation(false),
+		},
+		"spoke_virtual_networks": map[string]spoke{
+			"spoke0": aSpoke("spoke0", "vnet0", "172.20.0.0/16"),
+			"spoke1": aSpoke("spoke1", "vnet1", "172.21.0.0/16"),
+			"spoke2": aSpoke("spoke2", "vnet1", "172.22.0.0/16").withBgpRoutePropagation(false),
+			"spoke3": aSpoke("spoke3", "vnet2", "172.23.0.0/16").withBgpRoutePropagation(true),
+		},
+	}.toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		var routes map[string]routeMap
+		require.NoError(t, mapstructure.Decode(output["route_map"], &routes))
+		assert.False(t, routes["vnet0"].BgpRoutePropagationEnabled, "a bgp override entry stops the propagation")
+		assert.True(t, routes["vnet1"].BgpRoutePropagationEnabled)
+		assert.False(t, routes["vnet2"].BgpRoutePropagationEnabled)
+		var userRoutes map[string]struct {
+			UserRoutes []struct {
+				HasBgpOverride bool `mapstructure:"has_bgp_override"`
+			} `mapstructure:"user_routes"`
+		}
+		require.NoError(t, mapstructure.Decode(output["route_map"], &userRoutes))
+		require.Len(t, userRoutes["vnet0"].UserRoutes, 1)
+		assert.True(t, userRoutes["vnet0"].UserRoutes[0].HasBgpOverride)
+
+		var firewallRouteTables map[string]struct {
+			BgpRoutePropagationEnabled bool `mapstructure:"bgp_route_propagation_enabled"`
+		}
+		require.NoError(t, mapstructure.Decode(output["firewall_route_tables"], &firewallRouteTables))
+		assert.False(t, firewallRouteTables["vnet0"].BgpRoutePropagationEnabled)
+
+		var spokes map[string]struct {
+			BgpRoutePropagationEnabled bool `mapstructure:"bgp_route_propagation_enabled"`
+		}
+		require.NoError(t, mapstructure.Decode(output["spokes"], &spokes))
+		assert.False(t, spokes["spoke0"].BgpRoutePropagationEnabled, "spokes default to their hub")
+		assert.True(t, spokes["spoke1"].BgpRoutePropagationEnabled)
+		assert.False(t, spokes["spoke2"].BgpRoutePropagationEnabled)
+		assert.True(t, spokes["spoke3"].BgpRoutePropagationEnabled)
+	})
+}
+
 func TestUnit_SubnetAssignGeneratedRouteTableWouldProvisionGeneratedRouteTableAssociation(t *testing.T) {
 	inputs := []struct {
 		name     string
@@ -507,6 +915,26 @@ func TestUnit_SubnetAssignGeneratedRouteTableWouldProvisionGeneratedRouteTableAs
 				},
 			},
 		},
+		{
+			name: "no association to generated route table sending the default route through the firewall for bastion and route server subnets",
+			network: aVnet("vnet0", false).
+				withAddressSpace("10.0.0.0/16").
+				withFirewall(firewall{
+					SkuName:             "AZFW_VNet",
+					SkuTier:             "Standard",
+					SubnetAddressPrefix: "10.0.0.0/26",
+				}).
+				withSubnet("workload", aSubnet("10.0.1.0/24").UseGenerateRouteTable()).
+				withSubnet(hubnetworking.BastionSubnetName, aSubnet("10.0.2.0/26").UseGenerateRouteTable()).
+				withSubnet(hubnetworking.RouteServerSubnetName, aSubnet("10.0.3.0/27").UseGenerateRouteTable()),
+			expected: map[string]any{
+				"vnet0-workload": map[string]any{
+					"name":           "vnet0-workload",
+					"subnet_id":      "workload_id",
+					"route_table_id": "vnet0_route_table_id",
+				},
+			},
+		},
 	}
 	for i := 0; i < len(inputs); i++ {
 		input := inputs[i]
@@ -592,7 +1020,7 @@ func TestUnit_VnetWithFirewallShouldCreatePublicIp(t *testing.T) {
 				withAddressSpace("10.0.0.0/16").
 				withSubnet("AzureFirewallSubnet", subnet{
 					AddressPrefixes:           []string{"10.0.255.0/24"},
-					AssignGeneratedRouteTable: false,
+					AssignGeneratedRouteTable: Bool(false),
 					ExternalRouteTableId:      nil,
 				}),
 			expected: map[string]any{},
@@ -606,16 +1034,19 @@ func TestUnit_VnetWithFirewallShouldCreatePublicIp(t *testing.T) {
 					SkuName:                       "AZFW_VNet",
 					SkuTier:                       "Basic",
 					SubnetAddressPrefix:           "10.0.255.0/24",
-					ManagementSubnetAddressPrefix: "10.0.1.0/24",
+					ManagementSubnetAddressPrefix: String("10.0.1.0/24"),
 				}),
 			expected: map[string]any{
 				"vnet": map[string]any{
-					"location":            "eastus",
-					"name":                "pip-afw-vnet",
-					"resource_group_name": "rg0",
-					"ip_version":          "IPv4",
-					"sku_tier":            "Regional",
-					"zones":               nil,
+					"location":             "eastus",
+					"name":                 "pip-afw-vnet",
+					"resource_group_name":  "rg0",
+					"ip_version":           "IPv4",
+					"public_ip_prefix_id":  nil,
+					"public_ip_prefix_key": nil,
+					"sku_tier":             "Regional",
+					"tags":                 nil,
+					"zones":                nil,
 				},
 			},
 		},
@@ -675,54 +1106,259 @@ func TestUnit_VnetWithFirewallShouldCreateFirewall(t *testing.T) {
 					DefaultIpConfig: &IpConfigOutputEntry{
 						Name: "default",
 					},
+					IpConfigs: []IpConfigOutputEntry{},
 				},
 			},
 		},
-	}
-
-	for i := 0; i < len(inputs); i++ {
-		input := inputs[i]
-		t.Run(input.name, func(t *testing.T) {
-			varFilePath := vars{
-				"hub_virtual_networks": map[string]any{
-					input.network.Name: input.network,
-				},
-			}.toFile(t)
-			defer func() { _ = os.Remove(varFilePath) }()
-			test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
-				Upgrade:  true,
-				VarFiles: []string{varFilePath},
-				Logger:   logger.Discard,
-			}, func(t *testing.T, output test_helper.TerraformOutput) {
-				actual := make(map[string]firewallOutputEntry, 0)
-				err := mapstructure.Decode(output["firewalls"], &actual)
-				require.NoError(t, err)
-				assert.Equal(t, input.expected, actual)
-			})
-		})
-	}
-}
-
-func TestUnit_RoutingAddressSpaceShouldGenerateMeshRoutes(t *testing.T) {
-	inputs := []struct {
-		name     string
-		network  []vnet
-		expected map[string][]routeEntryOutput
-	}{
 		{
-			name: "vnet without firewall should not create firewall",
-			network: []vnet{
-				aVnet("vnet0", true).
-					withAddressSpace("10.0.0.0/16").
-					withRoutingAddressSpace("10.0.0.0/16").
-					withRoutingAddressSpace("192.168.0.0/24").
-					withHubRouterIpAddress("fake_fw_vnet0_ip"),
-				aVnet("vnet1", true).
-					withAddressSpace("10.1.0.0/16").
-					withRoutingAddressSpace("10.1.0.0/16").
-					withRoutingAddressSpace("192.168.1.0/24").
-					withHubRouterIpAddress("fake_fw_vnet1_ip"),
-			},
+			name: "default ip configuration should not take the name of the management ip configuration",
+			network: aVnet("vnet", false).
+				withResourceGroupName("rg0").
+				withAddressSpace("10.0.0.0/16").
+				withFirewall(firewall{
+					SkuName:             "AZFW_VNet",
+					SkuTier:             "Standard",
+					SubnetAddressPrefix: "10.0.255.0/24",
+					ManagementIpConfiguration: &hubnetworking.FirewallIpConfiguration{
+						Name: String("mgmt"),
+					},
+				}),
+			expected: map[string]firewallOutputEntry{
+				"vnet": {
+					Name:                "afw-vnet",
+					SkuName:             "AZFW_VNet",
+					SkuTier:             "Standard",
+					SubnetAddressPrefix: "10.0.255.0/24",
+					ThreatIntelMode:     "Alert",
+					DefaultIpConfig: &IpConfigOutputEntry{
+						Name: "default",
+					},
+					IpConfigs: []IpConfigOutputEntry{},
+				},
+			},
+		},
+		{
+			name: "firewall with additional ip configurations should list every ip configuration",
+			network: aVnet("vnet", false).
+				withResourceGroupName("rg0").
+				withAddressSpace("10.0.0.0/16").
+				withFirewall(firewall{
+					SkuName:             "AZFW_VNet",
+					SkuTier:             "Standard",
+					SubnetAddressPrefix: "10.0.255.0/24",
+					DefaultIpConfiguration: &hubnetworking.FirewallIpConfiguration{
+						Name: String("primary"),
+					},
+					IpConfigurations: map[string]hubnetworking.FirewallAdditionalIpConfiguration{
+						"dnat": {},
+						"snat": {},
+					},
+				}),
+			expected: map[string]firewallOutputEntry{
+				"vnet": {
+					Name:                "afw-vnet",
+					SkuName:             "AZFW_VNet",
+					SkuTier:             "Standard",
+					SubnetAddressPrefix: "10.0.255.0/24",
+					ThreatIntelMode:     "Alert",
+					DefaultIpConfig: &IpConfigOutputEntry{
+						Name: "primary",
+					},
+					IpConfigs: []IpConfigOutputEntry{
+						{Name: "dnat"},
+						{Name: "snat"},
+					},
+				},
+			},
+		},
+	}
+
+	for i := 0; i < len(inputs); i++ {
+		input := inputs[i]
+		t.Run(input.name, func(t *testing.T) {
+			varFilePath := vars{
+				"hub_virtual_networks": map[string]any{
+					input.network.Name: input.network,
+				},
+			}.toFile(t)
+			defer func() { _ = os.Remove(varFilePath) }()
+			test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+				Upgrade:  true,
+				VarFiles: []string{varFilePath},
+				Logger:   logger.Discard,
+			}, func(t *testing.T, output test_helper.TerraformOutput) {
+				actual := make(map[string]firewallOutputEntry, 0)
+				err := mapstructure.Decode(output["firewalls"], &actual)
+				require.NoError(t, err)
+				assert.Equal(t, input.expected, actual)
+			})
+		})
+	}
+}
+
+func TestUnit_FirewallIpConfigurationsShouldCreatePublicIpsFromPrefix(t *testing.T) {
+	existingPrefixId := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg0/providers/Microsoft.Network/publicIPPrefixes/existing"
+	hub := aVnet("vnet", false).
+		withResourceGroupName("rg0").
+		withAddressSpace("10.0.0.0/16").
+		withFirewall(firewall{
+			SkuName:             "AZFW_VNet",
+			SkuTier:             "Standard",
+			SubnetAddressPrefix: "10.0.255.0/24",
+			IpConfigurations: map[string]hubnetworking.FirewallAdditionalIpConfiguration{
+				"snat": {
+					PublicIpConfig: &hubnetworking.PublicIpConfig{Zones: []string{"1", "2", "3"}},
+				},
+				"dnat": {
+					Tags: map[string]string{"purpose": "dnat"},
+					PublicIpConfig: &hubnetworking.PublicIpConfig{
+						Name:             String("pip-dnat"),
+						PublicIpPrefixId: String(existingPrefixId),
+					},
+				},
+			},
+			PublicIpPrefix: &hubnetworking.FirewallPublicIpPrefix{
+				PrefixLength: Int(31),
+				Zones:        []string{"1", "2", "3"},
+			},
+		})
+	varFilePath := vars{
+		"hub_virtual_networks": map[string]any{
+			hub.Name: hub,
+		},
+	}.toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		assert.Equal(t, map[string]any{
+			"vnet-dnat": map[string]any{
+				"key":                   "vnet-dnat",
+				"hub_key":               "vnet",
+				"ip_configuration_name": "dnat",
+				"location":              "eastus",
+				"name":                  "pip-dnat",
+				"resource_group_name":   "rg0",
+				"tags":                  map[string]any{"purpose": "dnat"},
+				"ip_version":            "IPv4",
+				"public_ip_prefix_id":   existingPrefixId,
+				"public_ip_prefix_key":  nil,
+				"sku_tier":              "Regional",
+				"zones":                 nil,
+			},
+			"vnet-snat": map[string]any{
+				"key":                   "vnet-snat",
+				"hub_key":               "vnet",
+				"ip_configuration_name": "snat",
+				"location":              "eastus",
+				"name":                  "pip-afw-vnet-snat",
+				"resource_group_name":   "rg0",
+				"tags":                  nil,
+				"ip_version":            "IPv4",
+				"public_ip_prefix_id":   nil,
+				"public_ip_prefix_key":  "vnet",
+				"sku_tier":              "Regional",
+				"zones":                 []any{"1", "2", "3"},
+			},
+		}, output["fw_ip_configuration_pip"])
+		assert.Equal(t, map[string]any{
+			"vnet": map[string]any{
+				"ip_version":          "IPv4",
+				"location":            "eastus",
+				"name":                "ippre-afw-vnet",
+				"prefix_length":       float64(31),
+				"resource_group_name": "rg0",
+				"tags":                nil,
+				"zones":               []any{"1", "2", "3"},
+			},
+		}, output["fw_public_ip_prefix"])
+		assert.Equal(t, map[string]any{
+			"vnet": map[string]any{
+				"public_ip_addresses": []any{"pip-afw-vnet_ip_address", "pip-dnat_ip_address", "pip-afw-vnet-snat_ip_address"},
+				"public_ip_prefix_id": "ippre-afw-vnet_id",
+			},
+		}, output["firewall_public_ips"])
+
+		actual := make(map[string]firewallOutputEntry)
+		require.NoError(t, mapstructure.Decode(output["firewalls"], &actual))
+		assert.Equal(t, []IpConfigOutputEntry{{Name: "dnat"}, {Name: "snat"}}, actual["vnet"].IpConfigs)
+	})
+}
+
+func TestUnit_FirewallIpv6PublicIpsShouldBeAllocatedFromPrefixOfTheirVersion(t *testing.T) {
+	hub := aVnet("vnet", false).
+		withResourceGroupName("rg0").
+		withAddressSpace("10.0.0.0/16").
+		withFirewall(firewall{
+			SkuName:             "AZFW_VNet",
+			SkuTier:             "Standard",
+			SubnetAddressPrefix: "10.0.255.0/24",
+			IpConfigurations: map[string]hubnetworking.FirewallAdditionalIpConfiguration{
+				"v6":    {PublicIpConfig: &hubnetworking.PublicIpConfig{IpVersion: String("IPv6")}},
+				"v6bis": {PublicIpConfig: &hubnetworking.PublicIpConfig{IpVersion: String("IPv6")}},
+			},
+			PublicIpPrefix: &hubnetworking.FirewallPublicIpPrefix{
+				IpVersion:    String("IPv6"),
+				PrefixLength: Int(127),
+			},
+		})
+	varFilePath := vars{
+		"hub_virtual_networks": map[string]any{
+			hub.Name: hub,
+		},
+	}.toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		var prefixes map[string]struct {
+			IpVersion    string `mapstructure:"ip_version"`
+			PrefixLength int    `mapstructure:"prefix_length"`
+		}
+		require.NoError(t, mapstructure.Decode(output["fw_public_ip_prefix"], &prefixes))
+		assert.Equal(t, "IPv6", prefixes["vnet"].IpVersion)
+		assert.Equal(t, 127, prefixes["vnet"].PrefixLength)
+
+		type pip struct {
+			IpVersion         string  `mapstructure:"ip_version"`
+			PublicIpPrefixKey *string `mapstructure:"public_ip_prefix_key"`
+		}
+		var defaultPips map[string]pip
+		require.NoError(t, mapstructure.Decode(output["fw_default_ip_configuration_pip"], &defaultPips))
+		assert.Equal(t, pip{IpVersion: "IPv4"}, defaultPips["vnet"], "the IPv4 default public IP is not allocated from the IPv6 prefix")
+		var pips map[string]pip
+		require.NoError(t, mapstructure.Decode(output["fw_ip_configuration_pip"], &pips))
+		assert.Equal(t, map[string]pip{
+			"vnet-v6":    {IpVersion: "IPv6", PublicIpPrefixKey: String("vnet")},
+			"vnet-v6bis": {IpVersion: "IPv6", PublicIpPrefixKey: String("vnet")},
+		}, pips)
+	})
+}
+
+func TestUnit_RoutingAddressSpaceShouldGenerateMeshRoutes(t *testing.T) {
+	inputs := []struct {
+		name     string
+		network  []vnet
+		expected map[string][]routeEntryOutput
+	}{
+		{
+			name: "vnet without firewall should not create firewall",
+			network: []vnet{
+				aVnet("vnet0", true).
+					withAddressSpace("10.0.0.0/16").
+					withRoutingAddressSpace("10.0.0.0/16").
+					withRoutingAddressSpace("192.168.0.0/24").
+					withHubRouterIpAddress("fake_fw_vnet0_ip"),
+				aVnet("vnet1", true).
+					withAddressSpace("10.1.0.0/16").
+					withRoutingAddressSpace("10.1.0.0/16").
+					withRoutingAddressSpace("192.168.1.0/24").
+					withHubRouterIpAddress("fake_fw_vnet1_ip"),
+			},
 			expected: map[string][]routeEntryOutput{
 				"vnet0": {
 					{
@@ -788,22 +1424,1850 @@ func TestUnit_RoutingAddressSpaceShouldGenerateMeshRoutes(t *testing.T) {
 	}
 }
 
-func varFile(t *testing.T, inputs map[string]interface{}, path string) string {
-	cleanPath := filepath.Clean(path)
-	varFile, err := os.Create(cleanPath)
-	require.Nil(t, err)
-	c, err := json.Marshal(inputs)
-	require.Nil(t, err)
-	_, err = varFile.Write(c)
-	require.Nil(t, err)
-	_ = varFile.Close()
-	varFilePath, err := filepath.Abs(cleanPath)
-	require.Nil(t, err)
-	return varFilePath
+func TestUnit_DualStackMeshShouldRouteIpv6PrefixesThroughIpv6Routers(t *testing.T) {
+	hubs := hubnetworking.HubVirtualNetworks{
+		"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", true).
+			withResourceGroupName("rg0").
+			withAddressSpace("10.0.0.0/16").
+			withAddressSpace("fd00:0:0::/56").
+			withRoutingAddressSpace("10.0.0.0/16").
+			withRoutingAddressSpace("fd00:0:0::/48").
+			withSubnet("app", subnet{AddressPrefixes: []string{"10.0.1.0/24", "fd00:0:0:1::/64"}, AssignGeneratedRouteTable: Bool(true)}).
+			withHubRouterIpv6Address("fd00:0:0::4").
+			withFirewall(firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.0.255.0/24"})),
+		"vnet1": hubnetworking.HubVirtualNetwork(aVnet("vnet1", true).
+			withResourceGroupName("rg0").
+			withAddressSpace("10.1.0.0/16").
+			withAddressSpace("fd00:0:1::/56").
+			withRoutingAddressSpace("10.1.0.0/16").
+			withRoutingAddressSpace("fd00:0:1::/48").
+			withHubRouterIpAddress("10.1.0.4").
+			withHubRouterIpv6Address("fd00:0:1::4")),
+		"vnet2": hubnetworking.HubVirtualNetwork(aVnet("vnet2", true).
+			withResourceGroupName("rg0").
+			withAddressSpace("10.2.0.0/16").
+			withAddressSpace("fd00:0:2::/56").
+			withRoutingAddressSpace("10.2.0.0/16").
+			withRoutingAddressSpace("fd00:0:2::/48").
+			withHubRouterIpAddress("10.2.0.4")),
+	}
+	spokes := hubnetworking.SpokeVirtualNetworks{
+		"spoke0": hubnetworking.SpokeVirtualNetwork(aSpoke("spoke0", "vnet1", "172.20.0.0/16").withRoutedAddressPrefix("fd00:ffff::/48")),
+		"spoke1": hubnetworking.SpokeVirtualNetwork(aSpoke("spoke1", "vnet0", "fd00:1::/48")),
+	}
+	v := hubnetworking.Variables{HubVirtualNetworks: hubs, SpokeVirtualNetworks: spokes}
+	varFilePath := variables(t, v).toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		assert.Empty(t, output["cidr_conflicts"])
+
+		var routes map[string]routeMap
+		require.NoError(t, mapstructure.Decode(output["route_map"], &routes))
+		assert.Equal(t, []routeEntryOutput{
+			{Name: "vnet1-10.1.0.0-16", AddressPrefix: "10.1.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.1.0.4")},
+			{Name: "vnet1-fd00-0-1---48", AddressPrefix: "fd00:0:1::/48", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00:0:1::4")},
+			{Name: "spoke0-172.20.0.0-16", AddressPrefix: "172.20.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.1.0.4")},
+			{Name: "vnet2-10.2.0.0-16", AddressPrefix: "10.2.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.2.0.4")},
+		}, routes["vnet0"].MeshRoutes, "vnet2 has no IPv6 router to route fd00:0:2::/48 to")
+		assert.Contains(t, routes["vnet0"].DefaultRoutes, routeEntryOutput{Name: "default-ipv6", AddressPrefix: "::/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00:0:0::4")}, "the firewall has no IPv6 address to route ::/0 to")
+		for _, route := range routes["vnet1"].DefaultRoutes {
+			assert.NotEqual(t, "::/0", route.AddressPrefix, "vnet1 sends 0.0.0.0/0 to the internet")
+		}
+		for k, table := range v.RouteMap(fakeFirewallPrivateIps(hubs)) {
+			expected := make([]routeEntryOutput, 0, len(table.MeshRoutes))
+			for _, route := range table.MeshRoutes {
+				expected = append(expected, routeEntryOutput(route))
+			}
+			assert.Equal(t, expected, routes[k].MeshRoutes, k)
+			expected = make([]routeEntryOutput, 0, len(table.DefaultRoutes))
+			for _, route := range table.DefaultRoutes {
+				expected = append(expected, routeEntryOutput(route))
+			}
+			assert.Equal(t, expected, routes[k].DefaultRoutes, k)
+		}
+
+		var spokeRoutes map[string][]routeEntryOutput
+		require.NoError(t, mapstructure.Decode(output["spoke_route_map"], &spokeRoutes))
+		for k, routes := range v.SpokeRouteMap(fakeFirewallPrivateIps(hubs)) {
+			expected := make([]routeEntryOutput, 0, len(routes))
+			for _, route := range routes {
+				expected = append(expected, routeEntryOutput(route))
+			}
+			assert.Equal(t, expected, spokeRoutes[k], k)
+		}
+		assert.Contains(t, spokeRoutes["spoke0"], routeEntryOutput{Name: "routed-fd00-ffff---48", AddressPrefix: "fd00:ffff::/48", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00:0:1::4")})
+		assert.Contains(t, spokeRoutes["spoke1"], routeEntryOutput{Name: "default-ipv6", AddressPrefix: "::/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("fd00:0:0::4")})
+	})
 }
 
-func String(s string) *string {
-	return &s
+func TestUnit_CidrConflictsShouldReportOffendingKeys(t *testing.T) {
+	inputs := []struct {
+		name     string
+		networks map[string]vnet
+		expected []cidrConflictOutput
+	}{
+		{
+			name: "no conflict",
+			networks: map[string]vnet{
+				"vnet0": aVnet("vnet0", true).
+					withAddressSpace("10.0.0.0/16").
+					withRoutingAddressSpace("10.0.0.0/8").
+					withSubnet("subnet0", aSubnet("10.0.0.0/24")).
+					withFirewall(firewall{
+						SkuName:             "AZFW_VNet",
+						SkuTier:             "Standard",
+						SubnetAddressPrefix: "10.0.1.0/24",
+					}),
+				"vnet1": aVnet("vnet1", true).withAddressSpace("10.1.0.0/16"),
+			},
+			expected: []cidrConflictOutput{},
+		},
+		{
+			name: "overlapping hubs",
+			networks: map[string]vnet{
+				"vnet0": aVnet("vnet0", true).withAddressSpace("10.0.0.0/16"),
+				"vnet1": aVnet("vnet1", true).withAddressSpace("10.0.0.0/8"),
+			},
+			expected: []cidrConflictOutput{
+				{
+					HubKeys:    []string{"vnet0", "vnet1"},
+					SubnetKeys: []string{},
+					Message:    "address_space 10.0.0.0/16 of hub vnet0 overlaps with address_space 10.0.0.0/8 of hub vnet1",
+				},
+			},
+		},
+		{
+			name: "subnet outside of vnet and colliding with firewall subnet",
+			networks: map[string]vnet{
+				"vnet0": aVnet("vnet0", true).
+					withAddressSpace("10.0.0.0/16").
+					withSubnet("outside", aSubnet("10.1.0.0/24")).
+					withSubnet("subnet0", aSubnet("10.0.1.0/25")).
+					withFirewall(firewall{
+						SkuName:             "AZFW_VNet",
+						SkuTier:             "Standard",
+						SubnetAddressPrefix: "10.0.1.0/24",
+					}),
+			},
+			expected: []cidrConflictOutput{
+				{
+					HubKeys:    []string{"vnet0"},
+					SubnetKeys: []string{"outside"},
+					Message:    "address prefix 10.1.0.0/24 of subnet outside in hub vnet0 is not within the address_space of the hub",
+				},
+				{
+					HubKeys:    []string{"vnet0"},
+					SubnetKeys: []string{"subnet0", "AzureFirewallSubnet"},
+					Message:    "address prefix 10.0.1.0/25 of subnet subnet0 overlaps with address prefix 10.0.1.0/24 of subnet AzureFirewallSubnet in hub vnet0",
+				},
+			},
+		},
+		{
+			name: "routing address space not containing vnet address space",
+			networks: map[string]vnet{
+				"vnet0": aVnet("vnet0", true).
+					withAddressSpace("10.0.0.0/16").
+					withRoutingAddressSpace("192.168.0.0/16"),
+			},
+			expected: []cidrConflictOutput{
+				{
+					HubKeys:    []string{"vnet0"},
+					SubnetKeys: []string{},
+					Message:    "address_space 10.0.0.0/16 of hub vnet0 is not within its routing_address_space",
+				},
+			},
+		},
+		{
+			name: "dual-stack hubs should only conflict within an ip version",
+			networks: map[string]vnet{
+				"vnet0": aVnet("vnet0", true).
+					withAddressSpace("10.0.0.0/16").
+					withAddressSpace("fd00:0:0::/56").
+					withRoutingAddressSpace("10.0.0.0/8").
+					withRoutingAddressSpace("fd00::/40").
+					withSubnet("dualstack", subnet{AddressPrefixes: []string{"10.0.0.0/24", "fd00::/64"}, AssignGeneratedRouteTable: Bool(false)}).
+					withSubnet("outside", aSubnet("fd00:0:1::/64")),
+				"vnet1": aVnet("vnet1", true).
+					withAddressSpace("10.1.0.0/16").
+					withAddressSpace("fd00:0:1::/56"),
+			},
+			expected: []cidrConflictOutput{
+				{
+					HubKeys:    []string{"vnet0"},
+					SubnetKeys: []string{"outside"},
+					Message:    "address prefix fd00:0:1::/64 of subnet outside in hub vnet0 is not within the address_space of the hub",
+				},
+			},
+		},
+	}
+
+	for i := 0; i < len(inputs); i++ {
+		input := inputs[i]
+		t.Run(input.name, func(t *testing.T) {
+			varFilePath := vars{
+				"hub_virtual_networks": input.networks,
+			}.toFile(t)
+			defer func() { _ = os.Remove(varFilePath) }()
+			test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+				Upgrade:  true,
+				VarFiles: []string{varFilePath},
+				Logger:   logger.Discard,
+			}, func(t *testing.T, output test_helper.TerraformOutput) {
+				actual := make([]cidrConflictOutput, 0)
+				err := mapstructure.Decode(output["cidr_conflicts"], &actual)
+				require.NoError(t, err)
+				assert.Equal(t, input.expected, actual)
+				hubs := make(hubnetworking.HubVirtualNetworks)
+				for k, n := range input.networks {
+					hubs[k] = hubnetworking.HubVirtualNetwork(n)
+				}
+				goConflicts := make([]cidrConflictOutput, 0)
+				for _, c := range hubnetworking.ValidateCidrs(hubs) {
+					goConflicts = append(goConflicts, cidrConflictOutput{
+						HubKeys:    c.HubKeys,
+						SubnetKeys: append([]string{}, c.SubnetKeys...),
+						Message:    c.Message,
+					})
+				}
+				assert.Equal(t, actual, goConflicts)
+			})
+		})
+	}
+}
+
+func TestUnit_MeshPeeringSettingsShouldOverrideDefaultPeeringFlags(t *testing.T) {
+	varFilePath := vars{
+		"hub_virtual_networks": map[string]vnet{
+			"vnet0": aVnet("vnet0", true).withAddressSpace("10.0.0.0/16").withGatewaySubnet("10.0.255.0/27"),
+			"vnet1": aVnet("vnet1", true).withAddressSpace("10.1.0.0/16").
+				withMeshPeeringSettings(peeringSettings{}.allowForwardedTraffic(false).useRemoteGateways(true)),
+			"vnet2": aVnet("vnet2", true).withAddressSpace("10.2.0.0/16").
+				withMeshPeeringOverride("vnet0", peeringSettings{}.allowVirtualNetworkAccess(false)),
+		},
+		"hub_mesh_topology": hubnetworking.MeshTopology{
+			Type:          String(hubnetworking.MeshTopologyHubAndSpoke),
+			TransitHubKey: String("vnet0"),
+		},
+	}.toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		var peerings map[string]peeringOutput
+		err := mapstructure.Decode(output["hub_peering_map"], &peerings)
+		require.NoError(t, err)
+		flags := func(p peeringOutput) []bool {
+			return []bool{p.AllowVirtualNetworkAccess, p.AllowForwardedTraffic, p.AllowGatewayTransit, p.UseRemoteGateways}
+		}
+		assert.Equal(t, []bool{true, true, true, false}, flags(peerings["vnet0-vnet1"]))
+		assert.Equal(t, []bool{true, true, true, false}, flags(peerings["vnet0-vnet2"]))
+		assert.Equal(t, []bool{true, false, false, true}, flags(peerings["vnet1-vnet0"]))
+		assert.Equal(t, []bool{false, true, true, false}, flags(peerings["vnet2-vnet0"]))
+		var conflicts []peeringConflictOutput
+		err = mapstructure.Decode(output["peering_conflicts"], &conflicts)
+		require.NoError(t, err)
+		assert.Empty(t, conflicts)
+	})
+}
+
+func TestUnit_PeeringConflictsShouldReportRemoteGatewaysOnBothSides(t *testing.T) {
+	useRemoteGateways := peeringSettings{}.allowGatewayTransit(true).useRemoteGateways(true)
+	varFilePath := vars{
+		"hub_virtual_networks": map[string]vnet{
+			"vnet0": aVnet("vnet0", true).withAddressSpace("10.0.0.0/16").withGatewaySubnet("10.0.255.0/27").withMeshPeeringSettings(useRemoteGateways),
+			"vnet1": aVnet("vnet1", true).withAddressSpace("10.1.0.0/16").withGatewaySubnet("10.1.255.0/27").withMeshPeeringSettings(useRemoteGateways),
+		},
+	}.toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		var conflicts []peeringConflictOutput
+		err := mapstructure.Decode(output["peering_conflicts"], &conflicts)
+		require.NoError(t, err)
+		assert.Equal(t, []peeringConflictOutput{
+			{PeeringNames: []string{"vnet0-vnet1", "vnet1-vnet0"}, Message: "peerings vnet0-vnet1 and vnet1-vnet0 both set use_remote_gateways"},
+			{PeeringNames: []string{"vnet0-vnet1"}, Message: "peering vnet0-vnet1 sets use_remote_gateways but hub vnet0 has a gateway of its own"},
+			{PeeringNames: []string{"vnet1-vnet0"}, Message: "peering vnet1-vnet0 sets use_remote_gateways but hub vnet1 has a gateway of its own"},
+		}, conflicts)
+	})
+}
+
+func TestUnit_HubMeshTopologyShouldShapePeeringsAndMeshRoutes(t *testing.T) {
+	networks := map[string]vnet{
+		"vnet0":       aVnet("vnet0", true).withAddressSpace("10.0.0.0/16").withRoutingAddressSpace("10.0.0.0/16").withHubRouterIpAddress("vnet0-router-ip"),
+		"vnet1":       aVnet("vnet1", true).withAddressSpace("10.1.0.0/16").withRoutingAddressSpace("10.1.0.0/16").withHubRouterIpAddress("vnet1-router-ip"),
+		"vnet2":       aVnet("vnet2", true).withAddressSpace("10.2.0.0/16").withRoutingAddressSpace("10.2.0.0/16").withHubRouterIpAddress("vnet2-router-ip"),
+		"nonMeshVnet": aVnet("nonMeshVnet", false).withAddressSpace("10.3.0.0/16").withRoutingAddressSpace("10.3.0.0/16"),
+	}
+	inputs := []struct {
+		name             string
+		topology         *hubnetworking.MeshTopology
+		expectedPeerings []string
+		// expectedNextHops maps a source hub to the next hop of its mesh route towards each destination hub.
+		expectedNextHops map[string]map[string]string
+	}{
+		{
+			name:             "full mesh",
+			topology:         nil,
+			expectedPeerings: []string{"vnet0-vnet1", "vnet0-vnet2", "vnet1-vnet0", "vnet1-vnet2", "vnet2-vnet0", "vnet2-vnet1"},
+			expectedNextHops: map[string]map[string]string{
+				"vnet0":       {"vnet1": "vnet1-router-ip", "vnet2": "vnet2-router-ip"},
+				"vnet1":       {"vnet0": "vnet0-router-ip", "vnet2": "vnet2-router-ip"},
+				"vnet2":       {"vnet0": "vnet0-router-ip", "vnet1": "vnet1-router-ip"},
+				"nonMeshVnet": {},
+			},
+		},
+		{
+			name: "hub and spoke",
+			topology: &hubnetworking.MeshTopology{
+				Type:          String(hubnetworking.MeshTopologyHubAndSpoke),
+				TransitHubKey: String("vnet0"),
+			},
+			expectedPeerings: []string{"vnet0-vnet1", "vnet0-vnet2", "vnet1-vnet0", "vnet2-vnet0"},
+			expectedNextHops: map[string]map[string]string{
+				"vnet0":       {"vnet1": "vnet1-router-ip", "vnet2": "vnet2-router-ip"},
+				"vnet1":       {"vnet0": "vnet0-router-ip", "vnet2": "vnet0-router-ip"},
+				"vnet2":       {"vnet0": "vnet0-router-ip", "vnet1": "vnet0-router-ip"},
+				"nonMeshVnet": {},
+			},
+		},
+		{
+			name: "groups",
+			topology: &hubnetworking.MeshTopology{
+				Type: String(hubnetworking.MeshTopologyGroups),
+				Groups: map[string][]string{
+					"west": {"vnet0", "vnet1"},
+					"east": {"vnet2", "nonMeshVnet"},
+				},
+			},
+			expectedPeerings: []string{"vnet0-vnet1", "vnet1-vnet0"},
+			expectedNextHops: map[string]map[string]string{
+				"vnet0":       {"vnet1": "vnet1-router-ip"},
+				"vnet1":       {"vnet0": "vnet0-router-ip"},
+				"vnet2":       {},
+				"nonMeshVnet": {},
+			},
+		},
+		{
+			name: "allowed and denied pairs",
+			topology: &hubnetworking.MeshTopology{
+				Type:         String(hubnetworking.MeshTopologyFullMesh),
+				AllowedPairs: [][]string{{"vnet2", "nonMeshVnet"}},
+				DeniedPairs:  [][]string{{"vnet1", "vnet0"}},
+			},
+			expectedPeerings: []string{"vnet0-vnet2", "vnet1-vnet2", "vnet2-vnet0", "vnet2-vnet1"},
+			expectedNextHops: map[string]map[string]string{
+				"vnet0":       {"vnet2": "vnet2-router-ip"},
+				"vnet1":       {"vnet2": "vnet2-router-ip"},
+				"vnet2":       {"vnet0": "vnet0-router-ip", "vnet1": "vnet1-router-ip"},
+				"nonMeshVnet": {},
+			},
+		},
+	}
+
+	for _, input := range inputs {
+		i := input
+		t.Run(i.name, func(t *testing.T) {
+			v := vars{
+				"hub_virtual_networks": networks,
+			}
+			if i.topology != nil {
+				v["hub_mesh_topology"] = i.topology
+			}
+			varFilePath := v.toFile(t)
+			defer func() { _ = os.Remove(varFilePath) }()
+			test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+				Upgrade:  true,
+				VarFiles: []string{varFilePath},
+				Logger:   logger.Discard,
+			}, func(t *testing.T, output test_helper.TerraformOutput) {
+				var peerings map[string]peeringOutput
+				err := mapstructure.Decode(output["hub_peering_map"], &peerings)
+				require.NoError(t, err)
+				actualPeerings := make([]string, 0, len(peerings))
+				for name := range peerings {
+					actualPeerings = append(actualPeerings, name)
+				}
+				sort.Strings(actualPeerings)
+				assert.Equal(t, i.expectedPeerings, actualPeerings)
+
+				var routes map[string]routeMap
+				err = mapstructure.Decode(output["route_map"], &routes)
+				require.NoError(t, err)
+				actualNextHops := make(map[string]map[string]string)
+				for k, table := range routes {
+					actualNextHops[k] = make(map[string]string)
+					for _, route := range table.MeshRoutes {
+						actualNextHops[k][strings.TrimSuffix(route.Name, "-"+strings.ReplaceAll(route.AddressPrefix, "/", "-"))] = *route.NextHopIpAddress
+					}
+				}
+				assert.Equal(t, i.expectedNextHops, actualNextHops)
+			})
+		})
+	}
+}
+
+func TestUnit_HubMeshTopologyUnknownKeysShouldBeReported(t *testing.T) {
+	varFilePath := vars{
+		"hub_virtual_networks": map[string]vnet{
+			"vnet0": aVnet("vnet0", true).withAddressSpace("10.0.0.0/16"),
+			"vnet1": aVnet("vnet1", true).withAddressSpace("10.1.0.0/16"),
+		},
+		"hub_mesh_topology": hubnetworking.MeshTopology{
+			Type:          String(hubnetworking.MeshTopologyHubAndSpoke),
+			TransitHubKey: String("transit"),
+			AllowedPairs:  [][]string{{"vnet0", "vnet9"}},
+		},
+	}.toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		assert.Equal(t, []any{"transit", "vnet9"}, output["hub_mesh_topology_unknown_keys"])
+	})
+}
+
+func TestUnit_SpokesShouldRouteThroughTheirHubAndBeLearntByOtherHubs(t *testing.T) {
+	existingSpokeId := "/subscriptions/sub/resourceGroups/spoke-rg/providers/Microsoft.Network/virtualNetworks/existing"
+	varFilePath := vars{
+		"hub_virtual_networks": map[string]vnet{
+			"vnet0": aVnet("vnet0", true).withResourceGroupName("rg0").withAddressSpace("10.0.0.0/16").withRoutingAddressSpace("10.0.0.0/16").withFirewall(firewall{
+				SkuName:             "AZFW_VNet",
+				SkuTier:             "Standard",
+				SubnetAddressPrefix: "10.0.1.0/24",
+			}),
+			"vnet1": aVnet("vnet1", true).withResourceGroupName("rg1").withAddressSpace("10.1.0.0/16").withRoutingAddressSpace("10.1.0.0/16").withHubRouterIpAddress("vnet1-router-ip"),
+		},
+		"spoke_virtual_networks": map[string]spoke{
+			"new":      aSpoke("new", "vnet0", "10.0.128.0/24").withSubnet("workload", "10.0.128.0/25"),
+			"existing": anExistingSpoke(existingSpokeId, "vnet1", "172.20.0.0/16").withSubnet("workload").withRoutedAddressPrefix("172.16.0.0/12"),
+			"quiet":    aSpoke("quiet", "vnet1", "172.21.0.0/16").withMeshRouting(false),
+		},
+	}.toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		var spokeRoutes map[string][]routeEntryOutput
+		err := mapstructure.Decode(output["spoke_route_map"], &spokeRoutes)
+		require.NoError(t, err)
+		route := func(name, prefix, nextHop string) routeEntryOutput {
+			return routeEntryOutput{Name: name, AddressPrefix: prefix, NextHopType: "VirtualAppliance", NextHopIpAddress: String(nextHop)}
+		}
+		assert.Equal(t, []routeEntryOutput{
+			route("default", "0.0.0.0/0", "vnet0-fake-fw-private-ip"),
+			route("vnet0-10.0.0.0-16", "10.0.0.0/16", "vnet0-fake-fw-private-ip"),
+			route("vnet1-10.1.0.0-16", "10.1.0.0/16", "vnet0-fake-fw-private-ip"),
+			route("existing-172.20.0.0-16", "172.20.0.0/16", "vnet0-fake-fw-private-ip"),
+		}, spokeRoutes["new"])
+		assert.Equal(t, []routeEntryOutput{
+			route("default", "0.0.0.0/0", "vnet1-router-ip"),
+			route("vnet1-10.1.0.0-16", "10.1.0.0/16", "vnet1-router-ip"),
+			route("vnet0-10.0.0.0-16", "10.0.0.0/16", "vnet1-router-ip"),
+			route("routed-172.16.0.0-12", "172.16.0.0/12", "vnet1-router-ip"),
+		}, spokeRoutes["existing"])
+
+		var routes map[string]routeMap
+		err = mapstructure.Decode(output["route_map"], &routes)
+		require.NoError(t, err)
+		assert.Equal(t, []routeEntryOutput{
+			route("vnet1-10.1.0.0-16", "10.1.0.0/16", "vnet1-router-ip"),
+			route("existing-172.20.0.0-16", "172.20.0.0/16", "vnet1-router-ip"),
+		}, routes["vnet0"].MeshRoutes)
+
+		var associations map[string]subnetRouteTableAssociationOutput
+		err = mapstructure.Decode(output["spoke_subnet_route_table_association_map"], &associations)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]subnetRouteTableAssociationOutput{
+			"new-workload":      {Name: "new-workload", SubnetId: "workload_id", RouteTableId: "new_spoke_route_table_id"},
+			"existing-workload": {Name: "existing-workload", SubnetId: hubnetworking.SpokeSubnetId(existingSpokeId, "workload"), RouteTableId: "existing_spoke_route_table_id"},
+		}, associations)
+	})
+}
+
+func TestUnit_VnetWithVirtualNetworkGatewayShouldCreateGatewayAndPublicIps(t *testing.T) {
+	inputs := []struct {
+		name     string
+		network  vnet
+		expected map[string]any
+	}{
+		{
+			name: "vpn gateway in active-active mode should create two public ips",
+			network: aVnet("vnet", false).
+				withResourceGroupName("rg0").
+				withAddressSpace("10.0.0.0/16").
+				withVirtualNetworkGateway(gateway{
+					Type:                "Vpn",
+					Sku:                 "VpnGw1AZ",
+					SubnetAddressPrefix: "10.0.255.0/27",
+					ActiveActive:        Bool(true),
+				}),
+			expected: map[string]any{
+				"vnet": map[string]any{
+					"name":                "vgw-vnet",
+					"location":            "eastus",
+					"resource_group_name": "rg0",
+					"type":                "Vpn",
+					"sku":                 "VpnGw1AZ",
+					"vpn_type":            "RouteBased",
+					"generation":          nil,
+					"active_active":       true,
+					"enable_bgp":          false,
+					"bgp_settings":        nil,
+					"tags":                nil,
+					"ip_configurations": []any{
+						map[string]any{
+							"name":                 "default",
+							"public_ip_address_id": "pip-vgw-vnet_id",
+							"subnet_id":            "vnet_gateway_subnet_id",
+						},
+						map[string]any{
+							"name":                 "activeActive",
+							"public_ip_address_id": "pip-vgw-vnet-activeActive_id",
+							"subnet_id":            "vnet_gateway_subnet_id",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "expressroute gateway should not set vpn attributes",
+			network: aVnet("vnet", false).
+				withResourceGroupName("rg0").
+				withAddressSpace("10.0.0.0/16").
+				withVirtualNetworkGateway(gateway{
+					Type:                "ExpressRoute",
+					Sku:                 "ErGw1AZ",
+					SubnetAddressPrefix: "10.0.255.0/27",
+					Name:                String("ergw"),
+					Generation:          String("Generation2"),
+				}),
+			expected: map[string]any{
+				"vnet": map[string]any{
+					"name":                "ergw",
+					"location":            "eastus",
+					"resource_group_name": "rg0",
+					"type":                "ExpressRoute",
+					"sku":                 "ErGw1AZ",
+					"vpn_type":            nil,
+					"generation":          nil,
+					"active_active":       false,
+					"enable_bgp":          false,
+					"bgp_settings":        nil,
+					"tags":                nil,
+					"ip_configurations": []any{
+						map[string]any{
+							"name":                 "default",
+							"public_ip_address_id": "pip-vgw-vnet_id",
+							"subnet_id":            "vnet_gateway_subnet_id",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "vnet without gateway should not create gateway",
+			network: aVnet("vnet", false).
+				withResourceGroupName("rg0").
+				withAddressSpace("10.0.0.0/16"),
+			expected: map[string]any{},
+		},
+	}
+
+	for i := 0; i < len(inputs); i++ {
+		input := inputs[i]
+		t.Run(input.name, func(t *testing.T) {
+			varFilePath := vars{
+				"hub_virtual_networks": map[string]any{
+					input.network.Name: input.network,
+				},
+			}.toFile(t)
+			defer func() { _ = os.Remove(varFilePath) }()
+			test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+				Upgrade:  true,
+				VarFiles: []string{varFilePath},
+				Logger:   logger.Discard,
+			}, func(t *testing.T, output test_helper.TerraformOutput) {
+				gateways := output["virtual_network_gateways"]
+				assert.Equal(t, input.expected, gateways)
+			})
+		})
+	}
+}
+
+func TestUnit_VnetWithBastionShouldCreateBastionAndPublicIp(t *testing.T) {
+	inputs := []struct {
+		name             string
+		network          vnet
+		expectedPip      map[string]any
+		expectedBastions map[string]bastionOutputEntry
+	}{
+		{
+			name: "vnet without bastion should not create bastion",
+			network: aVnet("vnet", false).
+				withResourceGroupName("rg0").
+				withAddressSpace("10.0.0.0/16"),
+			expectedPip:      map[string]any{},
+			expectedBastions: map[string]bastionOutputEntry{},
+		},
+		{
+			name: "bastion with defaults should be a basic bastion",
+			network: aVnet("vnet", false).
+				withResourceGroupName("rg0").
+				withAddressSpace("10.0.0.0/16").
+				withBastion(bastion{SubnetAddressPrefix: "10.0.254.0/26"}),
+			expectedPip: map[string]any{
+				"vnet": map[string]any{
+					"location":            "eastus",
+					"name":                "pip-bas-vnet",
+					"resource_group_name": "rg0",
+					"tags":                nil,
+					"zones":               nil,
+				},
+			},
+			expectedBastions: map[string]bastionOutputEntry{
+				"vnet": {
+					Location:          "eastus",
+					Name:              "bas-vnet",
+					ResourceGroupName: "rg0",
+					Sku:               "Basic",
+					ScaleUnits:        2,
+					CopyPasteEnabled:  true,
+				},
+			},
+		},
+		{
+			name: "standard bastion should keep names and features",
+			network: aVnet("vnet", false).
+				withResourceGroupName("rg0").
+				withAddressSpace("10.0.0.0/16").
+				withBastion(bastion{
+					SubnetAddressPrefix: "10.0.254.0/26",
+					Name:                String("bastion"),
+					Sku:                 String("Standard"),
+					ScaleUnits:          Int(4),
+					IpConnectEnabled:    Bool(true),
+					TunnelingEnabled:    Bool(true),
+					PublicIpName:        String("bastion-pip"),
+					Zones:               []string{"1"},
+				}),
+			expectedPip: map[string]any{
+				"vnet": map[string]any{
+					"location":            "eastus",
+					"name":                "bastion-pip",
+					"resource_group_name": "rg0",
+					"tags":                nil,
+					"zones":               []any{"1"},
+				},
+			},
+			expectedBastions: map[string]bastionOutputEntry{
+				"vnet": {
+					Location:          "eastus",
+					Name:              "bastion",
+					ResourceGroupName: "rg0",
+					Sku:               "Standard",
+					ScaleUnits:        4,
+					CopyPasteEnabled:  true,
+					IpConnectEnabled:  true,
+					TunnelingEnabled:  true,
+				},
+			},
+		},
+	}
+
+	for i := 0; i < len(inputs); i++ {
+		input := inputs[i]
+		t.Run(input.name, func(t *testing.T) {
+			varFilePath := vars{
+				"hub_virtual_networks": map[string]any{
+					input.network.Name: input.network,
+				},
+			}.toFile(t)
+			defer func() { _ = os.Remove(varFilePath) }()
+			test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+				Upgrade:  true,
+				VarFiles: []string{varFilePath},
+				Logger:   logger.Discard,
+			}, func(t *testing.T, output test_helper.TerraformOutput) {
+				assert.Equal(t, input.expectedPip, output["bastion_pip"])
+				actual := make(map[string]bastionOutputEntry)
+				err := mapstructure.Decode(output["bastions"], &actual)
+				require.NoError(t, err)
+				assert.Equal(t, input.expectedBastions, actual)
+			})
+		})
+	}
+}
+
+func TestUnit_VnetWithRouteServerShouldCreateRouteServerAndSuppressBgpLearnedMeshRoutes(t *testing.T) {
+	hubs := hubnetworking.HubVirtualNetworks{
+		"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", true).
+			withResourceGroupName("rg0").
+			withAddressSpace("10.0.0.0/16").
+			withRoutingAddressSpace("10.0.0.0/16").
+			withHubRouterIpAddress("10.0.0.4").
+			withRouteServer(routeServer{
+				SubnetAddressPrefix:          "10.0.3.0/27",
+				BranchToBranchTrafficEnabled: Bool(true),
+				PublicIpZones:                []string{"1", "2", "3"},
+				BgpConnections: map[string]hubnetworking.RouteServerBgpConnection{
+					"nva": {PeerAsn: 65001, PeerIp: "10.0.0.4"},
+				},
+			})),
+		"vnet1": hubnetworking.HubVirtualNetwork(aVnet("vnet1", true).
+			withResourceGroupName("rg1").
+			withAddressSpace("10.1.0.0/16").
+			withRoutingAddressSpace("10.1.0.0/16").
+			withHubRouterIpAddress("10.1.0.4")),
+		"vnet2": hubnetworking.HubVirtualNetwork(aVnet("vnet2", true).
+			withResourceGroupName("rg2").
+			withAddressSpace("10.2.0.0/16").
+			withRoutingAddressSpace("10.2.0.0/16").
+			withFirewall(firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.2.1.0/26"})),
+	}
+	varFilePath := variables(t, hubnetworking.Variables{HubVirtualNetworks: hubs}).toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		assert.Equal(t, map[string]any{
+			"vnet0": map[string]any{
+				"location":            "eastus",
+				"name":                "pip-rs-vnet0",
+				"resource_group_name": "rg0",
+				"tags":                nil,
+				"zones":               []any{"1", "2", "3"},
+			},
+		}, output["route_server_pip"])
+		assert.Equal(t, map[string]any{
+			"vnet0": map[string]any{
+				"location":                         "eastus",
+				"name":                             "rs-vnet0",
+				"resource_group_name":              "rg0",
+				"branch_to_branch_traffic_enabled": true,
+				"tags":                             nil,
+			},
+		}, output["route_servers"])
+		assert.Equal(t, map[string]any{
+			"vnet0-nva": map[string]any{
+				"key":      "vnet0-nva",
+				"hub_key":  "vnet0",
+				"name":     "nva",
+				"peer_asn": float64(65001),
+				"peer_ip":  "10.0.0.4",
+			},
+		}, output["route_server_bgp_connections"])
+
+		var actual map[string]routeMap
+		require.NoError(t, mapstructure.Decode(output["route_map"], &actual))
+		assert.Equal(t, []routeEntryOutput{
+			{Name: "vnet2-10.2.0.0-16", AddressPrefix: "10.2.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet2-fake-fw-private-ip")},
+		}, actual["vnet0"].MeshRoutes, "routes towards the router of vnet1 are learnt over BGP")
+		assert.Equal(t, sortRouteEntryOutputs([]routeEntryOutput{
+			{Name: "vnet0-10.0.0.0-16", AddressPrefix: "10.0.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.0.0.4")},
+			{Name: "vnet2-10.2.0.0-16", AddressPrefix: "10.2.0.0/16", NextHopType: "VirtualAppliance", NextHopIpAddress: String("vnet2-fake-fw-private-ip")},
+		}), sortRouteEntryOutputs(actual["vnet1"].MeshRoutes))
+	})
+}
+
+func TestUnit_FirewallPolicyShouldBeCreatedWithMeshRuleCollectionGroup(t *testing.T) {
+	hub0 := aVnet("vnet0", true).
+		withResourceGroupName("rg0").
+		withAddressSpace("10.0.0.0/16").
+		withRoutingAddressSpace("10.0.0.0/16").
+		withFirewall(firewall{
+			SkuName:             "AZFW_VNet",
+			SkuTier:             "Premium",
+			SubnetAddressPrefix: "10.0.1.0/24",
+		})
+	hub1 := aVnet("vnet1", true).
+		withResourceGroupName("rg1").
+		withAddressSpace("10.1.0.0/16").
+		withRoutingAddressSpace("10.1.0.0/16").
+		withHubRouterIpAddress("10.1.0.4")
+	policies := map[string]hubnetworking.FirewallPolicy{
+		"base": {
+			Location:          String("eastus"),
+			ResourceGroupName: String("rg-policy"),
+			RuleCollectionGroups: map[string]hubnetworking.RuleCollectionGroup{
+				"egress": {
+					Priority: 300,
+					NetworkRuleCollections: []hubnetworking.NetworkRuleCollection{{
+						Name:     "rfc1918",
+						Priority: 100,
+						Action:   "Allow",
+						Rules: []hubnetworking.NetworkRule{{
+							Name:                 "rfc1918",
+							Protocols:            []string{"Any"},
+							DestinationPorts:     []string{"*"},
+							DestinationAddresses: []string{"10.0.0.0/8"},
+						}},
+					}},
+				},
+			},
+		},
+		"hub0": {
+			BasePolicyKey: String("base"),
+			Dns:           &hubnetworking.FirewallPolicyDns{ProxyEnabled: Bool(true)},
+			RuleCollectionGroups: map[string]hubnetworking.RuleCollectionGroup{
+				"egress": {
+					Priority: 200,
+					ApplicationRuleCollections: []hubnetworking.ApplicationRuleCollection{{
+						Name:     "windows-update",
+						Priority: 100,
+						Action:   "Allow",
+						Rules: []hubnetworking.ApplicationRule{{
+							Name:                "windows-update",
+							Protocols:           []hubnetworking.ApplicationRuleProtocol{{Type: "Https", Port: 443}},
+							SourceAddresses:     []string{"10.0.0.0/16"},
+							DestinationFqdnTags: []string{"WindowsUpdate"},
+						}},
+					}},
+				},
+			},
+		},
+	}
+	varFilePath := vars{
+		"hub_virtual_networks": map[string]any{
+			"hub0": hub0,
+			"hub1": hub1,
+		},
+		"firewall_policies": policies,
+	}.toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		assert.Equal(t, map[string]any{
+			"base": map[string]any{
+				"hub_key":                       nil,
+				"name":                          "afwp-base",
+				"location":                      "eastus",
+				"resource_group_name":           "rg-policy",
+				"base_policy_key":               nil,
+				"sku":                           "Standard",
+				"threat_intelligence_mode":      "Alert",
+				"dns":                           nil,
+				"threat_intelligence_allowlist": nil,
+				"intrusion_detection":           nil,
+				"tls_certificate":               nil,
+				"identity":                      nil,
+				"tags":                          nil,
+			},
+			"hub0": map[string]any{
+				"hub_key":                       "hub0",
+				"name":                          "afwp-hub0",
+				"location":                      "eastus",
+				"resource_group_name":           "rg0",
+				"base_policy_key":               "base",
+				"sku":                           "Premium",
+				"threat_intelligence_mode":      "Alert",
+				"dns":                           map[string]any{"proxy_enabled": true, "servers": nil},
+				"threat_intelligence_allowlist": nil,
+				"intrusion_detection":           nil,
+				"tls_certificate":               nil,
+				"identity":                      nil,
+				"tags":                          nil,
+			},
+		}, output["firewall_policies"])
+
+		assert.Empty(t, output["firewall_policy_conflicts"])
+
+		var groups map[string]struct {
+			PolicyKey                  string                                    `json:"policy_key"`
+			Name                       string                                    `json:"name"`
+			Priority                   int                                       `json:"priority"`
+			NetworkRuleCollections     []hubnetworking.NetworkRuleCollection     `json:"network_rule_collections"`
+			ApplicationRuleCollections []hubnetworking.ApplicationRuleCollection `json:"application_rule_collections"`
+		}
+		decodeJson(t, output["firewall_policy_rule_collection_groups"], &groups)
+		require.Len(t, groups, 3)
+		assert.Equal(t, "base", groups["base-egress"].PolicyKey)
+		assert.Equal(t, "egress", groups["base-egress"].Name)
+		assert.Equal(t, 300, groups["base-egress"].Priority)
+		assert.Equal(t, "hub0", groups["hub0-egress"].PolicyKey)
+		assert.Equal(t, "egress", groups["hub0-egress"].Name)
+		assert.Equal(t, 200, groups["hub0-egress"].Priority)
+		assert.Equal(t, []string{"WindowsUpdate"}, groups["hub0-egress"].ApplicationRuleCollections[0].Rules[0].DestinationFqdnTags)
+		assert.Equal(t, "hub-mesh", groups["hub0-hub-mesh"].Name)
+		assert.Equal(t, 100, groups["hub0-hub-mesh"].Priority)
+		assert.Equal(t, []hubnetworking.NetworkRuleCollection{{
+			Name:     "allow-hub-mesh",
+			Priority: 100,
+			Action:   "Allow",
+			Rules: []hubnetworking.NetworkRule{
+				{Name: "hub0-to-hub1", Protocols: []string{"Any"}, DestinationPorts: []string{"*"}, SourceAddresses: []string{"10.0.0.0/16"}, DestinationAddresses: []string{"10.1.0.0/16"}},
+				{Name: "hub1-to-hub0", Protocols: []string{"Any"}, DestinationPorts: []string{"*"}, SourceAddresses: []string{"10.1.0.0/16"}, DestinationAddresses: []string{"10.0.0.0/16"}},
+			},
+		}}, groups["hub0-hub-mesh"].NetworkRuleCollections)
+
+		var firewalls map[string]firewallOutputEntry
+		require.NoError(t, mapstructure.Decode(output["firewalls"], &firewalls))
+		assert.Equal(t, "afwp-hub0_id", *firewalls["hub0"].FirewallPolicyId)
+	})
+}
+
+func TestUnit_PremiumFirewallPolicyShouldCarryIdpsTlsInspectionAndIdentity(t *testing.T) {
+	identityId := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg0/providers/Microsoft.ManagedIdentity/userAssignedIdentities/afw"
+	hub := aVnet("vnet0", false).
+		withResourceGroupName("rg0").
+		withAddressSpace("10.0.0.0/16").
+		withFirewall(firewall{
+			SkuName:             "AZFW_VNet",
+			SkuTier:             "Premium",
+			SubnetAddressPrefix: "10.0.1.0/24",
+		})
+	varFilePath := vars{
+		"hub_virtual_networks": map[string]any{
+			"hub0": hub,
+		},
+		"firewall_policies": map[string]hubnetworking.FirewallPolicy{
+			"hub0": {
+				IntrusionDetection: &hubnetworking.IntrusionDetection{
+					SignatureOverrides: []hubnetworking.SignatureOverride{{Id: "2024897", State: "Deny"}},
+				},
+				TlsCertificate: &hubnetworking.TlsCertificate{Name: "ca", KeyVaultSecretId: "https://kv0.vault.azure.net/secrets/ca"},
+				Identity:       &hubnetworking.PolicyIdentity{IdentityIds: []string{identityId}},
+			},
+		},
+	}.toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		var policies map[string]struct {
+			Sku                string                            `json:"sku"`
+			IntrusionDetection *hubnetworking.IntrusionDetection `json:"intrusion_detection"`
+			TlsCertificate     *hubnetworking.TlsCertificate     `json:"tls_certificate"`
+			Identity           *hubnetworking.PolicyIdentity     `json:"identity"`
+		}
+		decodeJson(t, output["firewall_policies"], &policies)
+		policy := policies["hub0"]
+		assert.Equal(t, "Premium", policy.Sku)
+		assert.Equal(t, &hubnetworking.IntrusionDetection{
+			Mode:               String("Alert"),
+			SignatureOverrides: []hubnetworking.SignatureOverride{{Id: "2024897", State: "Deny"}},
+			TrafficBypass:      []hubnetworking.TrafficBypass{},
+		}, policy.IntrusionDetection)
+		assert.Equal(t, &hubnetworking.TlsCertificate{Name: "ca", KeyVaultSecretId: "https://kv0.vault.azure.net/secrets/ca"}, policy.TlsCertificate)
+		assert.Equal(t, &hubnetworking.PolicyIdentity{IdentityIds: []string{identityId}}, policy.Identity)
+	})
+}
+
+func TestUnit_VirtualWanShouldCreateVirtualHubsWithSecuredFirewallsAndRoutingIntent(t *testing.T) {
+	v := hubnetworking.Variables{
+		HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+			"hub0": hubnetworking.HubVirtualNetwork(aVnet("vhub0", true).
+				withResourceGroupName("rg0").
+				withAddressSpace("10.0.0.0/23").
+				withFirewall(firewall{
+					SkuName:                 "AZFW_Hub",
+					SkuTier:                 "Standard",
+					VirtualHubPublicIpCount: Int(2),
+				})),
+			"hub1": hubnetworking.HubVirtualNetwork(aVnet("vhub1", true).
+				withResourceGroupName("rg1").
+				withAddressSpace("10.1.0.0/23").
+				withFirewall(firewall{
+					SkuName:          "AZFW_Hub",
+					SkuTier:          "Premium",
+					FirewallPolicyId: String("policy1_id"),
+				}).
+				withVirtualHub(virtualHub{
+					HubRoutingPreference:          String("ASPath"),
+					InternetTrafficRoutingEnabled: Bool(false),
+				})),
+		},
+		SpokeVirtualNetworks: hubnetworking.SpokeVirtualNetworks{
+			"spoke0": hubnetworking.SpokeVirtualNetwork(aSpoke("spoke0", "hub0", "10.10.0.0/24").withSubnet("workload", "10.10.0.0/25")),
+			"spoke1": hubnetworking.SpokeVirtualNetwork(anExistingSpoke("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg-spoke1/providers/Microsoft.Network/virtualNetworks/spoke1", "hub1", "10.11.0.0/24")),
+		},
+		FirewallPolicies: map[string]hubnetworking.FirewallPolicy{"hub0": {}},
+		VirtualWan:       &hubnetworking.VirtualWan{Name: "vwan", Location: "eastus", ResourceGroupName: "rg0"},
+	}
+	varFilePath := variables(t, v).toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		assert.Equal(t, map[string]any{
+			"hub0": map[string]any{
+				"name":                   "vhub0",
+				"location":               "eastus",
+				"resource_group_name":    "rg0",
+				"address_prefix":         "10.0.0.0/23",
+				"sku":                    "Standard",
+				"hub_routing_preference": "ExpressRoute",
+				"tags":                   map[string]any{},
+			},
+			"hub1": map[string]any{
+				"name":                   "vhub1",
+				"location":               "eastus",
+				"resource_group_name":    "rg1",
+				"address_prefix":         "10.1.0.0/23",
+				"sku":                    "Standard",
+				"hub_routing_preference": "ASPath",
+				"tags":                   map[string]any{},
+			},
+		}, output["virtual_hubs"])
+		assert.Equal(t, map[string]any{
+			"hub0": map[string]any{
+				"name":                "afw-hub0",
+				"location":            "eastus",
+				"resource_group_name": "rg0",
+				"sku_name":            "AZFW_Hub",
+				"sku_tier":            "Standard",
+				"firewall_policy_id":  "afwp-hub0_id",
+				"public_ip_count":     float64(2),
+				"tags":                nil,
+				"zones":               nil,
+			},
+			"hub1": map[string]any{
+				"name":                "afw-hub1",
+				"location":            "eastus",
+				"resource_group_name": "rg1",
+				"sku_name":            "AZFW_Hub",
+				"sku_tier":            "Premium",
+				"firewall_policy_id":  "policy1_id",
+				"public_ip_count":     float64(1),
+				"tags":                nil,
+				"zones":               nil,
+			},
+		}, output["virtual_hub_firewalls"])
+		var intents map[string]hubnetworking.VirtualHubRoutingIntent
+		decodeJson(t, output["virtual_hub_routing_intents"], &intents)
+		assert.Equal(t, v.VirtualHubRoutingIntents(), intents)
+		assert.Equal(t, map[string]any{
+			"spoke0": map[string]any{
+				"name":                      "spoke0-vhub0",
+				"hub_key":                   "hub0",
+				"remote_virtual_network_id": "spoke0_id",
+				"internet_security_enabled": true,
+			},
+			"spoke1": map[string]any{
+				"name":                      "spoke1-vhub1",
+				"hub_key":                   "hub1",
+				"remote_virtual_network_id": "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg-spoke1/providers/Microsoft.Network/virtualNetworks/spoke1",
+				"internet_security_enabled": false,
+			},
+		}, output["virtual_hub_connections"])
+		var policies map[string]struct {
+			Location string `json:"location"`
+		}
+		decodeJson(t, output["firewall_policies"], &policies)
+		assert.Equal(t, "eastus", policies["hub0"].Location)
+		assert.Empty(t, output["firewalls"])
+		assert.Empty(t, output["hub_peering_map"])
+		assert.Empty(t, output["route_map"])
+		assert.Empty(t, output["spoke_peering_map"])
+		assert.Empty(t, output["spoke_route_map"])
+		assert.Empty(t, output["spoke_subnet_route_table_association_map"])
+		assert.Empty(t, output["virtual_wan_conflicts"])
+	})
+}
+
+func TestUnit_DnsResolverShouldBeTheDnsServerOfTheHubAndItsFirewall(t *testing.T) {
+	v := hubnetworking.Variables{
+		HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+			"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).
+				withResourceGroupName("rg0").
+				withAddressSpace("10.0.0.0/16").
+				withFirewall(firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.0.1.0/26"}).
+				withDnsResolver(dnsResolver{
+					InboundSubnetAddressPrefix:  "10.0.2.0/28",
+					OutboundSubnetAddressPrefix: String("10.0.2.16/28"),
+					ForwardingRules: map[string]hubnetworking.DnsForwardingRule{
+						"onprem": {DomainName: "contoso.com.", TargetDnsServers: []hubnetworking.DnsTargetServer{{IpAddress: "192.168.0.4"}}},
+					},
+				})),
+			"vnet1": hubnetworking.HubVirtualNetwork(aVnet("vnet1", false).
+				withResourceGroupName("rg1").
+				withAddressSpace("10.1.0.0/16").
+				withFirewall(firewall{
+					SkuName:             "AZFW_VNet",
+					SkuTier:             "Standard",
+					SubnetAddressPrefix: "10.1.1.0/26",
+				}).
+				withDnsResolver(dnsResolver{
+					Name:                       String("resolver1"),
+					InboundSubnetAddressPrefix: "10.1.2.0/28",
+					InboundEndpointIpAddress:   String("10.1.2.10"),
+				})),
+			"vnet2": hubnetworking.HubVirtualNetwork(aVnet("vnet2", false).
+				withResourceGroupName("rg2").
+				withAddressSpace("10.2.0.0/16")),
+		},
+		FirewallPolicies: map[string]hubnetworking.FirewallPolicy{"vnet1": {}},
+	}
+	varFilePath := variables(t, v).toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		assert.Equal(t, map[string]any{
+			"vnet0": map[string]any{
+				"location":                       "eastus",
+				"name":                           "dnspr-vnet0",
+				"resource_group_name":            "rg0",
+				"inbound_subnet_address_prefix":  "10.0.2.0/28",
+				"inbound_endpoint_ip_address":    "10.0.2.4",
+				"outbound_subnet_address_prefix": "10.0.2.16/28",
+				"forwarding_ruleset_name":        "dnsfrs-vnet0",
+				"tags":                           nil,
+			},
+			"vnet1": map[string]any{
+				"location":                       "eastus",
+				"name":                           "resolver1",
+				"resource_group_name":            "rg1",
+				"inbound_subnet_address_prefix":  "10.1.2.0/28",
+				"inbound_endpoint_ip_address":    "10.1.2.10",
+				"outbound_subnet_address_prefix": nil,
+				"forwarding_ruleset_name":        "dnsfrs-vnet1",
+				"tags":                           nil,
+			},
+		}, output["dns_resolvers"])
+		assert.Equal(t, map[string]any{
+			"vnet0-onprem": map[string]any{
+				"key":         "vnet0-onprem",
+				"hub_key":     "vnet0",
+				"name":        "onprem",
+				"domain_name": "contoso.com.",
+				"enabled":     true,
+				"target_dns_servers": []any{
+					map[string]any{"ip_address": "192.168.0.4", "port": float64(53)},
+				},
+			},
+		}, output["dns_forwarding_rules"])
+
+		var dnsServers map[string][]string
+		decodeJson(t, output["hub_dns_servers"], &dnsServers)
+		assert.Equal(t, v.DnsServers(), dnsServers)
+
+		var firewalls map[string]firewallOutputEntry
+		require.NoError(t, mapstructure.Decode(output["firewalls"], &firewalls))
+		assert.Equal(t, v.FirewallDnsServers("vnet0"), firewalls["vnet0"].DnsServers)
+		assert.Equal(t, []string{"10.0.2.4"}, firewalls["vnet0"].DnsServers)
+		assert.Nil(t, firewalls["vnet1"].DnsServers, "a firewall with a policy takes its DNS servers from the policy")
+
+		var policies map[string]struct {
+			Dns *hubnetworking.FirewallPolicyDns `json:"dns"`
+		}
+		decodeJson(t, output["firewall_policies"], &policies)
+		assert.Equal(t, v.FirewallPolicyDns("vnet1"), policies["vnet1"].Dns)
+		assert.Equal(t, &hubnetworking.FirewallPolicyDns{ProxyEnabled: Bool(false), Servers: []string{"10.1.2.10"}}, policies["vnet1"].Dns)
+	})
+}
+
+func TestUnit_PrivateDnsZonesShouldBeLinkedToEveryHubAndTheListedSpokes(t *testing.T) {
+	v := hubnetworking.Variables{
+		HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+			"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).withResourceGroupName("rg0").withAddressSpace("10.0.0.0/16")),
+			"vnet1": hubnetworking.HubVirtualNetwork(aVnet("vnet1", false).withResourceGroupName("rg1").withAddressSpace("10.1.0.0/16")),
+		},
+		SpokeVirtualNetworks: hubnetworking.SpokeVirtualNetworks{
+			"spoke0": hubnetworking.SpokeVirtualNetwork(aSpoke("spoke0", "vnet0", "10.10.0.0/24").withPrivateDnsZoneLinks(true)),
+			"spoke1": hubnetworking.SpokeVirtualNetwork(anExistingSpoke("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg-spoke1/providers/Microsoft.Network/virtualNetworks/spoke1", "vnet1", "10.11.0.0/24").withPrivateDnsZoneLinks(true)),
+			"spoke2": hubnetworking.SpokeVirtualNetwork(aSpoke("spoke2", "vnet1", "10.12.0.0/24")),
+		},
+		PrivateDnsZones: &hubnetworking.PrivateDnsZones{
+			ResourceGroupName:         "rg-dns",
+			ZoneNames:                 []string{"contoso.internal"},
+			PrivateLinkZonesEnabled:   Bool(true),
+			PrivateLinkZoneExclusions: []string{"privatelink.blob.core.windows.net"},
+		},
+	}
+	varFilePath := variables(t, v).toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		zones, ok := output["private_dns_zones"].(map[string]any)
+		require.True(t, ok)
+		names := make([]string, 0, len(zones))
+		for name := range zones {
+			names = append(names, name)
+		}
+		assert.ElementsMatch(t, v.PrivateDnsZoneNames(), names)
+		assert.NotContains(t, names, "privatelink.blob.core.windows.net")
+		assert.Equal(t, map[string]any{
+			"name":                "contoso.internal",
+			"resource_group_name": "rg-dns",
+			"tags":                nil,
+		}, zones["contoso.internal"])
+
+		var links map[string]hubnetworking.PrivateDnsZoneVirtualNetworkLink
+		decodeJson(t, output["private_dns_zone_virtual_network_links"], &links)
+		expected := v.PrivateDnsZoneVirtualNetworkLinks(
+			map[string]string{"vnet0": "vnet0_id", "vnet1": "vnet1_id"},
+			map[string]string{"spoke0": "spoke0_id"},
+		)
+		assert.Equal(t, expected, links)
+		assert.Len(t, links, 4*len(names))
+		assert.Equal(t, hubnetworking.PrivateDnsZoneVirtualNetworkLink{
+			Name:               "link-spoke-spoke0",
+			PrivateDnsZoneName: "contoso.internal",
+			VirtualNetworkId:   "spoke0_id",
+		}, links["contoso.internal/link-spoke-spoke0"])
+	})
+}
+
+func TestUnit_DdosProtectionPlanShouldBeAttachedToTheHubVirtualNetworks(t *testing.T) {
+	hubs := hubnetworking.HubVirtualNetworks{
+		"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).withAddressSpace("10.0.0.0/16")),
+		"vnet1": hubnetworking.HubVirtualNetwork(aVnet("vnet1", false).withAddressSpace("10.1.0.0/16").withDdosProtectionPlanId("existing_plan_id")),
+		"vnet2": hubnetworking.HubVirtualNetwork(aVnet("vnet2", false).withAddressSpace("10.2.0.0/16")),
+	}
+	inputs := []struct {
+		name     string
+		plan     *hubnetworking.DdosProtectionPlan
+		expected map[string]any
+	}{
+		{
+			name: "without plan",
+			expected: map[string]any{
+				"vnet0": nil,
+				"vnet1": map[string]any{"id": "existing_plan_id", "enable": true},
+				"vnet2": nil,
+			},
+		},
+		{
+			name: "every hub",
+			plan: &hubnetworking.DdosProtectionPlan{Name: "ddos", Location: "eastus", ResourceGroupName: "rg-ddos"},
+			expected: map[string]any{
+				"vnet0": map[string]any{"id": "ddos_id", "enable": true},
+				"vnet1": map[string]any{"id": "existing_plan_id", "enable": true},
+				"vnet2": map[string]any{"id": "ddos_id", "enable": true},
+			},
+		},
+		{
+			name: "selected hubs",
+			plan: &hubnetworking.DdosProtectionPlan{Name: "ddos", Location: "eastus", ResourceGroupName: "rg-ddos", HubKeys: []string{"vnet2"}},
+			expected: map[string]any{
+				"vnet0": nil,
+				"vnet1": map[string]any{"id": "existing_plan_id", "enable": true},
+				"vnet2": map[string]any{"id": "ddos_id", "enable": true},
+			},
+		},
+	}
+	for i := 0; i < len(inputs); i++ {
+		input := inputs[i]
+		t.Run(input.name, func(t *testing.T) {
+			v := hubnetworking.Variables{HubVirtualNetworks: hubs, DdosProtectionPlan: input.plan}
+			varFilePath := variables(t, v).toFile(t)
+			defer func() { _ = os.Remove(varFilePath) }()
+			test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+				Upgrade:  true,
+				VarFiles: []string{varFilePath},
+				Logger:   logger.Discard,
+			}, func(t *testing.T, output test_helper.TerraformOutput) {
+				assert.Equal(t, input.expected, output["hub_ddos_protection_plans"])
+				var actual map[string]*hubnetworking.VirtualNetworkDdosProtectionPlan
+				decodeJson(t, output["hub_ddos_protection_plans"], &actual)
+				assert.Equal(t, v.HubDdosProtectionPlans("ddos_id"), actual)
+				var hubKeys []string
+				decodeJson(t, output["ddos_protection_plan_hub_keys"], &hubKeys)
+				assert.Equal(t, v.DdosProtectionPlanHubKeys(), hubKeys)
+				assert.Empty(t, output["ddos_protection_plan_conflicts"])
+			})
+		})
+	}
+}
+
+func TestUnit_DiagnosticSettingsShouldCoverHubVirtualNetworksFirewallsAndTheirPublicIps(t *testing.T) {
+	v := hubnetworking.Variables{
+		HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+			"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).
+				withAddressSpace("10.0.0.0/16").
+				withFirewall(firewall{
+					SkuName:                       "AZFW_VNet",
+					SkuTier:                       "Basic",
+					SubnetAddressPrefix:           "10.0.1.0/26",
+					ManagementSubnetAddressPrefix: String("10.0.1.64/26"),
+					IpConfigurations:              map[string]hubnetworking.FirewallAdditionalIpConfiguration{"extra": {}},
+				})),
+			"vnet1": hubnetworking.HubVirtualNetwork(aVnet("vnet1", false).
+				withAddressSpace("10.1.0.0/16").
+				withDiagnosticSettings(hubnetworking.DiagnosticSettings{
+					StorageAccountId: String("storage_id"),
+					LogCategories:    []string{"VMProtectionAlerts", "AZFWNetworkRule"},
+				})),
+			"vnet2": hubnetworking.HubVirtualNetwork(aVnet("vnet2", false).withAddressSpace("10.2.0.0/16").withoutDiagnosticSettings()),
+		},
+		DiagnosticSettings: &hubnetworking.DiagnosticSettings{
+			LogAnalyticsWorkspaceId: String("workspace_id"),
+			MetricsEnabled:          Bool(false),
+		},
+	}
+	varFilePath := variables(t, v).toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		var hubSettings map[string]hubnetworking.DiagnosticSettings
+		decodeJson(t, output["hub_diagnostic_settings"], &hubSettings)
+		assert.Equal(t, v.HubDiagnosticSettings(), hubSettings)
+
+		var settings map[string]hubnetworking.DiagnosticSetting
+		decodeJson(t, output["diagnostic_settings"], &settings)
+		assert.Equal(t, v.ResourceDiagnosticSettings(), settings)
+		assert.Equal(t, map[string]any{
+			"key":                            "firewall/vnet0",
+			"hub_key":                        "vnet0",
+			"name":                           "diag",
+			"log_analytics_workspace_id":     "workspace_id",
+			"log_analytics_destination_type": "Dedicated",
+			"storage_account_id":             nil,
+			"eventhub_authorization_rule_id": nil,
+			"eventhub_name":                  nil,
+			"log_categories":                 []any{},
+			"log_category_groups":            []any{"allLogs"},
+			"metrics_enabled":                false,
+		}, output["diagnostic_settings"].(map[string]any)["firewall/vnet0"])
+		for _, key := range []string{"fw_default_ip_configuration_pip/vnet0", "fw_ip_configuration_pip/vnet0-extra", "fw_management_ip_configuration_pip/vnet0", "virtual_network/vnet0"} {
+			assert.Contains(t, settings, key)
+			assert.Nil(t, settings[key].LogAnalyticsDestinationType, "only the firewall has resource-specific tables")
+		}
+		assert.Equal(t, []string{"VMProtectionAlerts"}, settings["virtual_network/vnet1"].LogCategories)
+		assert.Equal(t, String("storage_id"), settings["virtual_network/vnet1"].StorageAccountId)
+		assert.Equal(t, String("workspace_id"), settings["virtual_network/vnet1"].LogAnalyticsWorkspaceId)
+		assert.NotContains(t, settings, "virtual_network/vnet2")
+		assert.Empty(t, output["diagnostic_setting_conflicts"])
+	})
+}
+
+func TestUnit_FlowLogsShouldUseTheNetworkWatcherOfTheRegionOfTheHub(t *testing.T) {
+	vnet1 := aVnet("vnet1", false).
+		withAddressSpace("10.1.0.0/16").
+		withFlowLog(hubnetworking.FlowLog{
+			StorageAccountId: "storage1_id",
+			RetentionDays:    Int(90),
+			TrafficAnalytics: &hubnetworking.TrafficAnalytics{
+				WorkspaceId:         "00000000-0000-0000-0000-000000000000",
+				WorkspaceResourceId: "workspace_id",
+				WorkspaceRegion:     String("northeurope"),
+				IntervalInMinutes:   Int(10),
+			},
+		})
+	vnet1.Location = "West Europe"
+	v := hubnetworking.Variables{
+		HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+			"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).withAddressSpace("10.0.0.0/16").withFlowLog(hubnetworking.FlowLog{StorageAccountId: "storage0_id"})),
+			"vnet1": hubnetworking.HubVirtualNetwork(vnet1),
+			"vnet2": hubnetworking.HubVirtualNetwork(aVnet("vnet2", false).withAddressSpace("10.2.0.0/16")),
+		},
+		NetworkWatchers: map[string]hubnetworking.NetworkWatcher{
+			"westeurope": {Name: "nw-weu", ResourceGroupName: "rg-nw"},
+		},
+	}
+	varFilePath := variables(t, v).toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		assert.Equal(t, map[string]any{
+			"vnet0": map[string]any{
+				"name":                                "fl-vnet0",
+				"location":                            "eastus",
+				"network_watcher_name":                "NetworkWatcher_eastus",
+				"network_watcher_resource_group_name": "NetworkWatcherRG",
+				"storage_account_id":                  "storage0_id",
+				"enabled":                             true,
+				"retention_days":                      float64(0),
+				"traffic_analytics":                   nil,
+				"tags":                                nil,
+			},
+			"vnet1": map[string]any{
+				"name":                                "fl-vnet1",
+				"location":                            "West Europe",
+				"network_watcher_name":                "nw-weu",
+				"network_watcher_resource_group_name": "rg-nw",
+				"storage_account_id":                  "storage1_id",
+				"enabled":                             true,
+				"retention_days":                      float64(90),
+				"traffic_analytics": map[string]any{
+					"workspace_id":          "00000000-0000-0000-0000-000000000000",
+					"workspace_resource_id": "workspace_id",
+					"workspace_region":      "northeurope",
+					"interval_in_minutes":   float64(10),
+				},
+				"tags": nil,
+			},
+		}, output["flow_logs"])
+		var actual map[string]hubnetworking.NetworkWatcherFlowLog
+		decodeJson(t, output["flow_logs"], &actual)
+		assert.Equal(t, v.FlowLogs(), actual)
+	})
+}
+
+func TestUnit_GeneratedNetworkSecurityGroupsShouldBeAssociatedWithTheHubSubnets(t *testing.T) {
+	subnet := aSubnet("10.0.1.0/24")
+	subnet.GeneratedNetworkSecurityGroup = &hubnetworking.GeneratedNetworkSecurityGroup{
+		Rules: map[string]hubnetworking.NetworkSecurityRule{
+			"AllowHttpsInbound": {Priority: 100, Direction: "Inbound", Access: "Allow", Protocol: "Tcp", DestinationPortRanges: []string{"443"}},
+		},
+		Tags: map[string]string{"team": "network"},
+	}
+	bastionSubnet := aSubnet("10.0.254.0/26")
+	bastionSubnet.GeneratedNetworkSecurityGroup = &hubnetworking.GeneratedNetworkSecurityGroup{
+		Name: String("nsg-bastion"),
+		Rules: map[string]hubnetworking.NetworkSecurityRule{
+			"DenyAllInbound": {Priority: 4096, Direction: "Inbound", Access: "Deny", Protocol: "*"},
+		},
+	}
+	v := hubnetworking.Variables{
+		HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+			"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).
+				withAddressSpace("10.0.0.0/16").
+				withSubnet("workload", subnet).
+				withSubnet("other", aSubnet("10.0.2.0/24")).
+				withSubnet(hubnetworking.BastionSubnetName, bastionSubnet).
+				withBastion(bastion{})),
+		},
+	}
+	varFilePath := variables(t, v).toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		var actual map[string]hubnetworking.NetworkSecurityGroup
+		decodeJson(t, output["network_security_groups"], &actual)
+		assert.Equal(t, v.NetworkSecurityGroups(), actual)
+		require.Contains(t, actual, "vnet0-workload")
+		assert.Equal(t, "nsg-vnet0-workload", actual["vnet0-workload"].Name)
+		assert.Len(t, actual["vnet0-workload"].Rules, 1, "a workload subnet has no baseline rules")
+		require.Contains(t, actual, "vnet0-AzureBastionSubnet")
+		assert.Equal(t, "nsg-bastion", actual["vnet0-AzureBastionSubnet"].Name)
+		assert.Len(t, actual["vnet0-AzureBastionSubnet"].Rules, len(hubnetworking.NetworkSecurityGroupBaselineRules["AzureBastionSubnet"])+1)
+		assert.NotContains(t, actual, "vnet0-other")
+		assert.Empty(t, output["network_security_group_conflicts"])
+
+		subnets := output["subnets_map"].(map[string]any)["vnet0"].(map[string]any)
+		assert.Equal(t, map[string]any{"id": "nsg-vnet0-workload_id"}, subnets["workload"].(map[string]any)["network_security_group"])
+		assert.Equal(t, map[string]any{"id": "nsg-bastion_id"}, subnets["AzureBastionSubnet"].(map[string]any)["network_security_group"])
+		assert.Nil(t, subnets["other"].(map[string]any)["network_security_group"])
+	})
+}
+
+// decodeJson decodes a Terraform output into a type of package hubnetworking through its json tags.
+func TestUnit_LocalsShouldConformToGoImplementation(t *testing.T) {
+	identity := &hubnetworking.PolicyIdentity{IdentityIds: []string{"/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg0/providers/Microsoft.ManagedIdentity/userAssignedIdentities/afw"}}
+	nsgSubnet := aSubnet("10.0.1.0/24")
+	nsgSubnet.GeneratedNetworkSecurityGroup = &hubnetworking.GeneratedNetworkSecurityGroup{
+		Rules: map[string]hubnetworking.NetworkSecurityRule{
+			"AllowSshInbound": {Priority: 1000, Direction: "Inbound", Access: "Allow", Protocol: "Tcp", DestinationPortRanges: []string{"22"}},
+			"AllowRdpInbound": {Priority: 1000, Direction: "Inbound", Access: "Allow", Protocol: "Tcp", DestinationPortRanges: []string{"3389"}},
+			"DenyAllOutbound": {Priority: 1000, Direction: "Outbound", Access: "Deny", Protocol: "*"},
+		},
+	}
+	nsgBastionSubnet := aSubnet("10.0.254.0/26")
+	nsgBastionSubnet.GeneratedNetworkSecurityGroup = &hubnetworking.GeneratedNetworkSecurityGroup{
+		Rules: map[string]hubnetworking.NetworkSecurityRule{
+			"AllowCorporateHttpsInbound": {Priority: 120, Direction: "Inbound", Access: "Allow", Protocol: "Tcp", SourceAddressPrefixes: []string{"192.168.0.0/16"}, DestinationPortRanges: []string{"443"}},
+		},
+	}
+	inputs := []struct {
+		name      string
+		random    bool
+		variables hubnetworking.Variables
+		expected  map[string]func(t *testing.T, v hubnetworking.Variables) any
+	}{
+		{
+			name:   "route map",
+			random: true,
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"route_map": func(t *testing.T, v hubnetworking.Variables) any {
+					return v.RouteMap(fakeFirewallPrivateIps(v.HubVirtualNetworks))
+				},
+			},
+		},
+		{
+			name:   "hub peering map",
+			random: true,
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"hub_peering_map": func(t *testing.T, v hubnetworking.Variables) any {
+					r := make(map[string]hubPeeringOutput)
+					for name, p := range v.PeeringMap() {
+						r[name] = hubPeeringOutput{Peering: p, RemoteVirtualNetworkId: fmt.Sprintf("%s_id", v.HubVirtualNetworks[p.DstKey].Name)}
+					}
+					return r
+				},
+				"peering_conflicts": func(t *testing.T, v hubnetworking.Variables) any {
+					return v.PeeringConflicts()
+				},
+			},
+		},
+		{
+			name:   "spoke maps",
+			random: true,
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"spoke_route_map": func(t *testing.T, v hubnetworking.Variables) any {
+					return v.SpokeRouteMap(fakeFirewallPrivateIps(v.HubVirtualNetworks))
+				},
+				"spokes": func(t *testing.T, v hubnetworking.Variables) any {
+					r := make(map[string]spokeOutput)
+					for k, enabled := range v.SpokeBgpRoutePropagation() {
+						r[k] = spokeOutput{BgpRoutePropagationEnabled: enabled}
+					}
+					return r
+				},
+				"spoke_peering_map": func(t *testing.T, v hubnetworking.Variables) any {
+					hubs := v.HubVirtualNetworks
+					r := make(map[string]spokePeeringOutput)
+					for name, p := range v.SpokePeeringMap() {
+						remote := fmt.Sprintf("%s_id", hubs[p.HubKey].Name)
+						if p.VirtualNetworkName == hubs[p.HubKey].Name {
+							remote = fmt.Sprintf("%s_id", v.SpokeVirtualNetworks[p.SpokeKey].VirtualNetworkName())
+							if id := v.SpokeVirtualNetworks[p.SpokeKey].VirtualNetworkId; id != nil {
+								remote = *id
+							}
+						}
+						// the peering name is the map key, the output doesn't repeat it
+						p.Name = ""
+						r[name] = spokePeeringOutput{SpokePeering: p, RemoteVirtualNetworkId: remote}
+					}
+					return r
+				},
+			},
+		},
+		{
+			name:   "virtual network gateways",
+			random: true,
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"virtual_network_gateway_public_ips": func(t *testing.T, v hubnetworking.Variables) any {
+					return v.HubVirtualNetworks.VirtualNetworkGatewayPublicIps()
+				},
+				"virtual_network_gateways": func(t *testing.T, v hubnetworking.Variables) any {
+					subnetIds := make(map[string]string)
+					pipIds := make(map[string]string)
+					for k, pip := range v.HubVirtualNetworks.VirtualNetworkGatewayPublicIps() {
+						subnetIds[pip.HubKey] = fmt.Sprintf("%s_gateway_subnet_id", pip.HubKey)
+						pipIds[k] = fmt.Sprintf("%s_id", pip.Name)
+					}
+					return v.HubVirtualNetworks.VirtualNetworkGateways(subnetIds, pipIds)
+				},
+			},
+		},
+		{
+			name:   "firewall policy mesh rules",
+			random: true,
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"firewall_policy_mesh_rules": func(t *testing.T, v hubnetworking.Variables) any {
+					require.Empty(t, hubnetworking.ValidateFirewallPolicies(v))
+					require.Empty(t, v.FirewallPolicyConflicts())
+					return v.FirewallPolicyMeshRules()
+				},
+			},
+		},
+		{
+			name: "firewall policy conflicts",
+			variables: hubnetworking.Variables{
+				HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+					"hub0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).
+						withResourceGroupName("rg0").
+						withAddressSpace("10.0.0.0/16").
+						withFirewall(firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.0.1.0/24"})),
+					"hub1": hubnetworking.HubVirtualNetwork(aVnet("vnet1", false).
+						withResourceGroupName("rg1").
+						withAddressSpace("10.1.0.0/16").
+						withFirewall(firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.1.1.0/24", FirewallPolicyId: String("policy1_id")})),
+					"hub2": hubnetworking.HubVirtualNetwork(aVnet("vnet2", false).
+						withResourceGroupName("rg2").
+						withAddressSpace("10.2.0.0/16")),
+				},
+				FirewallPolicies: map[string]hubnetworking.FirewallPolicy{
+					"base": {Identity: identity},
+					"hub0": {
+						Sku: String("Premium"),
+						RuleCollectionGroups: map[string]hubnetworking.RuleCollectionGroup{
+							"hub-mesh": {Priority: 200},
+						},
+					},
+					"hub1": {},
+					"hub2": {},
+				},
+			},
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"firewall_policy_conflicts": func(t *testing.T, v hubnetworking.Variables) any {
+					conflicts := v.FirewallPolicyConflicts()
+					require.Len(t, conflicts, 6)
+					return conflicts
+				},
+			},
+		},
+		{
+			name: "virtual wan conflicts of a hub firewall without virtual wan",
+			variables: hubnetworking.Variables{
+				HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+					"hub0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).withAddressSpace("10.0.0.0/16").withFirewall(firewall{SkuName: "AZFW_Hub", SkuTier: "Standard"})),
+				},
+			},
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"virtual_wan_conflicts": virtualWanConflicts,
+			},
+		},
+		{
+			name: "virtual wan conflicts of virtual network settings with virtual wan",
+			variables: hubnetworking.Variables{
+				HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+					"hub0": hubnetworking.HubVirtualNetwork(aVnet("vhub0", false).
+						withAddressSpace("10.0.0.0/16").
+						withSubnet("s", aSubnet("10.0.0.0/24")).
+						withFirewall(firewall{SkuName: "AZFW_VNet", SkuTier: "Standard", SubnetAddressPrefix: "10.0.1.0/24"}).
+						withVirtualNetworkGateway(gateway{Type: "Vpn", Sku: "VpnGw1AZ", SubnetAddressPrefix: "10.0.255.0/27"})),
+					"hub1": hubnetworking.HubVirtualNetwork(aVnet("vhub1", false).withResourceGroupName("rg1").withAddressSpace("10.1.0.0/23")),
+				},
+				SpokeVirtualNetworks: hubnetworking.SpokeVirtualNetworks{
+					"spoke0": hubnetworking.SpokeVirtualNetwork(aSpoke("spoke0", "hub1", "10.10.0.0/24").withRemoteGateways(true)),
+				},
+				VirtualWan: &hubnetworking.VirtualWan{Name: "vwan", Location: "eastus", ResourceGroupName: "rg"},
+			},
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"virtual_wan_conflicts": virtualWanConflicts,
+			},
+		},
+		{
+			name: "default route conflicts",
+			variables: hubnetworking.Variables{
+				HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+					"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).
+						withAddressSpace("10.0.0.0/16").
+						withUserRouteEntry(routeEntry{Name: "no_internet", AddressPrefix: "0.0.0.0/0", NextHopType: "None"})),
+					"vnet1": hubnetworking.HubVirtualNetwork(aVnet("vnet1", false).
+						withAddressSpace("10.1.0.0/16").
+						withDefaultRoute(defaultRoute{NextHopType: String("VirtualNetworkGateway")}).
+						withUserRouteEntry(routeEntry{Name: "nva", AddressPrefix: "0.0.0.0/0", NextHopType: "VirtualAppliance", NextHopIpAddress: String("10.1.0.5")}).
+						withUserRouteEntry(routeEntry{Name: "intranet", AddressPrefix: "10.0.0.0/8", NextHopType: "VnetLocal"})),
+					"vnet2": hubnetworking.HubVirtualNetwork(aVnet("vnet2", false).
+						withAddressSpace("10.2.0.0/16").
+						withDefaultRoute(defaultRoute{NextHopType: String("None")}).
+						withUserRouteEntry(routeEntry{Name: "no_internet", AddressPrefix: "0.0.0.0/0", NextHopType: "None"})),
+				},
+			},
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"default_route_conflicts": func(t *testing.T, v hubnetworking.Variables) any {
+					conflicts := v.DefaultRouteConflicts()
+					assert.Equal(t, []hubnetworking.DefaultRouteConflict{
+						{HubKeys: []string{"vnet0"}, Message: "route no_internet of hub vnet0 claims 0.0.0.0/0, which its default_route already routes to Internet; set the next_hop_type of the default_route to None to route it with route_table_entries"},
+						{HubKeys: []string{"vnet1"}, Message: "route nva of hub vnet1 claims 0.0.0.0/0, which its default_route already routes to VirtualNetworkGateway; set the next_hop_type of the default_route to None to route it with route_table_entries"},
+					}, conflicts)
+					return conflicts
+				},
+			},
+		},
+		{
+			name:   "firewall route tables",
+			random: true,
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"firewall_route_tables": func(t *testing.T, v hubnetworking.Variables) any {
+					return v.FirewallRouteTables(fakeFirewallPrivateIps(v.HubVirtualNetworks))
+				},
+			},
+		},
+		{
+			name: "ddos protection plan conflicts of an unknown hub and a hub with its own plan",
+			variables: hubnetworking.Variables{
+				HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+					"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).withAddressSpace("10.0.0.0/16").withDdosProtectionPlanId("existing_plan_id")),
+				},
+				DdosProtectionPlan: &hubnetworking.DdosProtectionPlan{Name: "ddos", Location: "eastus", ResourceGroupName: "rg-ddos", HubKeys: []string{"vnet0", "vnet1"}},
+			},
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"ddos_protection_plan_conflicts": ddosProtectionPlanConflicts,
+			},
+		},
+		{
+			name: "ddos protection plan conflicts of a virtual hub",
+			variables: hubnetworking.Variables{
+				HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+					"hub0": hubnetworking.HubVirtualNetwork(aVnet("vhub0", false).withResourceGroupName("rg0").withAddressSpace("10.0.0.0/23")),
+				},
+				VirtualWan:         &hubnetworking.VirtualWan{Name: "vwan", Location: "eastus", ResourceGroupName: "rg"},
+				DdosProtectionPlan: &hubnetworking.DdosProtectionPlan{Name: "ddos", Location: "eastus", ResourceGroupName: "rg-ddos", HubKeys: []string{"hub0"}},
+			},
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"ddos_protection_plan_conflicts": ddosProtectionPlanConflicts,
+			},
+		},
+		{
+			name: "diagnostic setting conflicts",
+			variables: hubnetworking.Variables{
+				HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+					"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).withAddressSpace("10.0.0.0/16").withDiagnosticSettings(hubnetworking.DiagnosticSettings{Name: String("diag-vnet0")})),
+					"vnet1": hubnetworking.HubVirtualNetwork(aVnet("vnet1", false).withAddressSpace("10.1.0.0/16").withDiagnosticSettings(hubnetworking.DiagnosticSettings{EventhubAuthorizationRuleId: String("rule_id")})),
+				},
+			},
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"diagnostic_setting_conflicts": func(t *testing.T, v hubnetworking.Variables) any {
+					conflicts := v.DiagnosticSettingConflicts()
+					require.Len(t, conflicts, 1)
+					return conflicts
+				},
+			},
+		},
+		{
+			name: "network security group conflicts",
+			variables: hubnetworking.Variables{
+				HubVirtualNetworks: hubnetworking.HubVirtualNetworks{
+					"vnet0": hubnetworking.HubVirtualNetwork(aVnet("vnet0", false).
+						withAddressSpace("10.0.0.0/16").
+						withSubnet("workload", nsgSubnet).
+						withSubnet(hubnetworking.BastionSubnetName, nsgBastionSubnet).
+						withBastion(bastion{})),
+				},
+			},
+			expected: map[string]func(t *testing.T, v hubnetworking.Variables) any{
+				"network_security_group_conflicts": func(t *testing.T, v hubnetworking.Variables) any {
+					conflicts := v.NetworkSecurityGroupConflicts()
+					require.Len(t, conflicts, 2)
+					return conflicts
+				},
+			},
+		},
+	}
+
+	seed := time.Now().UnixNano()
+	t.Logf("seed: %d", seed)
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < len(inputs); i++ {
+		input := inputs[i]
+		t.Run(input.name, func(t *testing.T) {
+			if !input.random {
+				assertOutputsConformToGoImplementation(t, input.variables, input.expected)
+				return
+			}
+			for n := 0; n < 5; n++ {
+				v := randomVariables(r)
+				t.Run(strconv.Itoa(n), func(t *testing.T) {
+					assertOutputsConformToGoImplementation(t, v, input.expected)
+				})
+			}
+		})
+	}
+}
+
+// assertOutputsConformToGoImplementation runs the unit-fixture with v and compares each output of expected with the value
+// its Go implementation computes from v, decoding the output into the type of that value.
+func assertOutputsConformToGoImplementation(t *testing.T, v hubnetworking.Variables, expected map[string]func(t *testing.T, v hubnetworking.Variables) any) {
+	varFilePath := variables(t, v).toFile(t)
+	defer func() { _ = os.Remove(varFilePath) }()
+	test_helper.RunUnitTest(t, "../../", "unit-fixture", terraform.Options{
+		Upgrade:  true,
+		VarFiles: []string{varFilePath},
+		Logger:   logger.Discard,
+	}, func(t *testing.T, output test_helper.TerraformOutput) {
+		for name, compute := range expected {
+			e := compute(t, v)
+			actual := reflect.New(reflect.TypeOf(e))
+			decodeJson(t, output[name], actual.Interface())
+			assert.Equal(t, e, actual.Elem().Interface(), name)
+		}
+	})
+}
+
+// randomVariables generates hubs with a mesh topology, spokes and firewall policies the module accepts.
+func randomVariables(r *rand.Rand) hubnetworking.Variables {
+	hubs := hubnetworking.RandomHubVirtualNetworks(r, 2+r.Intn(4))
+	return hubnetworking.Variables{
+		HubVirtualNetworks:   hubs,
+		HubMeshTopology:      hubnetworking.RandomMeshTopology(r, hubs),
+		SpokeVirtualNetworks: hubnetworking.RandomSpokeVirtualNetworks(r, hubs),
+		FirewallPolicies:     hubnetworking.RandomFirewallPolicies(r, hubs),
+	}
+}
+
+func virtualWanConflicts(t *testing.T, v hubnetworking.Variables) any {
+	conflicts := v.VirtualWanConflicts()
+	require.NotEmpty(t, conflicts)
+	return conflicts
+}
+
+func ddosProtectionPlanConflicts(t *testing.T, v hubnetworking.Variables) any {
+	conflicts := v.DdosProtectionPlanConflicts()
+	require.NotEmpty(t, conflicts)
+	return conflicts
+}
+
+func decodeJson(t *testing.T, output any, v any) {
+	c, err := json.Marshal(output)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(c, v))
+}
+
+// fakeFirewallPrivateIps mirrors `local.firewall_private_ip` in unit-fixture/fake_module.tf.
+func fakeFirewallPrivateIps(hubs hubnetworking.HubVirtualNetworks) map[string]string {
+	ips := make(map[string]string)
+	for k, hub := range hubs {
+		if hub.Firewall != nil {
+			ips[k] = fmt.Sprintf("%s-fake-fw-private-ip", k)
+		}
+	}
+	return ips
+}
+
+// variables turns typed variables into vars, leaving out the unset ones so Terraform applies their defaults.
+func variables(t *testing.T, v hubnetworking.Variables) vars {
+	c, err := json.Marshal(v)
+	require.Nil(t, err)
+	var r vars
+	require.Nil(t, json.Unmarshal(c, &r))
+	return r
+}
+
+func varFile(t *testing.T, inputs map[string]interface{}, path string) string {
+	cleanPath := filepath.Clean(path)
+	varFile, err := os.Create(cleanPath)
+	require.Nil(t, err)
+	c, err := json.Marshal(inputs)
+	require.Nil(t, err)
+	_, err = varFile.Write(c)
+	require.Nil(t, err)
+	_ = varFile.Close()
+	varFilePath, err := filepath.Abs(cleanPath)
+	require.Nil(t, err)
+	return varFilePath
+}
+
+func String(s string) *string {
+	return &s
+}
+
+func Bool(b bool) *bool {
+	return &b
+}
+
+func Int(i int) *int {
+	return &i
 }
 
 func sortRouteEntryOutputs(routes []routeEntryOutput) []routeEntryOutput {
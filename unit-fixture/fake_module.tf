@@ -1,14 +1,49 @@
 locals {
+  ddos_protection_plan_id = try("${var.ddos_protection_plan.name}_id", null)
+  firewall_policy_ids = {
+    for k, policy in local.firewall_policies : k => "${policy.name}_id"
+  }
+  fw_public_ip_addresses = merge(
+    { for k, pip in local.fw_default_ip_configuration_pip : "fw_default_ip_configuration_pip/${k}" => "${pip.name}_ip_address" },
+    { for k, pip in local.fw_ip_configuration_pip : "fw_ip_configuration_pip/${k}" => "${pip.name}_ip_address" },
+  )
+  fw_public_ip_prefix_ids = {
+    for k, prefix in local.fw_public_ip_prefix : k => "${prefix.name}_id"
+  }
+  gateway_subnet_ids = {
+    for k, vnet in var.hub_virtual_networks : k => "${k}_gateway_subnet_id"
+    if vnet.virtual_network_gateway != null
+  }
   hub_routing = {
     for vnet in var.hub_virtual_networks :
     vnet.name => {
       id = "${vnet.name}_route_table_id"
     }
   }
+  network_security_group_ids = {
+    for k, nsg in local.network_security_groups : k => "${nsg.name}_id"
+  }
+  spoke_routing = {
+    for k, spoke in var.spoke_virtual_networks :
+    k => {
+      id = "${k}_spoke_route_table_id"
+    }
+  }
+  spoke_virtual_networks_modules = {
+    for k, spoke in var.spoke_virtual_networks :
+    k => {
+      vnet_name            = spoke.name
+      vnet_id              = "${spoke.name}_id"
+      vnet_subnets_name_id = { for subnet_name, subnet in spoke.subnets : subnet_name => "${subnet_name}_id" }
+    } if spoke.virtual_network_id == null
+  }
   firewall_private_ip = {
     for vnet_name, vnet in var.hub_virtual_networks : vnet_name => "${vnet_name}-fake-fw-private-ip"
     if vnet.firewall != null
   }
+  virtual_network_gateway_public_ip_ids = {
+    for k, pip in local.virtual_network_gateway_public_ips : k => "${pip.name}_id"
+  }
   virtual_networks_modules = {
     for k, vnet in var.hub_virtual_networks :
     k => {
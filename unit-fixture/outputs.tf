@@ -22,6 +22,18 @@ output "fw_default_ip_configuration_pip" {
   value = local.fw_default_ip_configuration_pip
 }
 
+output "fw_ip_configuration_pip" {
+  value = local.fw_ip_configuration_pip
+}
+
+output "fw_public_ip_prefix" {
+  value = local.fw_public_ip_prefix
+}
+
+output "firewall_route_tables" {
+  value = local.firewall_route_tables
+}
+
 output "firewalls" {
   value = local.firewalls
 }
@@ -32,4 +44,164 @@ output "fw_management_ip_configuration_pip" {
 
 output "firewall_management_subnets" {
   value = local.firewall_management_subnets
-}  
\ No newline at end of file
+}
+
+output "default_route_conflicts" {
+  value = local.default_route_conflicts
+}
+
+output "cidr_conflicts" {
+  value = local.cidr_conflicts
+}
+
+output "hub_mesh_topology_unknown_keys" {
+  value = local.hub_mesh_topology_unknown_keys
+}
+
+output "peering_conflicts" {
+  value = local.peering_conflicts
+}
+
+output "spoke_peering_map" {
+  value = local.spoke_peering_map
+}
+
+output "spoke_route_map" {
+  value = local.spoke_route_map
+}
+
+output "spoke_subnet_route_table_association_map" {
+  value = local.spoke_subnet_route_table_association_map
+}
+
+output "virtual_network_gateway_public_ips" {
+  value = local.virtual_network_gateway_public_ips
+}
+
+output "virtual_network_gateways" {
+  value = local.virtual_network_gateways
+}
+
+output "bastion_pip" {
+  value = local.bastion_pip
+}
+
+output "bastions" {
+  value = local.bastions
+}
+
+output "firewall_policies" {
+  value = local.firewall_policies
+}
+
+output "firewall_public_ips" {
+  value = local.firewall_public_ips
+}
+
+output "firewall_policy_conflicts" {
+  value = local.firewall_policy_conflicts
+}
+
+output "firewall_policy_mesh_rules" {
+  value = local.firewall_policy_mesh_rules
+}
+
+output "firewall_policy_rule_collection_groups" {
+  value = local.firewall_policy_rule_collection_groups
+}
+
+output "virtual_hubs" {
+  value = local.virtual_hubs
+}
+
+output "virtual_hub_firewalls" {
+  value = local.virtual_hub_firewalls
+}
+
+output "virtual_hub_routing_intents" {
+  value = local.virtual_hub_routing_intents
+}
+
+output "virtual_hub_connections" {
+  value = local.virtual_hub_connections
+}
+
+output "virtual_wan_conflicts" {
+  value = local.virtual_wan_conflicts
+}
+
+output "route_server_pip" {
+  value = local.route_server_pip
+}
+
+output "route_servers" {
+  value = local.route_servers
+}
+
+output "route_server_bgp_connections" {
+  value = local.route_server_bgp_connections
+}
+
+output "spokes" {
+  value = local.spokes
+}
+
+output "dns_forwarding_rules" {
+  value = local.dns_forwarding_rules
+}
+
+output "dns_resolvers" {
+  value = local.dns_resolvers
+}
+
+output "hub_dns_servers" {
+  value = local.hub_dns_servers
+}
+
+output "private_dns_zones" {
+  value = local.private_dns_zones
+}
+
+output "private_dns_zone_virtual_network_links" {
+  value = local.private_dns_zone_virtual_network_links
+}
+
+output "ddos_protection_plan_conflicts" {
+  value = local.ddos_protection_plan_conflicts
+}
+
+output "ddos_protection_plan_hub_keys" {
+  value = local.ddos_protection_plan_hub_keys
+}
+
+output "hub_ddos_protection_plans" {
+  value = local.hub_ddos_protection_plans
+}
+
+output "diagnostic_setting_conflicts" {
+  value = local.diagnostic_setting_conflicts
+}
+
+output "diagnostic_settings" {
+  value = local.diagnostic_settings
+}
+
+output "hub_diagnostic_settings" {
+  value = local.hub_diagnostic_settings
+}
+
+output "flow_logs" {
+  value = local.flow_logs
+}
+
+output "network_security_group_conflicts" {
+  value = local.network_security_group_conflicts
+}
+
+output "network_security_groups" {
+  value = local.network_security_groups
+}
+
+output "subnets_map" {
+  value = local.subnets_map
+}
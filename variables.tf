@@ -7,16 +7,30 @@ variable "hub_virtual_networks" {
     route_table_name                = optional(string)
     route_table_tags                = optional(map(string))
     bgp_community                   = optional(string)
+    bgp_route_propagation_enabled   = optional(bool)
     ddos_protection_plan_id         = optional(string)
     dns_servers                     = optional(list(string))
     flow_timeout_in_minutes         = optional(number, 4)
     mesh_peering_enabled            = optional(bool, true)
+    mesh_peering_settings = optional(object({
+      allow_virtual_network_access = optional(bool)
+      allow_forwarded_traffic      = optional(bool)
+      allow_gateway_transit        = optional(bool)
+      use_remote_gateways          = optional(bool)
+    }), {})
+    mesh_peering_overrides = optional(map(object({
+      allow_virtual_network_access = optional(bool)
+      allow_forwarded_traffic      = optional(bool)
+      allow_gateway_transit        = optional(bool)
+      use_remote_gateways          = optional(bool)
+    })), {})
     resource_group_creation_enabled = optional(bool, true)
     resource_group_lock_enabled     = optional(bool, true)
     resource_group_lock_name        = optional(string)
     resource_group_tags             = optional(map(string))
     routing_address_space           = optional(list(string), [])
     hub_router_ip_address           = optional(string)
+    hub_router_ipv6_address         = optional(string)
     tags                            = optional(map(string), {})
 
     route_table_entries = optional(set(object({
@@ -27,6 +41,10 @@ variable "hub_virtual_networks" {
       has_bgp_override    = optional(bool, false)
       next_hop_ip_address = optional(string)
     })), [])
+    default_route = optional(object({
+      next_hop_type       = optional(string)
+      next_hop_ip_address = optional(string)
+    }), {})
 
     subnets = optional(map(object(
       {
@@ -37,6 +55,22 @@ variable "hub_virtual_networks" {
         network_security_group = optional(object({
           id = string
         }))
+        generated_network_security_group = optional(object({
+          name                   = optional(string)
+          baseline_rules_enabled = optional(bool, true)
+          rules = optional(map(object({
+            priority                     = number
+            direction                    = string
+            access                       = string
+            protocol                     = string
+            source_address_prefixes      = optional(list(string), ["*"])
+            source_port_ranges           = optional(list(string), ["*"])
+            destination_address_prefixes = optional(list(string), ["*"])
+            destination_port_ranges      = optional(list(string), ["*"])
+            description                  = optional(string)
+          })), {})
+          tags = optional(map(string))
+        }))
         private_endpoint_network_policies_enabled     = optional(bool, true)
         private_link_service_network_policies_enabled = optional(bool, true)
         assign_generated_route_table                  = optional(bool, true)
@@ -60,26 +94,41 @@ variable "hub_virtual_networks" {
     firewall = optional(object({
       sku_name                         = string
       sku_tier                         = string
-      subnet_address_prefix            = string
+      subnet_address_prefix            = optional(string)
       dns_servers                      = optional(list(string))
       firewall_policy_id               = optional(string)
       management_subnet_address_prefix = optional(string, null)
       name                             = optional(string)
       private_ip_ranges                = optional(list(string))
+      route_table_name                 = optional(string)
       subnet_route_table_id            = optional(string)
       tags                             = optional(map(string))
       threat_intel_mode                = optional(string, "Alert")
+      virtual_hub_public_ip_count      = optional(number, 1)
       zones                            = optional(list(string))
+
+      route_table_bgp_route_propagation_enabled = optional(bool, true)
       default_ip_configuration = optional(object({
         name = optional(string)
         tags = optional(map(string))
         public_ip_config = optional(object({
-          ip_version = optional(string)
-          name       = optional(string)
-          sku_tier   = optional(string, "Regional")
-          zones      = optional(set(string))
+          ip_version          = optional(string)
+          name                = optional(string)
+          public_ip_prefix_id = optional(string)
+          sku_tier            = optional(string, "Regional")
+          zones               = optional(set(string))
         }))
       }))
+      ip_configurations = optional(map(object({
+        tags = optional(map(string))
+        public_ip_config = optional(object({
+          ip_version          = optional(string)
+          name                = optional(string)
+          public_ip_prefix_id = optional(string)
+          sku_tier            = optional(string, "Regional")
+          zones               = optional(set(string))
+        }))
+      })), {})
       management_ip_configuration = optional(object({
         name = optional(string)
         tags = optional(map(string))
@@ -90,7 +139,109 @@ variable "hub_virtual_networks" {
           zones      = optional(set(string))
         }))
       }))
+      public_ip_prefix = optional(object({
+        ip_version    = optional(string, "IPv4")
+        name          = optional(string)
+        prefix_length = optional(number, 30)
+        tags          = optional(map(string))
+        zones         = optional(set(string))
+      }))
     }))
+
+    virtual_network_gateway = optional(object({
+      type                  = string
+      sku                   = string
+      subnet_address_prefix = string
+      name                  = optional(string)
+      vpn_type              = optional(string, "RouteBased")
+      generation            = optional(string)
+      active_active         = optional(bool, false)
+      enable_bgp            = optional(bool, false)
+      bgp_settings = optional(object({
+        asn         = optional(number)
+        peer_weight = optional(number)
+      }))
+      public_ip_zones = optional(set(string))
+      tags            = optional(map(string))
+    }))
+
+    bastion = optional(object({
+      subnet_address_prefix  = optional(string)
+      name                   = optional(string)
+      sku                    = optional(string, "Basic")
+      scale_units            = optional(number, 2)
+      copy_paste_enabled     = optional(bool, true)
+      file_copy_enabled      = optional(bool, false)
+      ip_connect_enabled     = optional(bool, false)
+      shareable_link_enabled = optional(bool, false)
+      tunneling_enabled      = optional(bool, false)
+      public_ip_name         = optional(string)
+      zones                  = optional(set(string))
+      tags                   = optional(map(string))
+    }))
+
+    route_server = optional(object({
+      subnet_address_prefix            = string
+      name                             = optional(string)
+      branch_to_branch_traffic_enabled = optional(bool, false)
+      public_ip_name                   = optional(string)
+      public_ip_zones                  = optional(set(string))
+      bgp_connections = optional(map(object({
+        peer_asn = number
+        peer_ip  = string
+      })), {})
+      tags = optional(map(string))
+    }))
+
+    dns_resolver = optional(object({
+      inbound_subnet_address_prefix  = string
+      name                           = optional(string)
+      inbound_endpoint_ip_address    = optional(string)
+      outbound_subnet_address_prefix = optional(string)
+      forwarding_ruleset_name        = optional(string)
+      forwarding_rules = optional(map(object({
+        domain_name = string
+        target_dns_servers = list(object({
+          ip_address = string
+          port       = optional(number, 53)
+        }))
+        enabled = optional(bool, true)
+      })), {})
+      tags = optional(map(string))
+    }))
+
+    diagnostic_settings = optional(object({
+      enabled                        = optional(bool, true)
+      name                           = optional(string)
+      log_analytics_workspace_id     = optional(string)
+      log_analytics_destination_type = optional(string)
+      storage_account_id             = optional(string)
+      eventhub_authorization_rule_id = optional(string)
+      eventhub_name                  = optional(string)
+      log_categories                 = optional(set(string))
+      metrics_enabled                = optional(bool)
+    }))
+
+    flow_log = optional(object({
+      storage_account_id = string
+      name               = optional(string)
+      enabled            = optional(bool, true)
+      retention_days     = optional(number, 0)
+      traffic_analytics = optional(object({
+        workspace_id          = string
+        workspace_resource_id = string
+        workspace_region      = optional(string)
+        interval_in_minutes   = optional(number, 60)
+      }))
+      tags = optional(map(string))
+    }))
+
+    virtual_hub = optional(object({
+      sku                              = optional(string, "Standard")
+      hub_routing_preference           = optional(string, "ExpressRoute")
+      internet_traffic_routing_enabled = optional(bool, true)
+      private_traffic_routing_enabled  = optional(bool, true)
+    }), {})
   }))
   default     = {}
   description = <<DESCRIPTION
@@ -99,26 +250,51 @@ A map of the hub virtual networks to create. The map key is an arbitrary value t
 ### Mandatory fields
 
 - `name` - The name of the Virtual Network.
-- `address_space` - A list of IPv4 address spaces that are used by this virtual network in CIDR format, e.g. `["192.168.0.0/24"]`.
+- `address_space` - A list of IPv4 and IPv6 address spaces that are used by this virtual network in CIDR format, e.g. `["192.168.0.0/24", "fd00:db8::/48"]`. Must not overlap with the address space of any other hub.
 - `location` - The Azure location where the virtual network should be created.
 - `resource_group_name` - The name of the resource group in which the virtual network should be created.
 
 ### Optional fields
 
 - `bgp_community` - The BGP community associated with the virtual network.
-- `ddos_protection_plan_id` - The ID of the DDoS protection plan associated with the virtual network.
-- `dns_servers` - A list of DNS servers IP addresses for the virtual network.
+- `bgp_route_propagation_enabled` - (Optional) Should the route table of the workload subnets of this hub network learn the routes of the virtual network gateway and the Route Server over BGP? Default `true`, `false` when a `route_table_entries` entry has `has_bgp_override`. Also the default of the spokes of the hub. When `false` the Route Server no longer replaces the static mesh routes, see `route_server`.
+- `ddos_protection_plan_id` - (Optional) The ID of an existing DDoS protection plan associated with the virtual network. Default the plan of `var.ddos_protection_plan` when it selects the hub.
+- `dns_servers` - A list of DNS servers IP addresses for the virtual network. Default the inbound endpoint of the `dns_resolver` of the hub, if any, Azure provided DNS otherwise.
 - `flow_timeout_in_minutes` - The flow timeout in minutes for the virtual network. Default `4`.
 - `mesh_peering_enabled` - Should the virtual network be peered to other hub networks with this flag enabled? Default `true`.
+- `mesh_peering_settings` - (Optional) The settings of the peerings from this hub to the other hubs. Unset fields use the defaults below:
+  - `allow_virtual_network_access` - Default `true`.
+  - `allow_forwarded_traffic` - Default `true`.
+  - `allow_gateway_transit` - Default `true`, `false` when the peering sets `use_remote_gateways`, which Azure does not allow together.
+  - `use_remote_gateways` - Default `false`. Can only be set when the remote hub has a gateway that allows gateway transit and this hub has no gateway of its own, and never on both peerings of a pair.
+- `mesh_peering_overrides` - (Optional) A map of settings for the peering from this hub to the hub with the map key, taking precedence over `mesh_peering_settings`. The value has the same fields as `mesh_peering_settings`.
 - `resource_group_creation_enabled` - Should the resource group for this virtual network be created by this module? Default `true`.
 - `resource_group_lock_enabled` - Should the resource group for this virtual network be locked? Default `true`.
 - `resource_group_lock_name` - The name of the resource group lock.
 - `resource_group_tags` - A map of tags to apply to the resource group.
-- `routing_address_space` - A list of IPv4 address spaces in CIDR format that are used for routing to this hub, e.g. `["192.168.0.0","172.16.0.0/12"]`.
+- `routing_address_space` - A list of IPv4 and IPv6 address spaces in CIDR format that are used for routing to this hub, e.g. `["192.168.0.0","172.16.0.0/12","fd00:db8::/40"]`. When specified, it must contain the hub's `address_space`. The routes towards an IPv6 prefix need an IPv6 next hop, so the other hubs only route it through `hub_router_ipv6_address`. Route names replace the `:` and `/` of the prefix with `-`.
 - `hub_router_ip_address` - If not using Azure Firewall, this is the IP address of the hub router. This is used to create route table entries for other hub networks.
+- `hub_router_ipv6_address` - (Optional) The IPv6 address of the hub router, the next hop of the routes towards the IPv6 prefixes of this hub and its spokes. Azure Firewall has no IPv6 private address, so without it the route tables get no route towards those prefixes and IPv6 traffic follows the system routes of the peerings.
 - `tags` - A map of tags to apply to the virtual network.
-- `route_table_name` - The name of the route table to create for this hub network.
-- `route_table_tags` - A map of tags to apply to all route tables.
+- `route_table_name` - The name of the route table to create for the workload subnets of this hub network.
+- `route_table_tags` - A map of tags to apply to all route tables, including the route table of the firewall subnet.
+
+#### Default route
+
+- `default_route` - (Optional) The `0.0.0.0/0` route of the route table for the workload subnets of this hub network. The firewall subnet gets its own route table, see `firewall`. Ignored with `virtual_wan`, see `virtual_hub`. An object with the following fields:
+  - `next_hop_type` - (Optional) Where to send the traffic without a more specific route. Default `Firewall` when the hub has a `firewall`, `Internet` otherwise. **Breaking:** the workload subnets of a hub with a `firewall` used to reach the internet directly, set `Internet` to keep it. Possible values include:
+    - `Internet` - Straight to the internet, the route is named `internet`.
+    - `Firewall` - To the Azure Firewall of the hub, which requires a `firewall`.
+    - `VirtualAppliance` - To the NVA at `next_hop_ip_address`, e.g. to force tunnel through a third party firewall.
+    - `VirtualNetworkGateway` - To the virtual network gateway of the hub, to force tunnel to on-premises.
+    - `None` - The module creates no default route, so it can be learnt over BGP, see `bgp_route_propagation_enabled`, or declared in `route_table_entries`.
+  - `next_hop_ip_address` - (Optional) The IP address of the NVA. Required if `next_hop_type` is `VirtualAppliance`, must not be set otherwise.
+
+With a `hub_router_ipv6_address`, a `Firewall` or `VirtualAppliance` default route also sends `::/0` to that address, in a route named `default-ipv6`, as Azure Firewall has no IPv6 private address. Other IPv6 traffic follows the system routes.
+
+A `route_table_entries` entry for `0.0.0.0/0` conflicts with any `default_route` but `None`, one for `::/0` with a `default-ipv6` route.
+
+A `GatewaySubnet` declared in `subnets` with `assign_generated_route_table` requires an `Internet` or `None` `default_route`.
 
 #### Route table entries
 
@@ -126,20 +302,34 @@ A map of the hub virtual networks to create. The map key is an arbitrary value t
   - `name` - The name of the route table entry.
   - `address_prefix` - The address prefix to match for this route table entry.
   - `next_hop_type` - The type of the next hop. Possible values include `Internet`, `VirtualAppliance`, `VirtualNetworkGateway`, `VnetLocal`, `None`.
-  - `has_bgp_override` - Should the BGP override be enabled for this route table entry? Default `false`.
+  - `has_bgp_override` - Should this route table entry take precedence over the routes learnt over BGP, even the more specific ones? Default `false`. Since a route table only overrides routes of the same prefix, the route table then learns no routes over BGP: `bgp_route_propagation_enabled` defaults to `false` and cannot be set to `true`.
   - `next_hop_ip_address` - The IP address of the next hop. Required if `next_hop_type` is `VirtualAppliance`.
 
 #### Subnets
 
 - `subnets` - (Optional) A map of subnets to create in the virtual network. The value is an object with the following fields:
-  - `address_prefixes` - The IPv4 address prefixes to use for the subnet in CIDR format.
+  - `address_prefixes` - The IPv4 and IPv6 address prefixes to use for the subnet in CIDR format, one of each for a dual-stack subnet. Must be within the virtual network's address space and must not overlap with other subnets, including the Azure Firewall subnets.
   - `nat_gateway` - (Optional) An object with the following fields:
     - `id` - The ID of the NAT Gateway which should be associated with the Subnet. Changing this forces a new resource to be created.
   - `network_security_group` - (Optional) An object with the following fields:
-    - `id` - The ID of the Network Security Group which should be associated with the Subnet. Changing this forces a new association to be created.
+    - `id` - The ID of the Network Security Group which should be associated with the Subnet. Changing this forces a new association to be created. Cannot be used with `generated_network_security_group`.
+  - `generated_network_security_group` - (Optional) A Network Security Group the module creates for the subnet and associates with it. Cannot be used with `network_security_group`, nor on a `GatewaySubnet`, `AzureFirewallSubnet`, `AzureFirewallManagementSubnet` or `RouteServerSubnet`, which Azure does not support a Network Security Group on. An object with the following fields:
+    - `name` - (Optional) The name of the Network Security Group. If not specified will use `nsg-{vnetname}-{subnetname}`.
+    - `baseline_rules_enabled` - (Optional) Should the Network Security Group start from the rules a well-known subnet requires, see `local.network_security_group_baseline_rules`, e.g. those of Azure Bastion for an `AzureBastionSubnet`? Default `true`.
+    - `rules` - (Optional) A map of the security rules of the Network Security Group, keyed by rule name. A rule named like a baseline rule replaces it. Two rules of the same direction must not share a priority. The value is an object with the following fields:
+      - `priority` - The priority of the rule, between `100` and `4096`.
+      - `direction` - The direction of the rule, `Inbound` or `Outbound`.
+      - `access` - Whether the rule allows or denies the traffic, `Allow` or `Deny`.
+      - `protocol` - The protocol of the rule, `Tcp`, `Udp`, `Icmp`, `Esp`, `Ah` or `*`.
+      - `source_address_prefixes` - (Optional) A list of CIDRs, IP addresses or a single service tag, e.g. `["VirtualNetwork"]`. Default `["*"]`.
+      - `source_port_ranges` - (Optional) A list of ports or port ranges. Default `["*"]`.
+      - `destination_address_prefixes` - (Optional) A list of CIDRs, IP addresses or a single service tag. Default `["*"]`.
+      - `destination_port_ranges` - (Optional) A list of ports or port ranges, e.g. `["443", "8080-8081"]`. Default `["*"]`.
+      - `description` - (Optional) The description of the rule.
+    - `tags` - (Optional) A map of tags to apply to the Network Security Group.
   - `private_endpoint_network_policies_enabled` - (Optional) Enable or Disable network policies for the private endpoint on the subnet. Setting this to true will Enable the policy and setting this to false will Disable the policy. Defaults to true.
   - `private_link_service_network_policies_enabled` - (Optional) Enable or Disable network policies for the private link service on the subnet. Setting this to true will Enable the policy and setting this to false will Disable the policy. Defaults to true.
-  - `assign_generated_route_table` - (Optional) Should the Route Table generated by this module be associated with this Subnet? Default `true`. Cannot be used with `external_route_table_id`.
+  - `assign_generated_route_table` - (Optional) Should the Route Table generated by this module be associated with this Subnet? Default `true`. Cannot be used with `external_route_table_id`. Set it to `false` for a `GatewaySubnet` unless the `default_route` is `Internet` or `None`. Ignored on an `AzureBastionSubnet` or a `RouteServerSubnet`, Azure Bastion and Route Server do not support a route table forcing `0.0.0.0/0` through a firewall or an NVA.
   - `external_route_table_id` - (Optional) The ID of the Route Table which should be associated with the Subnet. Changing this forces a new association to be created. Cannot be used with `assign_generated_route_table`.
   - `service_endpoints` - (Optional) The list of Service endpoints to associate with the subnet.
   - `service_endpoint_policy_ids` - (Optional) The list of Service Endpoint Policy IDs to associate with the subnet.
@@ -153,26 +343,33 @@ A map of the hub virtual networks to create. The map key is an arbitrary value t
 #### Azure Firewall
 
 - `firewall` - (Optional) An object with the following fields:
-  - `sku_name` - The name of the SKU to use for the Azure Firewall. Possible values include `AZFW_Hub`, `AZFW_VNet`.
+  - `sku_name` - The name of the SKU to use for the Azure Firewall. Possible values include `AZFW_Hub`, `AZFW_VNet`. Must be `AZFW_Hub` with `virtual_wan`, `AZFW_VNet` otherwise.
   - `sku_tier` - The tier of the SKU to use for the Azure Firewall. Possible values include `Basic`, ``Standard`, `Premium`.
-  - `subnet_address_prefix` - The IPv4 address prefix to use for the Azure Firewall subnet in CIDR format. Needs to be a part of the virtual network's address space.
-  - `dns_servers` - (Optional) A list of DNS server IP addresses for the Azure Firewall.
-  - `firewall_policy_id` - (Optional) The resource id of the Azure Firewall Policy to associate with the Azure Firewall.
+  - `subnet_address_prefix` - (Optional) The IPv4 address prefix to use for the Azure Firewall subnet in CIDR format. Needs to be a part of the virtual network's address space. Required without `virtual_wan`.
+  - `dns_servers` - (Optional) A list of DNS server IP addresses for the Azure Firewall. Default the inbound endpoint of the `dns_resolver` of the hub, if any, for a firewall without policy. A firewall with a policy takes its DNS servers from the policy.
+  - `firewall_policy_id` - (Optional) The resource id of the Azure Firewall Policy to associate with the Azure Firewall. Conflicts with a policy keyed by the hub in `firewall_policies`.
   - `management_subnet_address_prefix` - (Optional) The IPv4 address prefix to use for the Azure Firewall management subnet in CIDR format. Needs to be a part of the virtual network's address space.
   - `name` - (Optional) The name of the firewall resource. If not specified will use `afw-{vnetname}`.
   - `private_ip_ranges` - (Optional) A list of private IP ranges to use for the Azure Firewall, to which the firewall will not NAT traffic. If not specified will use RFC1918.
-  - `subnet_route_table_id` = (Optional) The resource id of the Route Table which should be associated with the Azure Firewall subnet. If not specified the module will assign the generated route table.
+  - `route_table_name` - (Optional) The name of the route table the module creates for the Azure Firewall subnet, which sends `0.0.0.0/0` to the internet and the other hubs to their firewall or router. If not specified will use `route-afw-{vnetname}`.
+  - `subnet_route_table_id` = (Optional) The resource id of the Route Table which should be associated with the Azure Firewall subnet. If not specified the module will create and assign a route table for the firewall subnet.
+  - `route_table_bgp_route_propagation_enabled` - (Optional) Should the route table the module creates for the Azure Firewall subnet learn routes over BGP? Default `true`. Its `0.0.0.0/0` route to the internet takes precedence over a default route learnt over BGP either way.
   - `tags` - (Optional) A map of tags to apply to the Azure Firewall.
-  - `threat_intel_mode` - (Optional) The threat intelligence mode for the Azure Firewall. Possible values include `Alert`, `Deny`, `Off`.
+  - `threat_intel_mode` - (Optional) The threat intelligence mode for the Azure Firewall. Possible values include `Alert`, `Deny`, `Off`. Ignored with `virtual_wan`, a secured hub firewall takes it from its policy.
+  - `virtual_hub_public_ip_count` - (Optional) The number of public IPs of a secured hub firewall with `virtual_wan`. Default `1`.
   - `zones` - (Optional) A list of availability zones to use for the Azure Firewall. If not specified will be `null`.
   - `default_ip_configuration` - (Optional) An object with the following fields. If not specified the defaults below will be used:
-    - `name` - (Optional) The name of the default IP configuration. If not specified will use `default`.
+    - `name` - (Optional) The name of the default IP configuration. If not specified will use `default`. Changing this forces a new firewall to be created.
     - `public_ip_config` - (Optional) An object with the following fields:
       - `name` - (Optional) The name of the public IP configuration. If not specified will use `pip-afw-{vnetname}`.
       - `tags` - (Optional) A map of tags to apply to the public IP configuration.
       - `zones` - (Optional) A list of availability zones to use for the public IP configuration. If not specified will be `null`.
       - `ip_version` - (Optional) The IP version to use for the public IP configuration. Possible values include `IPv4`, `IPv6`. If not specified will be `IPv4`.
+      - `public_ip_prefix_id` - (Optional) The resource id of an existing Public IP Prefix to allocate the public IP from. If not specified the public IP is allocated from the `public_ip_prefix` of the firewall, if any.
       - `sku_tier` - (Optional) The SKU tier to use for the public IP configuration. Possible values include `Regional`, `Global`. If not specified will be `Regional`.
+  - `ip_configurations` - (Optional) A map of additional IP configurations of the firewall, keyed by IP configuration name, each with its own public IP for SNAT port scaling or DNAT on distinct addresses. Not supported with `virtual_wan`, use `virtual_hub_public_ip_count` instead. The value is an object with the following fields:
+    - `tags` - (Optional) A map of tags to apply to the public IP.
+    - `public_ip_config` - (Optional) An object with the same fields as the `public_ip_config` of `default_ip_configuration`. If `name` is not specified will use `pip-afw-{vnetname}-{ipconfigurationname}`.
   - `management_ip_configuration` - (Optional) An object with the following fields. If not specified the defaults below will be used:
     - `name` - (Optional) The name of the management IP configuration. If not specified will use `defaultMgmt`.
     - `public_ip_config` - (Optional) An object with the following fields:
@@ -181,16 +378,249 @@ A map of the hub virtual networks to create. The map key is an arbitrary value t
       - `zones` - (Optional) A list of availability zones to use for the public IP configuration. If not specified will be `null`.
       - `ip_version` - (Optional) The IP version to use for the public IP configuration. Possible values include `IPv4`, `IPv6`. If not specified will be `IPv4`.
       - `sku_tier` - (Optional) The SKU tier to use for the public IP configuration. Possible values include `Regional`, `Global`. If not specified will be `Regional`.
+  - `public_ip_prefix` - (Optional) A Public IP Prefix the module creates for the firewall, so its public IPs are contiguous. Every public IP of `default_ip_configuration` and `ip_configurations` of its `ip_version` without a `public_ip_prefix_id` is allocated from it. An object with the following fields:
+    - `name` - (Optional) The name of the Public IP Prefix. If not specified will use `ippre-afw-{vnetname}`.
+    - `ip_version` - (Optional) The IP version of the Public IP Prefix, `IPv4` or `IPv6`. Only the public IPs of the same IP version are allocated from it. Default `IPv4`.
+    - `prefix_length` - (Optional) The length of the prefix, between `28` and `31` for `IPv4` and between `124` and `127` for `IPv6`. Must hold every public IP allocated from it. Default `30`.
+    - `tags` - (Optional) A map of tags to apply to the Public IP Prefix.
+    - `zones` - (Optional) A list of availability zones to use for the Public IP Prefix. If not specified will be `null`.
+
+#### Virtual network gateway
+
+- `virtual_network_gateway` - (Optional) An object with the following fields. The gateway allows gateway transit on the peerings from the hub by default, see `mesh_peering_settings`:
+  - `type` - The type of the gateway. Possible values include `Vpn`, `ExpressRoute`.
+  - `sku` - The SKU of the gateway, e.g. `VpnGw1AZ` or `ErGw1AZ`.
+  - `subnet_address_prefix` - The IPv4 address prefix to use for the `GatewaySubnet` in CIDR format. Needs to be a part of the virtual network's address space. The `subnets` of the hub must not contain a `GatewaySubnet` then.
+  - `name` - (Optional) The name of the gateway. If not specified will use `vgw-{vnetname}`.
+  - `vpn_type` - (Optional) The routing type of a VPN gateway. Possible values include `RouteBased`, `PolicyBased`. If not specified will be `RouteBased`.
+  - `generation` - (Optional) The generation of a VPN gateway. Possible values include `Generation1`, `Generation2`, `None`.
+  - `active_active` - (Optional) Should the gateway run in active-active mode? A second public IP is created then. Default `false`.
+  - `enable_bgp` - (Optional) Should BGP be enabled on the gateway? Default `false`.
+  - `bgp_settings` - (Optional) An object with the following fields:
+    - `asn` - (Optional) The Autonomous System Number of the gateway.
+    - `peer_weight` - (Optional) The weight added to the routes learned from the BGP peers.
+  - `public_ip_zones` - (Optional) A list of availability zones to use for the public IPs of the gateway. If not specified will be `null`.
+  - `tags` - (Optional) A map of tags to apply to the gateway and its public IPs.
+
+#### Bastion
+
+- `bastion` - (Optional) An object with the following fields:
+  - `subnet_address_prefix` - (Optional) The IPv4 address prefix to use for the `AzureBastionSubnet` in CIDR format. Needs to be a part of the virtual network's address space and at least a `/26`. The `subnets` of the hub must not contain an `AzureBastionSubnet` then. If not specified the Bastion host uses the `AzureBastionSubnet` of `subnets`, e.g. to give it a `generated_network_security_group`, which starts from the rules Azure Bastion requires.
+  - `name` - (Optional) The name of the Bastion host. If not specified will use `bas-{vnetname}`.
+  - `sku` - (Optional) The SKU of the Bastion host. Possible values include `Basic`, `Standard`. If not specified will be `Basic`.
+  - `scale_units` - (Optional) The number of scale units of the Bastion host, between `2` and `50`. Only `Standard` supports more than `2`. Default `2`.
+  - `copy_paste_enabled` - (Optional) Is copy and paste enabled on the Bastion host? Default `true`.
+  - `file_copy_enabled` - (Optional) Is file copy enabled on the Bastion host? Requires `Standard`. Default `false`.
+  - `ip_connect_enabled` - (Optional) Is IP connect enabled on the Bastion host? Requires `Standard`. Default `false`.
+  - `shareable_link_enabled` - (Optional) Is shareable link enabled on the Bastion host? Requires `Standard`. Default `false`.
+  - `tunneling_enabled` - (Optional) Is tunneling (native client support) enabled on the Bastion host? Requires `Standard`. Default `false`.
+  - `public_ip_name` - (Optional) The name of the Standard public IP of the Bastion host. If not specified will use `pip-bas-{vnetname}`.
+  - `zones` - (Optional) A list of availability zones to use for the public IP of the Bastion host. If not specified will be `null`.
+  - `tags` - (Optional) A map of tags to apply to the Bastion host and its public IP.
+
+#### Route Server
+
+- `route_server` - (Optional) An Azure Route Server exchanging routes over BGP with the NVAs of the hub, typically the one at `hub_router_ip_address`. The Route Server allows gateway transit on the peerings from the hub by default, see `mesh_peering_settings`. When it has BGP connections and `bgp_route_propagation_enabled` the route table of the hub gets no static mesh routes towards hubs reached through a router rather than a firewall, the NVAs advertise those prefixes instead. An object with the following fields:
+  - `subnet_address_prefix` - The IPv4 address prefix to use for the `RouteServerSubnet` in CIDR format. Needs to be a part of the virtual network's address space and at least a `/27`. The `subnets` of the hub must not contain a `RouteServerSubnet` then.
+  - `name` - (Optional) The name of the Route Server. If not specified will use `rs-{vnetname}`.
+  - `branch_to_branch_traffic_enabled` - (Optional) Should the Route Server exchange routes between the NVAs and the virtual network gateways of the hub? Default `false`.
+  - `public_ip_name` - (Optional) The name of the Standard public IP of the Route Server. If not specified will use `pip-rs-{vnetname}`.
+  - `public_ip_zones` - (Optional) A list of availability zones to use for the public IP of the Route Server. If not specified will be `null`.
+  - `bgp_connections` - (Optional) A map of the BGP peers of the Route Server, keyed by connection name. The value is an object with the `peer_asn` and the `peer_ip` of the NVA.
+  - `tags` - (Optional) A map of tags to apply to the Route Server and its public IP.
+
+#### DNS Private Resolver
+
+- `dns_resolver` - (Optional) An Azure DNS Private Resolver in the hub, the default DNS server of the hub, of its firewall and of the firewall policy the module creates for it. Its inbound endpoint gets a static address so the DNS servers are known at plan time. An object with the following fields:
+  - `inbound_subnet_address_prefix` - The IPv4 address prefix to use for the `DnsResolverInboundSubnet` in CIDR format, delegated to the resolver. Needs to be a part of the virtual network's address space and at least a `/28`. The `subnets` of the hub must not contain a `DnsResolverInboundSubnet` then.
+  - `name` - (Optional) The name of the DNS Private Resolver. If not specified will use `dnspr-{vnetname}`.
+  - `inbound_endpoint_ip_address` - (Optional) The static IP address of the inbound endpoint, within `inbound_subnet_address_prefix`. If not specified will use the fifth address of the subnet, the first one Azure does not reserve.
+  - `outbound_subnet_address_prefix` - (Optional) The IPv4 address prefix to use for the `DnsResolverOutboundSubnet` in CIDR format, delegated to the resolver. Needs to be a part of the virtual network's address space and at least a `/28`. Required by `forwarding_rules`.
+  - `forwarding_ruleset_name` - (Optional) The name of the DNS forwarding ruleset created with `outbound_subnet_address_prefix` and linked to the hub. If not specified will use `dnsfrs-{vnetname}`.
+  - `forwarding_rules` - (Optional) A map of the rules of the DNS forwarding ruleset, keyed by rule name. The value is an object with the following fields:
+    - `domain_name` - The domain name to forward, ending with a dot, e.g. `contoso.com.`.
+    - `target_dns_servers` - A list of objects with the `ip_address` and optional `port`, default `53`, of the DNS servers to forward the queries to.
+    - `enabled` - (Optional) Is the rule enabled? Default `true`.
+  - `tags` - (Optional) A map of tags to apply to the DNS Private Resolver, its endpoints and its forwarding ruleset.
+
+#### Diagnostic settings
+
+- `diagnostic_settings` - (Optional) The diagnostic settings of the virtual network, the firewall and the firewall public IPs of the hub, overriding `var.diagnostic_settings` attribute by attribute. An object with the following fields:
+  - `enabled` - (Optional) Should the hub have diagnostic settings? Default `true`, `false` opts the hub out of `var.diagnostic_settings`.
+  - `name`, `log_analytics_workspace_id`, `log_analytics_destination_type`, `storage_account_id`, `eventhub_authorization_rule_id`, `eventhub_name`, `log_categories`, `metrics_enabled` - (Optional) See `var.diagnostic_settings`. Default the value of `var.diagnostic_settings`.
+
+#### Flow log
+
+- `flow_log` - (Optional) A Network Watcher flow log of the virtual network, created in the Network Watcher of the region of the hub, see `var.network_watchers`. An object with the following fields:
+  - `storage_account_id` - The ID of the storage account to store the flow logs in, in the region of the hub.
+  - `name` - (Optional) The name of the flow log. If not specified will use `fl-{vnetname}`.
+  - `enabled` - (Optional) Is the flow log enabled? Default `true`.
+  - `retention_days` - (Optional) The number of days to keep the flow logs, `0` to keep them forever. Default `0`.
+  - `traffic_analytics` - (Optional) Traffic Analytics of the flow logs. An object with the following fields:
+    - `workspace_id` - The workspace ID, a GUID, of the Log Analytics workspace.
+    - `workspace_resource_id` - The resource ID of the Log Analytics workspace.
+    - `workspace_region` - (Optional) The location of the Log Analytics workspace. Default the location of the hub.
+    - `interval_in_minutes` - (Optional) How often Traffic Analytics processes the flow logs, `10` or `60` minutes. Default `60`.
+  - `tags` - (Optional) A map of tags to apply to the flow log.
+
+#### Virtual hub
+
+- `virtual_hub` - (Optional) The settings of the virtual hub created for the hub with `virtual_wan`, using the hub's `name`, `location`, `resource_group_name` and `tags`, and its single `address_space` as address prefix. `subnets`, `route_table_entries`, `virtual_network_gateway`, `bastion`, `route_server`, `dns_resolver`, `diagnostic_settings` and `flow_log` are not supported then. An object with the following fields:
+  - `sku` - (Optional) The SKU of the virtual hub. Possible values include `Basic`, `Standard`. Default `Standard`.
+  - `hub_routing_preference` - (Optional) The routing preference of the virtual hub. Possible values include `ExpressRoute`, `VpnGateway`, `ASPath`. Default `ExpressRoute`.
+  - `internet_traffic_routing_enabled` - (Optional) Should the routing intent of the hub send internet traffic through its firewall? Default `true`.
+  - `private_traffic_routing_enabled` - (Optional) Should the routing intent of the hub send private traffic, including the traffic between hubs, through its firewall? Default `true`.
 DESCRIPTION
   nullable    = false
 
   validation {
-    condition     = alltrue([for k, v in var.hub_virtual_networks : v.firewall.sku_tier == "Basic" ? length(regexall("^\\d{1,3}\\.\\d{1,3}\\.\\d{1,3}\\.\\d{1,3}/\\d{1,2}$", coalesce(v.firewall.management_subnet_address_prefix, "NonIp"))) > 0 : true if v.firewall != null])
-    error_message = "A valid management_subnet_address_prefix must be specified when using Basic SKU for Azure Firewall."
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.firewall.sku_tier == "Basic" && v.firewall.sku_name == "AZFW_VNet" ? length(regexall("^\\d{1,3}\\.\\d{1,3}\\.\\d{1,3}\\.\\d{1,3}/\\d{1,2}$", coalesce(v.firewall.management_subnet_address_prefix, "NonIp"))) > 0 : true if v.firewall != null])
+    error_message = "A valid management_subnet_address_prefix must be specified when using Basic SKU for an AZFW_VNet Azure Firewall."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : contains(["AZFW_VNet", "AZFW_Hub"], v.firewall.sku_name) if v.firewall != null])
+    error_message = "Azure Firewall SKU must be AZFW_VNet or AZFW_Hub."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.firewall.virtual_hub_public_ip_count >= 1 if v.firewall != null])
+    error_message = "The virtual_hub_public_ip_count of a firewall must be at least 1."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.default_route.next_hop_type == null || contains(["Internet", "Firewall", "VirtualAppliance", "VirtualNetworkGateway", "None"], coalesce(v.default_route.next_hop_type, "Internet"))])
+    error_message = "The next_hop_type of a default_route must be `Internet`, `Firewall`, `VirtualAppliance`, `VirtualNetworkGateway` or `None`."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.default_route.next_hop_type == "VirtualAppliance" ? can(cidrhost("${v.default_route.next_hop_ip_address}/32", 0)) : v.default_route.next_hop_ip_address == null])
+    error_message = "The next_hop_ip_address of a default_route must be a valid IPv4 address with the `VirtualAppliance` next_hop_type, and unset otherwise."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.firewall != null if v.default_route.next_hop_type == "Firewall"])
+    error_message = "A default_route with the `Firewall` next_hop_type requires a firewall in the hub."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : contains(["Internet", "None"], coalesce(v.default_route.next_hop_type, v.firewall != null ? "Firewall" : "Internet")) if try(v.subnets["GatewaySubnet"].assign_generated_route_table, false)])
+    error_message = "A GatewaySubnet with assign_generated_route_table must not get a default_route other than `Internet` or `None`, the gateway would send 0.0.0.0/0 away from itself. Set assign_generated_route_table of the GatewaySubnet to false, or the next_hop_type of the default_route to `Internet` or `None`."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.bgp_route_propagation_enabled != true || !anytrue([for e in v.route_table_entries : e.has_bgp_override])])
+    error_message = "A hub with a route_table_entries entry that has has_bgp_override cannot set bgp_route_propagation_enabled to true."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : !contains(keys(v.firewall.ip_configurations), try(coalesce(v.firewall.default_ip_configuration.name, "default"), "default")) if v.firewall != null])
+    error_message = "The ip_configurations of a firewall must not use the name of its default_ip_configuration."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : contains(["IPv4", "IPv6"], v.firewall.public_ip_prefix.ip_version) if try(v.firewall.public_ip_prefix, null) != null])
+    error_message = "The ip_version of a firewall public_ip_prefix must be `IPv4` or `IPv6`."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.firewall.public_ip_prefix.ip_version == "IPv6" ? v.firewall.public_ip_prefix.prefix_length >= 124 && v.firewall.public_ip_prefix.prefix_length <= 127 : v.firewall.public_ip_prefix.prefix_length >= 28 && v.firewall.public_ip_prefix.prefix_length <= 31 if try(v.firewall.public_ip_prefix, null) != null])
+    error_message = "The prefix_length of a firewall public_ip_prefix must be between 28 and 31 for IPv4, between 124 and 127 for IPv6."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : pow(2, (v.firewall.public_ip_prefix.ip_version == "IPv6" ? 128 : 32) - v.firewall.public_ip_prefix.prefix_length) >= length([for c in concat([v.firewall.default_ip_configuration], values(v.firewall.ip_configurations)) : c if try(c.public_ip_config.public_ip_prefix_id, null) == null && try(coalesce(c.public_ip_config.ip_version, "IPv4"), "IPv4") == v.firewall.public_ip_prefix.ip_version]) if try(v.firewall.public_ip_prefix, null) != null])
+    error_message = "The public_ip_prefix of a firewall must be large enough for every public IP allocated from it."
+  }
+  validation {
+    condition     = alltrue(flatten([for k, v in var.hub_virtual_networks : [for c in concat([v.firewall.default_ip_configuration, v.firewall.management_ip_configuration], values(v.firewall.ip_configurations)) : contains(["IPv4", "IPv6"], try(coalesce(c.public_ip_config.ip_version, "IPv4"), "IPv4"))] if v.firewall != null]))
+    error_message = "The ip_version of a firewall public_ip_config must be `IPv4` or `IPv6`."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.hub_router_ipv6_address == null || can(regex(":", v.hub_router_ipv6_address)) && can(cidrhost("${v.hub_router_ipv6_address}/128", 0))])
+    error_message = "The hub_router_ipv6_address of a hub must be a valid IPv6 address."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : contains(["Vpn", "ExpressRoute"], v.virtual_network_gateway.type) if v.virtual_network_gateway != null])
+    error_message = "The virtual network gateway type must be `Vpn` or `ExpressRoute`."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : !contains(keys(v.subnets), "GatewaySubnet") if v.virtual_network_gateway != null])
+    error_message = "A hub with a virtual_network_gateway must not declare a GatewaySubnet in subnets, the module creates it from subnet_address_prefix."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : contains(["Basic", "Standard"], v.bastion.sku) if v.bastion != null])
+    error_message = "The Bastion SKU must be `Basic` or `Standard`."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.bastion.sku == "Standard" || (v.bastion.scale_units == 2 && !v.bastion.file_copy_enabled && !v.bastion.ip_connect_enabled && !v.bastion.shareable_link_enabled && !v.bastion.tunneling_enabled) if v.bastion != null])
+    error_message = "Bastion scale_units other than 2, file_copy_enabled, ip_connect_enabled, shareable_link_enabled and tunneling_enabled require the `Standard` SKU."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.bastion.scale_units >= 2 && v.bastion.scale_units <= 50 if v.bastion != null])
+    error_message = "Bastion scale_units must be between 2 and 50."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : can(cidrhost(v.bastion.subnet_address_prefix, 0)) && try(tonumber(split("/", v.bastion.subnet_address_prefix)[1]) <= 26, false) if try(v.bastion.subnet_address_prefix, null) != null])
+    error_message = "The Bastion subnet_address_prefix must be a valid CIDR of at least /26."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : (v.bastion.subnet_address_prefix == null) == contains(keys(v.subnets), "AzureBastionSubnet") if v.bastion != null])
+    error_message = "A hub with a bastion must either declare an AzureBastionSubnet in subnets or set the subnet_address_prefix of the bastion, the module then creates the subnet."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : can(cidrhost(v.route_server.subnet_address_prefix, 0)) && try(tonumber(split("/", v.route_server.subnet_address_prefix)[1]) <= 27, false) if v.route_server != null])
+    error_message = "The Route Server subnet_address_prefix must be a valid CIDR of at least /27."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : !contains(keys(v.subnets), "RouteServerSubnet") if v.route_server != null])
+    error_message = "A hub with a route_server must not declare a RouteServerSubnet in subnets, the module creates it from subnet_address_prefix."
+  }
+  validation {
+    condition     = alltrue(flatten([for k, v in var.hub_virtual_networks : [for c in values(v.route_server.bgp_connections) : c.peer_asn >= 1 && c.peer_asn <= 4294967295 && (c.peer_asn < 65515 || c.peer_asn > 65520) && can(cidrhost("${c.peer_ip}/32", 0))] if v.route_server != null]))
+    error_message = "The bgp_connections of a route_server must have a peer_asn between 1 and 4294967295 other than the reserved 65515 to 65520, and a valid IPv4 peer_ip."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : alltrue([for cidr in compact([v.dns_resolver.inbound_subnet_address_prefix, v.dns_resolver.outbound_subnet_address_prefix]) : can(cidrhost(cidr, 0)) && !can(regex(":", cidr)) && try(tonumber(split("/", cidr)[1]) <= 28, false)]) if v.dns_resolver != null])
+    error_message = "The inbound_subnet_address_prefix and outbound_subnet_address_prefix of a dns_resolver must be valid IPv4 CIDRs of at least /28."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.dns_resolver.inbound_endpoint_ip_address == null || try(cidrhost("${v.dns_resolver.inbound_endpoint_ip_address}/${split("/", v.dns_resolver.inbound_subnet_address_prefix)[1]}", 0) == cidrhost(v.dns_resolver.inbound_subnet_address_prefix, 0), false) if v.dns_resolver != null])
+    error_message = "The inbound_endpoint_ip_address of a dns_resolver must be an IPv4 address within its inbound_subnet_address_prefix."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : !contains(keys(v.subnets), "DnsResolverInboundSubnet") && !contains(keys(v.subnets), "DnsResolverOutboundSubnet") if v.dns_resolver != null])
+    error_message = "A hub with a dns_resolver must not declare a DnsResolverInboundSubnet or DnsResolverOutboundSubnet in subnets, the module creates them from the subnet address prefixes of the resolver."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : length(v.dns_resolver.forwarding_rules) == 0 || v.dns_resolver.outbound_subnet_address_prefix != null if v.dns_resolver != null])
+    error_message = "The forwarding_rules of a dns_resolver require an outbound_subnet_address_prefix."
+  }
+  validation {
+    condition     = alltrue(flatten([for k, v in var.hub_virtual_networks : [for r in values(v.dns_resolver.forwarding_rules) : can(regex("[.]$", r.domain_name)) && length(r.target_dns_servers) > 0 && alltrue([for t in r.target_dns_servers : can(cidrhost("${t.ip_address}/32", 0))])] if v.dns_resolver != null]))
+    error_message = "The forwarding_rules of a dns_resolver must have a domain_name ending with a dot and at least one target_dns_servers entry with a valid IPv4 ip_address."
   }
   validation {
-    condition     = alltrue([for k, v in var.hub_virtual_networks : contains(["AZFW_VNet"], v.firewall.sku_name) if v.firewall != null])
-    error_message = "Azure Firewall SKU must be AZFW_VNet."
+    condition     = alltrue([for k, v in var.hub_virtual_networks : try(contains(["Dedicated", "AzureDiagnostics"], v.diagnostic_settings.log_analytics_destination_type), true)])
+    error_message = "The log_analytics_destination_type of the diagnostic_settings of a hub must be `Dedicated` or `AzureDiagnostics`."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : v.flow_log.retention_days >= 0 && v.flow_log.retention_days <= 365 if v.flow_log != null])
+    error_message = "The retention_days of the flow_log of a hub must be between 0 and 365."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : contains([10, 60], v.flow_log.traffic_analytics.interval_in_minutes) if try(v.flow_log.traffic_analytics, null) != null])
+    error_message = "The interval_in_minutes of the traffic_analytics of the flow_log of a hub must be 10 or 60."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : alltrue([for name, subnet in v.subnets : subnet.network_security_group == null || subnet.generated_network_security_group == null])])
+    error_message = "A subnet cannot have both a network_security_group and a generated_network_security_group."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : alltrue([for name, subnet in v.subnets : subnet.generated_network_security_group == null if contains(["GatewaySubnet", "AzureFirewallSubnet", "AzureFirewallManagementSubnet", "RouteServerSubnet"], name)])])
+    error_message = "The GatewaySubnet, AzureFirewallSubnet, AzureFirewallManagementSubnet and RouteServerSubnet cannot have a generated_network_security_group, Azure does not support a Network Security Group on them."
+  }
+  validation {
+    condition = alltrue(flatten([
+      for k, v in var.hub_virtual_networks : [
+        for r in flatten([for subnet in values(v.subnets) : values(subnet.generated_network_security_group.rules) if subnet.generated_network_security_group != null]) :
+        r.priority >= 100 && r.priority <= 4096 && contains(["Inbound", "Outbound"], r.direction) && contains(["Allow", "Deny"], r.access) && contains(["Tcp", "Udp", "Icmp", "Esp", "Ah", "*"], r.protocol)
+      ]
+    ]))
+    error_message = "The rules of a generated_network_security_group must have a priority between 100 and 4096, an Inbound or Outbound direction, an Allow or Deny access and a Tcp, Udp, Icmp, Esp, Ah or * protocol."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.hub_virtual_networks : contains(["Basic", "Standard"], v.virtual_hub.sku) && contains(["ExpressRoute", "VpnGateway", "ASPath"], v.virtual_hub.hub_routing_preference)])
+    error_message = "The virtual_hub sku must be `Basic` or `Standard` and its hub_routing_preference `ExpressRoute`, `VpnGateway` or `ASPath`."
   }
   validation {
     condition     = alltrue(flatten([for v_src in var.hub_virtual_networks : [for v_dst in var.hub_virtual_networks : coalesce(v_dst.hub_router_ip_address, "") != "" if v_dst.firewall == null && v_dst.routing_address_space != null && v_src != v_dst]]))
@@ -198,6 +628,366 @@ DESCRIPTION
   }
 }
 
+variable "hub_mesh_topology" {
+  type = object({
+    type            = optional(string, "full_mesh")
+    transit_hub_key = optional(string)
+    groups          = optional(map(set(string)), {})
+    allowed_pairs   = optional(list(set(string)), [])
+    denied_pairs    = optional(list(set(string)), [])
+  })
+  default     = {}
+  description = <<DESCRIPTION
+The topology of the peerings between the hubs with `mesh_peering_enabled`. Mesh routes are only generated towards the hubs a hub can reach through this topology.
+With `virtual_wan` the hubs are connected by the Virtual WAN instead, and the topology only shapes the generated mesh rules of the firewall policies.
+
+- `type` - (Optional) The topology to use. Default `full_mesh`. Possible values are:
+  - `full_mesh` - Every hub is peered with every other hub.
+  - `hub_and_spoke` - Every hub is peered with the transit hub only. Traffic between the other hubs is routed through the firewall, or the `hub_router_ip_address`, of the transit hub.
+  - `groups` - Hubs are peered with the hubs they share a group with.
+- `transit_hub_key` - (Optional) The key in `hub_virtual_networks` of the transit hub. Required when `type` is `hub_and_spoke`.
+- `groups` - (Optional) A map of named peering groups, the value being the set of the keys of the hubs in the group. Used when `type` is `groups`.
+- `allowed_pairs` - (Optional) A list of pairs of hub keys to peer in addition to the topology.
+- `denied_pairs` - (Optional) A list of pairs of hub keys never to peer, this takes precedence over the topology and `allowed_pairs`.
+DESCRIPTION
+  nullable    = false
+
+  validation {
+    condition     = contains(["full_mesh", "hub_and_spoke", "groups"], var.hub_mesh_topology.type)
+    error_message = "The hub mesh topology type must be one of `full_mesh`, `hub_and_spoke` or `groups`."
+  }
+  validation {
+    condition     = var.hub_mesh_topology.type != "hub_and_spoke" || var.hub_mesh_topology.transit_hub_key != null
+    error_message = "A transit_hub_key must be specified when using the `hub_and_spoke` hub mesh topology."
+  }
+  validation {
+    condition     = alltrue([for p in concat(var.hub_mesh_topology.allowed_pairs, var.hub_mesh_topology.denied_pairs) : length(p) == 2])
+    error_message = "Every allowed or denied pair must contain two distinct hub keys."
+  }
+}
+
+variable "spoke_virtual_networks" {
+  type = map(object({
+    hub_key             = string
+    address_space       = list(string)
+    virtual_network_id  = optional(string)
+    name                = optional(string)
+    location            = optional(string)
+    resource_group_name = optional(string)
+    subnets = optional(map(object({
+      address_prefixes             = optional(list(string), [])
+      assign_generated_route_table = optional(bool, true)
+    })), {})
+    route_table_name        = optional(string)
+    routed_address_prefixes = optional(list(string), [])
+    mesh_routing_enabled    = optional(bool, true)
+    use_remote_gateways     = optional(bool, false)
+    tags                    = optional(map(string), {})
+
+    bgp_route_propagation_enabled  = optional(bool)
+    private_dns_zone_links_enabled = optional(bool, false)
+  }))
+  default     = {}
+  description = <<DESCRIPTION
+A map of the spoke virtual networks to attach to the hubs. The map key is an arbitrary value, route names use it so it should not be a key of `hub_virtual_networks`.
+Each spoke is peered with its hub in both directions and gets a route table sending `0.0.0.0/0`, the prefixes of the hubs and spokes its hub reaches and `routed_address_prefixes` to the firewall, or the `hub_router_ip_address`, of its hub. `::/0` and the IPv6 prefixes are only routed to the `hub_router_ipv6_address` of the hub, if any.
+With `virtual_wan` each spoke is connected to the virtual hub of its hub instead, the routing intent of the hub replacing the route table, so `subnets` only matter to create the virtual network and `use_remote_gateways` is not supported.
+
+- `hub_key` - The key in `hub_virtual_networks` of the hub to attach the spoke to.
+- `address_space` - A list of IPv4 and IPv6 address spaces of the spoke virtual network in CIDR format. Also used to route towards the spoke, the IPv6 ones only through the `hub_router_ipv6_address` of a hub.
+- `virtual_network_id` - (Optional) The resource id of an existing spoke virtual network. When not specified the module creates the virtual network.
+- `name` - (Optional) The name of the virtual network to create. Required when `virtual_network_id` is not specified.
+- `location` - (Optional) The Azure location of the virtual network to create. Default the location of the hub.
+- `resource_group_name` - (Optional) The name of the existing resource group of the virtual network to create. Default the resource group of the hub.
+- `subnets` - (Optional) A map of subnets of the spoke, keyed by subnet name. The subnets are created along with the virtual network, for an existing spoke they must already exist. The value is an object with the following fields:
+  - `address_prefixes` - (Optional) The IPv4 and IPv6 address prefixes of the subnet in CIDR format. Required when the module creates the virtual network.
+  - `assign_generated_route_table` - (Optional) Should the Route Table generated for the spoke be associated with this Subnet? Default `true`.
+- `route_table_name` - (Optional) The name of the route table to create for the spoke. Default `route-spoke-{key}`.
+- `routed_address_prefixes` - (Optional) A list of additional address prefixes to route to the hub, e.g. on-premises prefixes.
+- `mesh_routing_enabled` - (Optional) Should the other hubs, and the spokes of the hubs reaching this spoke's hub, route `address_space` through the hub? Default `true`.
+- `use_remote_gateways` - (Optional) Should the spoke use the virtual network gateway of its hub? Default `false`.
+- `tags` - (Optional) A map of tags to apply to the virtual network and the route table.
+- `bgp_route_propagation_enabled` - (Optional) Should the route table of the spoke learn routes over BGP from the gateway of its hub? Default the `bgp_route_propagation_enabled` of the hub.
+- `private_dns_zone_links_enabled` - (Optional) Should the `private_dns_zones` be linked to the spoke, in addition to the hubs? Default `false`, e.g. for a spoke using the `dns_resolver` of its hub.
+DESCRIPTION
+  nullable    = false
+
+  validation {
+    condition     = alltrue([for k, v in var.spoke_virtual_networks : v.virtual_network_id != null || v.name != null])
+    error_message = "A name must be specified for every spoke virtual network without virtual_network_id."
+  }
+  validation {
+    condition     = alltrue(flatten([for k, v in var.spoke_virtual_networks : [for s in values(v.subnets) : length(s.address_prefixes) > 0] if v.virtual_network_id == null]))
+    error_message = "Every subnet of a spoke virtual network created by the module must have address_prefixes."
+  }
+}
+
+variable "firewall_policies" {
+  type = map(object({
+    name                     = optional(string)
+    location                 = optional(string)
+    resource_group_name      = optional(string)
+    base_policy_key          = optional(string)
+    sku                      = optional(string)
+    threat_intelligence_mode = optional(string)
+    dns = optional(object({
+      proxy_enabled = optional(bool, false)
+      servers       = optional(list(string))
+    }))
+    threat_intelligence_allowlist = optional(object({
+      fqdns        = optional(set(string))
+      ip_addresses = optional(set(string))
+    }))
+    intrusion_detection = optional(object({
+      mode           = optional(string, "Alert")
+      private_ranges = optional(list(string))
+      signature_overrides = optional(list(object({
+        id    = string
+        state = string
+      })), [])
+      traffic_bypass = optional(list(object({
+        name                  = string
+        protocol              = string
+        description           = optional(string)
+        source_addresses      = optional(set(string))
+        destination_addresses = optional(set(string))
+        destination_ports     = optional(set(string))
+      })), [])
+    }))
+    tls_certificate = optional(object({
+      name                = string
+      key_vault_secret_id = string
+    }))
+    identity = optional(object({
+      identity_ids = set(string)
+    }))
+    mesh_rules_enabled     = optional(bool, true)
+    mesh_rules_priority    = optional(number, 100)
+    rule_collection_groups = optional(map(object({
+      priority = number
+      network_rule_collections = optional(list(object({
+        name     = string
+        priority = number
+        action   = string
+        rules = list(object({
+          name                  = string
+          protocols             = list(string)
+          destination_ports     = list(string)
+          source_addresses      = optional(list(string))
+          source_ip_groups      = optional(list(string))
+          destination_addresses = optional(list(string))
+          destination_ip_groups = optional(list(string))
+          destination_fqdns     = optional(list(string))
+        }))
+      })), [])
+      application_rule_collections = optional(list(object({
+        name     = string
+        priority = number
+        action   = string
+        rules = list(object({
+          name = string
+          protocols = optional(list(object({
+            type = string
+            port = number
+          })))
+          source_addresses      = optional(list(string))
+          source_ip_groups      = optional(list(string))
+          destination_addresses = optional(list(string))
+          destination_fqdns     = optional(list(string))
+          destination_fqdn_tags = optional(list(string))
+          destination_urls      = optional(list(string))
+          terminate_tls         = optional(bool)
+          web_categories        = optional(list(string))
+        }))
+      })), [])
+      nat_rule_collections = optional(list(object({
+        name     = string
+        priority = number
+        action   = optional(string, "Dnat")
+        rules = list(object({
+          name                = string
+          protocols           = list(string)
+          source_addresses    = optional(list(string))
+          source_ip_groups    = optional(list(string))
+          destination_address = string
+          destination_ports   = list(string)
+          translated_address  = optional(string)
+          translated_fqdn     = optional(string)
+          translated_port     = number
+        }))
+      })), [])
+    })), {})
+    tags                   = optional(map(string))
+  }))
+  default     = {}
+  description = <<DESCRIPTION
+A map of Azure Firewall Policies to create. A policy keyed by the key of a hub in `hub_virtual_networks` is the policy of the firewall of that hub and takes its defaults from the hub, any other policy stands alone, typically as the parent of the hub policies so rules common to all hubs only need to be declared once.
+
+- `name` - (Optional) The name of the policy. If not specified will use `afwp-{key}`.
+- `location` - (Optional) The Azure location of the policy. Default the location of the hub, required for a policy not keyed by a hub.
+- `resource_group_name` - (Optional) The name of the existing resource group of the policy. Default the resource group of the hub, required for a policy not keyed by a hub.
+- `base_policy_key` - (Optional) The key of the parent policy to inherit from, which must not have a parent itself.
+- `sku` - (Optional) The SKU of the policy, which must match the `sku_tier` of the firewall of the hub. Possible values include `Basic`, `Standard`, `Premium`. Default the `sku_tier` of the firewall of the hub, `Standard` for a policy not keyed by a hub.
+- `threat_intelligence_mode` - (Optional) The threat intelligence mode of the policy. Possible values include `Alert`, `Deny`, `Off`. Default the `threat_intel_mode` of the firewall of the hub, `Alert` for a policy not keyed by a hub.
+- `dns` - (Optional) An object with the following fields:
+  - `proxy_enabled` - (Optional) Should the firewall act as a DNS proxy? Default `false`.
+  - `servers` - (Optional) A list of custom DNS servers. Default the inbound endpoint of the `dns_resolver` of the hub, if any, which also enables the `dns` settings of the policy.
+- `threat_intelligence_allowlist` - (Optional) An object with the optional `fqdns` and `ip_addresses` threat intelligence should not alert on.
+- `intrusion_detection` - (Optional) The IDPS settings of the policy, requires the `Premium` SKU. An object with the following fields:
+  - `mode` - (Optional) The IDPS mode. Possible values include `Off`, `Alert`, `Deny`. Default `Alert`.
+  - `private_ranges` - (Optional) A list of IP address ranges IDPS considers private.
+  - `signature_overrides` - (Optional) A list of objects with the `id` of an IDPS signature and its `state`, one of `Off`, `Alert`, `Deny`.
+  - `traffic_bypass` - (Optional) A list of traffic IDPS should not inspect, with a `name`, a `protocol` (`Any`, `TCP`, `ICMP` or `UDP`) and optional `description`, `source_addresses`, `destination_addresses` and `destination_ports`.
+- `tls_certificate` - (Optional) The intermediate CA certificate used for TLS inspection, requires the `Premium` SKU and an `identity` allowed to read it. An object with the `name` of the certificate and the `key_vault_secret_id` of the Key Vault secret holding it.
+- `identity` - (Optional) The user assigned identities of the policy, requires the `Premium` SKU. An object with the set of `identity_ids`.
+- `mesh_rules_enabled` - (Optional) Should the module generate a `hub-mesh` rule collection group allowing the traffic between the prefixes of the hubs, and their spokes, that is routed through the firewall of the hub? Ignored for a policy not keyed by a hub. Default `true`.
+- `mesh_rules_priority` - (Optional) The priority of the generated `hub-mesh` rule collection group. Default `100`.
+- `rule_collection_groups` - (Optional) A map of rule collection groups to create in the policy, keyed by group name. The value is an object with the following fields:
+  - `priority` - The priority of the rule collection group, between `100` and `65000`.
+  - `network_rule_collections` - (Optional) A list of network rule collections with `name`, `priority`, `action` (`Allow` or `Deny`) and `rules`. Each rule has a `name`, `protocols`, `destination_ports` and optional `source_addresses`, `source_ip_groups`, `destination_addresses`, `destination_ip_groups` and `destination_fqdns`.
+  - `application_rule_collections` - (Optional) A list of application rule collections with `name`, `priority`, `action` and `rules`. Each rule has a `name` and optional `protocols` (`type` and `port`), `source_addresses`, `source_ip_groups`, `destination_addresses`, `destination_fqdns`, `destination_fqdn_tags`, `destination_urls`, `terminate_tls` and `web_categories`.
+  - `nat_rule_collections` - (Optional) A list of DNAT rule collections with `name`, `priority`, `action` (default `Dnat`) and `rules`. Each rule has a `name`, `protocols`, `destination_address`, `destination_ports`, `translated_port` and optional `source_addresses`, `source_ip_groups`, `translated_address` and `translated_fqdn`.
+- `tags` - (Optional) A map of tags to apply to the policy.
+DESCRIPTION
+  nullable    = false
+
+  validation {
+    condition     = alltrue([for k, v in var.firewall_policies : v.base_policy_key == null || try(var.firewall_policies[v.base_policy_key].base_policy_key == null, false)])
+    error_message = "The base_policy_key of a firewall policy must be the key of another policy in firewall_policies without base_policy_key."
+  }
+  validation {
+    condition     = alltrue([for k, v in var.firewall_policies : v.tls_certificate == null || v.identity != null])
+    error_message = "The tls_certificate of a firewall policy requires an identity to read it from Key Vault."
+  }
+  validation {
+    condition     = alltrue(flatten([for k, v in var.firewall_policies : [for state in concat([v.intrusion_detection.mode], [for o in v.intrusion_detection.signature_overrides : o.state]) : contains(["Off", "Alert", "Deny"], state)] if v.intrusion_detection != null]))
+    error_message = "The intrusion_detection mode and signature override states of a firewall policy must be `Off`, `Alert` or `Deny`."
+  }
+}
+
+variable "virtual_wan" {
+  type = object({
+    name                           = string
+    location                       = string
+    resource_group_name            = string
+    type                           = optional(string, "Standard")
+    allow_branch_to_branch_traffic = optional(bool, true)
+    disable_vpn_encryption         = optional(bool, false)
+    tags                           = optional(map(string))
+  })
+  default     = null
+  description = <<DESCRIPTION
+(Optional) A Virtual WAN to deploy the hubs in. When specified every hub is created as a virtual hub of the Virtual WAN instead of a virtual network, its firewall as a secured hub firewall, which requires the `AZFW_Hub` SKU, and routing intent replaces the generated route tables.
+Spokes are connected to their hub with hub connections instead of peerings and the hubs reach each other through the Virtual WAN.
+
+- `name` - The name of the Virtual WAN.
+- `location` - The Azure location of the Virtual WAN.
+- `resource_group_name` - The name of the resource group of the Virtual WAN, either existing or created for a hub.
+- `type` - (Optional) The type of the Virtual WAN. Possible values include `Basic`, `Standard`. Default `Standard`.
+- `allow_branch_to_branch_traffic` - (Optional) Should branch to branch traffic be allowed? Default `true`.
+- `disable_vpn_encryption` - (Optional) Should VPN encryption be disabled? Default `false`.
+- `tags` - (Optional) A map of tags to apply to the Virtual WAN.
+DESCRIPTION
+
+  validation {
+    condition     = try(contains(["Basic", "Standard"], var.virtual_wan.type), true)
+    error_message = "The Virtual WAN type must be `Basic` or `Standard`."
+  }
+}
+
+variable "private_dns_zones" {
+  type = object({
+    resource_group_name          = string
+    zone_names                   = optional(set(string), [])
+    private_link_zones_enabled   = optional(bool, false)
+    private_link_zone_exclusions = optional(set(string), [])
+    tags                         = optional(map(string))
+  })
+  default     = null
+  description = <<DESCRIPTION
+(Optional) The private DNS zones to create, each linked to every hub virtual network and to the spokes with `private_dns_zone_links_enabled`. The hubs resolve them through Azure provided DNS, or through their `dns_resolver` for the clients using its inbound endpoint, e.g. on-premises.
+
+- `resource_group_name` - The name of the resource group of the zones, either existing or created for a hub.
+- `zone_names` - (Optional) A set of the names of the private DNS zones to create, e.g. `["contoso.internal"]`.
+- `private_link_zones_enabled` - (Optional) Should the module also create the `privatelink` zones of the Azure services supporting Private Endpoints? Only the zones that do not depend on the region are part of the set, see `local.private_link_dns_zone_names`. Default `false`.
+- `private_link_zone_exclusions` - (Optional) A set of the `privatelink` zones not to create, e.g. those managed elsewhere.
+- `tags` - (Optional) A map of tags to apply to the zones and their virtual network links.
+DESCRIPTION
+}
+
+variable "ddos_protection_plan" {
+  type = object({
+    name                = string
+    location            = string
+    resource_group_name = string
+    hub_keys            = optional(set(string))
+    tags                = optional(map(string))
+  })
+  default     = null
+  description = <<DESCRIPTION
+(Optional) A DDoS Protection Plan to create and share across the hub virtual networks, so that consumers do not have to create one outside the module. A hub with its own `ddos_protection_plan_id` keeps its plan. The plan is still created with `virtual_wan`, its ID being available to the spokes through the `ddos_protection_plan` output, but virtual hubs cannot be attached to it.
+
+- `name` - The name of the DDoS Protection Plan.
+- `location` - The Azure location of the DDoS Protection Plan.
+- `resource_group_name` - The name of the resource group of the DDoS Protection Plan, either existing or created for a hub.
+- `hub_keys` - (Optional) A set of the keys of the hubs to attach the plan to. Default every hub without `ddos_protection_plan_id`. A listed hub must exist and must not set `ddos_protection_plan_id`.
+- `tags` - (Optional) A map of tags to apply to the DDoS Protection Plan.
+DESCRIPTION
+
+  validation {
+    condition     = try(length(var.ddos_protection_plan.hub_keys) > 0, true)
+    error_message = "The hub_keys of the ddos_protection_plan must not be empty, leave them unset to attach the plan to every hub."
+  }
+}
+
+variable "diagnostic_settings" {
+  type = object({
+    name                           = optional(string, "diag")
+    log_analytics_workspace_id     = optional(string)
+    log_analytics_destination_type = optional(string, "Dedicated")
+    storage_account_id             = optional(string)
+    eventhub_authorization_rule_id = optional(string)
+    eventhub_name                  = optional(string)
+    log_categories                 = optional(set(string))
+    metrics_enabled                = optional(bool, true)
+  })
+  default     = null
+  description = <<DESCRIPTION
+(Optional) The diagnostic settings of the hub virtual networks, their firewalls and the public IPs of the firewalls, which a hub can override or opt out of with its own `diagnostic_settings`. The virtual hubs of `virtual_wan` and their firewalls get none.
+
+- `name` - (Optional) The name of the diagnostic settings, unique per resource. Default `diag`.
+- `log_analytics_workspace_id` - (Optional) The ID of the Log Analytics workspace to send the logs and metrics to.
+- `log_analytics_destination_type` - (Optional) The destination type of the logs of the firewalls in the Log Analytics workspace, `Dedicated` for the resource-specific tables or `AzureDiagnostics`. Default `Dedicated`. The public IPs and the virtual networks have no resource-specific table and always use `AzureDiagnostics`.
+- `storage_account_id` - (Optional) The ID of the storage account to archive the logs and metrics to.
+- `eventhub_authorization_rule_id` - (Optional) The ID of the authorization rule of the Event Hub namespace to stream the logs and metrics to.
+- `eventhub_name` - (Optional) The name of the Event Hub, default the one Azure creates per log category.
+- `log_categories` - (Optional) A set of the log categories to enable, e.g. `["AZFWNetworkRule", "AZFWApplicationRule", "DDoSMitigationReports"]`, each resource enabling those it supports, see `local.diagnostic_log_categories`. Default every log through the `allLogs` category group.
+- `metrics_enabled` - (Optional) Should `AllMetrics` be sent too? Default `true`.
+
+Each hub with diagnostic settings needs at least one of `log_analytics_workspace_id`, `storage_account_id` and `eventhub_authorization_rule_id`.
+DESCRIPTION
+
+  validation {
+    condition     = try(contains(["Dedicated", "AzureDiagnostics"], var.diagnostic_settings.log_analytics_destination_type), true)
+    error_message = "The log_analytics_destination_type of the diagnostic_settings must be `Dedicated` or `AzureDiagnostics`."
+  }
+}
+
+variable "network_watchers" {
+  type = map(object({
+    name                = string
+    resource_group_name = string
+  }))
+  default     = {}
+  description = <<DESCRIPTION
+(Optional) The existing Network Watchers to create the `flow_log` of the hubs in, keyed by Azure location, e.g. `eastus` or `East US`. Azure allows a single Network Watcher per region and subscription, the module never creates one. The hubs of a location without entry use the one Azure creates, `NetworkWatcher_{location}` in the `NetworkWatcherRG` resource group.
+
+- `name` - The name of the Network Watcher.
+- `resource_group_name` - The name of the resource group of the Network Watcher.
+DESCRIPTION
+  nullable    = false
+}
+
 # tflint-ignore: terraform_unused_declarations
 variable "tracing_tags_enabled" {
   type        = bool